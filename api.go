@@ -0,0 +1,185 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ---- REST import API ----
+//
+// A small programmatic surface over the same job machinery the wizard uses, so a
+// kiosk or script can drive imports:
+//
+//	POST   /api/imports       {"mount": "...", "name": "...", "shares": ["key", ...]}
+//	GET    /api/imports       list this session's imports, newest first
+//	GET    /api/imports/{id}  progress / result of one import
+//	DELETE /api/imports/{id}  cancel a running import
+//
+// When "shares" is omitted every configured share is used.
+
+// APIConfig secures the REST import API.
+type APIConfig struct {
+	// Token must be sent with every /api/imports request as
+	// "Authorization: Bearer <token>". The API is only served beyond
+	// loopback when it is set. Supports ${ENV} expansion.
+	Token string `yaml:"token,omitempty"`
+}
+
+// requireAPIToken guards an import API handler: without a token it is only
+// open on a loopback address, and with one every request must carry it.
+func (s *webServer) requireAPIToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.apiToken == "" {
+			if !s.apiLoopback {
+				writeError(w, http.StatusForbidden, "the import API needs api.token in config when served beyond loopback")
+				return
+			}
+			next(w, r)
+			return
+		}
+		bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(strings.TrimSpace(bearer)), []byte(s.apiToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "missing or invalid token")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *webServer) handleImports(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.Lock()
+		jobs := append([]*transferJob(nil), s.jobs...)
+		s.mu.Unlock()
+		out := make([]importStatus, 0, len(jobs))
+		for i := len(jobs) - 1; i >= 0; i-- {
+			out = append(out, jobs[i].status())
+		}
+		writeJSON(w, http.StatusOK, out)
+
+	case http.MethodPost:
+		var body struct {
+			Mount  string   `json:"mount"`
+			Name   string   `json:"name"`
+			Shares []string `json:"shares"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		body.Mount = strings.TrimSpace(body.Mount)
+		body.Name = strings.TrimSpace(body.Name)
+		if body.Mount == "" || body.Name == "" {
+			writeError(w, http.StatusBadRequest, "mount and name are required")
+			return
+		}
+		if err := validateMountPath(body.Mount); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid mount path: %v", err))
+			return
+		}
+		shares := s.resolveShares(body.Shares)
+		if len(shares) == 0 {
+			writeError(w, http.StatusBadRequest, "no matching shares are configured")
+			return
+		}
+
+		job, running := s.launchJob(body.Mount, body.Name, shares, false)
+		if running != nil {
+			writeError(w, http.StatusConflict, fmt.Sprintf("import %s is already reading %s", running.id, body.Mount))
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job.status())
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (s *webServer) handleImport(w http.ResponseWriter, r *http.Request) {
+	job := s.findJob(r.PathValue("id"))
+	if job == nil {
+		writeError(w, http.StatusNotFound, "no such import")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, job.status())
+
+	case http.MethodDelete:
+		if job.isDone() {
+			writeError(w, http.StatusConflict, "import has already finished")
+			return
+		}
+		job.requestCancel()
+		writeJSON(w, http.StatusAccepted, job.status())
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+// resolveShares maps share keys to expanded configs. An empty key list selects
+// every enabled share.
+func (s *webServer) resolveShares(keys []string) []SMBConfig {
+	wanted := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		wanted[k] = true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var shares []SMBConfig
+	for _, c := range s.config.SMBShares {
+		if (len(keys) == 0 && c.enabled()) || wanted[smbShareKey(c)] {
+			shares = append(shares, expandShare(c))
+		}
+	}
+	return shares
+}
+
+// handleShareHealth connects to every configured share in parallel and reports
+// whether it is reachable, for the dashboard's health panel.
+func (s *webServer) handleShareHealth(w http.ResponseWriter, r *http.Request) {
+	type healthDTO struct {
+		Key       string `json:"key"`
+		Display   string `json:"display"`
+		OK        bool   `json:"ok"`
+		Error     string `json:"error,omitempty"`
+		Class     string `json:"class,omitempty"` // errorClassName, e.g. "auth"
+		LatencyMs int64  `json:"latencyMs"`
+	}
+
+	s.mu.Lock()
+	configs := append([]SMBConfig(nil), s.config.SMBShares...)
+	s.mu.Unlock()
+
+	out := make([]healthDTO, len(configs))
+	var wg sync.WaitGroup
+	for i, c := range configs {
+		wg.Add(1)
+		go func(i int, c SMBConfig) {
+			defer wg.Done()
+			start := time.Now()
+			err := validateSMBConnection(expandShare(c), 10*time.Second)
+			out[i] = healthDTO{
+				Key:       smbShareKey(c),
+				Display:   formatShareForDisplay(c),
+				OK:        err == nil,
+				LatencyMs: time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				out[i].Error = err.Error()
+				out[i].Class = errorClassName(err)
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	writeJSON(w, http.StatusOK, out)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// Archive formats a share's archive setting accepts.
+const (
+	archiveZip = "zip"
+	archiveTar = "tar"
+)
+
+func normalizeArchiveFormat(s string) (string, error) {
+	switch v := strings.ToLower(strings.TrimSpace(s)); v {
+	case "", archiveZip, archiveTar:
+		return v, nil
+	}
+	return "", fmt.Errorf("archive must be %q or %q, got %q", archiveZip, archiveTar, s)
+}
+
+// archiveSet holds the archives a run has open on one share, one per date
+// folder. Each is written as <name>.snapvault-part and renamed once closed,
+// so a half-written archive never passes for a complete one.
+type archiveSet struct {
+	format string
+
+	mu   sync.Mutex
+	open map[string]*shareArchive // by the date folder it replaces
+}
+
+// shareArchive is one archive being written. Entries are written one at a
+// time; failed is set once an entry was cut off, after which the archive
+// can only be thrown away.
+type shareArchive struct {
+	mu      sync.Mutex
+	path    string
+	file    *smb2.File
+	zw      *zip.Writer
+	tw      *tar.Writer
+	entries []shareResult
+	failed  error
+}
+
+func newArchiveSet(format string) *archiveSet {
+	if format == "" {
+		return nil
+	}
+	return &archiveSet{format: format, open: map[string]*shareArchive{}}
+}
+
+// archiveFor returns the open archive for dir, starting one the first time.
+// An archive never grows across runs: when dir's archive is already on the
+// share, a numbered one is started next to it.
+func (s *archiveSet) archiveFor(ctx context.Context, conn *SMBConnection, dir string) (*shareArchive, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a := s.open[dir]; a != nil {
+		return a, nil
+	}
+	fs := conn.Share.WithContext(ctx)
+	if err := conn.mkdirAll(ctx, path.Dir(dir)); err != nil {
+		return nil, fmt.Errorf("creating directories: %w", err)
+	}
+	name := dir + "." + s.format
+	for n := 2; ; n++ {
+		_, err := fs.Stat(name)
+		if os.IsNotExist(err) {
+			_, err = fs.Stat(name + partialUploadSuffix)
+		}
+		if os.IsNotExist(err) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("checking %s: %w", name, err)
+		}
+		name = dir + "-" + strconv.Itoa(n) + "." + s.format
+	}
+	f, err := conn.Share.Create(name + partialUploadSuffix)
+	if err != nil {
+		return nil, fmt.Errorf("creating archive: %w", err)
+	}
+	a := &shareArchive{path: name, file: f}
+	// The archive outlives any one file's context; each entry's source
+	// reader stops the copy on cancellation instead.
+	w := conn.limiter.writer(context.Background(), f)
+	if s.format == archiveZip {
+		a.zw = zip.NewWriter(w)
+	} else {
+		a.tw = tar.NewWriter(w)
+	}
+	s.open[dir] = a
+	return a, nil
+}
+
+// transferArchived is transferToSMB for an archive share: the file becomes
+// an entry of its date folder's archive. Photos and video are compressed
+// already, so zip entries are stored as they are.
+func transferArchived(ctx context.Context, sourcePath, fileName, destDir string, conn *SMBConnection) (copyResult, error) {
+	a, err := conn.archives.archiveFor(ctx, conn, destDir)
+	if err != nil {
+		return copyResult{}, err
+	}
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: %w", errSourceRead, err)
+	}
+	edit := shareJPEGEdit(conn, sourcePath)
+	size := info.Size()
+	if a.tw != nil && !edit.none() {
+		// A tar header needs the size before the data.
+		if size, err = editedSize(ctx, sourcePath, edit); err != nil {
+			return copyResult{}, err
+		}
+	}
+
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
+	}
+	defer src.Close()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.failed != nil {
+		return copyResult{}, fmt.Errorf("archive %s is incomplete: %w", path.Base(a.path), a.failed)
+	}
+	var w io.Writer
+	if a.zw != nil {
+		w, err = a.zw.CreateHeader(&zip.FileHeader{Name: fileName, Method: zip.Store, Modified: info.ModTime()})
+	} else {
+		err = a.tw.WriteHeader(&tar.Header{Name: fileName, Size: size, Mode: 0o644, ModTime: info.ModTime(), Format: tar.FormatPAX})
+		w = a.tw
+	}
+	if err != nil {
+		a.failed = err
+		return copyResult{}, fmt.Errorf("writing archive entry: %w", err)
+	}
+	h := newHasher(conn.hashAlg)
+	r := newJPEGEditReader(contextReader{ctx, sourceReader{src}}, edit)
+	written, err := io.Copy(io.MultiWriter(w, h), r)
+	if err == nil && a.tw != nil && written != size {
+		err = fmt.Errorf("%w: wrote %d bytes, expected %d", errSizeMismatch, written, size)
+	}
+	if err != nil {
+		// Neither format can take back part of an entry.
+		a.failed = err
+		return copyResult{}, fmt.Errorf("copying data: %w", err)
+	}
+	if written-r.grown != info.Size() {
+		a.failed = errSizeMismatch
+		return copyResult{}, fmt.Errorf("%w: wrote %d bytes, source is %d bytes", errSizeMismatch, written-r.grown, info.Size())
+	}
+	a.entries = append(a.entries, shareResult{source: sourcePath, share: shareLabel(conn.Config), bytes: info.Size()})
+	return copyResult{DestPath: a.path, Sum: h.Sum(nil), Algorithm: conn.hashAlg}, nil
+}
+
+// editedSize is the size of sourcePath once edit is applied.
+func editedSize(ctx context.Context, sourcePath string, edit jpegEdit) (int64, error) {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return 0, fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
+	}
+	defer f.Close()
+	return io.Copy(io.Discard, newJPEGEditReader(contextReader{ctx, sourceReader{f}}, edit))
+}
+
+// closeArchives finishes conn's open archives and renames them into place.
+// It returns the entries of those that could not be completed, whose copies
+// were counted as delivered and now have to be taken back.
+func closeArchives(conn *SMBConnection) []shareResult {
+	s := conn.archives
+	s.mu.Lock()
+	open := s.open
+	s.open = map[string]*shareArchive{}
+	s.mu.Unlock()
+
+	var lost []shareResult
+	for _, a := range open {
+		a.mu.Lock()
+		err := a.failed
+		if err == nil && a.zw != nil {
+			err = a.zw.Close()
+		} else if err == nil {
+			err = a.tw.Close()
+		}
+		if cerr := a.file.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = renameArchive(conn, a.path)
+		}
+		if err != nil {
+			removePartial(conn.Share, a.path+partialUploadSuffix)
+			slog.Error("Archive could not be completed; its files must be copied again", "share", shareLabel(conn.Config),
+				"archive", a.path, "files", len(a.entries), "error", err)
+			for _, e := range a.entries {
+				e.err = fmt.Errorf("archive %s could not be completed: %w", path.Base(a.path), err)
+				e.retract = true
+				lost = append(lost, e)
+			}
+		} else {
+			slog.Info("Archive complete", "share", shareLabel(conn.Config), "archive", a.path, "files", len(a.entries))
+		}
+		a.mu.Unlock()
+	}
+	return lost
+}
+
+// finishArchives closes the run's archives once the workers are done, taking
+// back the copies in any that could not be completed from both the totals
+// and the hook's report.
+func finishArchives(connections []*SMBConnection, agg *resultAggregator, hook *TransferProgressHook) {
+	for _, conn := range connections {
+		if conn.archives == nil {
+			continue
+		}
+		for _, r := range closeArchives(conn) {
+			agg.results <- r
+			if hook != nil && hook.OnShareRetracted != nil {
+				hook.OnShareRetracted(r.share, r.source, r.bytes, r.err)
+			}
+		}
+	}
+}
+
+func renameArchive(conn *SMBConnection, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), partialCleanupTimeout)
+	defer cancel()
+	if err := conn.Share.WithContext(ctx).Rename(name+partialUploadSuffix, name); err != nil {
+		return fmt.Errorf("renaming archive: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// archiveSourceExts are the archive files -mount accepts in place of a card.
+var archiveSourceExts = []string{".zip", ".tar", ".tar.gz", ".tgz"}
+
+// isArchiveSource reports whether a -mount value is a zip or tar file, such
+// as an old card backup, rather than a folder.
+func isArchiveSource(mount string) bool {
+	lower := strings.ToLower(mount)
+	for _, ext := range archiveSourceExts {
+		if strings.HasSuffix(lower, ext) {
+			info, err := os.Stat(mount)
+			return err == nil && info.Mode().IsRegular()
+		}
+	}
+	return false
+}
+
+// stageArchiveSource extracts the photos and videos in archive into
+// staging, keeping their folders and modification times so dates work as
+// for a card. Entries are read in one pass, so a gzipped tar is never
+// uncompressed as a whole. It returns the number of files extracted.
+func stageArchiveSource(ctx context.Context, archive, staging string) (int, error) {
+	slog.Info("Extracting archive", "source", archive)
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		return stageZip(ctx, archive, staging)
+	}
+	return stageTar(ctx, archive, staging)
+}
+
+// archiveEntryPath is where the archive entry name goes under staging, or ""
+// when it isn't a photo, video or companion file to import: other files,
+// system metadata such as __MACOSX, and names that would escape staging.
+func archiveEntryPath(staging, name string) string {
+	name = strings.TrimPrefix(path.Clean(strings.ReplaceAll(name, `\`, "/")), "/")
+	local := filepath.FromSlash(name)
+	if !filepath.IsLocal(local) || !importableExtension(path.Ext(name)) {
+		return ""
+	}
+	for _, part := range strings.Split(name, "/") {
+		if isSystemMetadata(part) {
+			return ""
+		}
+	}
+	return filepath.Join(staging, local)
+}
+
+func stageZip(ctx context.Context, archive, staging string) (int, error) {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return 0, fmt.Errorf("opening %s: %w", archive, err)
+	}
+	defer zr.Close()
+	count := 0
+	for _, f := range zr.File {
+		if ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+		local := archiveEntryPath(staging, f.Name)
+		if local == "" || f.FileInfo().IsDir() {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return count, fmt.Errorf("reading %s from %s: %w", f.Name, archive, err)
+		}
+		// The zip reader checks each entry's CRC-32 as it reaches the end.
+		err = extractEntry(ctx, r, local, int64(f.UncompressedSize64), f.Modified)
+		r.Close()
+		if err != nil {
+			return count, fmt.Errorf("extracting %s from %s: %w", f.Name, archive, err)
+		}
+		count++
+	}
+	return count, nil
+}
+
+func stageTar(ctx context.Context, archive, staging string) (int, error) {
+	file, err := os.Open(archive)
+	if err != nil {
+		return 0, fmt.Errorf("opening %s: %w", archive, err)
+	}
+	defer file.Close()
+	var r io.Reader = file
+	if lower := strings.ToLower(archive); strings.HasSuffix(lower, ".gz") || strings.HasSuffix(lower, ".tgz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return 0, fmt.Errorf("opening %s: %w", archive, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	tr := tar.NewReader(r)
+	count := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, fmt.Errorf("reading %s: %w", archive, err)
+		}
+		if ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+		local := archiveEntryPath(staging, hdr.Name)
+		if local == "" || hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := extractEntry(ctx, tr, local, hdr.Size, hdr.ModTime); err != nil {
+			return count, fmt.Errorf("extracting %s from %s: %w", hdr.Name, archive, err)
+		}
+		count++
+	}
+}
+
+// extractEntry writes one entry's contents to local, checks its size and
+// gives it the entry's modification time.
+func extractEntry(ctx context.Context, r io.Reader, local string, size int64, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return fmt.Errorf("creating staging folder: %w", err)
+	}
+	// Two entries with the same name, as appending to a tar makes, leave
+	// the last one, as extracting it would.
+	out, err := os.Create(local)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(out, contextReader{ctx, r})
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n != size {
+		err = fmt.Errorf("%w: read %d bytes, entry is %d bytes", errSizeMismatch, n, size)
+	}
+	if err != nil {
+		return err
+	}
+	if modTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(local, modTime, modTime)
+}
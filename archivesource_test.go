@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveEntryPath(t *testing.T) {
+	staging := filepath.Join("tmp", "staging")
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"DCIM/100CANON/IMG_0001.JPG", filepath.Join(staging, "DCIM", "100CANON", "IMG_0001.JPG")},
+		{"IMG_0001.cr3", filepath.Join(staging, "IMG_0001.cr3")},
+		{`DCIM\100CANON\IMG_0001.JPG`, filepath.Join(staging, "DCIM", "100CANON", "IMG_0001.JPG")},
+		{"/DCIM/IMG_0001.JPG", filepath.Join(staging, "DCIM", "IMG_0001.JPG")},
+		{"DCIM/./100CANON/../IMG_0001.JPG", filepath.Join(staging, "DCIM", "IMG_0001.JPG")},
+		{"Audio/MEMO0001.WAV", filepath.Join(staging, "Audio", "MEMO0001.WAV")},
+		{"../IMG_0001.JPG", ""},
+		{"DCIM/../../IMG_0001.JPG", ""},
+		{`..\IMG_0001.JPG`, ""},
+		{"notes.txt", ""},
+		{"DCIM/100CANON/", ""},
+		{"__MACOSX/DCIM/._IMG_0001.JPG", ""},
+		{"DCIM/._IMG_0001.JPG", ""},
+		{"DCIM/.DS_Store", ""},
+	}
+	for _, tt := range tests {
+		if got := archiveEntryPath(staging, tt.name); got != tt.want {
+			t.Errorf("archiveEntryPath(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
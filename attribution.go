@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"sort"
+)
+
+// AttributionConfig is written into every JPEG copy, so delivered files
+// carry the photographer's name without a separate exiftool pass. Profiles
+// can set their own, e.g. a second shooter's.
+type AttributionConfig struct {
+	Artist    string `yaml:"artist,omitempty"`    // EXIF Artist and XMP dc:creator
+	Copyright string `yaml:"copyright,omitempty"` // EXIF Copyright and XMP dc:rights
+	Credit    string `yaml:"credit,omitempty"`    // XMP photoshop:Credit
+}
+
+func (a *AttributionConfig) empty() bool {
+	return a == nil || (a.Artist == "" && a.Copyright == "" && a.Credit == "")
+}
+
+// EXIF IFD0 tags for attribution.
+const (
+	tagArtist    = 0x013B
+	tagCopyright = 0x8298
+)
+
+// addAttribution returns head, the start of a JPEG, with the attribution
+// written into its EXIF data and, when the file has no XMP packet of its own,
+// a new XMP packet. Anything it doesn't understand is left alone.
+func addAttribution(head []byte, a *AttributionConfig) []byte {
+	if a.empty() || len(head) < 4 || head[0] != 0xFF || head[1] != 0xD8 {
+		return head
+	}
+	insertAt, exifStart, exifEnd, hasXMP := 2, -1, -1, false
+	for i := 2; i+4 <= len(head); {
+		if head[i] != 0xFF {
+			return head
+		}
+		marker := head[i+1]
+		if marker == 0xFF {
+			i++
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		if marker >= 0xD0 && marker <= 0xD7 || marker == 0x01 {
+			i += 2
+			continue
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(head[i+2:]))
+		if end < i+4 || end > len(head) {
+			return head
+		}
+		payload := head[i+4 : end]
+		switch {
+		case marker == 0xE0 && i == 2: // JFIF must stay first
+			insertAt = end
+		case marker == 0xE1 && bytes.HasPrefix(payload, exifHeader) && exifStart < 0:
+			exifStart, exifEnd = i, end
+		case marker == 0xE1 && (bytes.HasPrefix(payload, xmpHeader) || bytes.HasPrefix(payload, xmpExtHeader)):
+			hasXMP = true
+		}
+		i = end
+	}
+
+	var tiff []byte
+	if exifStart >= 0 {
+		tiff = head[exifStart+4+len(exifHeader) : exifEnd]
+	}
+	var segs []byte
+	if a.Artist != "" || a.Copyright != "" {
+		if newTIFF, ok := tiffWithAttribution(tiff, a); ok {
+			segs = append(segs, jpegSegment(0xE1, exifHeader, newTIFF)...)
+		}
+	}
+	if segs == nil && exifStart >= 0 {
+		segs = append(segs, head[exifStart:exifEnd]...)
+	}
+	if !hasXMP {
+		segs = append(segs, jpegSegment(0xE1, xmpHeader, attributionXMP(a))...)
+	}
+
+	out := make([]byte, 0, len(head)+len(segs))
+	if exifStart >= 0 {
+		out = append(append(append(out, head[:exifStart]...), segs...), head[exifEnd:]...)
+	} else {
+		out = append(append(append(out, head[:insertAt]...), segs...), head[insertAt:]...)
+	}
+	return out
+}
+
+// jpegSegment builds one marker segment, or nil when it would be too long.
+func jpegSegment(marker byte, header, data []byte) []byte {
+	n := 2 + len(header) + len(data)
+	if n > 0xFFFF {
+		return nil
+	}
+	seg := []byte{0xFF, marker, byte(n >> 8), byte(n)}
+	seg = append(seg, header...)
+	return append(seg, data...)
+}
+
+// tiffWithAttribution appends a new IFD0 to tiff holding the old IFD0's
+// entries plus Artist and Copyright, and points the header at it. Offsets
+// elsewhere in the block are absolute, so they stay valid; the old IFD0 is
+// left behind unused. With no EXIF to start from a minimal block is made.
+func tiffWithAttribution(tiff []byte, a *AttributionConfig) ([]byte, bool) {
+	var bo binary.ByteOrder = binary.BigEndian
+	var entries [][]byte
+	next := uint32(0)
+	if tiff == nil {
+		tiff = []byte{'M', 'M', 0, 42, 0, 0, 0, 8}
+	} else {
+		if len(tiff) < 8 {
+			return nil, false
+		}
+		switch string(tiff[:2]) {
+		case "II":
+			bo = binary.LittleEndian
+		case "MM":
+		default:
+			return nil, false
+		}
+		ifd0 := int(bo.Uint32(tiff[4:]))
+		if ifd0+2 > len(tiff) {
+			return nil, false
+		}
+		count := int(bo.Uint16(tiff[ifd0:]))
+		if ifd0+2+count*12+4 > len(tiff) {
+			return nil, false
+		}
+		for k := 0; k < count; k++ {
+			e := tiff[ifd0+2+k*12 : ifd0+2+k*12+12]
+			if tag := bo.Uint16(e); tag != tagArtist && tag != tagCopyright {
+				entries = append(entries, e)
+			}
+		}
+		next = bo.Uint32(tiff[ifd0+2+count*12:])
+		tiff = append([]byte(nil), tiff...)
+	}
+	if len(tiff)%2 == 1 {
+		tiff = append(tiff, 0)
+	}
+
+	type field struct {
+		tag   uint16
+		value string
+	}
+	var added []field
+	if a.Artist != "" {
+		added = append(added, field{tagArtist, a.Artist})
+	}
+	if a.Copyright != "" {
+		added = append(added, field{tagCopyright, a.Copyright})
+	}
+	ifdAt := len(tiff)
+	dataAt := ifdAt + 2 + (len(entries)+len(added))*12 + 4
+	var data []byte
+	for _, f := range added {
+		e := make([]byte, 12)
+		bo.PutUint16(e, f.tag)
+		bo.PutUint16(e[2:], 2) // ASCII
+		v := append([]byte(f.value), 0)
+		bo.PutUint32(e[4:], uint32(len(v)))
+		if len(v) <= 4 {
+			copy(e[8:], v)
+		} else {
+			bo.PutUint32(e[8:], uint32(dataAt+len(data)))
+			data = append(data, v...)
+			if len(data)%2 == 1 {
+				data = append(data, 0)
+			}
+		}
+		entries = append(entries, e)
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return bo.Uint16(entries[i]) < bo.Uint16(entries[j]) })
+
+	ifd := make([]byte, 2, 2+len(entries)*12+4)
+	bo.PutUint16(ifd, uint16(len(entries)))
+	for _, e := range entries {
+		ifd = append(ifd, e...)
+	}
+	ifd = append(ifd, 0, 0, 0, 0)
+	bo.PutUint32(ifd[len(ifd)-4:], next)
+	tiff = append(append(tiff, ifd...), data...)
+	bo.PutUint32(tiff[4:], uint32(ifdAt))
+	return tiff, true
+}
+
+// attributionXMP is a minimal XMP packet with the attribution.
+func attributionXMP(a *AttributionConfig) []byte {
+	esc := func(s string) string {
+		var b bytes.Buffer
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	var b bytes.Buffer
+	b.WriteString(`<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>` +
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` +
+		`<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/">`)
+	if a.Artist != "" {
+		b.WriteString(`<dc:creator><rdf:Seq><rdf:li>` + esc(a.Artist) + `</rdf:li></rdf:Seq></dc:creator>`)
+	}
+	if a.Copyright != "" {
+		b.WriteString(`<dc:rights><rdf:Alt><rdf:li xml:lang="x-default">` + esc(a.Copyright) + `</rdf:li></rdf:Alt></dc:rights>`)
+	}
+	if a.Credit != "" {
+		b.WriteString(`<photoshop:Credit>` + esc(a.Credit) + `</photoshop:Credit>`)
+	}
+	b.WriteString(`</rdf:Description></rdf:RDF></x:xmpmeta><?xpacket end="w"?>`)
+	return b.Bytes()
+}
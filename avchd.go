@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// AVCHD cameras write clips to AVCHD/BDMV/STREAM (under PRIVATE on SD
+// cards) with names that restart at 00000.MTS on every card, next to clip
+// databases that skip_folders leaves out. The clips carry no EXIF; the
+// recording time is in the H.264 stream, as the MDPM metadata Sony and
+// Panasonic define.
+
+// avchdStreamDir is the folder the clips themselves are in.
+const avchdStreamDir = "avchd/bdmv/stream"
+
+// avchdScanBytes is how much of a clip is read looking for its metadata,
+// which comes with the first frame.
+const avchdScanBytes = 4 << 20
+
+// avchdVideoPID is the transport stream PID of an AVCHD clip's video.
+const avchdVideoPID = 0x1011
+
+// mdpmMarker is the start of the MDPM block, inside an SEI
+// user_data_unregistered message.
+var mdpmMarker = []byte("MDPM")
+
+// isAVCHDClip reports whether path is a clip in an AVCHD structure.
+func isAVCHDClip(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	if ext != ".mts" && ext != ".m2ts" {
+		return false
+	}
+	dir := strings.ToLower(filepath.ToSlash(filepath.Dir(path)))
+	return strings.HasSuffix(dir, "/"+avchdStreamDir) || dir == avchdStreamDir
+}
+
+// avchdClipName is the name a clip is archived under when no file template
+// renames it: the recording time, then the camera's clip number, as in
+// 20240511_143022_00000.MTS. Clip numbers alone collide between cards.
+func avchdClipName(path string, recorded time.Time) string {
+	base := filepath.Base(path)
+	return recorded.Format("20060102_150405") + "_" + base
+}
+
+// avchdRecorded reads a clip's recording time from its MDPM metadata.
+func avchdRecorded(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, avchdScanBytes))
+	if err != nil {
+		return time.Time{}, err
+	}
+	es := videoPayload(data)
+	i := bytes.Index(es, mdpmMarker)
+	if i < 0 {
+		return time.Time{}, fmt.Errorf("no AVCHD recording time in the first %s", formatBytes(avchdScanBytes))
+	}
+	return parseMDPM(unescapeNAL(es[i+len(mdpmMarker) : min(len(es), i+len(mdpmMarker)+256)]))
+}
+
+// videoPayload joins the video payload of the transport stream packets in
+// data, so metadata split across packets reads as one. AVCHD uses 192-byte
+// packets, a 4-byte timestamp followed by a 188-byte packet.
+func videoPayload(data []byte) []byte {
+	size, skip := 188, 0
+	if len(data) > 4 && data[0] != 0x47 && data[4] == 0x47 {
+		size, skip = 192, 4
+	}
+	var es []byte
+	for off := 0; off+size <= len(data); off += size {
+		p := data[off+skip : off+size]
+		if p[0] != 0x47 {
+			continue
+		}
+		pid := int(p[1]&0x1f)<<8 | int(p[2])
+		afc := p[3] >> 4 & 3
+		if pid != avchdVideoPID || afc&1 == 0 {
+			continue
+		}
+		start := 4
+		if afc&2 != 0 {
+			start += 1 + int(p[4])
+		}
+		if start < len(p) {
+			es = append(es, p[start:]...)
+		}
+	}
+	return es
+}
+
+// unescapeNAL drops the emulation prevention bytes H.264 inserts after two
+// zero bytes, which BCD dates at midnight or on the hour can contain.
+func unescapeNAL(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// parseMDPM reads the recording time from an MDPM block: a count, then
+// five-byte entries of a tag and four bytes. Tag 0x18 holds the time zone,
+// year and month, tag 0x19 the day and time, all in BCD.
+func parseMDPM(b []byte) (time.Time, error) {
+	if len(b) < 1 {
+		return time.Time{}, fmt.Errorf("short AVCHD metadata")
+	}
+	n := int(b[0])
+	var date, clock []byte
+	for i := 0; i < n && 1+i*5+5 <= len(b); i++ {
+		e := b[1+i*5 : 1+i*5+5]
+		switch e[0] {
+		case 0x18:
+			date = e[1:]
+		case 0x19:
+			clock = e[1:]
+		}
+	}
+	if date == nil || clock == nil {
+		return time.Time{}, fmt.Errorf("AVCHD metadata has no recording time")
+	}
+	var v [7]int
+	for i, c := range append(date[1:4:4], clock...) {
+		hi, lo := int(c>>4), int(c&0x0f)
+		if hi > 9 || lo > 9 {
+			return time.Time{}, fmt.Errorf("AVCHD recording time is not BCD")
+		}
+		v[i] = hi*10 + lo
+	}
+	year, month, day, hour, minute, sec := v[0]*100+v[1], v[2], v[3], v[4], v[5], v[6]
+	if month < 1 || month > 12 || day < 1 || day > 31 || hour > 23 || minute > 59 || sec > 59 {
+		return time.Time{}, fmt.Errorf("AVCHD recording time is out of range")
+	}
+	loc := time.Local
+	// Bit 6 is daylight saving time, bit 5 the sign, bits 1-4 hours and
+	// bit 0 half an hour. Cameras
+	// without a time zone set leave it at 0xff.
+	if tz := date[0]; tz != 0xff {
+		offset := (int(tz>>1&0x0f)*60 + int(tz&1)*30) * 60
+		if tz&0x20 != 0 {
+			offset = -offset
+		}
+		if tz&0x40 != 0 {
+			// Daylight saving time is on; the zone is the standard one.
+			offset += 3600
+		}
+		loc = time.FixedZone("", offset)
+	}
+	return time.Date(year, time.Month(month), day, hour, minute, sec, 0, loc), nil
+}
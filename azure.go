@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AzureBlobConfig makes a share a container in Azure Blob Storage.
+type AzureBlobConfig struct {
+	Account   string `yaml:"account"`
+	Container string `yaml:"container"`
+	// Key is the storage account's access key. SASToken, a shared access
+	// signature with read, create, write, delete and list rights, can be
+	// given instead. Both support ${ENV} expansion.
+	Key      string `yaml:"key,omitempty"`
+	SASToken string `yaml:"sas_token,omitempty"`
+	// Endpoint overrides https://<account>.blob.core.windows.net, for
+	// Azurite or national clouds.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// AccessTier is the tier new blobs are written in: "Hot", "Cool",
+	// "Cold" or "Archive". The account's default when unset.
+	AccessTier string `yaml:"access_tier,omitempty"`
+}
+
+// azureAPIVersion is the Blob service version requests are made against.
+const azureAPIVersion = "2021-08-06"
+
+func (a *AzureBlobConfig) validate() error {
+	switch {
+	case strings.TrimSpace(a.Account) == "" || strings.TrimSpace(a.Container) == "":
+		return errors.New("needs account and container")
+	case (strings.TrimSpace(a.Key) == "") == (strings.TrimSpace(a.SASToken) == ""):
+		return errors.New("needs exactly one of key and sas_token")
+	}
+	switch strings.ToLower(a.AccessTier) {
+	case "", "hot", "cool", "cold", "archive":
+	default:
+		return fmt.Errorf("access_tier must be Hot, Cool, Cold or Archive, got %q", a.AccessTier)
+	}
+	if a.Endpoint != "" {
+		if u, err := url.Parse(a.Endpoint); err != nil || u.Host == "" {
+			return fmt.Errorf("endpoint %q is not a URL", a.Endpoint)
+		}
+	}
+	return nil
+}
+
+// azureBlob is a share's container in Azure Blob Storage.
+type azureBlob struct {
+	account   string
+	container string // URL of the container
+	key       []byte // nil when a SAS token is used
+	sas       url.Values
+	tier      string
+}
+
+func newAzureBlob(cfg SMBConfig) (*azureBlob, error) {
+	a := cfg.Azure
+	endpoint := strings.TrimRight(strings.TrimSpace(a.Endpoint), "/")
+	if endpoint == "" {
+		endpoint = "https://" + a.Account + ".blob.core.windows.net"
+	}
+	b := &azureBlob{account: a.Account, container: endpoint + "/" + url.PathEscape(a.Container)}
+	if t := strings.ToLower(a.AccessTier); t != "" {
+		b.tier = strings.ToUpper(t[:1]) + t[1:]
+	}
+	if sas := strings.TrimSpace(os.ExpandEnv(a.SASToken)); sas != "" {
+		v, err := url.ParseQuery(strings.TrimPrefix(sas, "?"))
+		if err != nil {
+			return nil, fmt.Errorf("sas_token: %w", err)
+		}
+		b.sas = v
+		return b, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(os.ExpandEnv(a.Key)))
+	if err != nil {
+		return nil, fmt.Errorf("key is not an Azure access key: %w", err)
+	}
+	b.key = key
+	return b, nil
+}
+
+func (b *azureBlob) kind() string { return "Azure Blob" }
+
+// blobURL is the URL of blob p, with query.
+func (b *azureBlob) blobURL(p string, query url.Values) string {
+	var segs []string
+	for _, s := range strings.Split(strings.Trim(p, "/"), "/") {
+		segs = append(segs, url.PathEscape(s))
+	}
+	u := b.container
+	if len(segs) > 0 && segs[0] != "" {
+		u += "/" + strings.Join(segs, "/")
+	}
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
+
+// do signs and sends one request. body may be nil.
+func (b *azureBlob) do(ctx context.Context, method, rawURL string, header http.Header, body []byte, r io.Reader) (*http.Response, error) {
+	if b.sas != nil {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		q := u.Query()
+		for k, v := range b.sas {
+			q[k] = v
+		}
+		u.RawQuery = q.Encode()
+		rawURL = u.String()
+	}
+	switch {
+	case r != nil:
+	case len(body) == 0:
+		r = http.NoBody
+	default:
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, r)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if b.key != nil {
+		req.Header.Set("Authorization", "SharedKey "+b.account+":"+b.sign(req))
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var e struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		xml.Unmarshal(data, &e)
+		if resp.StatusCode == http.StatusNotFound {
+			return resp, fmt.Errorf("%s: %w", resp.Status, os.ErrNotExist)
+		}
+		msg, _, _ := strings.Cut(strings.TrimSpace(e.Message), "\n")
+		return resp, fmt.Errorf("Azure returned %s: %s %s", resp.Status, e.Code, msg)
+	}
+	return resp, nil
+}
+
+// sign computes the Shared Key signature of req.
+func (b *azureBlob) sign(req *http.Request) string {
+	length := ""
+	if req.ContentLength > 0 {
+		length = strconv.FormatInt(req.ContentLength, 10)
+	}
+	h := req.Header
+	var sb strings.Builder
+	for _, v := range []string{
+		req.Method, h.Get("Content-Encoding"), h.Get("Content-Language"), length, h.Get("Content-MD5"),
+		h.Get("Content-Type"), "", h.Get("If-Modified-Since"), h.Get("If-Match"), h.Get("If-None-Match"),
+		h.Get("If-Unmodified-Since"), h.Get("Range"),
+	} {
+		sb.WriteString(v + "\n")
+	}
+	var names []string
+	for k := range h {
+		if k := strings.ToLower(k); strings.HasPrefix(k, "x-ms-") {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		sb.WriteString(k + ":" + strings.TrimSpace(h.Get(k)) + "\n")
+	}
+	sb.WriteString("/" + b.account + req.URL.EscapedPath())
+	q := req.URL.Query()
+	var params []string
+	for k := range q {
+		params = append(params, k)
+	}
+	sort.Strings(params)
+	for _, k := range params {
+		v := q[k]
+		sort.Strings(v)
+		sb.WriteString("\n" + strings.ToLower(k) + ":" + strings.Join(v, ","))
+	}
+	mac := hmac.New(sha256.New, b.key)
+	mac.Write([]byte(sb.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (b *azureBlob) exists(ctx context.Context, p string) (bool, error) {
+	resp, err := b.do(ctx, http.MethodHead, b.blobURL(p, nil), nil, nil, nil)
+	if err == nil {
+		resp.Body.Close()
+		return true, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	// Folders are only prefixes of blob names.
+	q := url.Values{"restype": {"container"}, "comp": {"list"}, "prefix": {strings.Trim(p, "/") + "/"}, "maxresults": {"1"}}
+	resp, err = b.do(ctx, http.MethodGet, b.container+"?"+q.Encode(), nil, nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Blobs []struct {
+			Name string `xml:"Name"`
+		} `xml:"Blobs>Blob"`
+	}
+	if err := xml.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&list); err != nil {
+		return false, fmt.Errorf("reading blob list: %w", err)
+	}
+	return len(list.Blobs) > 0, nil
+}
+
+func (b *azureBlob) remove(ctx context.Context, p string) error {
+	resp, err := b.do(ctx, http.MethodDelete, b.blobURL(p, nil), http.Header{"X-Ms-Delete-Snapshots": {"include"}}, nil, nil)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// transfer is transferToSMB for Azure Blob. A file that fits in one chunk is
+// one Put Blob; a larger one is staged as blocks and committed with Put
+// Block List, so no blob appears until the whole file is there. Azure checks
+// every request's Content-MD5, and the blob's size is checked afterwards.
+func (b *azureBlob) transfer(ctx context.Context, sourcePath, destPath string, conn *SMBConnection) (copyResult, error) {
+	h, whole := newHasher(conn.hashAlg), md5.New()
+	var blocks []string
+	header := func(chunk []byte) http.Header {
+		sum := md5.Sum(chunk)
+		whole.Write(chunk)
+		return http.Header{"Content-Md5": {base64.StdEncoding.EncodeToString(sum[:])}}
+	}
+	put := func(u string, hdr http.Header, chunk []byte) error {
+		resp, err := b.do(ctx, http.MethodPut, u, hdr, chunk, conn.limiter.reader(ctx, bytes.NewReader(chunk)))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	written, err := sendInChunks(ctx, sourcePath, conn, h, func(i int, chunk []byte, last bool) error {
+		hdr := header(chunk)
+		if i == 0 && last {
+			hdr.Set("X-Ms-Blob-Type", "BlockBlob")
+			hdr.Set("Content-Type", "application/octet-stream")
+			if b.tier != "" {
+				hdr.Set("X-Ms-Access-Tier", b.tier)
+			}
+			return put(b.blobURL(destPath, nil), hdr, chunk)
+		}
+		id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("snapvault-%08d", i)))
+		blocks = append(blocks, id)
+		if err := put(b.blobURL(destPath, url.Values{"comp": {"block"}, "blockid": {id}}), hdr, chunk); err != nil {
+			return fmt.Errorf("block %d: %w", i, err)
+		}
+		if !last {
+			return nil
+		}
+		var list bytes.Buffer
+		list.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+		for _, id := range blocks {
+			list.WriteString("<Latest>" + id + "</Latest>")
+		}
+		list.WriteString("</BlockList>")
+		hdr = http.Header{
+			"Content-Type":           {"application/xml"},
+			"X-Ms-Blob-Content-Type": {"application/octet-stream"},
+			"X-Ms-Blob-Content-Md5":  {base64.StdEncoding.EncodeToString(whole.Sum(nil))},
+		}
+		if b.tier != "" {
+			hdr.Set("X-Ms-Access-Tier", b.tier)
+		}
+		if err := put(b.blobURL(destPath, url.Values{"comp": {"blocklist"}}), hdr, list.Bytes()); err != nil {
+			return fmt.Errorf("committing blocks: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		// Staged blocks that are never committed are dropped by Azure.
+		return copyResult{}, err
+	}
+
+	resp, err := b.do(ctx, http.MethodHead, b.blobURL(destPath, nil), nil, nil, nil)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("checking copy: %w", err)
+	}
+	resp.Body.Close()
+	if resp.ContentLength != written {
+		return copyResult{}, fmt.Errorf("%w: Azure has %d bytes, %d were sent", errSizeMismatch, resp.ContentLength, written)
+	}
+	return copyResult{DestPath: path.Clean(destPath), Sum: h.Sum(nil), Algorithm: conn.hashAlg}, nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// B2Config makes a share a bucket in Backblaze B2, through B2's own API.
+type B2Config struct {
+	Bucket string `yaml:"bucket"`
+	// KeyID and Key are an application key with read, write and delete
+	// access to the bucket. Key supports ${ENV} expansion.
+	KeyID string `yaml:"key_id"`
+	Key   string `yaml:"key"`
+}
+
+const b2AuthURL = "https://api.backblazeb2.com/b2api/v2/b2_authorize_account"
+
+func (c *B2Config) validate() error {
+	if strings.TrimSpace(c.Bucket) == "" || strings.TrimSpace(c.KeyID) == "" || strings.TrimSpace(c.Key) == "" {
+		return errors.New("needs bucket, key_id and key")
+	}
+	return nil
+}
+
+// b2Bucket is a share's bucket in B2.
+type b2Bucket struct {
+	keyID, key, bucket string
+
+	mu       sync.Mutex
+	apiURL   string
+	token    string
+	bucketID string
+}
+
+// b2Error is an error response from the B2 API.
+type b2Error struct {
+	Status  int    `json:"status"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *b2Error) Error() string { return "B2 returned " + e.Code + ": " + e.Message }
+
+func newB2Bucket(ctx context.Context, cfg SMBConfig) (*b2Bucket, error) {
+	c := cfg.B2
+	b := &b2Bucket{keyID: c.KeyID, key: os.ExpandEnv(c.Key), bucket: c.Bucket}
+	auth, err := b.authorize(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// A key restricted to one bucket names it; any other key looks it up.
+	if auth.Allowed.BucketName == b.bucket && auth.Allowed.BucketID != "" {
+		b.bucketID = auth.Allowed.BucketID
+		return b, nil
+	}
+	var list struct {
+		Buckets []struct {
+			BucketID string `json:"bucketId"`
+		} `json:"buckets"`
+	}
+	if err := b.call(ctx, "b2_list_buckets", map[string]string{"accountId": auth.AccountID, "bucketName": b.bucket}, &list); err != nil {
+		return nil, fmt.Errorf("looking up bucket %s: %w", b.bucket, err)
+	}
+	if len(list.Buckets) == 0 {
+		return nil, fmt.Errorf("B2 has no bucket %q for this key", b.bucket)
+	}
+	b.bucketID = list.Buckets[0].BucketID
+	return b, nil
+}
+
+func (b *b2Bucket) kind() string { return "B2" }
+
+// b2Auth is the part of b2_authorize_account's response SnapVault uses.
+type b2Auth struct {
+	AccountID string `json:"accountId"`
+	Token     string `json:"authorizationToken"`
+	APIURL    string `json:"apiUrl"`
+	Allowed   struct {
+		BucketID   string `json:"bucketId"`
+		BucketName string `json:"bucketName"`
+	} `json:"allowed"`
+}
+
+// authorize signs in with the application key. Tokens last a day, so a
+// long-running -serve process signs in again when one expires.
+func (b *b2Bucket) authorize(ctx context.Context) (b2Auth, error) {
+	ctx, cancel := context.WithTimeout(ctx, googleRequestTimeout)
+	defer cancel()
+	var auth b2Auth
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b2AuthURL, nil)
+	if err != nil {
+		return auth, err
+	}
+	req.SetBasicAuth(b.keyID, b.key)
+	if err := b2Decode(req, &auth); err != nil {
+		return auth, fmt.Errorf("signing in to B2: %w", err)
+	}
+	b.mu.Lock()
+	b.apiURL, b.token = auth.APIURL, auth.Token
+	b.mu.Unlock()
+	return auth, nil
+}
+
+// b2Decode sends req and decodes the JSON response into out.
+func b2Decode(req *http.Request, out any) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		e := &b2Error{Status: resp.StatusCode, Code: resp.Status}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(e)
+		return e
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// call makes one API call, signing in again once if the token expired.
+func (b *b2Bucket) call(ctx context.Context, op string, in, out any) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		rctx, cancel := context.WithTimeout(ctx, googleRequestTimeout)
+		b.mu.Lock()
+		apiURL, token := b.apiURL, b.token
+		b.mu.Unlock()
+		req, err := http.NewRequestWithContext(rctx, http.MethodPost, apiURL+"/b2api/v2/"+op, bytes.NewReader(data))
+		if err != nil {
+			cancel()
+			return err
+		}
+		req.Header.Set("Authorization", token)
+		err = b2Decode(req, out)
+		cancel()
+		var e *b2Error
+		if attempt == 0 && errors.As(err, &e) && e.Code == "expired_auth_token" {
+			if _, err := b.authorize(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		return err
+	}
+}
+
+// b2FileName encodes a file name for the X-Bz-File-Name header.
+func b2FileName(p string) string {
+	segs := strings.Split(strings.Trim(p, "/"), "/")
+	for i, s := range segs {
+		segs[i] = url.PathEscape(s)
+	}
+	return strings.Join(segs, "/")
+}
+
+// upload posts one file or part to an upload URL, with its SHA-1 for B2 to
+// check.
+func (b *b2Bucket) upload(ctx context.Context, conn *SMBConnection, uploadURL, token string, header http.Header, chunk []byte) (*b2File, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, uploadURL, conn.limiter.reader(ctx, bytes.NewReader(chunk)))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(chunk))
+	req.Header = header
+	req.Header.Set("Authorization", token)
+	sum := sha1.Sum(chunk)
+	req.Header.Set("X-Bz-Content-Sha1", hex.EncodeToString(sum[:]))
+	var f b2File
+	if err := b2Decode(req, &f); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// b2File is the part of B2's file info SnapVault uses.
+type b2File struct {
+	FileID        string `json:"fileId"`
+	FileName      string `json:"fileName"`
+	ContentLength int64  `json:"contentLength"`
+	Action        string `json:"action"`
+}
+
+// latest returns the newest version of the file p, or nil.
+func (b *b2Bucket) latest(ctx context.Context, p string) (*b2File, error) {
+	var list struct {
+		Files []b2File `json:"files"`
+	}
+	p = strings.Trim(p, "/")
+	in := map[string]any{"bucketId": b.bucketID, "startFileName": p, "prefix": p, "maxFileCount": 1}
+	if err := b.call(ctx, "b2_list_file_versions", in, &list); err != nil {
+		return nil, err
+	}
+	if len(list.Files) == 0 || list.Files[0].FileName != p || list.Files[0].Action != "upload" {
+		return nil, nil
+	}
+	return &list.Files[0], nil
+}
+
+func (b *b2Bucket) exists(ctx context.Context, p string) (bool, error) {
+	var list struct {
+		Files []b2File `json:"files"`
+	}
+	// A folder is a prefix; a file name is a prefix of itself.
+	p = strings.Trim(p, "/")
+	for _, prefix := range []string{p, p + "/"} {
+		in := map[string]any{"bucketId": b.bucketID, "prefix": prefix, "maxFileCount": 1}
+		if err := b.call(ctx, "b2_list_file_names", in, &list); err != nil {
+			return false, err
+		}
+		for _, f := range list.Files {
+			if f.FileName == p || strings.HasPrefix(f.FileName, p+"/") {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// remove deletes the newest version of p, which is the one a run uploaded.
+func (b *b2Bucket) remove(ctx context.Context, p string) error {
+	f, err := b.latest(ctx, p)
+	if err != nil || f == nil {
+		return err
+	}
+	return b.call(ctx, "b2_delete_file_version", map[string]string{"fileId": f.FileID, "fileName": f.FileName}, nil)
+}
+
+// transfer is transferToSMB for B2. A file that fits in one chunk is one
+// upload; a larger one is a large file of parts that only appears once
+// finished. B2 checks the SHA-1 sent with every upload and part, and the
+// stored size is checked against what was sent.
+func (b *b2Bucket) transfer(ctx context.Context, sourcePath, destPath string, conn *SMBConnection) (copyResult, error) {
+	name := strings.Trim(destPath, "/")
+	h := newHasher(conn.hashAlg)
+	var (
+		fileID    string
+		uploadURL struct {
+			URL   string `json:"uploadUrl"`
+			Token string `json:"authorizationToken"`
+		}
+		sums   []string
+		stored int64
+	)
+	written, err := sendInChunks(ctx, sourcePath, conn, h, func(i int, chunk []byte, last bool) error {
+		if i == 0 && last {
+			if err := b.call(ctx, "b2_get_upload_url", map[string]string{"bucketId": b.bucketID}, &uploadURL); err != nil {
+				return err
+			}
+			f, err := b.upload(ctx, conn, uploadURL.URL, uploadURL.Token, http.Header{
+				"X-Bz-File-Name": {b2FileName(name)},
+				"Content-Type":   {"b2/x-auto"},
+			}, chunk)
+			if err != nil {
+				return err
+			}
+			stored = f.ContentLength
+			return nil
+		}
+		if i == 0 {
+			var started b2File
+			in := map[string]string{"bucketId": b.bucketID, "fileName": name, "contentType": "b2/x-auto"}
+			if err := b.call(ctx, "b2_start_large_file", in, &started); err != nil {
+				return err
+			}
+			fileID = started.FileID
+			if err := b.call(ctx, "b2_get_upload_part_url", map[string]string{"fileId": fileID}, &uploadURL); err != nil {
+				return err
+			}
+		}
+		sum := sha1.Sum(chunk)
+		sums = append(sums, hex.EncodeToString(sum[:]))
+		_, err := b.upload(ctx, conn, uploadURL.URL, uploadURL.Token, http.Header{
+			"X-Bz-Part-Number": {strconv.Itoa(i + 1)},
+		}, chunk)
+		if err != nil {
+			return fmt.Errorf("part %d: %w", i+1, err)
+		}
+		stored += int64(len(chunk))
+		if !last {
+			return nil
+		}
+		var done b2File
+		if err := b.call(ctx, "b2_finish_large_file", map[string]any{"fileId": fileID, "partSha1Array": sums}, &done); err != nil {
+			return fmt.Errorf("finishing upload: %w", err)
+		}
+		stored = done.ContentLength
+		return nil
+	})
+	if err != nil {
+		if fileID != "" {
+			// Drop the parts, or B2 keeps billing for them.
+			cctx, cancel := context.WithTimeout(context.Background(), partialCleanupTimeout)
+			b.call(cctx, "b2_cancel_large_file", map[string]string{"fileId": fileID}, nil)
+			cancel()
+		}
+		return copyResult{}, err
+	}
+	if stored != written {
+		return copyResult{}, fmt.Errorf("%w: B2 has %d bytes, %d were sent", errSizeMismatch, stored, written)
+	}
+	return copyResult{DestPath: path.Clean(destPath), Sum: h.Sum(nil), Algorithm: conn.hashAlg}, nil
+}
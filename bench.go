@@ -0,0 +1,322 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// benchChunk is the write size of the benchmark, and the size of the random
+// buffer it repeats: incompressible, so a NAS that compresses or dedupes
+// can't flatter itself.
+const benchChunk = 1 << 20
+
+// benchResult is one share's measurements.
+type benchResult struct {
+	share  string
+	writes []benchRate // by stream count, ascending
+	read   benchRate
+	// Median round trips of the metadata operations an import makes per
+	// file and per folder.
+	stat, create, mkdir, rename time.Duration
+	err                         error
+}
+
+type benchRate struct {
+	streams int
+	bytes   int64
+	elapsed time.Duration
+}
+
+func (r benchRate) perSecond() float64 {
+	if r.elapsed <= 0 {
+		return 0
+	}
+	return float64(r.bytes) / r.elapsed.Seconds()
+}
+
+// runBenchCommand implements `snapvault bench`: it writes and reads test data
+// on each share in turn and reports throughput and latency, so a slow NAS
+// or a worker count past what a share can take shows up before an import.
+func runBenchCommand(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	sizeFlag := fs.String("size", "256MB", "Test data written to each share per stream count")
+	workers := fs.Int("workers", 8, "Highest number of parallel write streams to try (1, 2, 4, ... up to this)")
+	ops := fs.Int("ops", 20, "Metadata operations (stat, create, mkdir, rename) timed per share")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault bench [-size 256MB] [-workers 8] [-ops 20]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	size, err := parseByteSize(*sizeFlag)
+	if err != nil || size < benchChunk {
+		fmt.Fprintf(fs.Output(), "-size: want at least 1MB, got %q\n", *sizeFlag)
+		return 2
+	}
+	if *workers < 1 || *ops < 1 {
+		fmt.Fprintln(fs.Output(), "-workers and -ops must be at least 1")
+		return 2
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	_, connections, err := common.connectAll(ctx)
+	if err != nil {
+		slog.Error("Failed to connect to shares", "error", err)
+		return 1
+	}
+	defer closeConnections(connections)
+
+	var results []benchResult
+	for _, conn := range connections {
+		if conn.cloud != nil {
+			slog.Info("Skipping "+conn.cloud.kind()+" share", "share", shareLabel(conn.Config))
+			continue
+		}
+		// One share at a time, so they don't compete for the local link.
+		// The bandwidth limit doesn't apply: this measures the share.
+		slog.Info("Benchmarking share", "share", shareLabel(conn.Config), "size", formatBytes(size))
+		res := benchShare(ctx, conn, size, *workers, *ops)
+		if ctx.Err() != nil {
+			return exitCancelled
+		}
+		results = append(results, res)
+	}
+	if len(results) == 0 {
+		slog.Error("No SMB shares to benchmark")
+		return 1
+	}
+	printBench(results)
+	for _, r := range results {
+		if r.err != nil {
+			return 1
+		}
+	}
+	return 0
+}
+
+// benchShare measures conn in a scratch folder under .snapvault, which it
+// removes again whatever happens.
+func benchShare(ctx context.Context, conn *SMBConnection, size int64, workers, ops int) benchResult {
+	res := benchResult{share: shareLabel(conn.Config)}
+	fs := conn.Share.WithContext(ctx)
+	dir := shootRoot(conn, remoteMetaDir+"/bench-"+strconv.FormatInt(time.Now().UnixNano(), 36))
+	if err := fs.MkdirAll(dir, 0o755); err != nil {
+		res.err = fmt.Errorf("creating %s: %w", dir, err)
+		return res
+	}
+	defer func() {
+		if err := conn.Share.RemoveAll(dir); err != nil {
+			slog.Warn("Could not remove benchmark folder", "share", res.share, "folder", dir, "error", err)
+		}
+	}()
+
+	buf := make([]byte, benchChunk)
+	if _, err := rand.Read(buf); err != nil {
+		res.err = err
+		return res
+	}
+	for streams := 1; streams <= workers; streams *= 2 {
+		rate, err := benchWrite(ctx, conn, dir, buf, size, streams)
+		if err != nil {
+			res.err = err
+			return res
+		}
+		res.writes = append(res.writes, rate)
+	}
+	// The single-stream file is still there to read back. The NAS may serve
+	// it from its cache, so this is an upper bound on what restores see.
+	start := time.Now()
+	n, err := benchRead(fs, path.Join(dir, "stream-1-0.bin"))
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.read = benchRate{streams: 1, bytes: n, elapsed: time.Since(start)}
+
+	res.stat, res.create, res.mkdir, res.rename, res.err = benchMetadata(ctx, conn, dir, ops)
+	return res
+}
+
+// benchWrite writes size bytes split over streams parallel files.
+func benchWrite(ctx context.Context, conn *SMBConnection, dir string, buf []byte, size int64, streams int) (benchRate, error) {
+	per := size / int64(streams)
+	if per < benchChunk {
+		per = benchChunk
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	start := time.Now()
+	for i := range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			name := path.Join(dir, fmt.Sprintf("stream-%d-%d.bin", streams, i))
+			if err := benchWriteFile(ctx, conn, name, buf, per); err != nil {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("writing %s: %w", name, err)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return benchRate{}, firstErr
+	}
+	return benchRate{streams: streams, bytes: per * int64(streams), elapsed: time.Since(start)}, nil
+}
+
+func benchWriteFile(ctx context.Context, conn *SMBConnection, name string, buf []byte, size int64) error {
+	f, err := conn.Share.WithContext(ctx).Create(name)
+	if err != nil {
+		return err
+	}
+	for written := int64(0); written < size; {
+		n, err := f.Write(buf[:min(int64(len(buf)), size-written)])
+		written += int64(n)
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+	return f.Close()
+}
+
+func benchRead(fs *smb2.Share, name string) (int64, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return 0, fmt.Errorf("opening %s: %w", name, err)
+	}
+	defer f.Close()
+	n, err := io.CopyBuffer(io.Discard, f, make([]byte, benchChunk))
+	if err != nil {
+		return n, fmt.Errorf("reading %s: %w", name, err)
+	}
+	return n, nil
+}
+
+// benchMetadata times ops rounds of the small operations an import makes:
+// stat (the existence check before a copy), creating a small file, making a
+// folder and renaming a file into place. It reports the medians.
+func benchMetadata(ctx context.Context, conn *SMBConnection, dir string, ops int) (stat, create, mkdir, rename time.Duration, err error) {
+	fs := conn.Share.WithContext(ctx)
+	small := make([]byte, 4<<10)
+	var stats, creates, mkdirs, renames []time.Duration
+	timed := func(into *[]time.Duration, op func() error) error {
+		start := time.Now()
+		if err := op(); err != nil {
+			return err
+		}
+		*into = append(*into, time.Since(start))
+		return nil
+	}
+	for i := range ops {
+		name := path.Join(dir, fmt.Sprintf("small-%d.bin", i))
+		sub := path.Join(dir, fmt.Sprintf("dir-%d", i))
+		err := errors.Join(
+			timed(&stats, func() error { _, err := fs.Stat(dir); return err }),
+			timed(&creates, func() error { return fs.WriteFile(name, small, 0o644) }),
+			timed(&mkdirs, func() error { return fs.Mkdir(sub, 0o755) }),
+			timed(&renames, func() error { return fs.Rename(name, path.Join(sub, "renamed.bin")) }),
+		)
+		if err != nil {
+			return 0, 0, 0, 0, fmt.Errorf("metadata operations: %w", err)
+		}
+	}
+	return median(stats), median(creates), median(mkdirs), median(renames), nil
+}
+
+func median(d []time.Duration) time.Duration {
+	if len(d) == 0 {
+		return 0
+	}
+	d = slices.Clone(d)
+	slices.Sort(d)
+	return d[len(d)/2]
+}
+
+// printBench prints one block per share and, where writes stopped scaling,
+// the stream count past which more workers don't help.
+func printBench(results []benchResult) {
+	for i, r := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Println(r.share)
+		for _, w := range r.writes {
+			fmt.Printf("  write  %2d stream(s)  %10s/s\n", w.streams, formatBytes(int64(w.perSecond())))
+		}
+		if r.read.bytes > 0 {
+			fmt.Printf("  read    1 stream     %10s/s\n", formatBytes(int64(r.read.perSecond())))
+		}
+		if r.stat > 0 {
+			fmt.Printf("  latency  stat %s  create %s  mkdir %s  rename %s\n",
+				formatLatency(r.stat), formatLatency(r.create), formatLatency(r.mkdir), formatLatency(r.rename))
+		}
+		if n := benchSaturation(r.writes); n > 0 && n < r.writes[len(r.writes)-1].streams {
+			fmt.Printf("  writes stop scaling at %d stream(s); more workers won't help this share\n", n)
+		}
+		if r.err != nil {
+			fmt.Printf("  error: %v\n", r.err)
+		}
+	}
+
+	slowest := -1
+	for i, r := range results {
+		if len(r.writes) > 0 && (slowest < 0 || bestRate(r.writes) < bestRate(results[slowest].writes)) {
+			slowest = i
+		}
+	}
+	if slowest >= 0 && len(results) > 1 {
+		fmt.Printf("\nSlowest share: %s (%s/s at best); every import waits for it.\n",
+			results[slowest].share, formatBytes(int64(bestRate(results[slowest].writes))))
+	}
+}
+
+// benchSaturation is the fewest streams that reach 90% of the best write
+// rate, or 0 without measurements.
+func benchSaturation(writes []benchRate) int {
+	best := bestRate(writes)
+	for _, w := range writes {
+		if w.perSecond() >= 0.9*best {
+			return w.streams
+		}
+	}
+	return 0
+}
+
+func bestRate(writes []benchRate) float64 {
+	best := 0.0
+	for _, w := range writes {
+		if r := w.perSecond(); r > best {
+			best = r
+		}
+	}
+	return best
+}
+
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.1f ms", float64(d.Microseconds())/1000)
+}
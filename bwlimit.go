@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BandwidthWindow caps a share's upload rate during part of each day.
+type BandwidthWindow struct {
+	// Hours is a daily window like "08:00-22:00", in local time. It may wrap
+	// midnight.
+	Hours string `yaml:"hours"`
+	// Limit is the cap inside the window, like "5MB" per second; "0" lifts it.
+	Limit string `yaml:"limit"`
+}
+
+// limiterChunk is the most a limited writer hands on at once, so one large
+// write can't overshoot the cap by much before the limiter catches up.
+const limiterChunk = 64 << 10
+
+// parseByteSize parses a size like "64MB", "1.5G" or "500KB" into bytes, in
+// the same 1024-based units the reports use.
+func parseByteSize(s string) (int64, error) {
+	v := strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(s), " ", ""))
+	v = strings.TrimSuffix(strings.TrimSuffix(v, "IB"), "B")
+	mult := int64(1)
+	if n := len(v); n > 0 {
+		if i := strings.IndexByte("KMG", v[n-1]); i >= 0 {
+			mult = int64(1) << (10 * (i + 1))
+			v = v[:n-1]
+		}
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil || !(n >= 0) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("want a size like \"64MB\" or \"500KB\", got %q", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+// parseByteRate parses a rate like "5MB", "500 KB/s" or "1.5M" into bytes per
+// second. "0" is unlimited.
+func parseByteRate(s string) (int64, error) {
+	v := strings.TrimSpace(s)
+	if len(v) > 2 && strings.EqualFold(v[len(v)-2:], "/s") {
+		v = v[:len(v)-2]
+	}
+	n, err := parseByteSize(v)
+	if err != nil {
+		return 0, fmt.Errorf("want a rate like \"5MB\" or \"500KB\", got %q", s)
+	}
+	return n, nil
+}
+
+// scheduledRate is one parsed bwlimit_schedule entry.
+type scheduledRate struct {
+	window dailyWindow
+	rate   int64 // bytes per second; 0 is unlimited
+}
+
+// bandwidthLimiter paces the writes to one share so they stay under the
+// share's bwlimit, or the bwlimit_schedule entry covering the time of day.
+// It is shared by every worker writing to the share, so the cap holds for
+// the share as a whole.
+type bandwidthLimiter struct {
+	base     int64
+	schedule []scheduledRate
+
+	mu   sync.Mutex
+	next time.Time // when the bytes let through so far are sent at the cap
+}
+
+// newBandwidthLimiter returns the limiter for cfg, or nil when the share has
+// no limit at any time of day.
+func newBandwidthLimiter(cfg SMBConfig) (*bandwidthLimiter, error) {
+	l := &bandwidthLimiter{}
+	limited := false
+	if cfg.BWLimit != "" {
+		rate, err := parseByteRate(cfg.BWLimit)
+		if err != nil {
+			return nil, fmt.Errorf("bwlimit: %w", err)
+		}
+		l.base = rate
+		limited = rate > 0
+	}
+	for i, entry := range cfg.BWLimitSchedule {
+		w, err := parseDailyWindow(entry.Hours)
+		if err != nil {
+			return nil, fmt.Errorf("bwlimit_schedule %d: hours: %w", i, err)
+		}
+		rate, err := parseByteRate(entry.Limit)
+		if err != nil {
+			return nil, fmt.Errorf("bwlimit_schedule %d: limit: %w", i, err)
+		}
+		l.schedule = append(l.schedule, scheduledRate{w, rate})
+		limited = limited || rate > 0
+	}
+	if !limited {
+		return nil, nil
+	}
+	return l, nil
+}
+
+// rate is the cap at t: that of the first schedule entry whose window is
+// open, or else bwlimit.
+func (l *bandwidthLimiter) rate(t time.Time) int64 {
+	for _, s := range l.schedule {
+		if s.window.open(t) {
+			return s.rate
+		}
+	}
+	return l.base
+}
+
+// wait blocks until n more bytes can be sent without going over the current
+// cap.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	now := time.Now()
+	rate := l.rate(now)
+	if rate <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	// Time spent idle, or unlimited, doesn't build up credit for a burst.
+	if l.next.Before(now) {
+		l.next = now
+	}
+	l.next = l.next.Add(time.Duration(float64(n) / float64(rate) * float64(time.Second)))
+	delay := l.next.Sub(now)
+	l.mu.Unlock()
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writer wraps w so writes to it are paced by l. A nil limiter returns w
+// unchanged.
+func (l *bandwidthLimiter) writer(ctx context.Context, w io.Writer) io.Writer {
+	if l == nil {
+		return w
+	}
+	return limitedWriter{ctx, w, l}
+}
+
+// reader wraps r so reads from it are paced by l, for request bodies that
+// are read rather than written. A nil limiter returns r unchanged.
+func (l *bandwidthLimiter) reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return limitedReader{ctx, r, l}
+}
+
+type limitedReader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *bandwidthLimiter
+}
+
+func (lr limitedReader) Read(p []byte) (int, error) {
+	if len(p) > limiterChunk {
+		p = p[:limiterChunk]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if werr := lr.l.wait(lr.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+type limitedWriter struct {
+	ctx context.Context
+	w   io.Writer
+	l   *bandwidthLimiter
+}
+
+func (lw limitedWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := len(p)
+		if n > limiterChunk {
+			n = limiterChunk
+		}
+		if err := lw.l.wait(lw.ctx, n); err != nil {
+			return written, err
+		}
+		m, err := lw.w.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// cameraDevice is a camera reachable over PTP/MTP, as reported by gphoto2.
+type cameraDevice struct {
+	Model string
+	Port  string
+}
+
+// detectCameras lists USB-connected cameras using `gphoto2 --auto-detect`.
+func detectCameras(ctx context.Context) ([]cameraDevice, error) {
+	out, err := runGphoto2(ctx, "--auto-detect")
+	if err != nil {
+		return nil, err
+	}
+
+	var cams []cameraDevice
+	pastHeader := false
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "---") {
+			pastHeader = true
+			continue
+		}
+		if !pastHeader || line == "" {
+			continue
+		}
+		// "Canon EOS R5                   usb:002,014": the port is the last field.
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		port := fields[len(fields)-1]
+		model := strings.TrimSpace(strings.TrimSuffix(line, port))
+		cams = append(cams, cameraDevice{Model: model, Port: port})
+	}
+	return cams, nil
+}
+
+// selectCamera picks the camera to import from. With a single camera attached
+// the selector may be empty; otherwise it must match a port or part of a model name.
+func selectCamera(cams []cameraDevice, selector string) (cameraDevice, error) {
+	if len(cams) == 0 {
+		return cameraDevice{}, errors.New("no PTP/MTP camera detected; is it switched on and connected over USB?")
+	}
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		if len(cams) > 1 {
+			return cameraDevice{}, fmt.Errorf("%d cameras connected; choose one with -camera (port or model)", len(cams))
+		}
+		return cams[0], nil
+	}
+	for _, c := range cams {
+		if c.Port == selector || strings.Contains(strings.ToLower(c.Model), strings.ToLower(selector)) {
+			return c, nil
+		}
+	}
+	return cameraDevice{}, fmt.Errorf("no connected camera matches %q", selector)
+}
+
+// downloadFromCamera copies every file on the camera into destDir, keeping one
+// subdirectory per camera folder so same-named files (100CANON/IMG_0001.JPG,
+// 101CANON/IMG_0001.JPG) never collide.
+//
+// PTP offers no random-access file reads that the EXIF reader and size check
+// can use, so camera imports are the one case that stages locally first.
+func downloadFromCamera(ctx context.Context, cam cameraDevice, destDir string) error {
+	out, err := runGphoto2(ctx, "--port", cam.Port, "--list-files")
+	if err != nil {
+		return err
+	}
+	folders := parseGphoto2Folders(out)
+	if len(folders) == 0 {
+		return errors.New("camera reports no files")
+	}
+
+	for _, folder := range folders {
+		local := filepath.Join(destDir, filepath.FromSlash(strings.TrimPrefix(folder, "/")))
+		if err := os.MkdirAll(local, 0o755); err != nil {
+			return fmt.Errorf("creating staging folder: %w", err)
+		}
+		slog.Info("Downloading from camera", "model", cam.Model, "folder", folder)
+		_, err := runGphoto2(ctx,
+			"--port", cam.Port,
+			"--folder", folder,
+			"--no-recurse",
+			"--get-all-files",
+			"--force-overwrite",
+			"--filename", filepath.Join(local, "%f.%C"),
+		)
+		if err != nil {
+			return fmt.Errorf("downloading %s: %w", folder, err)
+		}
+	}
+	return nil
+}
+
+// parseGphoto2Folders extracts folder paths from `gphoto2 --list-files` output,
+// which announces each folder as: There are 12 files in folder '/store_00010001/DCIM/100CANON'.
+func parseGphoto2Folders(out []byte) []string {
+	var folders []string
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		idx := strings.Index(line, "in folder '")
+		if idx < 0 || !strings.HasPrefix(line, "There ") {
+			continue
+		}
+		rest := line[idx+len("in folder '"):]
+		if end := strings.LastIndex(rest, "'"); end > 0 {
+			folders = append(folders, rest[:end])
+		}
+	}
+	return folders
+}
+
+func runGphoto2(ctx context.Context, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath("gphoto2"); err != nil {
+		return nil, errors.New("gphoto2 is required for -source camera; install it (e.g. brew install gphoto2, apt install gphoto2)")
+	}
+	cmd := exec.CommandContext(ctx, "gphoto2", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("gphoto2: %s", msg)
+		}
+		return nil, fmt.Errorf("gphoto2: %w", err)
+	}
+	return out, nil
+}
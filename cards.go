@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cardFingerprint identifies the volume mounted at mount by its filesystem
+// UUID (or serial, for FAT/exFAT), which survives reformat-free reinsertion
+// and changes when the card is formatted.
+func cardFingerprint(ctx context.Context, mount string) (string, error) {
+	switch runtime.GOOS {
+	case "darwin":
+		return darwinVolumeUUID(ctx, mount)
+	case "windows":
+		return windowsVolumeSerial(mount)
+	}
+	return linuxVolumeUUID(mount)
+}
+
+func darwinVolumeUUID(ctx context.Context, mount string) (string, error) {
+	info, err := diskutilInfo(ctx, mount)
+	if err != nil {
+		return "", err
+	}
+	if uuid := info["Volume UUID"]; uuid != "" {
+		return "uuid:" + uuid, nil
+	}
+	if uuid := info["Disk / Partition UUID"]; uuid != "" {
+		return "uuid:" + uuid, nil
+	}
+	return "", errors.New("volume has no UUID")
+}
+
+// diskutilInfo returns the "Key: value" lines of `diskutil info` for a volume.
+func diskutilInfo(ctx context.Context, mount string) (map[string]string, error) {
+	out, err := exec.CommandContext(ctx, "diskutil", "info", mount).Output()
+	if err != nil {
+		return nil, fmt.Errorf("diskutil info: %w", err)
+	}
+	info := map[string]string{}
+	sc := bufio.NewScanner(strings.NewReader(string(out)))
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if ok {
+			info[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return info, nil
+}
+
+// darwinIsRemovable reports whether a volume under /Volumes is a card or
+// external drive, as opposed to a disk image, a second internal volume or a
+// mounted network share, which diskutil does not know at all.
+func darwinIsRemovable(ctx context.Context, mount string) bool {
+	info, err := diskutilInfo(ctx, mount)
+	if err != nil {
+		return false
+	}
+	switch {
+	case info["Removable Media"] == "Removable", info["Removable Media"] == "Yes":
+		return true
+	case info["Ejectable"] == "Yes", info["Device Location"] == "External":
+		return info["Protocol"] != "Disk Image"
+	}
+	return false
+}
+
+// ejectCard unmounts and ejects the card at mount so it can be pulled out.
+func ejectCard(ctx context.Context, mount string) error {
+	if runtime.GOOS != "darwin" {
+		return fmt.Errorf("ejecting is only supported on macOS; unmount %s yourself", mount)
+	}
+	out, err := exec.CommandContext(ctx, "diskutil", "eject", mount).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("diskutil eject: %s", strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func linuxVolumeUUID(mount string) (string, error) {
+	device := mountDevice(mount)
+	if device == "" {
+		return "", fmt.Errorf("%s is not a mount point", mount)
+	}
+
+	entries, err := os.ReadDir("/dev/disk/by-uuid")
+	if err != nil {
+		return "", err
+	}
+	for _, e := range entries {
+		target, err := filepath.EvalSymlinks(filepath.Join("/dev/disk/by-uuid", e.Name()))
+		if err == nil && target == device {
+			return "uuid:" + e.Name(), nil
+		}
+	}
+	return "", fmt.Errorf("no UUID found for %s", device)
+}
+
+// cardMemory ties a run to the catalog's per-card records. It filters jobs for
+// -incremental runs and, afterwards, records how far each card was offloaded.
+type cardMemory struct {
+	incremental bool
+	mu          sync.Mutex
+	cards       map[string]*cardState // mount -> state; absent if unidentifiable
+}
+
+type cardState struct {
+	id      string
+	since   time.Time // files modified after this are new
+	newest  time.Time
+	newFile string
+}
+
+// newCardMemory fingerprints each mount and loads what the catalog knows.
+// Cards that cannot be identified are imported in full.
+func newCardMemory(ctx context.Context, cfg *Config, mounts []string, incremental bool) *cardMemory {
+	m := &cardMemory{incremental: incremental, cards: map[string]*cardState{}}
+	catalog, err := readCatalog(cfg)
+	if err != nil {
+		slog.Warn("Card memory unavailable", "error", err)
+		return m
+	}
+	for _, mount := range mounts {
+		id, err := cardFingerprint(ctx, mount)
+		if err != nil {
+			if incremental {
+				slog.Warn("Cannot identify card; importing everything", "mount", mount, "error", err)
+			}
+			continue
+		}
+		st := &cardState{id: id}
+		if rec := catalog.Cards[id]; rec != nil && incremental {
+			st.since = rec.LastModTime
+			slog.Info("Incremental import", "mount", mount, "card", id, "last_file", rec.LastFile, "since", rec.LastModTime)
+		}
+		m.cards[mount] = st
+	}
+	return m
+}
+
+// ids returns the fingerprints of the identified cards, for the run journal.
+func (m *cardMemory) ids() []string {
+	var ids []string
+	for _, st := range m.cards {
+		ids = append(ids, st.id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// include is a TransferOptions.Include filter. It also tracks the newest file
+// seen per card so remember can advance the high-water mark.
+func (m *cardMemory) include(job TransferJob) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.cards[job.SourceRoot]
+	if st == nil {
+		return true
+	}
+	if m.incremental && !st.since.IsZero() && !job.ModTime.After(st.since) {
+		return false
+	}
+	if job.ModTime.After(st.newest) {
+		st.newest = job.ModTime
+		st.newFile, _ = filepath.Rel(job.SourceRoot, job.SourcePath)
+	}
+	return true
+}
+
+// remember records the run in the catalog. The high-water mark only moves
+// after a clean run, so files that failed are picked up by the next
+// incremental offload.
+func (m *cardMemory) remember(cfg *Config, shoot string, ok bool) {
+	if len(m.cards) == 0 {
+		return
+	}
+	err := updateCatalog(cfg, func(c *catalogData) error {
+		now := time.Now()
+		for mount, st := range m.cards {
+			rec := c.Cards[st.id]
+			if rec == nil {
+				rec = &cardRecord{FirstSeen: now}
+				c.Cards[st.id] = rec
+			}
+			rec.Label = filepath.Base(mount)
+			rec.LastImport = now
+			rec.LastShoot = shoot
+			rec.Imports++
+			if ok && st.newest.After(rec.LastModTime) {
+				rec.LastModTime = st.newest
+				rec.LastFile = st.newFile
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("Failed to update card catalog", "error", err)
+	}
+}
+
+// importMarkerName is written to the card root after a clean import.
+const importMarkerName = ".snapvault_imported"
+
+// writeImportMarker leaves a note on the card that it has been archived, so
+// whoever picks it up next knows it is safe to format. It is only written for
+// runs where every file reached every share (r.allCopied).
+func writeImportMarker(mount string, r *transferReport) error {
+	var b strings.Builder
+	b.WriteString("This card was imported by SnapVault and copied to every destination.\n\n")
+	fmt.Fprintf(&b, "shoot:        %s\n", r.FolderName)
+	fmt.Fprintf(&b, "imported_at:  %s\n", time.Now().Format(time.RFC3339))
+	if host, err := os.Hostname(); err == nil {
+		fmt.Fprintf(&b, "machine:      %s\n", host)
+	}
+	fmt.Fprintf(&b, "files:        %d\n", r.Completed)
+	fmt.Fprintf(&b, "bytes:        %d\n", r.Bytes)
+	b.WriteString("destinations:\n")
+	for _, sr := range r.Shares {
+		fmt.Fprintf(&b, "  - %s (%d files)\n", sr.Share, sr.Files)
+	}
+	if err := os.WriteFile(filepath.Join(mount, importMarkerName), []byte(b.String()), 0o644); err != nil {
+		return fmt.Errorf("writing import marker: %w", err)
+	}
+	return nil
+}
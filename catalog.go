@@ -0,0 +1,85 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// catalogData is SnapVault's persistent memory across runs, stored as
+// catalog.json in the state dir.
+type catalogData struct {
+	Cards map[string]*cardRecord `json:"cards"`
+	// Placements records which member of an overflow group holds each file,
+	// keyed by group and then by path below the share's base path.
+	Placements map[string]map[string]*placementRecord `json:"placements,omitempty"`
+	// Encrypted maps the files on encrypted shares to the random names they
+	// are stored under, keyed by share and then by path below the share's
+	// base path.
+	Encrypted map[string]map[string]string `json:"encrypted,omitempty"`
+}
+
+// placementRecord is where one file of an overflow group landed.
+type placementRecord struct {
+	Share    string    `json:"share"`
+	ShareKey string    `json:"shareKey"`
+	Stored   time.Time `json:"stored"`
+}
+
+// cardRecord remembers one physical card, keyed by its volume fingerprint.
+type cardRecord struct {
+	Label      string    `json:"label"`
+	FirstSeen  time.Time `json:"firstSeen"`
+	LastImport time.Time `json:"lastImport"`
+	LastShoot  string    `json:"lastShoot"`
+	Imports    int       `json:"imports"`
+	// LastFile and LastModTime mark the newest file of the last fully
+	// successful offload; -incremental imports only files after it.
+	LastFile    string    `json:"lastFile,omitempty"`
+	LastModTime time.Time `json:"lastModTime,omitempty"`
+}
+
+var catalogMu sync.Mutex
+
+// errSkipCatalogSave lets an updateCatalog callback read without writing.
+var errSkipCatalogSave = errors.New("catalog unchanged")
+
+// readCatalog returns a snapshot of the catalog.
+func readCatalog(cfg *Config) (*catalogData, error) {
+	var data *catalogData
+	err := updateCatalog(cfg, func(c *catalogData) error {
+		data = c
+		return errSkipCatalogSave
+	})
+	if errors.Is(err, errSkipCatalogSave) {
+		err = nil
+	}
+	return data, err
+}
+
+// updateCatalog loads the catalog, applies fn and saves the result, holding a
+// lock so concurrent jobs in one process never lose each other's updates.
+// fn may return errSkipCatalogSave to leave the file untouched.
+func updateCatalog(cfg *Config, fn func(c *catalogData) error) error {
+	dir, err := resolveStateDir(cfg)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "catalog.json")
+
+	catalogMu.Lock()
+	defer catalogMu.Unlock()
+
+	data := &catalogData{}
+	if err := readStateFile(path, data); err != nil {
+		return err
+	}
+	if data.Cards == nil {
+		data.Cards = map[string]*cardRecord{}
+	}
+	if err := fn(data); err != nil {
+		return err
+	}
+	return writeStateFile(path, data)
+}
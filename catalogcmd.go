@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runCatalogCommand implements `snapvault catalog export|prune`.
+func runCatalogCommand(args []string) int {
+	if len(args) > 0 {
+		switch args[0] {
+		case "export":
+			return runCatalogExport(args[1:])
+		case "prune":
+			return runCatalogPrune(args[1:])
+		}
+	}
+	fmt.Fprintln(os.Stderr, "Usage: snapvault catalog export [-format csv|json] [-o file]")
+	fmt.Fprintln(os.Stderr, "       snapvault catalog prune [-older-than 5y] [-deleted] [-dry-run] [-yes]")
+	return 2
+}
+
+// catalogExport is the layout of `catalog export -format json`: the card
+// catalog plus every run journal.
+type catalogExport struct {
+	Exported   time.Time                              `json:"exported"`
+	Cards      map[string]*cardRecord                 `json:"cards"`
+	Placements map[string]map[string]*placementRecord `json:"placements,omitempty"`
+	Encrypted  map[string]map[string]string           `json:"encrypted,omitempty"`
+	Runs       []*runJournal                          `json:"runs"`
+}
+
+var catalogExportHeader = []string{"run", "imported", "shoot", "share", "path", "size", "algorithm", "checksum", "source", "cards", "undone"}
+
+func runCatalogExport(args []string) int {
+	fs := flag.NewFlagSet("catalog export", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	format := fs.String("format", "csv", "Output format: csv (one row per copy) or json (everything)")
+	out := fs.String("o", "", "Write to this file instead of stdout")
+	fs.Parse(args)
+	if *format != "csv" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "-format must be csv or json, got %q\n", *format)
+		return 2
+	}
+
+	config, err := loadConfig(*common.configPath, *common.profile, *common.overrides)
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return 1
+	}
+	journals, err := loadJournals(config)
+	if err != nil {
+		slog.Error("Failed to read run journals", "error", err)
+		return 1
+	}
+	catalog, err := readCatalog(config)
+	if err != nil {
+		slog.Error("Failed to read catalog", "error", err)
+		return 1
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			slog.Error("Failed to create export file", "error", err)
+			return 1
+		}
+		defer f.Close()
+		w = f
+	}
+	if *format == "json" {
+		err = writeCatalogJSON(w, catalog, journals)
+	} else {
+		err = writeCatalogCSV(w, journals)
+	}
+	if err != nil {
+		slog.Error("Failed to export catalog", "error", err)
+		return 1
+	}
+	return 0
+}
+
+func writeCatalogJSON(w io.Writer, catalog *catalogData, journals []*runJournal) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(catalogExport{
+		Exported:   time.Now().UTC(),
+		Cards:      catalog.Cards,
+		Placements: catalog.Placements,
+		Encrypted:  catalog.Encrypted,
+		Runs:       journals,
+	})
+}
+
+// writeCatalogCSV writes one row per copy, oldest run first, for
+// spreadsheets and asset managers.
+func writeCatalogCSV(w io.Writer, journals []*runJournal) error {
+	cw := csv.NewWriter(w)
+	cw.Write(catalogExportHeader)
+	for i := len(journals) - 1; i >= 0; i-- {
+		j := journals[i]
+		undone := ""
+		if j.Undone != nil {
+			undone = j.Undone.UTC().Format(time.RFC3339)
+		}
+		for _, f := range j.Files {
+			cw.Write([]string{
+				j.ID, j.StartedAt.UTC().Format(time.RFC3339), j.Folder, f.Share, f.Path,
+				strconv.FormatInt(f.Size, 10), f.SumAlg, f.Sum, f.Source, strings.Join(j.Cards, ";"), undone,
+			})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func runCatalogPrune(args []string) int {
+	fs := flag.NewFlagSet("catalog prune", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	olderThan := fs.String("older-than", "", `Forget runs, cards and placements older than this, e.g. "5y", "180d" or "720h"`)
+	deleted := fs.Bool("deleted", false, "Forget shoots whose folder is gone from every share that received it (connects to the shares)")
+	dryRun := fs.Bool("dry-run", false, "Show what would be forgotten without changing anything")
+	yes := fs.Bool("yes", false, "Do not ask for confirmation")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault catalog prune [-older-than 5y] [-deleted] [-dry-run] [-yes]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var cutoff time.Time
+	if *olderThan != "" {
+		var err error
+		if cutoff, err = parseAge(*olderThan); err != nil {
+			fmt.Fprintf(os.Stderr, "-older-than: %v\n", err)
+			return 2
+		}
+	}
+	if cutoff.IsZero() && !*deleted {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	var (
+		config      *Config
+		connections []*SMBConnection
+		err         error
+	)
+	if *deleted {
+		config, connections, err = common.connectAll(ctx)
+		if err != nil {
+			slog.Error("Failed to connect to shares", "error", err)
+			return 1
+		}
+		defer closeConnections(connections)
+	} else if config, err = loadConfig(*common.configPath, *common.profile, *common.overrides); err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return 1
+	}
+	journals, err := loadJournals(config)
+	if err != nil {
+		slog.Error("Failed to read run journals", "error", err)
+		return 1
+	}
+
+	var gone map[string]bool
+	if *deleted {
+		gone = deletedShoots(ctx, journals, connections)
+		if ctx.Err() != nil {
+			return 130
+		}
+	}
+	var runs []*runJournal
+	for _, j := range journals {
+		if gone[j.Folder] || (!cutoff.IsZero() && j.StartedAt.Before(cutoff)) {
+			runs = append(runs, j)
+		}
+	}
+
+	// Count on a snapshot first, so the plan can be shown before anything
+	// changes.
+	snapshot, err := readCatalog(config)
+	if err != nil {
+		slog.Error("Failed to read catalog", "error", err)
+		return 1
+	}
+	cards, placements := pruneCatalog(snapshot, cutoff, gone)
+	printPrunePlan(runs, cards, placements, gone)
+	if *dryRun || len(runs)+cards+placements == 0 {
+		return 0
+	}
+	if !*yes && !confirm("Forget these? Files on the shares are not touched.") {
+		fmt.Println("Aborted.")
+		return 1
+	}
+
+	if cards+placements > 0 {
+		err := updateCatalog(config, func(c *catalogData) error {
+			pruneCatalog(c, cutoff, gone)
+			return nil
+		})
+		if err != nil {
+			slog.Error("Failed to prune catalog", "error", err)
+			return 1
+		}
+	}
+	removed := 0
+	for _, j := range runs {
+		if err := os.Remove(j.path); err != nil {
+			slog.Warn("Failed to remove journal", "run", j.ID, "error", err)
+			continue
+		}
+		removed++
+	}
+	if len(gone) > 0 {
+		if err := forgetSequences(config, gone); err != nil {
+			slog.Warn("Failed to prune sequence counters", "error", err)
+		}
+	}
+	fmt.Printf("Forgot %d runs, %d cards and %d placements.\n", removed, cards, placements)
+	return 0
+}
+
+// parseAge turns "5y", "180d" or a Go duration into the cutoff time that far
+// back from now.
+func parseAge(s string) (time.Time, error) {
+	now := time.Now()
+	if n, err := strconv.Atoi(strings.TrimSuffix(s, "y")); err == nil && strings.HasSuffix(s, "y") && n > 0 {
+		return now.AddDate(-n, 0, 0), nil
+	}
+	if n, err := strconv.Atoi(strings.TrimSuffix(s, "d")); err == nil && strings.HasSuffix(s, "d") && n > 0 {
+		return now.AddDate(0, 0, -n), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("want a positive age like 5y, 180d or 720h, got %q", s)
+	}
+	return now.Add(-d), nil
+}
+
+// deletedShoots returns the shoot folders that are missing from every
+// connected share their runs copied to. Shoots that landed only on shares
+// not in the config are kept, since there is no way to look.
+func deletedShoots(ctx context.Context, journals []*runJournal, connections []*SMBConnection) map[string]bool {
+	byKey := map[string]*SMBConnection{}
+	for _, conn := range connections {
+		byKey[smbShareKey(conn.Config)] = conn
+	}
+	shares := map[string]map[string]bool{} // shoot -> share keys
+	for _, j := range journals {
+		if shares[j.Folder] == nil {
+			shares[j.Folder] = map[string]bool{}
+		}
+		for _, f := range j.Files {
+			shares[j.Folder][f.ShareKey] = true
+		}
+	}
+
+	gone := map[string]bool{}
+	for shoot, keys := range shares {
+		if ctx.Err() != nil {
+			return gone
+		}
+		looked, present := false, false
+		for key := range keys {
+			conn := byKey[key]
+			if conn == nil {
+				continue
+			}
+			looked = true
+			if conn.cloud != nil {
+				if ok, _ := conn.cloud.exists(ctx, shootRoot(conn, shoot)); ok {
+					present = true
+					break
+				}
+				continue
+			}
+			if _, err := conn.Share.WithContext(ctx).Stat(shootRoot(conn, shoot)); err == nil {
+				present = true
+				break
+			}
+		}
+		if looked && !present {
+			gone[shoot] = true
+		}
+	}
+	return gone
+}
+
+// pruneCatalog removes cards not imported since cutoff and placements stored
+// before it or belonging to a gone shoot, and returns how many of each.
+func pruneCatalog(c *catalogData, cutoff time.Time, gone map[string]bool) (cards, placements int) {
+	if !cutoff.IsZero() {
+		for id, rec := range c.Cards {
+			if rec.LastImport.Before(cutoff) {
+				delete(c.Cards, id)
+				cards++
+			}
+		}
+	}
+	for group, files := range c.Placements {
+		for rel, p := range files {
+			shoot, _, _ := strings.Cut(rel, "/")
+			if gone[shoot] || (!cutoff.IsZero() && p.Stored.Before(cutoff)) {
+				delete(files, rel)
+				placements++
+			}
+		}
+		if len(files) == 0 {
+			delete(c.Placements, group)
+		}
+	}
+	return cards, placements
+}
+
+// forgetSequences drops the file name counters of deleted shoots.
+func forgetSequences(cfg *Config, gone map[string]bool) error {
+	dir, err := resolveStateDir(cfg)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "sequences.json")
+	sequenceMu.Lock()
+	defer sequenceMu.Unlock()
+	store := map[string]*shootSequence{}
+	if err := readStateFile(path, &store); err != nil {
+		return err
+	}
+	changed := false
+	for shoot := range gone {
+		if _, ok := store[shoot]; ok {
+			delete(store, shoot)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return writeStateFile(path, store)
+}
+
+func printPrunePlan(runs []*runJournal, cards, placements int, gone map[string]bool) {
+	shoots := make([]string, 0, len(gone))
+	for shoot := range gone {
+		shoots = append(shoots, shoot)
+	}
+	sort.Strings(shoots)
+	for _, shoot := range shoots {
+		fmt.Printf("deleted shoot %s\n", shoot)
+	}
+	for _, j := range runs {
+		fmt.Printf("run %s  %s  %s  %d files\n", j.ID, j.StartedAt.Format("2006-01-02"), j.Folder, len(j.Files))
+	}
+	fmt.Printf("%d runs, %d cards and %d placements to forget.\n", len(runs), cards, placements)
+}
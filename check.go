@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// runCheckCommand compares one shoot folder across all shares and prints
+// what differs, without changing anything.
+func runCheckCommand(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	name := fs.String("name", "", `Shoot folder to check, as it appears on the shares (e.g. "2025 - Smith Wedding")`)
+	hashed := fs.Bool("hash", false, "Also compare file contents: hash every copy and verify checksum manifests (reads all files over the network)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault check -name <shoot folder> [-hash]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	folder := strings.TrimSpace(*name)
+	if folder == "" {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	config, connections, err := common.connectAll(ctx)
+	if err != nil {
+		slog.Error("Failed to connect to shares", "error", err)
+		return 1
+	}
+	defer closeConnections(connections)
+
+	alg, err := normalizeHashAlgorithm(config.HashAlgorithm)
+	if err != nil {
+		slog.Error("Invalid config", "error", err)
+		return 1
+	}
+	invs, err := inventoryAll(ctx, connections, folder)
+	if err != nil {
+		slog.Error("Failed to list shoot folder", "error", err)
+		return 1
+	}
+	verdicts, err := compareInventories(ctx, invs, compareOptions{Manifest: *hashed, CrossHash: *hashed, Alg: alg})
+	if err != nil {
+		slog.Error("Failed to compare shares", "error", err)
+		return 1
+	}
+
+	labels := make([]string, len(invs))
+	for i, inv := range invs {
+		labels[i] = shareLabel(inv.conn.Config)
+		fmt.Printf("%-32s %6d files\n", labels[i], len(inv.files))
+	}
+	fmt.Println()
+
+	names := func(idx []int) string {
+		out := make([]string, 0, len(idx))
+		for _, i := range idx {
+			out = append(out, labels[i])
+		}
+		return strings.Join(out, ", ")
+	}
+
+	issues := 0
+	for _, v := range verdicts {
+		if v.healthy() {
+			continue
+		}
+		issues++
+		if len(v.Missing) > 0 {
+			fmt.Printf("MISSING   %s\n          absent on: %s\n          present on: %s\n", v.Path, names(v.Missing), names(presentOn(invs, v.Path)))
+		}
+		corrupt := make([]int, 0, len(v.Corrupt))
+		for i := range v.Corrupt {
+			corrupt = append(corrupt, i)
+		}
+		sort.Ints(corrupt)
+		for _, i := range corrupt {
+			kind := "SIZE"
+			if !strings.HasPrefix(v.Corrupt[i], "size") {
+				kind = "CONTENT"
+			}
+			fmt.Printf("%-9s %s\n          on %s: %s\n", kind, v.Path, labels[i], v.Corrupt[i])
+		}
+	}
+
+	if len(verdicts) == 0 {
+		fmt.Printf("No files found under %q on any share; check the folder name.\n", folder)
+		return 1
+	}
+	if issues == 0 {
+		fmt.Printf("All %d files are consistent across %d shares.\n", len(verdicts), len(invs))
+		return 0
+	}
+	fmt.Printf("\n%d of %d files differ. Run `snapvault repair -name %q` to fix them from a good copy.\n", issues, len(verdicts), folder)
+	return 1
+}
+
+func presentOn(invs []*shareInventory, rel string) []int {
+	var idx []int
+	for i, inv := range invs {
+		if _, ok := inv.files[rel]; ok {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// ChunkedUploadConfig makes copies of large videos resumable.
+type ChunkedUploadConfig struct {
+	// MinSize is the smallest video copied in chunks, like "1GB" (default).
+	MinSize string `yaml:"min_size,omitempty"`
+	// ChunkSize is how much is written between two checkpoints, like "64MB"
+	// (default).
+	ChunkSize string `yaml:"chunk_size,omitempty"`
+}
+
+const (
+	defaultChunkedMinSize = 1 << 30
+	defaultChunkSize      = 64 << 20
+)
+
+// partialUploadSuffix marks a chunked copy that isn't complete yet. It is
+// renamed to the real name once the last chunk is written, so an
+// interrupted copy never passes for a real file.
+const partialUploadSuffix = ".snapvault-part"
+
+func isPartialUpload(name string) bool {
+	return strings.HasSuffix(name, partialUploadSuffix)
+}
+
+// chunkedUploads is the parsed chunked_uploads setting, shared by every
+// connection.
+type chunkedUploads struct {
+	minSize   int64
+	chunkSize int64
+	dir       string // the state directory's uploads/
+}
+
+// newChunkedUploads returns nil when chunked uploads are off. Like a missing
+// run journal, an unusable state directory turns them off rather than
+// blocking the import.
+func newChunkedUploads(cfg *Config) (*chunkedUploads, error) {
+	uc := cfg.ChunkedUploads
+	if uc == nil {
+		return nil, nil
+	}
+	c := &chunkedUploads{minSize: defaultChunkedMinSize, chunkSize: defaultChunkSize}
+	var err error
+	if uc.MinSize != "" {
+		if c.minSize, err = parseByteSize(uc.MinSize); err != nil {
+			return nil, fmt.Errorf("chunked_uploads: min_size: %w", err)
+		}
+	}
+	if uc.ChunkSize != "" {
+		if c.chunkSize, err = parseByteSize(uc.ChunkSize); err != nil {
+			return nil, fmt.Errorf("chunked_uploads: chunk_size: %w", err)
+		}
+		if c.chunkSize <= 0 {
+			return nil, fmt.Errorf("chunked_uploads: chunk_size must be positive")
+		}
+	}
+	dir, err := resolveStateDir(cfg)
+	if err == nil {
+		dir = filepath.Join(dir, "uploads")
+		err = os.MkdirAll(dir, 0o700)
+	}
+	if err != nil {
+		slog.Warn("Chunked uploads disabled", "error", err)
+		return nil, nil
+	}
+	c.dir = dir
+	return c, nil
+}
+
+// applies reports whether sourcePath, of size bytes, is copied in chunks.
+func (c *chunkedUploads) applies(sourcePath string, size int64) bool {
+	return c != nil && size >= c.minSize && videoExtensions[strings.ToLower(filepath.Ext(sourcePath))]
+}
+
+// chunkedUpload is the upload journal of one chunked copy, kept in the state
+// directory's uploads/ until the copy is complete. It records the checksum
+// of every chunk written so far.
+type chunkedUpload struct {
+	Share     string    `json:"share"` // smbShareKey
+	Path      string    `json:"path"`
+	Source    string    `json:"source"`
+	Size      int64     `json:"size"`
+	ModTime   time.Time `json:"modTime"`
+	ChunkSize int64     `json:"chunkSize"`
+	Algorithm string    `json:"algorithm"`
+	Chunks    []string  `json:"chunks"`
+}
+
+// sameCopy reports whether u and o are the same file going to the same place.
+func (u chunkedUpload) sameCopy(o chunkedUpload) bool {
+	return u.Share == o.Share && u.Path == o.Path && u.Source == o.Source && u.Size == o.Size &&
+		u.ModTime.Equal(o.ModTime) && u.ChunkSize == o.ChunkSize && u.Algorithm == o.Algorithm
+}
+
+// chunkRange is the offset and length of chunk i.
+func (u chunkedUpload) chunkRange(i int) (int64, int64) {
+	off := int64(i) * u.ChunkSize
+	n := u.Size - off
+	if n > u.ChunkSize {
+		n = u.ChunkSize
+	}
+	return off, n
+}
+
+// copyFileChunked is copyFileToSMB for large videos. It writes to a partial
+// file and journals each chunk's checksum, so a copy cut off by a dropped
+// connection, a file_timeout or Ctrl+C carries on from the last good chunk
+// the next time instead of starting over.
+func copyFileChunked(ctx context.Context, sourcePath string, info os.FileInfo, conn *SMBConnection, destPath string, h hash.Hash) (int64, error) {
+	fs := conn.Share.WithContext(ctx)
+	destPath = filepath.ToSlash(destPath)
+	partPath := destPath + partialUploadSuffix
+
+	want := chunkedUpload{
+		Share:     smbShareKey(conn.Config),
+		Path:      destPath,
+		Source:    sourcePath,
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		ChunkSize: conn.chunks.chunkSize,
+		Algorithm: conn.hashAlg,
+	}
+	key := sha256.Sum256([]byte(want.Share + "\x00" + destPath))
+	statePath := filepath.Join(conn.chunks.dir, hex.EncodeToString(key[:8])+".json")
+	var up chunkedUpload
+	if err := readStateFile(statePath, &up); err != nil || !up.sameCopy(want) {
+		up = want
+	}
+
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return 0, fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
+	}
+	defer src.Close()
+	dst, err := fs.OpenFile(partPath, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return 0, fmt.Errorf("creating destination file: %w", err)
+	}
+	defer dst.Close()
+
+	up.Chunks = up.Chunks[:goodChunks(ctx, &up, src, dst, h)]
+	offset, _ := up.chunkRange(len(up.Chunks))
+	if offset > 0 {
+		slog.Info("Resuming upload", "file", filepath.Base(sourcePath), "share", shareLabel(conn.Config),
+			"from", formatBytes(offset), "of", formatBytes(up.Size))
+	}
+	if err := dst.Truncate(offset); err != nil {
+		return 0, fmt.Errorf("truncating partial copy: %w", err)
+	}
+	if _, err := dst.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("seeking partial copy: %w", err)
+	}
+	if _, err := src.Seek(offset, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("%w: seeking source file: %w", errSourceRead, err)
+	}
+
+	w := conn.limiter.writer(ctx, dst)
+	r := contextReader{ctx, sourceReader{src}}
+	for i := len(up.Chunks); ; i++ {
+		off, n := up.chunkRange(i)
+		if n <= 0 {
+			break
+		}
+		sum := newHasher(up.Algorithm)
+		written, err := io.CopyN(io.MultiWriter(w, h, sum), r, n)
+		if err == nil {
+			// The chunk only counts once the server has it.
+			err = dst.Sync()
+		}
+		if err != nil {
+			if errors.Is(err, errSourceRead) {
+				// The card is the problem; a later run can't resume from it.
+				dst.Close()
+				removePartial(conn.Share, partPath)
+				os.Remove(statePath)
+			}
+			return off + written, fmt.Errorf("copying data: %w", err)
+		}
+		up.Chunks = append(up.Chunks, hex.EncodeToString(sum.Sum(nil)))
+		if err := writeStateFile(statePath, up); err != nil {
+			slog.Debug("Failed to journal upload chunk", "path", destPath, "error", err)
+		}
+	}
+
+	if err := dst.Close(); err != nil {
+		return up.Size, fmt.Errorf("closing destination file: %w", err)
+	}
+	// Rename doesn't replace, and a plain copy would have overwritten.
+	if err := fs.Remove(destPath); err != nil && !os.IsNotExist(err) {
+		return up.Size, fmt.Errorf("replacing %s: %w", path.Base(destPath), err)
+	}
+	if err := fs.Rename(partPath, destPath); err != nil {
+		return up.Size, fmt.Errorf("renaming partial copy: %w", err)
+	}
+	if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+		slog.Debug("Failed to remove upload journal", "path", statePath, "error", err)
+	}
+	return up.Size, nil
+}
+
+// goodChunks returns how many of up's journaled chunks can be kept. The last
+// one on the share is read back and checked, going back further while it
+// doesn't match, and the source is re-read up to there, both to feed h and
+// to make sure it hasn't changed since.
+func goodChunks(ctx context.Context, up *chunkedUpload, src *os.File, dst *smb2.File, h hash.Hash) int {
+	n := len(up.Chunks)
+	if n == 0 {
+		return 0
+	}
+	info, err := dst.Stat()
+	if err != nil {
+		return 0
+	}
+	for n > 0 {
+		if off, size := up.chunkRange(n - 1); off+size <= info.Size() {
+			break
+		}
+		n--
+	}
+	for ; n > 0; n-- {
+		off, size := up.chunkRange(n - 1)
+		sum := newHasher(up.Algorithm)
+		if _, err := io.Copy(sum, contextReader{ctx, io.NewSectionReader(dst, off, size)}); err != nil {
+			return 0
+		}
+		if hex.EncodeToString(sum.Sum(nil)) == up.Chunks[n-1] {
+			break
+		}
+	}
+	for i := 0; i < n; i++ {
+		off, size := up.chunkRange(i)
+		sum := newHasher(up.Algorithm)
+		if _, err := io.Copy(io.MultiWriter(sum, h), contextReader{ctx, io.NewSectionReader(src, off, size)}); err != nil ||
+			hex.EncodeToString(sum.Sum(nil)) != up.Chunks[i] {
+			h.Reset()
+			return 0
+		}
+	}
+	return n
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+)
+
+// cloudRemote is a destination that isn't an SMB share: an rclone remote,
+// Google Drive, Azure Blob Storage, Backblaze B2, a mounted directory or an FTP server. It only receives copies; paths are slash-separated and
+// relative to its root, as shootRoot builds them.
+type cloudRemote interface {
+	// kind names the destination type in logs and errors, e.g. "rclone".
+	kind() string
+	transfer(ctx context.Context, sourcePath, destPath string, conn *SMBConnection) (copyResult, error)
+	// exists reports whether the file or folder p is on the remote.
+	exists(ctx context.Context, p string) (bool, error)
+	remove(ctx context.Context, p string) error
+}
+
+// isCloud reports whether the share is a cloudRemote rather than an SMB share.
+func (c SMBConfig) isCloud() bool { return c.cloudTypes() > 0 }
+
+// cloudTypes counts the cloud destination types set on the share.
+func (c SMBConfig) cloudTypes() int {
+	n := 0
+	for _, set := range []bool{c.isRclone(), c.GoogleDrive != nil, c.Azure != nil, c.B2 != nil, c.Mount != "", c.FTP != nil} {
+		if set {
+			n++
+		}
+	}
+	return n
+}
+
+// newCloudRemote returns share's remote, or nil for an SMB share.
+func newCloudRemote(ctx context.Context, cfg *Config, share SMBConfig) (cloudRemote, error) {
+	switch {
+	case share.isRclone():
+		return newRcloneRemote(share)
+	case share.GoogleDrive != nil:
+		return newGoogleDrive(ctx, cfg, share)
+	case share.Azure != nil:
+		return newAzureBlob(share)
+	case share.B2 != nil:
+		return newB2Bucket(ctx, share)
+	case share.Mount != "":
+		return newMountedDir(share)
+	case share.FTP != nil:
+		return newFTPRemote(ctx, share)
+	}
+	return nil, nil
+}
+
+// validateCloud checks what every cloud share has in common. Only the copies
+// go to the remote, so the modes that read or rewrite files on a share are
+// refused, as are the SMB login settings.
+func validateCloud(share SMBConfig) error {
+	switch {
+	case share.cloudTypes() > 1:
+		return errors.New("can only be one of rclone, google_drive, azure, b2, mount and ftp")
+	case share.Host != "" || share.Share != "":
+		return errors.New("has no host or share")
+	case share.Password != "" || share.AskPass || share.Keyring:
+		return errors.New("has no SMB login; remove password, ask_pass and keyring")
+	case share.Group != "":
+		return errors.New("cannot be an overflow group member")
+	case share.isPreviewShare():
+		return errors.New("cannot be a preview share")
+	case share.isDeferred():
+		return errors.New("cannot be a deferred share")
+	case share.Archive != "":
+		return errors.New("cannot store archives")
+	case share.Synology != nil:
+		return errors.New("cannot use synology, which needs an SMB share")
+	}
+	return nil
+}
+
+// cloudChunkSize is how much of a file goes in one request to the object
+// stores that take large files in parts. Each worker holds one chunk.
+const cloudChunkSize = 16 << 20
+
+// sendInChunks reads the copy of sourcePath, with the share's edits, in
+// chunks of up to cloudChunkSize and hands each to send in order, saying
+// whether it is the last. A file that fits in one chunk is sent as chunk 0
+// and last, so it can go up in a single request. h is fed every chunk. It
+// returns the number of bytes sent.
+func sendInChunks(ctx context.Context, sourcePath string, conn *SMBConnection, h hash.Hash, send func(i int, chunk []byte, last bool) error) (int64, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", errSourceRead, err)
+	}
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return 0, fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
+	}
+	defer src.Close()
+	r := newJPEGEditReader(contextReader{ctx, sourceReader{src}}, shareJPEGEdit(conn, sourcePath))
+	br := bufio.NewReader(r)
+	buf := make([]byte, cloudChunkSize)
+	var written int64
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(br, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return written, fmt.Errorf("copying data: %w", err)
+		}
+		last := err != nil
+		if !last {
+			if _, perr := br.Peek(1); perr == io.EOF {
+				last = true
+			} else if perr != nil {
+				return written, fmt.Errorf("copying data: %w", perr)
+			}
+		}
+		h.Write(buf[:n])
+		if err := send(i, buf[:n], last); err != nil {
+			return written, fmt.Errorf("copying data: %w", err)
+		}
+		written += int64(n)
+		if last {
+			break
+		}
+	}
+	if written-r.grown != info.Size() {
+		return written, fmt.Errorf("%w: wrote %d bytes, source is %d bytes", errSizeMismatch, written-r.grown, info.Size())
+	}
+	return written, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// subcommands run instead of an import when named as the first argument,
+// e.g. `snapvault repair -name "2025 - Wedding"`. Each parses its own flags
+// and returns the process exit code.
+var subcommands = map[string]func(args []string) int{
+	"bench":        runBenchCommand,
+	"catalog":      runCatalogCommand,
+	"check":        runCheckCommand,
+	"completion":   runCompletionCommand,
+	"config":       runConfigCommand,
+	"decrypt":      runDecryptCommand,
+	"deferred":     runDeferredCommand,
+	"find":         runFindCommand,
+	"google-login": runGoogleLoginCommand,
+	"history":      runHistoryCommand,
+	"init":         runInitCommand,
+	"repair":       runRepairCommand,
+	"replicate":    runReplicateCommand,
+	"sources":      runSourcesCommand,
+	"sync":         runSyncCommand,
+	"undo":         runUndoCommand,
+}
+
+// runSubcommand dispatches os.Args to a subcommand. It reports false when the
+// arguments are an ordinary import invocation.
+func runSubcommand(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	if args[0] == "__complete" {
+		// Hidden helper behind the shell completion scripts.
+		return runCompleteCommand(args[1:]), true
+	}
+	cmd, ok := subcommands[args[0]]
+	if !ok {
+		return 0, false
+	}
+	return cmd(args[1:]), true
+}
+
+// commandContext is cancelled on Ctrl+C or SIGTERM.
+func commandContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+// commonFlags are shared by every subcommand that talks to the shares.
+type commonFlags struct {
+	configPath *string
+	profile    *string
+	timeout    *time.Duration
+	onlyShares *listFlag
+	skipShares *listFlag
+	overrides  *[]string
+	askPass    *listFlag
+	insecure   *bool
+}
+
+func addCommonFlags(fs *flag.FlagSet) commonFlags {
+	c := commonFlags{
+		configPath: fs.String("config", "config.yaml", "Path to SMB config YAML file"),
+		profile:    fs.String("profile", "", "Named profile from the config's profiles: section"),
+		timeout:    fs.Duration("timeout", 30*time.Second, "SMB connection timeout"),
+		onlyShares: &listFlag{},
+		skipShares: &listFlag{},
+		overrides:  &[]string{},
+		askPass:    &listFlag{},
+		insecure:   fs.Bool("insecure-config", false, "Run even though the config holds passwords and other users can read it"),
+	}
+	fs.Var(c.askPass, "ask-pass", "Prompt for share passwords: \"all\" or share names")
+	fs.Func("set", "Override a config value, e.g. -set smb_shares.0.host=10.0.0.5; repeatable", func(v string) error {
+		*c.overrides = append(*c.overrides, v)
+		return nil
+	})
+	fs.Var(c.onlyShares, "only-share", "Use only these shares; repeat or comma-separate")
+	fs.Var(c.skipShares, "skip-share", "Leave these shares out; repeat or comma-separate")
+	return c
+}
+
+// connectAll loads the config and connects to every share. The caller must
+// closeConnections on success.
+func (c commonFlags) connectAll(ctx context.Context) (*Config, []*SMBConnection, error) {
+	if err := checkConfigPermissions(*c.configPath); err != nil {
+		if !*c.insecure {
+			return nil, nil, err
+		}
+		slog.Warn("Using insecure config", "error", err)
+	}
+	config, err := loadConfig(*c.configPath, *c.profile, *c.overrides)
+	if err != nil {
+		return nil, nil, fmt.Errorf("loading config: %w", err)
+	}
+	if len(config.SMBShares) == 0 {
+		return nil, nil, fmt.Errorf("no SMB shares configured")
+	}
+	config.SMBShares, err = selectShares(config.SMBShares, *c.onlyShares, *c.skipShares)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := askPasswords(config.SMBShares, *c.askPass); err != nil {
+		return nil, nil, err
+	}
+	connections, err := establishConnections(ctx, config, *c.timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	return config, connections, nil
+}
+
+// inventoryAll lists the shoot folder on every share.
+func inventoryAll(ctx context.Context, connections []*SMBConnection, folderName string) ([]*shareInventory, error) {
+	invs := make([]*shareInventory, 0, len(connections))
+	for _, conn := range connections {
+		if conn.Config.Group != "" {
+			// Overflow members each hold only part of a shoot, so comparing
+			// them against full copies would flag most files as missing.
+			slog.Info("Skipping overflow group member", "share", shareLabel(conn.Config), "group", conn.Config.Group)
+			continue
+		}
+		if conn.Config.isPreviewShare() {
+			slog.Info("Skipping preview share", "share", shareLabel(conn.Config))
+			continue
+		}
+		if conn.Config.isSelectsShare() {
+			slog.Info("Skipping selects share", "share", shareLabel(conn.Config))
+			continue
+		}
+		if conn.Config.isEncrypted() {
+			slog.Info("Skipping encrypted share", "share", shareLabel(conn.Config))
+			continue
+		}
+		if conn.archives != nil {
+			slog.Info("Skipping archive share", "share", shareLabel(conn.Config))
+			continue
+		}
+		if conn.cloud != nil {
+			slog.Info("Skipping "+conn.cloud.kind()+" share", "share", shareLabel(conn.Config))
+			continue
+		}
+		slog.Info("Listing shoot folder", "share", shareLabel(conn.Config), "folder", folderName)
+		inv, err := inventoryShare(ctx, conn, folderName)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", shareLabel(conn.Config), err)
+		}
+		invs = append(invs, inv)
+	}
+	return invs, nil
+}
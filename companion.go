@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Companion files are what some cameras record next to the images:
+// voice memos named after the photo they annotate, and GPS track logs. They
+// are imported with companion_files.
+const (
+	companionMemo  = "memo"
+	companionTrack = "track"
+)
+
+// companionExtensions maps the extensions of companion files to their kind.
+var companionExtensions = map[string]string{
+	".wav": companionMemo,
+	".gpx": companionTrack,
+	".log": companionTrack,
+}
+
+// isCompanion reports whether path is a voice memo or track log rather than
+// a photo or video.
+func isCompanion(path string) bool {
+	return companionExtensions[strings.ToLower(filepath.Ext(path))] != ""
+}
+
+// importableExtension reports whether files with ext are ever imported, for
+// the staging of network and archive sources, which don't know whether
+// companion_files is on; collectTransferJobs applies that.
+func importableExtension(ext string) bool {
+	ext = strings.ToLower(ext)
+	return photoExtensions[ext] || companionExtensions[ext] != ""
+}
+
+// companionJob makes the job for a companion file, or returns false when the
+// file isn't one after all: a .LOG that holds no GPS fixes. A track log is
+// dated by its first fix, falling back to the modification time.
+func companionJob(job TransferJob) (TransferJob, bool) {
+	if companionExtensions[strings.ToLower(filepath.Ext(job.SourcePath))] != companionTrack {
+		return job, true
+	}
+	first, isTrack := trackLogStart(job.SourcePath)
+	if !isTrack {
+		return job, false
+	}
+	if !first.IsZero() {
+		// Fixes are in UTC; date folders go by local time, like the camera's.
+		job.PhotoDate = first.Local()
+	}
+	return job, true
+}
+
+// trackLogStart returns the time of the first fix in a GPX or NMEA log, and
+// whether the file is a track log at all. GPX files always are; a .LOG is
+// when it holds NMEA sentences.
+func trackLogStart(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+	if strings.EqualFold(filepath.Ext(path), ".gpx") {
+		return gpxStart(f), true
+	}
+	sc := bufio.NewScanner(io.LimitReader(f, 1<<20))
+	isNMEA := false
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if !strings.HasPrefix(line, "$G") {
+			continue
+		}
+		isNMEA = true
+		if t, ok := nmeaRMCTime(line); ok {
+			return t, true
+		}
+	}
+	return time.Time{}, isNMEA
+}
+
+// gpxStart is the first <time> in a GPX file, or zero without one.
+func gpxStart(r io.Reader) time.Time {
+	dec := xml.NewDecoder(io.LimitReader(r, 4<<20))
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return time.Time{}
+		}
+		if se, ok := tok.(xml.StartElement); ok && se.Name.Local == "time" {
+			var s string
+			if dec.DecodeElement(&s, &se) != nil {
+				continue
+			}
+			if t, err := time.Parse(time.RFC3339, strings.TrimSpace(s)); err == nil {
+				return t
+			}
+		}
+	}
+}
+
+// nmeaRMCTime reads the UTC date and time of an RMC sentence, such as
+// $GPRMC,123519,A,4807.038,N,01131.000,E,022.4,084.4,230394,003.1,W*6A.
+func nmeaRMCTime(line string) (time.Time, bool) {
+	if i := strings.IndexByte(line, '*'); i >= 0 {
+		line = line[:i]
+	}
+	fields := strings.Split(line, ",")
+	if len(fields) < 10 || !strings.HasSuffix(fields[0], "RMC") || fields[2] != "A" {
+		return time.Time{}, false
+	}
+	clock := fields[1]
+	if i := strings.IndexByte(clock, '.'); i >= 0 {
+		clock = clock[:i]
+	}
+	t, err := time.Parse("020106 150405", fields[9]+" "+clock)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// pairCompanions dates each voice memo by the photo it was recorded for,
+// the file with the same name in the same folder, and notes that photo in
+// its Companion field. Memos without one keep their own date.
+func pairCompanions(jobs []TransferJob) {
+	photos := map[string]int{}
+	for i, job := range jobs {
+		if !isCompanion(job.SourcePath) {
+			key := strings.ToLower(strings.TrimSuffix(job.SourcePath, filepath.Ext(job.SourcePath)))
+			if _, seen := photos[key]; !seen {
+				photos[key] = i
+			}
+		}
+	}
+	for i, job := range jobs {
+		if companionExtensions[strings.ToLower(filepath.Ext(job.SourcePath))] != companionMemo {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSuffix(job.SourcePath, filepath.Ext(job.SourcePath)))
+		if p, ok := photos[key]; ok {
+			jobs[i].PhotoDate = jobs[p].PhotoDate
+			jobs[i].Companion = jobs[p].SourcePath
+		}
+	}
+}
+
+// placeCompanions puts each paired memo in its photo's folder, under its
+// photo's name, once naming and layout have run.
+func placeCompanions(jobs []TransferJob) {
+	bySource := map[string]int{}
+	for i, job := range jobs {
+		bySource[job.SourcePath] = i
+	}
+	for i, job := range jobs {
+		p, ok := bySource[job.Companion]
+		if job.Companion == "" || !ok {
+			continue
+		}
+		photo := jobs[p]
+		name := photo.DestName
+		if name == "" {
+			name = filepath.Base(photo.SourcePath)
+		}
+		jobs[i].DestDir = photo.DestDir
+		jobs[i].DestName = strings.TrimSuffix(name, filepath.Ext(name)) + filepath.Ext(job.SourcePath)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The shell scripts only forward the words typed so far to the hidden
+// `snapvault __complete` command, so share names, profiles and mounted cards
+// are always read fresh instead of being baked into the script.
+
+// completionFlags lists the flags of the import run ("") and each subcommand.
+// Keep it in step with the flag definitions.
+var (
+	commonCompletionFlags = []string{"-config", "-profile", "-timeout", "-only-share", "-skip-share", "-ask-pass", "-set", "-insecure-config"}
+	completionFlags       = map[string][]string{
+		"": {
+			"-mount", "-auto-mount", "-name", "-config", "-profile", "-set", "-timeout", "-workers", "-serve", "-addr", "-no-open",
+			"-receive-ftp", "-receive-http", "-watch", "-watch-settle", "-source", "-camera", "-similar", "-incremental", "-mark-card", "-quarantine", "-queue", "-yes", "-eject",
+			"-only-share", "-skip-share", "-ask-pass", "-quorum", "-min-rating", "-files-from", "-min-size", "-max-size", "-file-timeout", "-worker-ramp", "-order", "-grpc-addr", "-review-addr", "-insecure-config",
+			"-preserve-structure", "-log-format", "-log-file", "-log-max-size", "-log-max-backups", "-log-level", "-quiet",
+		},
+		"bench":        append([]string{"-size", "-workers", "-ops"}, commonCompletionFlags...),
+		"check":        append([]string{"-name", "-hash"}, commonCompletionFlags...),
+		"repair":       append([]string{"-name", "-deep", "-dry-run"}, commonCompletionFlags...),
+		"undo":         append([]string{"-run", "-name", "-last", "-list", "-dry-run", "-yes"}, commonCompletionFlags...),
+		"history":      append([]string{"-n", "-name", "-card", "-files", "-all", "-remote"}, commonCompletionFlags...),
+		"find":         append([]string{"-all"}, commonCompletionFlags...),
+		"google-login": append([]string{"-share"}, commonCompletionFlags...),
+		"catalog":      append([]string{"-format", "-o", "-older-than", "-deleted", "-dry-run", "-yes"}, commonCompletionFlags...),
+		"config":       {"-config"},
+		"decrypt":      append([]string{"-share", "-name", "-out", "-identity", "-list", "-from"}, commonCompletionFlags...),
+		"deferred":     append([]string{"-list", "-now"}, commonCompletionFlags...),
+		"init":         {"-config", "-timeout"},
+		"sources":      {"-all"},
+		"replicate":    append([]string{"-name", "-since", "-from", "-to", "-dry-run"}, commonCompletionFlags...),
+		"sync":         append([]string{"-dir", "-name", "-delete", "-checksum", "-dry-run", "-yes"}, commonCompletionFlags...),
+	}
+	// completionBoolFlags take no value, so the next word is not theirs.
+	completionBoolFlags = map[string]bool{
+		"-auto-mount": true, "-serve": true, "-no-open": true, "-similar": true, "-incremental": true, "-mark-card": true, "-queue": true, "-eject": true, "-quiet": true,
+		"-preserve-structure": true,
+		"-insecure-config":    true, "-hash": true, "-deep": true, "-dry-run": true, "-last": true, "-list": true, "-yes": true, "-all": true,
+		"-files": true, "-deleted": true, "-now": true, "-remote": true, "-delete": true, "-checksum": true,
+	}
+	completionShells = []string{"bash", "zsh", "fish"}
+)
+
+// runCompletionCommand implements `snapvault completion bash|zsh|fish`.
+func runCompletionCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: snapvault completion bash|zsh|fish")
+		return 2
+	}
+	switch args[0] {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown shell %q; use bash, zsh or fish\n", args[0])
+		return 2
+	}
+	return 0
+}
+
+// runCompleteCommand prints one candidate per line for the last of args,
+// the word under the cursor.
+func runCompleteCommand(args []string) int {
+	for _, c := range completeWords(args) {
+		fmt.Println(c)
+	}
+	return 0
+}
+
+func completeWords(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur, prev := words[len(words)-1], words[:len(words)-1]
+	all := prev
+
+	cmd := ""
+	if len(prev) > 0 && !strings.HasPrefix(prev[0], "-") {
+		cmd, prev = prev[0], prev[1:]
+	}
+	if cmd == "" && len(prev) == 0 && !strings.HasPrefix(cur, "-") {
+		names := make([]string, 0, len(subcommands))
+		for name := range subcommands {
+			names = append(names, name)
+		}
+		return filterPrefix(names, cur)
+	}
+
+	if len(prev) > 0 {
+		if last := normalizeFlag(prev[len(prev)-1]); strings.HasPrefix(last, "-") && !strings.Contains(last, "=") && !completionBoolFlags[last] {
+			return completeFlagValue(last, cur, all)
+		}
+	}
+	if name, value, ok := strings.Cut(cur, "="); ok && strings.HasPrefix(name, "-") {
+		values := completeFlagValue(normalizeFlag(name), value, all)
+		for i, v := range values {
+			values[i] = name + "=" + v
+		}
+		return values
+	}
+
+	switch {
+	case strings.HasPrefix(cur, "-"):
+		return filterPrefix(completionFlags[cmd], normalizeFlag(cur))
+	case cmd == "config" && len(prev) == 0:
+		return filterPrefix([]string{"validate"}, cur)
+	case cmd == "catalog" && len(prev) == 0:
+		return filterPrefix([]string{"export", "prune"}, cur)
+	case cmd == "completion" && len(prev) == 0:
+		return filterPrefix(completionShells, cur)
+	}
+	return nil
+}
+
+func completeFlagValue(flagName, cur string, words []string) []string {
+	switch flagName {
+	case "-config":
+		return completeFiles(cur, ".yaml", ".yml", ".toml", ".json", ".age")
+	case "-quarantine", "-dir", "-out", "-identity":
+		return completeFiles(cur)
+	case "-mount":
+		var paths []string
+		for _, c := range detectMountCandidates() {
+			paths = append(paths, c.Path)
+		}
+		if len(paths) == 0 || strings.Contains(cur, string(filepath.Separator)) && len(filterPrefix(paths, cur)) == 0 {
+			return completeFiles(cur)
+		}
+		return filterPrefix(paths, cur)
+	case "-source":
+		return filterPrefix([]string{"card", "camera"}, cur)
+	case "-log-format":
+		return filterPrefix([]string{"text", "json"}, cur)
+	case "-order":
+		return filterPrefix([]string{orderCard, orderJPEG, orderTwoPhase, orderSmallest}, cur)
+	case "-log-level":
+		return filterPrefix([]string{"debug", "info", "warn", "error"}, cur)
+	case "-log-file", "-o":
+		return completeFiles(cur)
+	case "-format":
+		return filterPrefix([]string{"csv", "json"}, cur)
+	case "-profile":
+		cfg := completionConfig(words, false)
+		if cfg == nil {
+			return nil
+		}
+		var names []string
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		return filterPrefix(names, cur)
+	case "-only-share", "-skip-share", "-ask-pass", "-from", "-to", "-share":
+		cfg := completionConfig(words, true)
+		var names []string
+		if flagName == "-ask-pass" {
+			names = append(names, "all")
+		}
+		if cfg != nil {
+			for _, s := range cfg.SMBShares {
+				names = append(names, shareLabel(s))
+			}
+		}
+		// Complete the last entry of a comma-separated list.
+		done := ""
+		if i := strings.LastIndex(cur, ","); i >= 0 {
+			done, cur = cur[:i+1], cur[i+1:]
+		}
+		out := filterPrefix(dedupeStrings(names), cur)
+		for i := range out {
+			out[i] = done + out[i]
+		}
+		return out
+	}
+	return nil
+}
+
+// completionConfig loads the config named by -config (and, if withProfile,
+// -profile) among the words typed so far. Errors give no candidates.
+func completionConfig(words []string, withProfile bool) *Config {
+	path, profile := "config.yaml", ""
+	for i, w := range words {
+		name, value, hasValue := strings.Cut(normalizeFlag(w), "=")
+		if !hasValue && i+1 < len(words) {
+			value = words[i+1]
+		}
+		switch name {
+		case "-config":
+			path = value
+		case "-profile":
+			profile = value
+		}
+	}
+	if !withProfile {
+		profile = ""
+	}
+	cfg, err := loadConfigFromFile(path, profile, false)
+	if err != nil {
+		return nil
+	}
+	return cfg
+}
+
+// completeFiles lists directories and, when exts are given, the files with
+// one of those extensions whose path starts with cur.
+func completeFiles(cur string, exts ...string) []string {
+	dir, base := filepath.Split(cur)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+	var out []string
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasPrefix(name, base) || (strings.HasPrefix(name, ".") && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if e.IsDir() {
+			out = append(out, dir+name+string(filepath.Separator))
+			continue
+		}
+		if len(exts) == 0 {
+			out = append(out, dir+name)
+			continue
+		}
+		for _, ext := range exts {
+			if strings.HasSuffix(strings.ToLower(name), ext) {
+				out = append(out, dir+name)
+				break
+			}
+		}
+	}
+	return out
+}
+
+// normalizeFlag turns the --flag spelling the flag package also accepts into -flag.
+func normalizeFlag(w string) string {
+	if strings.HasPrefix(w, "--") {
+		return w[1:]
+	}
+	return w
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	var out []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+const bashCompletion = `# bash completion for snapvault; load with: source <(snapvault completion bash)
+_snapvault() {
+    local IFS=$'\n'
+    local cur=${COMP_WORDS[COMP_CWORD]}
+    local words=("${COMP_WORDS[@]:1:COMP_CWORD-1}")
+    COMPREPLY=($(snapvault __complete "${words[@]}" "$cur" 2>/dev/null))
+    if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == */ ]]; then
+        compopt -o nospace
+    fi
+}
+complete -F _snapvault snapvault
+`
+
+const zshCompletion = `#compdef snapvault
+# zsh completion for snapvault; load with: source <(snapvault completion zsh)
+_snapvault() {
+    local -a candidates
+    candidates=("${(@f)$(snapvault __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    candidates=(${candidates:#})
+    local -a dirs files
+    dirs=(${(M)candidates:#*/})
+    files=(${candidates:#*/})
+    (( ${#files} )) && compadd -a files
+    (( ${#dirs} )) && compadd -S '' -a dirs
+}
+compdef _snapvault snapvault
+`
+
+const fishCompletion = `# fish completion for snapvault; load with: snapvault completion fish | source
+function __snapvault_complete
+    set -l words (commandline -opc)[2..-1] (commandline -ct)
+    snapvault __complete $words 2>/dev/null
+end
+complete -c snapvault -f -a '(__snapvault_complete)'
+`
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config files may be YAML, TOML or JSON, picked by extension. TOML and JSON
+// are converted to YAML when read and back when the UIs save, so every
+// setting keeps the same snake_case key in all three formats.
+const (
+	formatYAML = "yaml"
+	formatTOML = "toml"
+	formatJSON = "json"
+)
+
+// configFormat is the syntax of the config at path; an age-encrypted file's
+// ".age" suffix is ignored, so config.toml.age is TOML.
+func configFormat(path string) string {
+	path = strings.TrimSuffix(strings.ToLower(path), ".age")
+	switch filepath.Ext(path) {
+	case ".toml":
+		return formatTOML
+	case ".json":
+		return formatJSON
+	default:
+		return formatYAML
+	}
+}
+
+// configToYAML converts a config file's contents to YAML.
+func configToYAML(format string, data []byte) ([]byte, error) {
+	var tree map[string]any
+	switch format {
+	case formatTOML:
+		if err := toml.Unmarshal(data, &tree); err != nil {
+			return nil, err
+		}
+	case formatJSON:
+		if err := json.Unmarshal(data, &tree); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			return nil, err
+		}
+	default:
+		return data, nil
+	}
+	if tree == nil {
+		return nil, nil
+	}
+	return yaml.Marshal(tree)
+}
+
+// configFromYAML converts YAML produced by saveConfig to the given format.
+func configFromYAML(format string, data []byte) ([]byte, error) {
+	if format == formatYAML {
+		return data, nil
+	}
+	var tree map[string]any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	if format == formatJSON {
+		out, err := json.MarshalIndent(tree, "", "  ")
+		return append(out, '\n'), err
+	}
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(tree); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
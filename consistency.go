@@ -0,0 +1,306 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// shareInventory is what one share holds under a shoot folder.
+type shareInventory struct {
+	conn  *SMBConnection
+	root  string           // share-relative shoot folder, slash-separated
+	files map[string]int64 // path relative to root -> size
+	sums  map[string]manifestEntry
+}
+
+// manifestEntry is a checksum recorded by a folder manifest or sidecar.
+type manifestEntry struct {
+	alg string
+	sum string
+}
+
+// manifestAlgorithms maps manifest file names and sidecar extensions back to
+// the algorithm that produced them.
+var manifestAlgorithms = func() map[string]string {
+	m := map[string]string{}
+	for _, alg := range []string{hashSHA256, hashBLAKE3, hashXXH64} {
+		folder, ext := manifestNames(alg)
+		m[folder] = alg
+		m[ext] = alg
+	}
+	return m
+}()
+
+// isChecksumFile reports whether name is a manifest or sidecar SnapVault writes.
+func isChecksumFile(name string) bool {
+	if _, ok := manifestAlgorithms[name]; ok {
+		return true
+	}
+	_, ok := manifestAlgorithms[path.Ext(name)]
+	return ok && path.Ext(name) != ""
+}
+
+// isShootReport reports whether name, in the root of a shoot folder, is one
+// of the summaries SnapVault writes there. Each share's copy describes what
+// that share received, so they differ between shares by design.
+func isShootReport(name string) bool {
+	return name == galleryFile || name == shootReadmeFile || strings.HasPrefix(name, shootManifestName+".")
+}
+
+// shootRoot is the share-relative folder a shoot was imported into.
+func shootRoot(conn *SMBConnection, folderName string) string {
+	return strings.TrimPrefix(path.Join(strings.ReplaceAll(conn.Config.BasePath, "\\", "/"), folderName), "/")
+}
+
+// inventoryShare lists every file under the shoot folder on one share and
+// reads any checksum manifests it finds there. A missing folder yields an
+// empty inventory, not an error.
+func inventoryShare(ctx context.Context, conn *SMBConnection, folderName string) (*shareInventory, error) {
+	inv := &shareInventory{
+		conn:  conn,
+		root:  shootRoot(conn, folderName),
+		files: map[string]int64{},
+		sums:  map[string]manifestEntry{},
+	}
+	fs := conn.Share.WithContext(ctx)
+	if _, err := fs.Stat(inv.root); err != nil {
+		return inv, nil
+	}
+
+	var walk func(rel string) error
+	walk = func(rel string) error {
+		entries, err := fs.ReadDir(path.Join(inv.root, rel))
+		if err != nil {
+			return fmt.Errorf("listing %s: %w", path.Join(inv.root, rel), err)
+		}
+		for _, e := range entries {
+			child := path.Join(rel, e.Name())
+			if e.IsDir() {
+				if conn.isProxyFolder(child) {
+					continue
+				}
+				if err := walk(child); err != nil {
+					return err
+				}
+				continue
+			}
+			if rel == "" && isShootReport(e.Name()) {
+				continue
+			}
+			if strings.EqualFold(path.Ext(e.Name()), ".xmp") {
+				// Provenance sidecars hold each share's own checksum.
+				continue
+			}
+			if isPartialUpload(e.Name()) {
+				continue
+			}
+			if !isChecksumFile(e.Name()) {
+				inv.files[child] = e.Size()
+				continue
+			}
+			data, err := fs.ReadFile(path.Join(inv.root, child))
+			if err != nil {
+				continue
+			}
+			alg, ok := manifestAlgorithms[e.Name()]
+			if !ok {
+				alg = manifestAlgorithms[path.Ext(e.Name())]
+			}
+			for name, sum := range parseManifest(string(data)) {
+				inv.sums[path.Join(rel, name)] = manifestEntry{alg: alg, sum: sum}
+			}
+		}
+		return nil
+	}
+	if err := walk(""); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// fileVerdict is the state of one relative path across all shares.
+type fileVerdict struct {
+	Path    string
+	Size    int64          // consensus size
+	Good    []int          // inventory indices holding a good copy
+	Missing []int          // indices without the file
+	Corrupt map[int]string // index -> reason
+}
+
+func (v fileVerdict) healthy() bool { return len(v.Missing) == 0 && len(v.Corrupt) == 0 }
+
+// compareOptions selects how hard compareInventories looks.
+type compareOptions struct {
+	// Manifest re-hashes every copy that has a checksum manifest entry and
+	// requires it to match.
+	Manifest bool
+	// CrossHash hashes every copy with Alg and treats copies whose content
+	// differs from the majority as corrupt.
+	CrossHash bool
+	Alg       string
+}
+
+// compareInventories decides, per file, which copies are good. Copies whose
+// size differs from the most common size are corrupt (a tie goes to the
+// larger size, since truncation is the usual failure). The options add
+// content checks, which read every copy over the network.
+func compareInventories(ctx context.Context, invs []*shareInventory, opts compareOptions) ([]fileVerdict, error) {
+	union := map[string]struct{}{}
+	for _, inv := range invs {
+		for rel := range inv.files {
+			union[rel] = struct{}{}
+		}
+	}
+	paths := make([]string, 0, len(union))
+	for rel := range union {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	verdicts := make([]fileVerdict, 0, len(paths))
+	for _, rel := range paths {
+		v := fileVerdict{Path: rel, Corrupt: map[int]string{}}
+		counts := map[int64]int{}
+		for i, inv := range invs {
+			size, ok := inv.files[rel]
+			if !ok {
+				v.Missing = append(v.Missing, i)
+				continue
+			}
+			// Copies with stripped metadata differ from the rest by design.
+			if shareScrub(inv.conn.Config, rel) == scrubNone {
+				counts[size]++
+			}
+		}
+		for size, n := range counts {
+			if n > counts[v.Size] || (n == counts[v.Size] && size > v.Size) {
+				v.Size = size
+			}
+		}
+
+		contentSums := map[int]string{}
+		for i, inv := range invs {
+			size, ok := inv.files[rel]
+			if !ok {
+				continue
+			}
+			scrubbed := shareScrub(inv.conn.Config, rel) != scrubNone
+			if size != v.Size && !scrubbed {
+				v.Corrupt[i] = fmt.Sprintf("size %d, expected %d", size, v.Size)
+				continue
+			}
+			entry, has := inv.sums[rel]
+			if opts.Manifest && has {
+				sum, err := hashShareFile(ctx, inv, rel, entry.alg)
+				if err != nil {
+					return nil, err
+				}
+				if !strings.EqualFold(sum, entry.sum) {
+					v.Corrupt[i] = fmt.Sprintf("%s mismatch against manifest", entry.alg)
+					continue
+				}
+				if entry.alg == opts.Alg && !scrubbed {
+					contentSums[i] = strings.ToLower(sum)
+				}
+			}
+			if opts.CrossHash && !scrubbed {
+				if _, done := contentSums[i]; !done {
+					sum, err := hashShareFile(ctx, inv, rel, opts.Alg)
+					if err != nil {
+						return nil, err
+					}
+					contentSums[i] = sum
+				}
+			}
+			v.Good = append(v.Good, i)
+		}
+
+		if opts.CrossHash && len(contentSums) > 1 {
+			votes := map[string]int{}
+			for _, sum := range contentSums {
+				votes[sum]++
+			}
+			var winner string
+			for sum, n := range votes {
+				if n > votes[winner] || (n == votes[winner] && sum < winner) {
+					winner = sum
+				}
+			}
+			good := v.Good[:0]
+			for _, i := range v.Good {
+				if contentSums[i] != winner {
+					v.Corrupt[i] = "content differs from the other copies"
+					continue
+				}
+				good = append(good, i)
+			}
+			v.Good = good
+		}
+		verdicts = append(verdicts, v)
+	}
+	return verdicts, nil
+}
+
+func hashShareFile(ctx context.Context, inv *shareInventory, rel, alg string) (string, error) {
+	f, err := inv.conn.Share.WithContext(ctx).Open(path.Join(inv.root, rel))
+	if err != nil {
+		return "", fmt.Errorf("opening %s on %s: %w", rel, shareLabel(inv.conn.Config), err)
+	}
+	defer f.Close()
+	h := newHasher(alg)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("reading %s on %s: %w", rel, shareLabel(inv.conn.Config), err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// copyBetweenShares streams rel from one share to another and checks the size.
+// The bytes written are fed to h when it is non-nil.
+func copyBetweenShares(ctx context.Context, from, to *shareInventory, rel string, size int64, h hash.Hash) error {
+	src, err := from.conn.Share.WithContext(ctx).Open(path.Join(from.root, rel))
+	if err != nil {
+		return fmt.Errorf("opening source: %w", err)
+	}
+	defer src.Close()
+
+	destPath := path.Join(to.root, rel)
+	if err := to.conn.mkdirAll(ctx, path.Dir(destPath)); err != nil {
+		return fmt.Errorf("creating directories: %w", err)
+	}
+	dst, err := to.conn.Share.WithContext(ctx).Create(destPath)
+	if err != nil {
+		return fmt.Errorf("creating destination: %w", err)
+	}
+	// Attribution survives on copies read from another share, except where
+	// the target strips all metadata; it is written again after the scrub.
+	edit := jpegEdit{scrub: shareScrub(to.conn.Config, rel)}
+	if edit.scrub == scrubAll {
+		edit.credit = to.conn.attribution
+	}
+	w := to.conn.limiter.writer(ctx, dst)
+	if h != nil {
+		w = io.MultiWriter(w, h)
+	}
+	r := newJPEGEditReader(contextReader{ctx, src}, edit)
+	written, err := io.Copy(w, r)
+	closeErr := dst.Close()
+	if err != nil {
+		if ctx.Err() != nil {
+			removePartial(to.conn.Share, destPath)
+		}
+		return fmt.Errorf("copying data: %w", err)
+	}
+	if closeErr != nil {
+		return fmt.Errorf("closing destination: %w", closeErr)
+	}
+	if written-r.grown != size {
+		return fmt.Errorf("%w: wrote %d bytes, expected %d", errSizeMismatch, written-r.grown, size)
+	}
+	return nil
+}
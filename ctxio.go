@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// contextReader fails the next Read once ctx is done, so copying a 4 GB
+// video stops within one buffer of Ctrl+C instead of running to the end.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// partialCleanupTimeout bounds removing an unfinished copy after the run was
+// cancelled.
+const partialCleanupTimeout = 10 * time.Second
+
+// removePartial deletes an unfinished copy so it can't pass for a real file.
+// It runs on a fresh context, since the copy's own is usually the one that
+// was cancelled.
+func removePartial(fs *smb2.Share, destPath string) {
+	ctx, cancel := context.WithTimeout(context.Background(), partialCleanupTimeout)
+	defer cancel()
+	if err := fs.WithContext(ctx).Remove(destPath); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove partial copy", "path", destPath, "error", err)
+	}
+}
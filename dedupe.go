@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// duplicateFile is a source file skipped because another file on the card
+// has identical content.
+type duplicateFile struct {
+	Path        string
+	DuplicateOf string
+}
+
+// dedupeJobs drops jobs whose content matches an earlier job, comparing size
+// and then a checksum with alg. Only files that share a size are hashed, so the common case costs nothing beyond the walk.
+// Some cameras write protected copies of an image to a second folder; this
+// keeps those from being archived twice. xxh64 is not collision resistant,
+// so with it a matching checksum is confirmed by comparing the files byte
+// for byte. A file that can't be read is dropped and passed to problem,
+// like a damaged file found during the walk, instead of failing the run.
+func dedupeJobs(ctx context.Context, jobs []TransferJob, alg string, problem func(root string, p sourceProblem)) ([]TransferJob, []duplicateFile, error) {
+	bySize := make(map[int64][]int)
+	for i, job := range jobs {
+		bySize[job.Size] = append(bySize[job.Size], i)
+	}
+
+	drop := make(map[int]string)
+	unreadable := make(map[int]bool)
+	for _, idxs := range bySize {
+		if len(idxs) < 2 {
+			continue
+		}
+		seen := make(map[string][]int, len(idxs))
+	next:
+		for _, i := range idxs {
+			if err := ctx.Err(); err != nil {
+				return nil, nil, err
+			}
+			sum, err := hashFile(jobs[i].SourcePath, alg)
+			if err != nil {
+				unreadable[i] = true
+				problem(jobs[i].SourceRoot, sourceProblem{Path: jobs[i].SourcePath, Reason: "unreadable: " + err.Error()})
+				continue
+			}
+			for _, first := range seen[sum] {
+				if alg == hashXXH64 {
+					same, err := sameFiles(jobs[first].SourcePath, jobs[i].SourcePath)
+					if err != nil {
+						unreadable[i] = true
+						problem(jobs[i].SourceRoot, sourceProblem{Path: jobs[i].SourcePath, Reason: "unreadable: " + err.Error()})
+						continue next
+					}
+					if !same {
+						continue
+					}
+				}
+				drop[i] = jobs[first].SourcePath
+				continue next
+			}
+			seen[sum] = append(seen[sum], i)
+		}
+	}
+	if len(drop) == 0 && len(unreadable) == 0 {
+		return jobs, nil, nil
+	}
+
+	kept := make([]TransferJob, 0, len(jobs)-len(drop)-len(unreadable))
+	var dups []duplicateFile
+	for i, job := range jobs {
+		if unreadable[i] {
+			slog.Warn("Skipping unreadable file", "file", job.SourcePath)
+			continue
+		}
+		if orig, ok := drop[i]; ok {
+			slog.Debug("Skipping duplicate file", "file", job.SourcePath, "duplicate_of", orig)
+			dups = append(dups, duplicateFile{Path: job.SourcePath, DuplicateOf: orig})
+			continue
+		}
+		kept = append(kept, job)
+	}
+	return kept, dups, nil
+}
+
+// sameFiles compares two local files byte for byte.
+func sameFiles(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+	bufA, bufB := make([]byte, 1<<20), make([]byte, 1<<20)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		endA := errA == io.EOF || errA == io.ErrUnexpectedEOF
+		endB := errB == io.EOF || errB == io.ErrUnexpectedEOF
+		switch {
+		case errA != nil && !endA:
+			return false, errA
+		case errB != nil && !endB:
+			return false, errB
+		case endA || endB:
+			return endA == endB, nil
+		}
+	}
+}
+
+func hashFile(path, alg string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := newHasher(alg)
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
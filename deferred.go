@@ -0,0 +1,379 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+)
+
+// dailyWindow is a time of day range like "02:00-06:00", as used by a
+// share's deferred and bwlimit_schedule settings. A window may wrap midnight
+// ("22:00-05:00").
+type dailyWindow struct {
+	start, end time.Duration // since midnight
+}
+
+func parseDailyWindow(s string) (dailyWindow, error) {
+	from, to, ok := strings.Cut(strings.ReplaceAll(s, " ", ""), "-")
+	if !ok {
+		return dailyWindow{}, fmt.Errorf("want a window like \"02:00-06:00\", got %q", s)
+	}
+	parse := func(hm string) (time.Duration, error) {
+		t, err := time.Parse("15:04", hm)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a time like 02:00", hm)
+		}
+		return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+	}
+	var w dailyWindow
+	var err error
+	if w.start, err = parse(from); err != nil {
+		return dailyWindow{}, err
+	}
+	if w.end, err = parse(to); err != nil {
+		return dailyWindow{}, err
+	}
+	if w.start == w.end {
+		return dailyWindow{}, fmt.Errorf("window %q is empty", s)
+	}
+	return w, nil
+}
+
+// open reports whether t, in local time, falls inside the window.
+func (w dailyWindow) open(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	now := t.Sub(midnight)
+	if w.start < w.end {
+		return now >= w.start && now < w.end
+	}
+	return now >= w.start || now < w.end
+}
+
+func (c SMBConfig) isDeferred() bool { return c.Deferred != "" }
+
+// splitDeferred separates the shares an import copies to straight away from
+// the deferred ones, which are only queued in the run journal.
+func splitDeferred(shares []SMBConfig) (now, later []SMBConfig) {
+	for _, share := range shares {
+		if share.isDeferred() {
+			later = append(later, share)
+		} else {
+			now = append(now, share)
+		}
+	}
+	return now, later
+}
+
+// deferredCopy is a deferred share still owed the files of a run.
+type deferredCopy struct {
+	ShareKey string     `json:"shareKey"`
+	Share    string     `json:"share"`
+	Done     *time.Time `json:"done,omitempty"`
+}
+
+// deferTo queues the run's files for shares.
+func (j *runJournal) deferTo(shares []SMBConfig) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, share := range shares {
+		j.Deferred = append(j.Deferred, deferredCopy{ShareKey: smbShareKey(share), Share: shareLabel(share)})
+	}
+}
+
+// pendingDeferred returns the indices of j's deferred copies not yet done.
+func (j *runJournal) pendingDeferred() []int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var out []int
+	if j.Undone != nil {
+		return nil
+	}
+	for i, d := range j.Deferred {
+		if d.Done == nil {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// runDeferredCopies copies every pending deferred run to its share, if the
+// share's window is open at now or force is set, copying each file from a
+// share that already holds it. A copy that fails stays pending for the next
+// pass.
+func runDeferredCopies(ctx context.Context, cfg *Config, timeout time.Duration, now time.Time, force bool) (copied, failed int, err error) {
+	targets := map[string]SMBConfig{}
+	for _, share := range cfg.SMBShares {
+		if !share.isDeferred() || !share.enabled() {
+			continue
+		}
+		w, err := parseDailyWindow(share.Deferred)
+		if err != nil {
+			return 0, 0, fmt.Errorf("share %s: deferred: %w", shareLabel(share), err)
+		}
+		if force || w.open(now) {
+			targets[smbShareKey(share)] = share
+		}
+	}
+	if len(targets) == 0 {
+		return 0, 0, nil
+	}
+	journals, err := loadJournals(cfg)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// Connect only to the shares this pass needs: the open targets and the
+	// shares holding their files.
+	needed := map[string]bool{}
+	var work []*runJournal
+	for _, j := range journals {
+		due := false
+		for _, i := range j.pendingDeferred() {
+			if _, ok := targets[j.Deferred[i].ShareKey]; ok {
+				needed[j.Deferred[i].ShareKey] = true
+				due = true
+			}
+		}
+		if !due {
+			continue
+		}
+		work = append(work, j)
+		for _, f := range j.Files {
+			needed[f.ShareKey] = true
+		}
+	}
+	if len(work) == 0 {
+		return 0, 0, nil
+	}
+	pass := *cfg
+	pass.SMBShares = nil
+	for _, share := range cfg.SMBShares {
+		if needed[smbShareKey(share)] && !share.isPreviewShare() && !share.isEncrypted() && share.Archive == "" && !share.isCloud() {
+			pass.SMBShares = append(pass.SMBShares, share)
+		}
+	}
+	connections, err := establishConnections(ctx, &pass, timeout)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer closeConnections(connections)
+	conns := map[string]*SMBConnection{}
+	for _, conn := range connections {
+		conns[smbShareKey(conn.Config)] = conn
+	}
+
+	manifests, err := newManifestWriter(cfg.ChecksumManifest)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() {
+		if manifests != nil {
+			manifests.flush()
+		}
+	}()
+	for _, j := range work {
+		for _, i := range j.pendingDeferred() {
+			target := conns[j.Deferred[i].ShareKey]
+			if target == nil {
+				continue
+			}
+			c, f := copyDeferredRun(ctx, j, target, conns, manifests)
+			copied += c
+			failed += f
+			if ctx.Err() != nil {
+				return copied, failed, ctx.Err()
+			}
+			if f == 0 {
+				done := time.Now()
+				j.mu.Lock()
+				j.Deferred[i].Done = &done
+				j.mu.Unlock()
+				slog.Info("Deferred copy finished", "run", j.ID, "folder", j.Folder, "share", shareLabel(target.Config), "files", c)
+			}
+		}
+		if err := j.save(); err != nil {
+			slog.Warn("Failed to save run journal", "run", j.ID, "error", err)
+		}
+		publishRemoteImport(connections, j)
+	}
+	return copied, failed, nil
+}
+
+// copyDeferredRun copies j's files to target, each from the first connected
+// share the journal says holds it. Files target already holds at the same
+// size are skipped, so an interrupted pass resumes.
+func copyDeferredRun(ctx context.Context, j *runJournal, target *SMBConnection, conns map[string]*SMBConnection, manifests *manifestWriter) (copied, failed int) {
+	j.mu.Lock()
+	files := append([]journalEntry(nil), j.Files...)
+	j.mu.Unlock()
+
+	targetKey := smbShareKey(target.Config)
+	to := &shareInventory{conn: target, root: shootRoot(target, j.Folder)}
+	type source struct {
+		from  *shareInventory
+		entry journalEntry
+	}
+	sources := map[string]source{} // path below the shoot folder -> where to read it
+	var order []string
+	for _, f := range files {
+		conn := conns[f.ShareKey]
+		if conn == nil || f.ShareKey == targetKey || conn.Config.isPreviewShare() {
+			continue
+		}
+		root := shootRoot(conn, j.Folder)
+		rel := strings.TrimPrefix(f.Path, root+"/")
+		// Sidecars, proxies and shoot reports are each share's own; the
+		// deferred share's are not derived from another's.
+		switch {
+		case rel == f.Path, isChecksumFile(path.Base(rel)), strings.EqualFold(path.Ext(rel), ".xmp"),
+			!strings.Contains(rel, "/") && isShootReport(rel), conn.isProxyFolder(path.Dir(rel)):
+			continue
+		}
+		// Prefer a copy no share setting has edited.
+		if prev, seen := sources[rel]; !seen {
+			order = append(order, rel)
+		} else if shareJPEGEdit(prev.from.conn, rel).none() || !shareJPEGEdit(conn, rel).none() {
+			continue
+		}
+		sources[rel] = source{from: &shareInventory{conn: conn, root: root}, entry: f}
+	}
+
+	fs := target.Share.WithContext(ctx)
+	for _, rel := range order {
+		if ctx.Err() != nil {
+			return copied, failed
+		}
+		src := sources[rel]
+		info, err := src.from.conn.Share.WithContext(ctx).Stat(path.Join(src.from.root, rel))
+		if err != nil {
+			slog.Error("Deferred copy failed", "share", shareLabel(target.Config), "path", rel, "error", classifyError(err))
+			failed++
+			continue
+		}
+		dest := path.Join(to.root, rel)
+		if have, err := fs.Stat(dest); err == nil {
+			edited := !shareJPEGEdit(src.from.conn, rel).none() || !shareJPEGEdit(target, rel).none()
+			if have.Size() == info.Size() || edited {
+				continue
+			}
+		}
+		h := newHasher(target.hashAlg)
+		if err := copyBetweenShares(ctx, src.from, to, rel, info.Size(), h); err != nil {
+			slog.Error("Deferred copy failed", "share", shareLabel(target.Config), "path", rel, "error", classifyError(err))
+			failed++
+			continue
+		}
+		res := copyResult{DestPath: dest, Sum: h.Sum(nil), Algorithm: target.hashAlg}
+		if manifests != nil {
+			manifests.add(ctx, target, res)
+		}
+		j.record(target, src.entry.Source, src.entry.Size, res)
+		copied++
+	}
+	return copied, failed
+}
+
+// deferredPollInterval is how often the -serve process looks for deferred
+// copies whose window has opened.
+const deferredPollInterval = time.Minute
+
+// runDeferredLoop runs deferred copies from the -serve process until ctx
+// ends, re-reading the config each time so edits in the UI apply.
+func runDeferredLoop(ctx context.Context, configPath string, timeout time.Duration) {
+	ticker := time.NewTicker(deferredPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cfg, err := loadConfig(configPath, "", nil)
+		if err != nil {
+			continue
+		}
+		copied, failed, err := runDeferredCopies(ctx, cfg, timeout, time.Now(), false)
+		if err != nil && ctx.Err() == nil {
+			slog.Warn("Deferred copies failed", "error", err)
+		}
+		if copied+failed > 0 {
+			slog.Info("Deferred copy pass finished", "copied", copied, "failed", failed)
+		}
+	}
+}
+
+// runDeferredCommand implements `snapvault deferred`: list the pending
+// deferred copies, or run those whose window is open, for setups without a
+// -serve process.
+func runDeferredCommand(args []string) int {
+	fs := flag.NewFlagSet("deferred", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	list := fs.Bool("list", false, "List the pending deferred copies and exit")
+	now := fs.Bool("now", false, "Run the pending copies even outside their shares' windows")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault deferred [-list] [-now]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if err := checkConfigPermissions(*common.configPath); err != nil && !*common.insecure {
+		slog.Error("Refusing to use config", "error", err)
+		return exitConfig
+	}
+	config, err := loadConfig(*common.configPath, *common.profile, *common.overrides)
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitConfig
+	}
+	if *list {
+		journals, err := loadJournals(config)
+		if err != nil {
+			slog.Error("Failed to read run journals", "error", err)
+			return 1
+		}
+		pending := 0
+		for _, j := range journals {
+			for _, i := range j.pendingDeferred() {
+				pending++
+				fmt.Printf("%s  %-30s -> %s\n", j.ID, j.Folder, j.Deferred[i].Share)
+			}
+		}
+		if pending == 0 {
+			fmt.Println("No deferred copies pending.")
+		}
+		return 0
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+	copied, failed, err := runDeferredCopies(ctx, config, *common.timeout, time.Now(), *now)
+	switch {
+	case ctx.Err() != nil:
+		return exitCancelled
+	case err != nil:
+		slog.Error("Deferred copies failed", "error", err)
+		return connectExitCode(err)
+	}
+	fmt.Printf("%d copied, %d failed\n", copied, failed)
+	if failed > 0 {
+		return exitPartial
+	}
+	return 0
+}
+
+// logDeferredShares tells an import which shares it only queued.
+func logDeferredShares(shares []SMBConfig) {
+	if len(shares) == 0 {
+		return
+	}
+	labels := make([]string, len(shares))
+	for i, share := range shares {
+		labels[i] = shareLabel(share) + " (" + share.Deferred + ")"
+	}
+	slog.Info("Deferred shares are copied later, inside their window, by snapvault -serve or snapvault deferred",
+		"shares", strings.Join(labels, ", "))
+}
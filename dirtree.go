@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// dirTree remembers which folders are known to exist on one SMB share, as
+// a prefix tree, so each folder costs at most one Mkdir round trip per run
+// however many files, workers and configured shares land in it. Parents
+// are remembered on the way down: once 2026/2026-05-01 exists, creating
+// 2026/2026-05-02 only asks the server for the new leaf. Workers asking for
+// the same new folder at once wait for the first one's Mkdir instead of
+// sending their own.
+type dirTree struct {
+	mu   sync.Mutex
+	root dirNode
+}
+
+type dirNode struct {
+	children map[string]*dirNode
+	exists   bool
+	pending  chan struct{} // closed when an in-flight Mkdir of this folder returns
+}
+
+// shareDirTrees gives every SMB connection its dirTree, one per server
+// share: connections that differ only in base path, such as a preview
+// share next to the main one or overflow group members on the same NAS,
+// see each other's folders.
+func shareDirTrees(connections []*SMBConnection) {
+	trees := map[string]*dirTree{}
+	for _, conn := range connections {
+		if conn.Share == nil {
+			continue
+		}
+		port := conn.Config.Port
+		if port == 0 {
+			port = 445
+		}
+		key := strings.ToLower(conn.Config.Host) + ":" + strconv.Itoa(port) + "/" + strings.ToLower(conn.Config.Share)
+		if trees[key] == nil {
+			trees[key] = &dirTree{}
+		}
+		conn.dirs = trees[key]
+	}
+}
+
+// mkdirAll creates dir and its parents on conn's share, skipping the ones
+// this run already knows about.
+func (c *SMBConnection) mkdirAll(ctx context.Context, dir string) error {
+	if c.dirs == nil {
+		return mkdirAllSMB(ctx, c.Share, dir)
+	}
+	return c.dirs.mkdirAll(ctx, c.Share.WithContext(ctx), dir)
+}
+
+func (t *dirTree) mkdirAll(ctx context.Context, fs *smb2.Share, dir string) error {
+	node, current := &t.root, ""
+	for _, part := range strings.Split(filepath.ToSlash(dir), "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		current = path.Join(current, part)
+		t.mu.Lock()
+		child := node.children[part]
+		if child == nil {
+			if node.children == nil {
+				node.children = map[string]*dirNode{}
+			}
+			child = &dirNode{}
+			node.children[part] = child
+		}
+		t.mu.Unlock()
+		if err := t.mkdir(ctx, fs, child, current); err != nil {
+			return err
+		}
+		node = child
+	}
+	return nil
+}
+
+// mkdir makes sure the folder n stands for exists. "Already exists" counts
+// as success and is remembered like a folder this run created; a failure
+// is not, so the next file tries again.
+func (t *dirTree) mkdir(ctx context.Context, fs *smb2.Share, n *dirNode, p string) error {
+	for {
+		t.mu.Lock()
+		if n.exists {
+			t.mu.Unlock()
+			return nil
+		}
+		if wait := n.pending; wait != nil {
+			t.mu.Unlock()
+			select {
+			case <-wait:
+				continue
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		n.pending = done
+		t.mu.Unlock()
+
+		slog.Debug("Creating destination directory", "path", p)
+		err := fs.Mkdir(p, 0755)
+		ok := err == nil || os.IsExist(err)
+		t.mu.Lock()
+		n.exists, n.pending = ok, nil
+		t.mu.Unlock()
+		close(done)
+		if !ok {
+			return fmt.Errorf("creating directory %s: %w", p, err)
+		}
+		return nil
+	}
+}
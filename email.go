@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// emailNotifier mails the full end-of-run report, for studios that want a paper
+// trail of every ingest rather than a one-line push.
+type emailNotifier struct{ cfg *EmailConfig }
+
+func (e emailNotifier) name() string { return "email" }
+
+func (e emailNotifier) wants(event notifyEvent) bool { return wantsEvent(e.cfg.Events, event) }
+
+func (e emailNotifier) send(ctx context.Context, msg notification) error {
+	body := msg.message
+	if msg.report != nil {
+		body = renderEmailReport(msg.report)
+	}
+	return sendMail(ctx, e.cfg, msg.title+": "+reportSubjectName(msg.report), body)
+}
+
+func reportSubjectName(r *transferReport) string {
+	if r == nil {
+		return ""
+	}
+	return r.FolderName
+}
+
+// renderEmailReport formats a plain-text summary: totals, per-share results and
+// every file error.
+func renderEmailReport(r *transferReport) string {
+	var b strings.Builder
+	status := "completed successfully"
+	switch {
+	case !r.ok():
+		status = "completed with errors"
+	case len(r.Errors) > 0:
+		status = fmt.Sprintf("met its quorum (%d of %d destinations complete)", r.completeDestinations(), len(r.Shares))
+	}
+	fmt.Fprintf(&b, "SnapVault import %s.\n\n", status)
+	fmt.Fprintf(&b, "Shoot folder: %s\n", r.FolderName)
+	if r.Mount != "" {
+		fmt.Fprintf(&b, "Source:       %s\n", r.Mount)
+	}
+	if host, err := os.Hostname(); err == nil {
+		fmt.Fprintf(&b, "Machine:      %s\n", host)
+	}
+	fmt.Fprintf(&b, "Started:      %s\n", r.StartedAt.Format(time.RFC1123))
+	fmt.Fprintf(&b, "Duration:     %s\n", r.Duration.Round(time.Second))
+	fmt.Fprintf(&b, "Files:        %d of %d processed\n", r.Completed, r.Total)
+	fmt.Fprintf(&b, "Data:         %s\n", formatBytes(r.Bytes))
+
+	if len(r.Shares) > 0 {
+		b.WriteString("\nPer-share results:\n")
+		for _, sr := range r.Shares {
+			fmt.Fprintf(&b, "  %-40s %5d ok  %5d failed  %s\n", sr.Share, sr.Files, sr.Failed, formatBytes(sr.Bytes))
+		}
+	}
+	if len(r.Extensions) > 0 {
+		b.WriteString("\n")
+		writeBreakdown(&b, "By file type:", r.Extensions)
+	}
+	if len(r.Cameras) > 0 {
+		b.WriteString("\n")
+		writeBreakdown(&b, "By camera:", r.Cameras)
+	}
+
+	if len(r.SourceProblems) > 0 {
+		fmt.Fprintf(&b, "\nSource problems (%d), not copied:\n", len(r.SourceProblems))
+		for _, p := range r.SourceProblems {
+			fmt.Fprintf(&b, "  %s: %s\n", p.Path, p.Reason)
+			if p.Quarantined != "" {
+				fmt.Fprintf(&b, "    salvaged to %s\n", p.Quarantined)
+			}
+		}
+	}
+
+	if len(r.Renamed) > 0 {
+		fmt.Fprintf(&b, "\nRenamed for the shares (%d):\n", len(r.Renamed))
+		for _, rn := range r.Renamed {
+			fmt.Fprintf(&b, "  %s -> %s\n", rn.Path, rn.Stored)
+		}
+	}
+
+	if len(r.Duplicates) > 0 {
+		fmt.Fprintf(&b, "\nSkipped duplicates (%d):\n", len(r.Duplicates))
+		for _, d := range r.Duplicates {
+			fmt.Fprintf(&b, "  %s (same as %s)\n", d.Path, d.DuplicateOf)
+		}
+	}
+
+	if len(r.Similar) > 0 {
+		fmt.Fprintf(&b, "\nNear-duplicates: %d groups, %d frames to cull\n", len(r.Similar), r.similarFrames())
+		for _, g := range r.Similar {
+			fmt.Fprintf(&b, "  %d frames: %s .. %s\n", len(g.Files), filepath.Base(g.Files[0]), filepath.Base(g.Files[len(g.Files)-1]))
+		}
+	}
+
+	if r.Fatal != nil {
+		fmt.Fprintf(&b, "\nFatal error: %v\n", r.Fatal)
+	}
+	if len(r.Errors) > 0 {
+		fmt.Fprintf(&b, "\nFile errors (%d):\n", len(r.Errors))
+		for _, te := range r.Errors {
+			fmt.Fprintf(&b, "  %s -> %s: %v\n", filepath.Base(te.FilePath), te.Share, te.Error)
+		}
+	}
+	return b.String()
+}
+
+// sendMail delivers a plain-text message. Port 465 uses implicit TLS; anything
+// else connects in the clear and upgrades with STARTTLS when offered.
+func sendMail(ctx context.Context, cfg *EmailConfig, subject, body string) error {
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+	}
+	host := strings.TrimSpace(cfg.Host)
+	addr := net.JoinHostPort(host, fmt.Sprintf("%d", port))
+
+	dialCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	var conn net.Conn
+	var err error
+	if port == 465 {
+		d := tls.Dialer{Config: &tls.Config{ServerName: host}}
+		conn, err = d.DialContext(dialCtx, "tcp", addr)
+	} else {
+		var d net.Dialer
+		conn, err = d.DialContext(dialCtx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("dialing SMTP server: %w", err)
+	}
+	if deadline, ok := dialCtx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake: %w", err)
+	}
+	defer client.Close()
+
+	if port != 465 {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+				return fmt.Errorf("STARTTLS: %w", err)
+			}
+		}
+	}
+	if cfg.Username != "" {
+		auth := smtp.PlainAuth("", cfg.Username, os.ExpandEnv(cfg.Password), host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("SMTP auth: %w", err)
+		}
+	}
+
+	from := strings.TrimSpace(cfg.From)
+	if from == "" {
+		from = cfg.Username
+	}
+	if err := client.Mail(from); err != nil {
+		return fmt.Errorf("MAIL FROM: %w", err)
+	}
+	for _, rcpt := range cfg.To {
+		if err := client.Rcpt(strings.TrimSpace(rcpt)); err != nil {
+			return fmt.Errorf("RCPT TO %s: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA: %w", err)
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", oneLine(from))
+	fmt.Fprintf(&msg, "To: %s\r\n", oneLine(strings.Join(cfg.To, ", ")))
+	// The subject carries the shoot name, which may hold line breaks or
+	// non-ASCII text; encode it so it can't add headers of its own.
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", oneLine(subject)))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	if _, err := w.Write([]byte(msg.String())); err != nil {
+		return fmt.Errorf("writing message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("finishing message: %w", err)
+	}
+	return client.Quit()
+}
+
+// oneLine replaces line breaks in a header value with spaces.
+func oneLine(s string) string {
+	return strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(s)
+}
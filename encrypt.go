@@ -0,0 +1,548 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	iofs "io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+)
+
+// EncryptConfig makes a share an untrusted destination, such as cloud storage
+// or a friend's NAS: every file is encrypted with age before it leaves this
+// machine and stored under a random name. The real names are kept in the
+// catalog and, encrypted, on the share itself.
+type EncryptConfig struct {
+	// Recipients are the age public keys ("age1...") the files are encrypted
+	// to. Only the matching identities can read them; SnapVault needs none
+	// to write.
+	Recipients []string `yaml:"recipients,omitempty"`
+	// RecipientsFile is a file of recipients, one per line, as for age -R.
+	RecipientsFile string `yaml:"recipients_file,omitempty"`
+}
+
+// encryptedNamesDir is the folder in the share's .snapvault holding the
+// encrypted name lists, one per session that stored files, so several
+// machines can write to the share without overwriting each other's.
+const encryptedNamesDir = remoteMetaDir + "/names"
+
+// encryptedNamesTimeout bounds saving the names once the connection is
+// closing, which may be because the run was cancelled.
+const encryptedNamesTimeout = 30 * time.Second
+
+// isEncrypted reports whether the share only receives encrypted copies.
+func (c SMBConfig) isEncrypted() bool { return c.Encrypt != nil }
+
+func (e *EncryptConfig) recipients() ([]age.Recipient, error) {
+	var list strings.Builder
+	for _, r := range e.Recipients {
+		list.WriteString(r + "\n")
+	}
+	if e.RecipientsFile != "" {
+		data, err := os.ReadFile(os.ExpandEnv(e.RecipientsFile))
+		if err != nil {
+			return nil, fmt.Errorf("reading recipients_file: %w", err)
+		}
+		list.Write(data)
+	}
+	if strings.TrimSpace(list.String()) == "" {
+		return nil, errors.New("needs recipients or a recipients_file")
+	}
+	recipients, err := age.ParseRecipients(strings.NewReader(list.String()))
+	if err != nil {
+		return nil, fmt.Errorf("parsing recipients: %w", err)
+	}
+	return recipients, nil
+}
+
+// shareEncryption is the state of one encrypted share's connection.
+type shareEncryption struct {
+	cfg        *Config
+	key        string // smbShareKey
+	recipients []age.Recipient
+
+	mu    sync.Mutex
+	names map[string]string // path below the base path -> stored name
+	added map[string]string // names made since the last save
+}
+
+// newShareEncryption returns nil for a share that isn't encrypted.
+func newShareEncryption(cfg *Config, share SMBConfig) (*shareEncryption, error) {
+	if !share.isEncrypted() {
+		return nil, nil
+	}
+	recipients, err := share.Encrypt.recipients()
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: %w", err)
+	}
+	catalog, err := readCatalog(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("reading encrypted names: %w", err)
+	}
+	e := &shareEncryption{
+		cfg:        cfg,
+		key:        smbShareKey(share),
+		recipients: recipients,
+		names:      map[string]string{},
+		added:      map[string]string{},
+	}
+	for rel, name := range catalog.Encrypted[e.key] {
+		e.names[rel] = name
+	}
+	return e, nil
+}
+
+// storedName returns the name rel is stored under, making up a random one
+// the first time. A file copied again keeps its name, so it is replaced
+// rather than stored twice.
+func (e *shareEncryption) storedName(rel string) (string, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if name, ok := e.names[rel]; ok {
+		return name, nil
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b[:])
+	name := id[:2] + "/" + id + ".age"
+	e.names[rel] = name
+	e.added[rel] = name
+	return name, nil
+}
+
+// transferEncrypted is transferToSMB for an encrypted share. rel is the
+// file's path below the base path. The checksum is of the plaintext, like
+// every other share's, so it matches the file once decrypted.
+func transferEncrypted(ctx context.Context, sourcePath, rel string, conn *SMBConnection) (copyResult, error) {
+	name, err := conn.encryption.storedName(rel)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("naming encrypted copy: %w", err)
+	}
+	if conn.cloud != nil {
+		return transferEncryptedCloud(ctx, sourcePath, name, conn)
+	}
+	destPath := shootRoot(conn, name)
+	destDir := path.Dir(destPath)
+	if err := conn.mkdirAll(ctx, destDir); err != nil {
+		return copyResult{}, fmt.Errorf("creating directories: %w", err)
+	}
+
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
+	}
+	defer src.Close()
+	dst, err := conn.Share.WithContext(ctx).Create(destPath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("creating destination file: %w", err)
+	}
+	defer dst.Close()
+
+	enc, err := age.Encrypt(conn.limiter.writer(ctx, dst), conn.encryption.recipients...)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("encrypting: %w", err)
+	}
+	h := newHasher(conn.hashAlg)
+	r := newJPEGEditReader(contextReader{ctx, sourceReader{src}}, shareJPEGEdit(conn, sourcePath))
+	written, err := io.Copy(io.MultiWriter(enc, h), r)
+	if err == nil {
+		err = enc.Close()
+	}
+	if err == nil {
+		err = dst.Close()
+	}
+	if err != nil {
+		dst.Close()
+		removePartial(conn.Share, destPath)
+		return copyResult{}, fmt.Errorf("copying file: %w", err)
+	}
+	if srcInfo, statErr := os.Stat(sourcePath); statErr == nil && written-r.grown != srcInfo.Size() {
+		return copyResult{}, fmt.Errorf("%w: wrote %d bytes, source is %d bytes", errSizeMismatch, written-r.grown, srcInfo.Size())
+	}
+	return copyResult{DestPath: destPath, Sum: h.Sum(nil), Algorithm: conn.hashAlg}, nil
+}
+
+// transferEncryptedCloud encrypts sourcePath into a temporary file on this
+// machine, which the cloud remote's own uploader then sends as name. The
+// temporary file is as large as the source, so each worker needs that much
+// free local disk space.
+func transferEncryptedCloud(ctx context.Context, sourcePath, name string, conn *SMBConnection) (copyResult, error) {
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
+	}
+	defer src.Close()
+	srcInfo, err := src.Stat()
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: %w", errSourceRead, err)
+	}
+	tmp, err := os.CreateTemp("", "snapvault-*.age")
+	if err != nil {
+		return copyResult{}, fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	enc, err := age.Encrypt(tmp, conn.encryption.recipients...)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("encrypting: %w", err)
+	}
+	h := newHasher(conn.hashAlg)
+	r := newJPEGEditReader(contextReader{ctx, sourceReader{src}}, shareJPEGEdit(conn, sourcePath))
+	written, err := io.Copy(io.MultiWriter(enc, h), r)
+	if err == nil {
+		err = enc.Close()
+	}
+	if err == nil {
+		err = tmp.Close()
+	}
+	if err != nil {
+		return copyResult{}, fmt.Errorf("encrypting file: %w", err)
+	}
+	if written-r.grown != srcInfo.Size() {
+		return copyResult{}, fmt.Errorf("%w: wrote %d bytes, source is %d bytes", errSizeMismatch, written-r.grown, srcInfo.Size())
+	}
+	// Remotes that keep a modification time take the temporary file's.
+	_ = os.Chtimes(tmp.Name(), srcInfo.ModTime(), srcInfo.ModTime())
+
+	res, err := conn.cloud.transfer(ctx, tmp.Name(), shootRoot(conn, name), conn)
+	if err != nil {
+		return copyResult{}, err
+	}
+	return copyResult{DestPath: res.DestPath, Sum: h.Sum(nil), Algorithm: conn.hashAlg}, nil
+}
+
+// saveEncryptedNames records the names conn's copies were stored under since
+// the last save, in the catalog and encrypted on the share, so the shoots
+// can be restored even without this machine. Failures are logged: the copies
+// themselves are made.
+func saveEncryptedNames(conn *SMBConnection) {
+	e := conn.encryption
+	e.mu.Lock()
+	added := e.added
+	e.added = map[string]string{}
+	e.mu.Unlock()
+	if len(added) == 0 {
+		return
+	}
+
+	err := updateCatalog(e.cfg, func(c *catalogData) error {
+		if c.Encrypted == nil {
+			c.Encrypted = map[string]map[string]string{}
+		}
+		if c.Encrypted[e.key] == nil {
+			c.Encrypted[e.key] = map[string]string{}
+		}
+		for rel, name := range added {
+			c.Encrypted[e.key][rel] = name
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("Failed to save encrypted file names to the catalog", "share", shareLabel(conn.Config), "error", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), encryptedNamesTimeout)
+	defer cancel()
+	if err := writeEncryptedNames(ctx, conn, added); err != nil {
+		slog.Warn("Failed to save encrypted file names on share", "share", shareLabel(conn.Config), "error", err)
+	}
+}
+
+func writeEncryptedNames(ctx context.Context, conn *SMBConnection, names map[string]string) error {
+	data, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return err
+	}
+	p := path.Join(shootRoot(conn, encryptedNamesDir), time.Now().Format("20060102-150405")+"-"+hex.EncodeToString(b[:])+".age")
+	if conn.cloud != nil {
+		return uploadEncryptedNames(ctx, conn, p, data)
+	}
+	fs := conn.Share.WithContext(ctx)
+	if err := fs.MkdirAll(path.Dir(p), 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", path.Dir(p), err)
+	}
+	f, err := fs.Create(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w, err := age.Encrypt(f, conn.encryption.recipients...)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// uploadEncryptedNames sends a name list to a cloud share as p, through a
+// temporary file like the copies.
+func uploadEncryptedNames(ctx context.Context, conn *SMBConnection, p string, data []byte) error {
+	tmp, err := os.CreateTemp("", "snapvault-names-*.age")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	w, err := age.Encrypt(tmp, conn.encryption.recipients...)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	_, err = conn.cloud.transfer(ctx, tmp.Name(), p, conn)
+	return err
+}
+
+// readEncryptedNames merges the name lists below root, the share's base
+// path, that identities can decrypt.
+func readEncryptedNames(root iofs.FS, label string, identities []age.Identity) (map[string]string, error) {
+	entries, err := iofs.ReadDir(root, encryptedNamesDir)
+	if errors.Is(err, iofs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", encryptedNamesDir, err)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	names := map[string]string{}
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".age" {
+			continue
+		}
+		f, err := root.Open(path.Join(encryptedNamesDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var list map[string]string
+		r, err := age.Decrypt(f, identities...)
+		if err == nil {
+			err = json.NewDecoder(r).Decode(&list)
+		}
+		f.Close()
+		if err != nil {
+			slog.Warn("Skipping unreadable name list", "share", label, "file", e.Name(), "error", err)
+			continue
+		}
+		for rel, name := range list {
+			names[rel] = name
+		}
+	}
+	return names, nil
+}
+
+// runDecryptCommand restores a shoot from an encrypted share into a local
+// folder, under its real names.
+func runDecryptCommand(args []string) int {
+	fs := flag.NewFlagSet("decrypt", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	share := fs.String("share", "", "Encrypted share to restore from, by name or host/share")
+	name := fs.String("name", "", `Shoot folder to restore (e.g. "2026 - Smith Wedding")`)
+	out := fs.String("out", "", "Local folder to write the decrypted files to")
+	identity := fs.String("identity", "", "age identity file (default: SOPS_AGE_KEY, SOPS_AGE_KEY_FILE or the sops key file)")
+	list := fs.Bool("list", false, "List the shoots on the share instead of restoring one")
+	from := fs.String("from", "", "Local copy of the share's base folder to read the encrypted files from; needed for cloud shares")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault decrypt -share <share> (-list | -name <shoot folder> -out <folder>) [-identity <file>] [-from <folder>]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *share == "" || (!*list && (*name == "" || *out == "")) {
+		fs.Usage()
+		return exitUsage
+	}
+	identities, err := loadIdentities(*identity)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitConfig
+	}
+
+	// The offsite share may well be disabled for imports.
+	*common.onlyShares = append(*common.onlyShares, *share)
+	ctx, stop := commandContext()
+	defer stop()
+	_, connections, err := common.connectAll(ctx)
+	if err != nil {
+		slog.Error("Failed to connect to shares", "error", err)
+		return connectExitCode(err)
+	}
+	defer closeConnections(connections)
+
+	var conn *SMBConnection
+	for _, c := range connections {
+		if matchesShareName(c.Config, *share) {
+			conn = c
+			break
+		}
+	}
+	switch {
+	case conn == nil:
+		fmt.Fprintf(os.Stderr, "no connected share named %q\n", *share)
+		return exitUsage
+	case conn.encryption == nil:
+		fmt.Fprintf(os.Stderr, "share %q is not encrypted\n", *share)
+		return exitUsage
+	case conn.cloud != nil && *from == "":
+		fmt.Fprintf(os.Stderr, "share %q is a %s destination, which SnapVault can't read from; download its folder with the provider's tools and pass it as -from\n", *share, conn.cloud.kind())
+		return exitUsage
+	}
+	var root iofs.FS
+	if *from != "" {
+		root = os.DirFS(*from)
+	} else {
+		root = conn.Share.WithContext(ctx).DirFS(shootRoot(conn, ""))
+	}
+
+	// The share's own lists cover imports from other machines, or from
+	// this one before its catalog was lost.
+	names, err := readEncryptedNames(root, shareLabel(conn.Config), identities)
+	if err != nil {
+		slog.Error("Failed to read encrypted file names", "error", err)
+		return 1
+	}
+	if names == nil {
+		names = map[string]string{}
+	}
+	conn.encryption.mu.Lock()
+	for rel, stored := range conn.encryption.names {
+		names[rel] = stored
+	}
+	conn.encryption.mu.Unlock()
+
+	if *list {
+		shoots := map[string]int{}
+		for rel := range names {
+			shoot, _, _ := strings.Cut(rel, "/")
+			shoots[shoot]++
+		}
+		keys := make([]string, 0, len(shoots))
+		for shoot := range shoots {
+			keys = append(keys, shoot)
+		}
+		sort.Strings(keys)
+		for _, shoot := range keys {
+			fmt.Printf("%-40s %d files\n", shoot, shoots[shoot])
+		}
+		return 0
+	}
+
+	prefix := strings.TrimSuffix(*name, "/") + "/"
+	var rels []string
+	for rel := range names {
+		if strings.HasPrefix(rel, prefix) {
+			rels = append(rels, rel)
+		}
+	}
+	if len(rels) == 0 {
+		fmt.Fprintf(os.Stderr, "no files of %q are known on %s\n", *name, shareLabel(conn.Config))
+		return 1
+	}
+	sort.Strings(rels)
+	var restored, failed int
+	for _, rel := range rels {
+		if ctx.Err() != nil {
+			return exitCancelled
+		}
+		// Anyone holding the recipient can write a name list, so a name that
+		// would land outside -out is refused rather than trusted.
+		local := filepath.FromSlash(strings.TrimPrefix(rel, prefix))
+		if !filepath.IsLocal(local) {
+			slog.Error("Refusing to restore file outside the output folder", "path", rel)
+			failed++
+			continue
+		}
+		dest := filepath.Join(*out, local)
+		if err := decryptFile(ctx, root, names[rel], dest, identities); err != nil {
+			slog.Error("Failed to restore file", "path", rel, "error", err)
+			failed++
+			continue
+		}
+		restored++
+	}
+	fmt.Printf("\n%d restored, %d failed\n", restored, failed)
+	if failed > 0 {
+		return exitPartial
+	}
+	return 0
+}
+
+// loadIdentities reads the age identities from file, or the ones used for
+// encrypted configs when it is empty.
+func loadIdentities(file string) ([]age.Identity, error) {
+	if file == "" {
+		return ageIdentities()
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("reading identity: %w", err)
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing age identity %s: %w", file, err)
+	}
+	return ids, nil
+}
+
+// decryptFile writes the plaintext of stored below root to dest.
+func decryptFile(ctx context.Context, root iofs.FS, stored, dest string, identities []age.Identity) error {
+	src, err := root.Open(stored)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	r, err := age.Decrypt(contextReader{ctx, src}, identities...)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return err
+	}
+	tmp := dest + partialUploadSuffix
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, contextReader{ctx, r})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
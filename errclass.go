@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// Failure classes. classifyError wraps share errors with one of these, so
+// callers can react with errors.Is instead of reading messages. errSourceRead
+// (quarantine.go) for the card side and errSizeMismatch for failed
+// verification are classes too.
+var (
+	errAuth        = errors.New("authentication failed")
+	errNoSpace     = errors.New("share is full")
+	errPathTooLong = errors.New("path too long for the share")
+	errSessionLost = errors.New("connection to the share lost")
+)
+
+// errorClassOrder ranks the classes, most serious first, for exit codes and
+// summaries.
+var errorClassOrder = []error{errAuth, errNoSpace, errSessionLost, errSizeMismatch, errPathTooLong, errSourceRead}
+
+// NTSTATUS codes, from [MS-ERREF]; go-smb2 keeps its table internal.
+const (
+	ntStatusQuotaExceeded         = 0xC0000044
+	ntStatusLogonFailure          = 0xC000006D
+	ntStatusAccountRestriction    = 0xC000006E
+	ntStatusPasswordExpired       = 0xC0000071
+	ntStatusAccountDisabled       = 0xC0000072
+	ntStatusDiskFull              = 0xC000007F
+	ntStatusNetworkNameDeleted    = 0xC00000C9
+	ntStatusNameTooLong           = 0xC0000106
+	ntStatusAccountExpired        = 0xC0000193
+	ntStatusUserSessionDeleted    = 0xC0000203
+	ntStatusConnectionDisconnect  = 0xC000020C
+	ntStatusAccountLockedOut      = 0xC0000234
+	ntStatusNetworkSessionExpired = 0xC000035C
+)
+
+// errorClass returns the failure class of err, or nil when it has none.
+func errorClass(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, class := range []error{errSourceRead, errAuth, errNoSpace, errPathTooLong, errSessionLost, errSizeMismatch} {
+		if errors.Is(err, class) {
+			return class
+		}
+	}
+	var resp *smb2.ResponseError
+	if errors.As(err, &resp) {
+		switch resp.Code {
+		case ntStatusLogonFailure, ntStatusAccountRestriction, ntStatusPasswordExpired, ntStatusAccountDisabled,
+			ntStatusAccountExpired, ntStatusAccountLockedOut:
+			return errAuth
+		case ntStatusDiskFull, ntStatusQuotaExceeded:
+			return errNoSpace
+		case ntStatusNameTooLong:
+			return errPathTooLong
+		case ntStatusNetworkNameDeleted, ntStatusUserSessionDeleted, ntStatusConnectionDisconnect, ntStatusNetworkSessionExpired:
+			return errSessionLost
+		}
+		return nil
+	}
+	var transport *smb2.TransportError
+	switch {
+	case errors.Is(err, errGroupFull), errors.Is(err, syscall.ENOSPC):
+		return errNoSpace
+	case errors.Is(err, syscall.ENAMETOOLONG):
+		return errPathTooLong
+	case errors.As(err, &transport), errors.Is(err, net.ErrClosed), errors.Is(err, io.ErrUnexpectedEOF),
+		errors.Is(err, syscall.ECONNRESET), errors.Is(err, syscall.EPIPE):
+		return errSessionLost
+	}
+	return nil
+}
+
+// classifyError wraps err with its failure class. Errors without one, and
+// errors already carrying one, are returned unchanged.
+func classifyError(err error) error {
+	class := errorClass(err)
+	if class == nil || errors.Is(err, class) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", class, err)
+}
+
+// errorClassName is the class of err for JSON and logs, or "".
+func errorClassName(err error) string {
+	switch errorClass(err) {
+	case errAuth:
+		return "auth"
+	case errNoSpace:
+		return "no_space"
+	case errPathTooLong:
+		return "path_too_long"
+	case errSessionLost:
+		return "session_lost"
+	case errSourceRead:
+		return "source_read"
+	case errSizeMismatch:
+		return "verify_mismatch"
+	}
+	return ""
+}
+
+// errorHint says what to do about a class of failure, or "".
+func errorHint(class error) string {
+	switch class {
+	case errAuth:
+		return "check the share's username and password, or use -ask-pass"
+	case errNoSpace:
+		return "free up space on the share or add it to an overflow group, then run snapvault repair"
+	case errPathTooLong:
+		return "shorten the shoot name, folder layout or file_template"
+	case errSessionLost:
+		return "the NAS dropped the connection; once it is back, run snapvault repair"
+	case errSourceRead:
+		return "the card is damaged; use -quarantine to salvage what can be read"
+	case errSizeMismatch:
+		return "the share may be failing; run snapvault check -hash on the shoot"
+	}
+	return ""
+}
+
+// Exit codes of an import, for wrapper scripts: only exitOK means every file
+// is safely on the shares (or the quorum of them).
+const (
+	exitOK          = 0
+	exitError       = 1 // anything not covered below
+	exitUsage       = 2 // bad flags
+	exitAuth        = 3
+	exitNoSpace     = 4
+	exitPathTooLong = 5
+	exitSessionLost = 6
+	exitSourceRead  = 7
+	exitConfig      = 8 // the config is missing, unreadable or invalid
+	exitConnection  = 9 // a share could not be reached before copying
+	exitPartial     = 10
+	exitVerify      = 11 // a copy failed verification
+	exitLocked      = 12 // another run is importing the same card
+	exitCancelled   = 130
+)
+
+// exitCode maps err to the process exit code.
+func exitCode(err error) int {
+	switch errorClass(err) {
+	case errAuth:
+		return exitAuth
+	case errNoSpace:
+		return exitNoSpace
+	case errPathTooLong:
+		return exitPathTooLong
+	case errSessionLost:
+		return exitSessionLost
+	case errSourceRead:
+		return exitSourceRead
+	case errSizeMismatch:
+		return exitVerify
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return exitCancelled
+	case errors.Is(err, errCardLocked):
+		return exitLocked
+	}
+	return exitError
+}
+
+// connectExitCode is exitCode for a failure to set up the shares, where
+// anything but bad credentials counts as a connection failure.
+func connectExitCode(err error) int {
+	if code := exitCode(err); code != exitError {
+		return code
+	}
+	return exitConnection
+}
+
+// transferExitCode is the exit code of a run that failed on errs: the most
+// serious class among them, since the first thing to fix is what breaks a
+// whole share, and exitPartial when none has a class.
+func transferExitCode(errs []TransferError) int {
+	classes := map[error]bool{}
+	for _, te := range errs {
+		classes[errorClass(te.Error)] = true
+	}
+	for _, class := range errorClassOrder {
+		if classes[class] {
+			return exitCode(class)
+		}
+	}
+	return exitPartial
+}
+
+// printErrorHints prints one line per failure class among errs, with the
+// number of failed copies and what to do about them.
+func printErrorHints(w io.Writer, errs []TransferError) {
+	counts := map[error]int{}
+	for _, te := range errs {
+		if class := errorClass(te.Error); class != nil {
+			counts[class]++
+		}
+	}
+	for _, class := range errorClassOrder {
+		if counts[class] > 0 {
+			fmt.Fprintf(w, "%d failed: %v; %s\n", counts[class], class, errorHint(class))
+		}
+	}
+}
+
+// errShareDown marks copies not attempted because their destination already
+// failed in a way every later copy would too.
+var errShareDown = errors.New("skipped after an earlier failure on this share")
+
+// shareOutages remembers destinations lost for the rest of a run: wrong
+// credentials, a full share or a dropped session. Skipping them saves waiting
+// out a timeout per file; snapvault repair fills them in later.
+type shareOutages struct {
+	mu   sync.Mutex
+	down map[string]error
+}
+
+func newShareOutages() *shareOutages {
+	return &shareOutages{down: map[string]error{}}
+}
+
+// record notes err for destination label if it takes the whole destination
+// down. A full overflow group isn't: a smaller file may still fit.
+func (o *shareOutages) record(label string, err error) {
+	switch errorClass(err) {
+	case errAuth, errNoSpace, errSessionLost:
+	default:
+		return
+	}
+	if errors.Is(err, errGroupFull) || errors.Is(err, errShareDown) {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.down[label] == nil {
+		o.down[label] = err
+		slog.Warn("Giving up on destination for this run", "destination", label, "reason", errorClassName(err), "error", err)
+	}
+}
+
+// check returns an errShareDown error, carrying the original cause's class,
+// once label is down.
+func (o *shareOutages) check(label string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if cause := o.down[label]; cause != nil {
+		return fmt.Errorf("%w: %w", errShareDown, errorClass(cause))
+	}
+	return nil
+}
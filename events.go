@@ -0,0 +1,115 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// RunEvent is something that happened during an import, published on an
+// eventBus: one of the types below.
+type RunEvent interface {
+	runEvent()
+}
+
+// FileDiscovered is published for each file that will be imported, after
+// filtering, de-duplication and naming, just before copying starts.
+type FileDiscovered struct {
+	Path  string // on the card
+	Size  int64
+	Taken time.Time
+	Dest  string // below the share's base path, e.g. "2026 - Wedding/2026-10-12/IMG_0001.CR3"
+}
+
+// RunStarted follows the FileDiscovered events.
+type RunStarted struct {
+	Folder string
+	Files  int
+	Bytes  int64
+}
+
+// FileTransferred is published each time a destination holds a verified copy.
+type FileTransferred struct {
+	Path  string
+	Share string // destination label: a share, or an overflow group
+	Dest  string // share-relative path of the copy
+	Size  int64
+}
+
+// ShareError is published each time a copy to a destination fails.
+type ShareError struct {
+	Path  string
+	Share string
+	Err   error
+}
+
+// FileCompleted is published once every destination has been tried for a
+// file, whatever the outcome.
+type FileCompleted struct {
+	Path      string
+	Completed int
+	Total     int
+}
+
+// RunCompleted is published when copying has stopped, after manifests and
+// the journal are written. Err is set when the run was cancelled.
+type RunCompleted struct {
+	Folder string
+	Files  int
+	Failed int // failed copies, counted per destination
+	// Delivered counts the files each destination received.
+	Delivered map[string]int
+	Duration  time.Duration
+	Err       error
+}
+
+func (FileDiscovered) runEvent()  {}
+func (RunStarted) runEvent()      {}
+func (FileTransferred) runEvent() {}
+func (ShareError) runEvent()      {}
+func (FileCompleted) runEvent()   {}
+func (RunCompleted) runEvent()    {}
+
+// eventBus fans run events out to its subscribers. Delivery is synchronous,
+// on the goroutine that published, and in publishing order for that
+// goroutine; copy workers publish concurrently, so a subscriber must be safe
+// for concurrent use and should hand slow work off rather than block a copy.
+type eventBus struct {
+	mu   sync.RWMutex
+	next int
+	subs map[int]func(RunEvent)
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: map[int]func(RunEvent){}}
+}
+
+// subscribe calls fn for every later event until the returned function is
+// called.
+func (b *eventBus) subscribe(fn func(RunEvent)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.subs[id] = fn
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, id)
+	}
+}
+
+// publish is a no-op on a nil bus, so runs without subscribers need no checks.
+func (b *eventBus) publish(e RunEvent) {
+	if b == nil {
+		return
+	}
+	b.mu.RLock()
+	subs := make([]func(RunEvent), 0, len(b.subs))
+	for _, fn := range b.subs {
+		subs = append(subs, fn)
+	}
+	b.mu.RUnlock()
+	for _, fn := range subs {
+		fn(e)
+	}
+}
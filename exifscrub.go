@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"path"
+	"strings"
+)
+
+// metadataScrub is what a share strips from JPEG copies.
+type metadataScrub int
+
+const (
+	scrubNone metadataScrub = iota
+	scrubGPS                // the GPS block of the EXIF data, and XMP that repeats it
+	scrubAll                // EXIF, XMP and IPTC entirely
+)
+
+// jpegScrubWindow is how much of a JPEG is searched for metadata. EXIF must
+// fit in one 64 KiB segment near the start of the file.
+const jpegScrubWindow = 256 << 10
+
+func isJPEG(name string) bool {
+	ext := strings.ToLower(path.Ext(strings.ReplaceAll(name, `\`, "/")))
+	return ext == ".jpg" || ext == ".jpeg"
+}
+
+// shareScrub returns what cfg strips from the file at name (a local or share
+// path). Only JPEGs are changed; everything else is copied as is.
+func shareScrub(cfg SMBConfig, name string) metadataScrub {
+	switch {
+	case !isJPEG(name):
+		return scrubNone
+	case cfg.StripEXIF:
+		return scrubAll
+	case cfg.StripGPS:
+		return scrubGPS
+	}
+	return scrubNone
+}
+
+// jpegEdit is what a copy to one share changes in a JPEG.
+type jpegEdit struct {
+	scrub  metadataScrub
+	credit *AttributionConfig
+}
+
+// shareJPEGEdit returns the changes conn makes to the file at name.
+func shareJPEGEdit(conn *SMBConnection, name string) jpegEdit {
+	if !isJPEG(name) {
+		return jpegEdit{}
+	}
+	return jpegEdit{scrub: shareScrub(conn.Config, name), credit: conn.attribution}
+}
+
+func (e jpegEdit) none() bool { return e.scrub == scrubNone && e.credit.empty() }
+
+// jpegEditReader applies a jpegEdit to the JPEG read through r. Stripped
+// segments are blanked in place rather than cut out, so a scrubbed copy keeps
+// the size of the original; only attribution makes a copy grow.
+type jpegEditReader struct {
+	r     io.Reader
+	edit  jpegEdit
+	head  *bytes.Reader
+	grown int64 // bytes added by the edit
+}
+
+func newJPEGEditReader(r io.Reader, edit jpegEdit) *jpegEditReader {
+	return &jpegEditReader{r: r, edit: edit}
+}
+
+func (s *jpegEditReader) Read(p []byte) (int, error) {
+	if s.edit.none() {
+		return s.r.Read(p)
+	}
+	if s.head == nil {
+		buf := make([]byte, jpegScrubWindow)
+		n, err := io.ReadFull(s.r, buf)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		head := buf[:n]
+		scrubJPEG(head, s.edit.scrub)
+		edited := addAttribution(head, s.edit.credit)
+		s.grown = int64(len(edited) - len(head))
+		s.head = bytes.NewReader(edited)
+	}
+	if s.head.Len() > 0 {
+		return s.head.Read(p)
+	}
+	return s.r.Read(p)
+}
+
+var (
+	exifHeader   = []byte("Exif\x00\x00")
+	xmpHeader    = []byte("http://ns.adobe.com/xap/1.0/\x00")
+	xmpExtHeader = []byte("http://ns.adobe.com/xmp/extension/\x00")
+)
+
+// scrubJPEG walks the marker segments before the image data in b.
+func scrubJPEG(b []byte, mode metadataScrub) {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return
+	}
+	for i := 2; i+4 <= len(b); {
+		if b[i] != 0xFF {
+			return
+		}
+		marker := b[i+1]
+		switch {
+		case marker == 0xFF: // fill byte
+			i++
+			continue
+		case marker == 0xDA, marker == 0xD9: // start of scan, end of image
+			return
+		case marker >= 0xD0 && marker <= 0xD7, marker == 0x01: // no length
+			i += 2
+			continue
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+		if end < i+4 || end > len(b) {
+			return
+		}
+		seg := b[i:end]
+		payload := seg[4:]
+		switch {
+		case marker == 0xE1 && bytes.HasPrefix(payload, exifHeader):
+			if mode == scrubAll || !stripGPSIFD(payload[len(exifHeader):]) {
+				blankSegment(seg)
+			}
+		case marker == 0xE1 && (bytes.HasPrefix(payload, xmpHeader) || bytes.HasPrefix(payload, xmpExtHeader)):
+			if mode == scrubAll || bytes.Contains(payload, []byte("GPS")) {
+				blankSegment(seg)
+			}
+		case marker == 0xED && mode == scrubAll: // IPTC
+			blankSegment(seg)
+		}
+		i = end
+	}
+}
+
+// blankSegment turns a segment into a zero-filled comment of the same length.
+func blankSegment(seg []byte) {
+	seg[1] = 0xFE
+	clear(seg[4:])
+}
+
+// tiffTypeSizes are the byte sizes of the TIFF field types EXIF uses.
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// stripGPSIFD zeroes the GPS IFD of the TIFF structure in an EXIF segment and
+// drops IFD0's pointer to it. It reports false when the structure is not
+// what it expects, in which case the caller blanks the whole segment rather
+// than risk leaving the position in.
+func stripGPSIFD(tiff []byte) bool {
+	if len(tiff) < 8 {
+		return false
+	}
+	var bo binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		bo = binary.LittleEndian
+	case "MM":
+		bo = binary.BigEndian
+	default:
+		return false
+	}
+	inRange := func(off, n int) bool { return off >= 0 && n >= 0 && off+n <= len(tiff) }
+
+	ifd0 := int(bo.Uint32(tiff[4:]))
+	if !inRange(ifd0, 2) {
+		return false
+	}
+	count := int(bo.Uint16(tiff[ifd0:]))
+	entries := ifd0 + 2
+	if !inRange(entries, count*12+4) {
+		return false
+	}
+	for k := 0; k < count; k++ {
+		e := entries + k*12
+		if bo.Uint16(tiff[e:]) != 0x8825 {
+			continue
+		}
+		gps := int(bo.Uint32(tiff[e+8:]))
+		if !inRange(gps, 2) {
+			return false
+		}
+		n := int(bo.Uint16(tiff[gps:]))
+		if !inRange(gps+2, n*12) {
+			return false
+		}
+		for j := 0; j < n; j++ {
+			g := gps + 2 + j*12
+			size, ok := tiffTypeSizes[bo.Uint16(tiff[g+2:])]
+			if !ok {
+				return false
+			}
+			if size *= int(bo.Uint32(tiff[g+4:])); size > 4 {
+				off := int(bo.Uint32(tiff[g+8:]))
+				if !inRange(off, size) {
+					return false
+				}
+				clear(tiff[off : off+size])
+			}
+		}
+		clear(tiff[gps : gps+2+n*12])
+		if inRange(gps+2+n*12, 4) {
+			clear(tiff[gps+2+n*12 : gps+2+n*12+4])
+		}
+
+		// Shift the later entries and the next-IFD offset over the pointer.
+		last := entries + count*12 + 4
+		copy(tiff[e:], tiff[e+12:last])
+		clear(tiff[last-12 : last])
+		bo.PutUint16(tiff[ifd0:], uint16(count-1))
+		return true
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fileList is the set of source files -files-from names. Entries are matched
+// ignoring case, as on the FAT and exFAT file systems of memory cards.
+type fileList struct {
+	mu      sync.Mutex
+	abs     map[string]string // absolute path -> entry as listed
+	rel     map[string]string // slash path below the card root -> entry
+	names   map[string]string // bare file name -> entry
+	matched map[string]bool   // entries that matched at least one file
+}
+
+// readFileList reads a -files-from list from name, or from stdin for "-".
+func readFileList(name string, stdin io.Reader) (*fileList, error) {
+	var data []byte
+	var err error
+	if name == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading file list: %w", err)
+	}
+	l := parseFileList(data)
+	if len(l.abs)+len(l.rel)+len(l.names) == 0 {
+		return nil, fmt.Errorf("file list %s names no files", name)
+	}
+	return l, nil
+}
+
+// parseFileList splits a list on NULs when it has any, as from find -print0,
+// and otherwise on lines. Absolute paths name one file; relative paths are
+// taken from the card root, e.g. DCIM/100CANON/IMG_0001.CR3, and a bare file
+// name matches that name in any folder. Blank lines and lines starting with
+// # are skipped.
+func parseFileList(data []byte) *fileList {
+	sep := []byte("\n")
+	if bytes.IndexByte(data, 0) >= 0 {
+		sep = []byte{0}
+	}
+	l := &fileList{abs: map[string]string{}, rel: map[string]string{}, names: map[string]string{}, matched: map[string]bool{}}
+	for _, raw := range bytes.Split(data, sep) {
+		entry := strings.TrimRight(string(raw), "\r")
+		if sep[0] == '\n' {
+			entry = strings.TrimSpace(entry)
+			if strings.HasPrefix(entry, "#") {
+				continue
+			}
+		}
+		switch {
+		case entry == "":
+		case filepath.IsAbs(entry):
+			if abs, err := filepath.Abs(entry); err == nil {
+				l.abs[listKey(abs)] = entry
+			}
+		case !strings.ContainsAny(entry, `/\`):
+			l.names[listKey(entry)] = entry
+		default:
+			rel := path.Clean(strings.ReplaceAll(entry, `\`, "/"))
+			l.rel[listKey(strings.TrimPrefix(rel, "/"))] = entry
+		}
+	}
+	return l
+}
+
+// include is a TransferOptions.Include filter that keeps the listed files.
+func (l *fileList) include(job TransferJob) bool {
+	var hits []string
+	if abs, err := filepath.Abs(job.SourcePath); err == nil {
+		if e, ok := l.abs[listKey(abs)]; ok {
+			hits = append(hits, e)
+		}
+	}
+	if rel, err := filepath.Rel(job.SourceRoot, job.SourcePath); err == nil {
+		if e, ok := l.rel[listKey(filepath.ToSlash(rel))]; ok {
+			hits = append(hits, e)
+		}
+	}
+	if e, ok := l.names[listKey(filepath.Base(job.SourcePath))]; ok {
+		hits = append(hits, e)
+	}
+	if len(hits) == 0 {
+		return false
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range hits {
+		l.matched[e] = true
+	}
+	return true
+}
+
+// missing returns the entries that matched no file on the card, sorted.
+func (l *fileList) missing() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []string
+	for _, set := range []map[string]string{l.abs, l.rel, l.names} {
+		for _, e := range set {
+			if !l.matched[e] {
+				out = append(out, e)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// listKey is how list entries and card paths are compared: ignoring case
+// and Unicode form, so a list written on a Mac still matches.
+func listKey(s string) string {
+	return strings.ToLower(nameKey(s))
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FTPDestConfig makes a share a folder on an FTP or FTPS server.
+type FTPDestConfig struct {
+	Host string `yaml:"host"`
+	// Port defaults to 21, or 990 with implicit TLS.
+	Port     int    `yaml:"port,omitempty"`
+	Username string `yaml:"username,omitempty"` // "anonymous" when unset
+	Password string `yaml:"password,omitempty"` // supports ${ENV} expansion
+	// TLS is "explicit" (AUTH TLS on the normal port), "implicit" (TLS from
+	// the first byte, usually port 990) or empty for plain FTP. Data
+	// connections are encrypted too.
+	TLS string `yaml:"tls,omitempty"`
+	// InsecureTLS accepts a self-signed or expired server certificate.
+	InsecureTLS bool `yaml:"insecure_tls,omitempty"`
+	// Active has the server connect back for data (PORT/EPRT) instead of
+	// passive mode, for servers whose passive ports are firewalled.
+	Active bool `yaml:"active,omitempty"`
+}
+
+// ftpTimeout bounds each FTP command and the idle time of a data transfer.
+const ftpTimeout = 60 * time.Second
+
+// ftpIdleConns is how many logged-in control connections are kept for reuse.
+const ftpIdleConns = 4
+
+func (c *FTPDestConfig) validate() error {
+	if strings.TrimSpace(c.Host) == "" {
+		return errors.New("needs host")
+	}
+	if c.Port < 0 || c.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", c.Port)
+	}
+	switch c.TLS {
+	case "", "explicit", "implicit":
+	default:
+		return fmt.Errorf("tls must be explicit or implicit, got %q", c.TLS)
+	}
+	return nil
+}
+
+func (c *FTPDestConfig) addr() string {
+	port := c.Port
+	if port == 0 {
+		port = 21
+		if c.TLS == "implicit" {
+			port = 990
+		}
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// ftpRemote is a share on an FTP server. Control connections are logged in
+// once and reused; workers copying at the same time each get their own.
+type ftpRemote struct {
+	cfg  FTPDestConfig
+	pass string
+	tls  *tls.Config
+	home string // the login directory, which paths are relative to
+
+	mu   sync.Mutex
+	idle []*ftpConn
+}
+
+// ftpConn is one logged-in control connection.
+type ftpConn struct {
+	conn net.Conn
+	text *textproto.Conn
+}
+
+func newFTPRemote(ctx context.Context, cfg SMBConfig) (*ftpRemote, error) {
+	r := &ftpRemote{cfg: *cfg.FTP, pass: os.ExpandEnv(cfg.FTP.Password)}
+	if r.cfg.TLS != "" {
+		r.tls = &tls.Config{
+			ServerName:         r.cfg.Host,
+			InsecureSkipVerify: r.cfg.InsecureTLS,
+			// Many servers only accept data connections that resume the
+			// control connection's TLS session.
+			ClientSessionCache: tls.NewLRUClientSessionCache(8),
+		}
+	}
+	c, err := r.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	_, msg, err := c.cmd(257, "PWD")
+	if err != nil {
+		c.close()
+		return nil, fmt.Errorf("reading FTP home folder: %w", err)
+	}
+	// 257 "/home/photos" is the current directory
+	if start, end := strings.Index(msg, `"`), strings.LastIndex(msg, `"`); start >= 0 && end > start {
+		r.home = strings.ReplaceAll(msg[start+1:end], `""`, `"`)
+	}
+	if r.home == "" {
+		r.home = "/"
+	}
+	r.put(c)
+	return r, nil
+}
+
+func (r *ftpRemote) kind() string { return "FTP" }
+
+// abs is the server path of p.
+func (r *ftpRemote) abs(p string) string { return path.Join(r.home, p) }
+
+// dial connects and logs in.
+func (r *ftpRemote) dial(ctx context.Context) (*ftpConn, error) {
+	d := net.Dialer{Timeout: ftpTimeout}
+	conn, err := d.DialContext(ctx, "tcp", r.cfg.addr())
+	if err != nil {
+		return nil, fmt.Errorf("dialing FTP server: %w", err)
+	}
+	if r.cfg.TLS == "implicit" {
+		conn = tls.Client(conn, r.tls)
+	}
+	c := &ftpConn{conn: conn, text: textproto.NewConn(conn)}
+	fail := func(format string, err error) (*ftpConn, error) {
+		c.close()
+		return nil, fmt.Errorf(format, err)
+	}
+	conn.SetDeadline(time.Now().Add(ftpTimeout))
+	if _, _, err := c.text.ReadResponse(220); err != nil {
+		return fail("FTP greeting: %w", err)
+	}
+	if r.cfg.TLS == "explicit" {
+		if _, _, err := c.cmd(234, "AUTH TLS"); err != nil {
+			return fail("FTP server refused TLS: %w", err)
+		}
+		tlsConn := tls.Client(conn, r.tls)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fail("TLS handshake: %w", err)
+		}
+		c.conn, c.text = tlsConn, textproto.NewConn(tlsConn)
+	}
+	user := r.cfg.Username
+	if user == "" {
+		user = "anonymous"
+	}
+	code, _, err := c.cmd(0, "USER %s", user)
+	if err == nil && code == 331 {
+		code, _, err = c.cmd(0, "PASS %s", r.pass)
+	}
+	if err == nil && code != 230 {
+		err = fmt.Errorf("server replied %d", code)
+	}
+	if err != nil {
+		return fail("FTP login failed: %w", err)
+	}
+	if r.cfg.TLS != "" {
+		if _, _, err := c.cmd(200, "PBSZ 0"); err != nil {
+			return fail("FTP PBSZ: %w", err)
+		}
+		if _, _, err := c.cmd(200, "PROT P"); err != nil {
+			return fail("FTP server refused encrypted data connections: %w", err)
+		}
+	}
+	if _, _, err := c.cmd(200, "TYPE I"); err != nil {
+		return fail("FTP binary mode: %w", err)
+	}
+	return c, nil
+}
+
+// cmd sends one command and reads its reply. With expect 0 any reply that
+// isn't an error is returned; otherwise the reply must start with expect.
+func (c *ftpConn) cmd(expect int, format string, args ...any) (int, string, error) {
+	c.conn.SetDeadline(time.Now().Add(ftpTimeout))
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.reply(expect)
+}
+
+func (c *ftpConn) reply(expect int) (int, string, error) {
+	c.conn.SetDeadline(time.Now().Add(ftpTimeout))
+	if expect == 0 {
+		code, msg, err := c.text.ReadResponse(0)
+		if err == nil && code >= 400 {
+			err = &textproto.Error{Code: code, Msg: msg}
+		}
+		return code, msg, err
+	}
+	return c.text.ReadResponse(expect)
+}
+
+func (c *ftpConn) close() { c.conn.Close() }
+
+// get returns an idle connection, or a new one.
+func (r *ftpRemote) get(ctx context.Context) (*ftpConn, error) {
+	r.mu.Lock()
+	if n := len(r.idle); n > 0 {
+		c := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mu.Unlock()
+		// The server may have dropped it while idle.
+		if _, _, err := c.cmd(200, "NOOP"); err == nil {
+			return c, nil
+		}
+		c.close()
+		return r.dial(ctx)
+	}
+	r.mu.Unlock()
+	return r.dial(ctx)
+}
+
+// put keeps c for reuse.
+func (r *ftpRemote) put(c *ftpConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.idle) >= ftpIdleConns {
+		c.close()
+		return
+	}
+	r.idle = append(r.idle, c)
+}
+
+// with runs fn on a connection, which is closed after a failure that may
+// have left it out of step with the server, and kept otherwise.
+func (r *ftpRemote) with(ctx context.Context, fn func(c *ftpConn) error) error {
+	c, err := r.get(ctx)
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, c.close)
+	err = fn(c)
+	if !stop() {
+		return ctx.Err()
+	}
+	var te *textproto.Error
+	if err != nil && !errors.As(err, &te) {
+		c.close()
+		return err
+	}
+	r.put(c)
+	return err
+}
+
+// ftpMissing reports whether err is a 550, which FTP uses for no such file.
+func ftpMissing(err error) bool {
+	var te *textproto.Error
+	return errors.As(err, &te) && te.Code == 550
+}
+
+// size returns the size of the file p.
+func (c *ftpConn) size(p string) (int64, error) {
+	_, msg, err := c.cmd(213, "SIZE %s", p)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+}
+
+func (r *ftpRemote) exists(ctx context.Context, p string) (bool, error) {
+	var found bool
+	err := r.with(ctx, func(c *ftpConn) error {
+		if _, err := c.size(r.abs(p)); err == nil {
+			found = true
+			return nil
+		}
+		// Folders have no size; see if one can be entered.
+		_, _, err := c.cmd(250, "CWD %s", r.abs(p))
+		if ftpMissing(err) {
+			return nil
+		}
+		found = err == nil
+		return err
+	})
+	return found, err
+}
+
+func (r *ftpRemote) remove(ctx context.Context, p string) error {
+	return r.with(ctx, func(c *ftpConn) error {
+		_, _, err := c.cmd(250, "DELE %s", r.abs(p))
+		if ftpMissing(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+// mkdirAll creates dir and its parents. Servers refuse to create a folder
+// that exists with one error code or another, so refusals are ignored, as
+// mkdirAllSMB ignores them; the upload fails if the folder is really missing.
+func (c *ftpConn) mkdirAll(dir string) error {
+	current := ""
+	for _, part := range strings.Split(strings.Trim(dir, "/"), "/") {
+		current += "/" + part
+		var te *textproto.Error
+		if _, _, err := c.cmd(257, "MKD %s", current); err != nil && !errors.As(err, &te) {
+			return err
+		}
+	}
+	return nil
+}
+
+// store uploads from src to p over a new data connection, returning the
+// bytes sent.
+func (r *ftpRemote) store(c *ftpConn, p string, src io.Reader) (int64, error) {
+	var data net.Conn
+	if r.cfg.Active {
+		ln, err := r.listenActive(c)
+		if err != nil {
+			return 0, err
+		}
+		defer ln.Close()
+		if _, _, err := c.cmd(0, "STOR %s", p); err != nil {
+			return 0, err
+		}
+		ln.(*net.TCPListener).SetDeadline(time.Now().Add(ftpTimeout))
+		if data, err = ln.Accept(); err != nil {
+			return 0, fmt.Errorf("server did not connect for data: %w", err)
+		}
+	} else {
+		addr, err := r.passive(c)
+		if err != nil {
+			return 0, err
+		}
+		if data, err = net.DialTimeout("tcp", addr, ftpTimeout); err != nil {
+			return 0, fmt.Errorf("opening data connection: %w", err)
+		}
+		if _, _, err := c.cmd(0, "STOR %s", p); err != nil {
+			data.Close()
+			return 0, err
+		}
+	}
+	if r.tls != nil {
+		data = tls.Client(data, r.tls)
+	}
+	n, err := io.Copy(deadlineWriter{data}, src)
+	if cerr := data.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return n, err
+	}
+	// 226 once the server has the whole file.
+	_, _, err = c.reply(2)
+	return n, err
+}
+
+// passive asks for a passive data port. The server's own address is used
+// rather than the one PASV reports, which is often a private one behind NAT.
+func (r *ftpRemote) passive(c *ftpConn) (string, error) {
+	host, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	_, msg, err := c.cmd(229, "EPSV")
+	if err == nil {
+		// Entering Extended Passive Mode (|||50001|)
+		start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+		if start >= 0 && end > start+4 {
+			if port, err := strconv.Atoi(msg[start+4 : end]); err == nil {
+				return net.JoinHostPort(host, strconv.Itoa(port)), nil
+			}
+		}
+		return "", fmt.Errorf("unexpected EPSV reply %q", msg)
+	}
+	_, msg, err = c.cmd(227, "PASV")
+	if err != nil {
+		return "", err
+	}
+	// Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+	start, end := strings.Index(msg, "("), strings.LastIndex(msg, ")")
+	var parts []string
+	if start >= 0 && end > start {
+		parts = strings.Split(msg[start+1:end], ",")
+	}
+	if len(parts) != 6 {
+		return "", fmt.Errorf("unexpected PASV reply %q", msg)
+	}
+	hi, err1 := strconv.Atoi(parts[4])
+	lo, err2 := strconv.Atoi(parts[5])
+	if err1 != nil || err2 != nil {
+		return "", fmt.Errorf("unexpected PASV reply %q", msg)
+	}
+	return net.JoinHostPort(host, strconv.Itoa(hi<<8|lo)), nil
+}
+
+// listenActive listens on the control connection's local address and tells
+// the server to connect there.
+func (r *ftpRemote) listenActive(c *ftpConn) (net.Listener, error) {
+	host, _, _ := net.SplitHostPort(c.conn.LocalAddr().String())
+	ln, err := net.Listen("tcp", net.JoinHostPort(host, "0"))
+	if err != nil {
+		return nil, fmt.Errorf("listening for data connection: %w", err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	if ip := net.ParseIP(host).To4(); ip != nil {
+		_, _, err = c.cmd(200, "PORT %d,%d,%d,%d,%d,%d", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff)
+	} else {
+		_, _, err = c.cmd(200, "EPRT |2|%s|%d|", host, port)
+	}
+	if err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// deadlineWriter pushes a connection's deadline forward on every write, so
+// only a stalled transfer times out.
+type deadlineWriter struct{ conn net.Conn }
+
+func (w deadlineWriter) Write(p []byte) (int, error) {
+	w.conn.SetWriteDeadline(time.Now().Add(ftpTimeout))
+	return w.conn.Write(p)
+}
+
+// transfer is transferToSMB for an FTP share. The file is uploaded under a
+// temporary name, its size checked with SIZE, and renamed into place, so a
+// copy that fails never leaves a partial file at the real name.
+func (r *ftpRemote) transfer(ctx context.Context, sourcePath, destPath string, conn *SMBConnection) (copyResult, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: %w", errSourceRead, err)
+	}
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
+	}
+	defer src.Close()
+
+	dest := r.abs(destPath)
+	tmp := path.Join(path.Dir(dest), "."+path.Base(dest)+".partial")
+	slog.Debug("Copying file to FTP", "source", filepath.Base(sourcePath), "destination", dest)
+	h := newHasher(conn.hashAlg)
+	var written int64
+	err = r.with(ctx, func(c *ftpConn) error {
+		dir := path.Dir(dest)
+		if _, ok := conn.createdDirs.Load(dir); !ok {
+			if err := c.mkdirAll(dir); err != nil {
+				return fmt.Errorf("creating directories: %w", err)
+			}
+			conn.createdDirs.Store(dir, struct{}{})
+		}
+		er := newJPEGEditReader(contextReader{ctx, sourceReader{src}}, shareJPEGEdit(conn, sourcePath))
+		var err error
+		written, err = r.store(c, tmp, io.TeeReader(conn.limiter.reader(ctx, er), h))
+		if err != nil {
+			return fmt.Errorf("copying file: %w", err)
+		}
+		if written-er.grown != info.Size() {
+			return fmt.Errorf("%w: wrote %d bytes, source is %d bytes", errSizeMismatch, written-er.grown, info.Size())
+		}
+		if size, err := c.size(tmp); err != nil {
+			return fmt.Errorf("checking copy: %w", err)
+		} else if size != written {
+			return fmt.Errorf("%w: server has %d bytes, %d were sent", errSizeMismatch, size, written)
+		}
+		if _, _, err := c.cmd(350, "RNFR %s", tmp); err != nil {
+			return fmt.Errorf("renaming copy: %w", err)
+		}
+		if _, _, err := c.cmd(250, "RNTO %s", dest); err != nil {
+			return fmt.Errorf("renaming copy: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		r.removePartial(tmp)
+		return copyResult{}, err
+	}
+	return copyResult{DestPath: path.Clean(destPath), Sum: h.Sum(nil), Algorithm: conn.hashAlg}, nil
+}
+
+// removePartial deletes a failed upload's temporary file, on a connection of
+// its own since the failed one may be gone.
+func (r *ftpRemote) removePartial(p string) {
+	ctx, cancel := context.WithTimeout(context.Background(), partialCleanupTimeout)
+	defer cancel()
+	err := r.with(ctx, func(c *ftpConn) error {
+		_, _, err := c.cmd(250, "DELE %s", p)
+		if ftpMissing(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		slog.Warn("Failed to remove partial copy", "path", p, "error", err)
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"golang.org/x/image/draw"
+)
+
+// GalleryConfig turns on a contact sheet: one self-contained HTML page of
+// thumbnails, file names and capture times in every destination shoot
+// folder, for checking coverage without opening the RAWs.
+type GalleryConfig struct {
+	// ThumbnailSize is the longest thumbnail edge in pixels; 240 by default.
+	ThumbnailSize int `yaml:"thumbnail_size,omitempty"`
+}
+
+const (
+	galleryFile          = "gallery.html"
+	defaultThumbnailSize = 240
+)
+
+func (c *GalleryConfig) size() int {
+	if c.ThumbnailSize > 0 {
+		return c.ThumbnailSize
+	}
+	return defaultThumbnailSize
+}
+
+// galleryWriter collects the files each share received and writes the
+// galleries once the copies are done.
+type galleryWriter struct {
+	cfg *GalleryConfig
+
+	mu      sync.Mutex
+	pending map[*SMBConnection]map[string][]galleryItem // conn -> shoot root -> files
+}
+
+// galleryItem is one copied file.
+type galleryItem struct {
+	rel    string // path relative to the shoot folder
+	source string
+	key    string // sequenceKey, to borrow a JPEG sibling's thumbnail
+	taken  time.Time
+}
+
+// newGalleryWriter returns nil when galleries are disabled.
+func newGalleryWriter(cfg *GalleryConfig) *galleryWriter {
+	if cfg == nil {
+		return nil
+	}
+	return &galleryWriter{cfg: cfg, pending: map[*SMBConnection]map[string][]galleryItem{}}
+}
+
+// add records a finished copy of job to conn.
+func (g *galleryWriter) add(conn *SMBConnection, job TransferJob, res copyResult) {
+	root := shootRoot(conn, job.FolderName)
+	rel := strings.TrimPrefix(strings.TrimPrefix(res.DestPath, root), "/")
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	roots := g.pending[conn]
+	if roots == nil {
+		roots = map[string][]galleryItem{}
+		g.pending[conn] = roots
+	}
+	roots[root] = append(roots[root], galleryItem{rel: rel, source: job.SourcePath, key: sequenceKey(job), taken: job.PhotoDate})
+}
+
+// flush writes one gallery per shoot folder per share, keeping the entries
+// an earlier card of the same shoot left in it. Thumbnails are made once per
+// source file, from the embedded EXIF thumbnail where there is one.
+func (g *galleryWriter) flush(ctx context.Context) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	defer func() { g.pending = map[*SMBConnection]map[string][]galleryItem{} }()
+
+	thumbs := map[string][]byte{} // source -> JPEG thumbnail
+	bySibling := map[string][]byte{}
+	for _, roots := range g.pending {
+		for _, items := range roots {
+			for _, it := range items {
+				if _, done := thumbs[it.source]; done || ctx.Err() != nil {
+					continue
+				}
+				thumbs[it.source] = galleryThumbnail(it.source, g.cfg.size())
+				if thumbs[it.source] != nil && isJPEG(it.source) {
+					bySibling[it.key] = thumbs[it.source]
+				}
+			}
+		}
+	}
+	if ctx.Err() != nil {
+		return
+	}
+
+	for conn, roots := range g.pending {
+		for root, items := range roots {
+			entries := map[string]string{}
+			if existing, err := conn.Share.ReadFile(path.Join(root, galleryFile)); err == nil {
+				entries = parseGallery(string(existing))
+			}
+			for _, it := range items {
+				thumb := thumbs[it.source]
+				if thumb == nil {
+					thumb = bySibling[it.key]
+				}
+				entries[it.rel] = galleryEntry(it, thumb)
+			}
+			page := formatGallery(path.Base(root), entries)
+			if err := conn.Share.WriteFile(path.Join(root, galleryFile), []byte(page), 0o644); err != nil {
+				slog.Warn("Failed to write gallery", "folder", root, "share", shareLabel(conn.Config), "error", err)
+				continue
+			}
+			slog.Info("Gallery written", "share", shareLabel(conn.Config), "path", path.Join(root, galleryFile), "files", len(entries))
+		}
+	}
+}
+
+// galleryThumbnail returns a small upright JPEG of the file, or nil for
+// files with no picture SnapVault can read (most RAWs, videos).
+func galleryThumbnail(sourcePath string, size int) []byte {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	orientation := 1
+	if x, err := exif.Decode(f); err == nil {
+		if tag, err := x.Get(exif.Orientation); err == nil {
+			if v, err := tag.Int(0); err == nil {
+				orientation = v
+			}
+		}
+		if data, err := x.JpegThumbnail(); err == nil {
+			if img, err := jpeg.Decode(bytes.NewReader(data)); err == nil {
+				return encodeThumbnail(img, orientation, size)
+			}
+		}
+	}
+	if !isJPEG(sourcePath) {
+		return nil
+	}
+	// No embedded thumbnail: scale the full image, as for preview shares.
+	data, err := renderPreview(sourcePath, &PreviewConfig{MaxDimension: size, Quality: 75})
+	if err != nil {
+		slog.Debug("No gallery thumbnail", "file", sourcePath, "error", err)
+		return nil
+	}
+	return data
+}
+
+func encodeThumbnail(src image.Image, orientation, size int) []byte {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if longest := max(w, h); longest > size {
+		w, h = max(1, w*size/longest), max(1, h*size/longest)
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), src, b, draw.Src, nil)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, orient(scaled, orientation), &jpeg.Options{Quality: 75}); err != nil {
+		return nil
+	}
+	return buf.Bytes()
+}
+
+// Every gallery entry is one line, so the next card of the same shoot can
+// merge into the page without an HTML parser.
+var galleryEntryLine = regexp.MustCompile(`^<figure data-path="([^"]*)" data-taken="([^"]*)">`)
+
+func galleryEntry(it galleryItem, thumb []byte) string {
+	var href strings.Builder
+	for i, seg := range strings.Split(it.rel, "/") {
+		if i > 0 {
+			href.WriteByte('/')
+		}
+		href.WriteString(url.PathEscape(seg))
+	}
+	img := `<div class="none">` + html.EscapeString(strings.TrimPrefix(strings.ToUpper(path.Ext(it.rel)), ".")) + `</div>`
+	if thumb != nil {
+		img = `<img loading="lazy" alt="" src="data:image/jpeg;base64,` + base64.StdEncoding.EncodeToString(thumb) + `">`
+	}
+	return fmt.Sprintf(`<figure data-path="%s" data-taken="%s"><a href="%s">%s</a><figcaption>%s<br><time>%s</time></figcaption></figure>`,
+		html.EscapeString(it.rel), it.taken.UTC().Format(time.RFC3339), html.EscapeString(href.String()), img,
+		html.EscapeString(path.Base(it.rel)), it.taken.Format("2006-01-02 15:04:05"))
+}
+
+// parseGallery returns the entries of an existing gallery by relative path.
+func parseGallery(page string) map[string]string {
+	out := map[string]string{}
+	for _, line := range strings.Split(page, "\n") {
+		if m := galleryEntryLine.FindStringSubmatch(line); m != nil {
+			out[html.UnescapeString(m[1])] = line
+		}
+	}
+	return out
+}
+
+// formatGallery lays the entries out in capture order.
+func formatGallery(title string, entries map[string]string) string {
+	type row struct{ rel, taken, line string }
+	rows := make([]row, 0, len(entries))
+	for rel, line := range entries {
+		taken := ""
+		if m := galleryEntryLine.FindStringSubmatch(line); m != nil {
+			taken = m[2]
+		}
+		rows = append(rows, row{rel, taken, line})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].taken != rows[j].taken {
+			return rows[i].taken < rows[j].taken
+		}
+		return rows[i].rel < rows[j].rel
+	})
+
+	var b strings.Builder
+	title = html.EscapeString(filepath.Base(title))
+	b.WriteString("<!DOCTYPE html>\n<html lang=\"en\"><head><meta charset=\"utf-8\">\n")
+	b.WriteString(`<meta name="viewport" content="width=device-width, initial-scale=1">` + "\n")
+	b.WriteString("<title>" + title + "</title>\n")
+	b.WriteString(`<style>body{font:14px system-ui,sans-serif;margin:1rem;background:#111;color:#ddd}` +
+		`main{display:grid;grid-template-columns:repeat(auto-fill,minmax(180px,1fr));gap:.75rem}` +
+		`figure{margin:0}img,.none{width:100%;aspect-ratio:3/2;object-fit:contain;background:#222;display:block}` +
+		`.none{display:flex;align-items:center;justify-content:center;color:#777}` +
+		`figcaption{font-size:12px;overflow-wrap:anywhere;margin-top:.25rem}time{color:#888}a{color:inherit}</style>` + "\n")
+	fmt.Fprintf(&b, "</head><body>\n<h1>%s</h1>\n<p>%d files</p>\n<main>\n", title, len(rows))
+	for _, r := range rows {
+		b.WriteString(r.line + "\n")
+	}
+	b.WriteString("</main>\n</body></html>\n")
+	return b.String()
+}
@@ -0,0 +1,641 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GoogleDriveConfig makes a share a folder in Google Drive, signed in to with
+// `snapvault google-login`.
+type GoogleDriveConfig struct {
+	// ClientID and ClientSecret are a Google Cloud OAuth client of the
+	// "Desktop app" type. ClientSecret supports ${ENV} expansion.
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// Folder is the folder in My Drive that imports go into, "SnapVault"
+	// by default. SnapVault creates it.
+	Folder string `yaml:"folder,omitempty"`
+	// PhotosAlbum also adds each import's JPEGs and videos to a Google
+	// Photos album named after the shoot.
+	PhotosAlbum bool `yaml:"photos_album,omitempty"`
+}
+
+func (g *GoogleDriveConfig) folder() string {
+	if f := strings.Trim(strings.TrimSpace(g.Folder), "/"); f != "" {
+		return f
+	}
+	return "SnapVault"
+}
+
+func (g *GoogleDriveConfig) validate() error {
+	switch {
+	case strings.TrimSpace(g.ClientID) == "":
+		return errors.New("needs the client_id of a Google Cloud OAuth client")
+	case strings.TrimSpace(g.ClientSecret) == "":
+		return errors.New("needs the client_secret of a Google Cloud OAuth client")
+	case strings.Contains(g.folder(), "/"):
+		return fmt.Errorf("folder %q must be a single folder name", g.Folder)
+	}
+	return nil
+}
+
+const (
+	googleAuthURL   = "https://accounts.google.com/o/oauth2/v2/auth"
+	googleTokenURL  = "https://oauth2.googleapis.com/token"
+	googleDriveAPI  = "https://www.googleapis.com/drive/v3/files"
+	googleUploadAPI = "https://www.googleapis.com/upload/drive/v3/files"
+
+	// Only the files SnapVault creates are visible to it.
+	googleDriveScope  = "https://www.googleapis.com/auth/drive.file"
+	googlePhotosScope = "https://www.googleapis.com/auth/photoslibrary.appendonly"
+
+	googleFolderType = "application/vnd.google-apps.folder"
+
+	// googleRequestTimeout bounds an API request other than an upload.
+	googleRequestTimeout = 30 * time.Second
+)
+
+var errGoogleSignIn = errors.New("not signed in to Google")
+
+// googleScopes are the OAuth scopes cfg needs.
+func googleScopes(cfg *GoogleDriveConfig) []string {
+	scopes := []string{googleDriveScope}
+	if cfg.PhotosAlbum {
+		scopes = append(scopes, googlePhotosScope)
+	}
+	return scopes
+}
+
+// googleState is what `snapvault google-login` leaves in the state
+// directory's google/ for one share, along with the albums made for it.
+type googleState struct {
+	RefreshToken string            `json:"refreshToken"`
+	Scopes       []string          `json:"scopes"`
+	Albums       map[string]string `json:"albums,omitempty"` // Photos album ID by shoot folder
+}
+
+// googleStatePath is where share's googleState is kept.
+func googleStatePath(cfg *Config, share SMBConfig) (string, error) {
+	dir, err := resolveStateDir(cfg)
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "google")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	key := sha256.Sum256([]byte(smbShareKey(share)))
+	return filepath.Join(dir, hex.EncodeToString(key[:8])+".json"), nil
+}
+
+// googleTokens hands out access tokens, refreshing them from the refresh
+// token as they expire.
+type googleTokens struct {
+	clientID, clientSecret, refresh string
+
+	mu      sync.Mutex
+	access  string
+	expires time.Time
+}
+
+type googleTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Scope        string `json:"scope"`
+	Error        string `json:"error"`
+	Description  string `json:"error_description"`
+}
+
+// requestGoogleToken posts form to the token endpoint.
+func requestGoogleToken(ctx context.Context, form url.Values) (*googleTokenResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, googleRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, googleTokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tok googleTokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tok); err != nil {
+		return nil, fmt.Errorf("reading Google token response: %s", resp.Status)
+	}
+	if tok.Error != "" || tok.AccessToken == "" {
+		return nil, fmt.Errorf("Google refused the sign-in: %s %s", tok.Error, tok.Description)
+	}
+	return &tok, nil
+}
+
+func (t *googleTokens) token(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.access != "" && time.Until(t.expires) > time.Minute {
+		return t.access, nil
+	}
+	tok, err := requestGoogleToken(ctx, url.Values{
+		"client_id": {t.clientID}, "client_secret": {t.clientSecret},
+		"refresh_token": {t.refresh}, "grant_type": {"refresh_token"},
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errGoogleSignIn, err)
+	}
+	t.access = tok.AccessToken
+	t.expires = time.Now().Add(time.Duration(tok.ExpiresIn) * time.Second)
+	return t.access, nil
+}
+
+// googleAPIError is an error response from a Google API.
+type googleAPIError struct {
+	Status  string
+	Message string
+}
+
+func (e *googleAPIError) Error() string {
+	if e.Message == "" {
+		return "Google returned " + e.Status
+	}
+	return "Google returned " + e.Status + ": " + e.Message
+}
+
+// googleDo sends req with the account's access token and decodes a JSON
+// response into out, when out is non-nil.
+func googleDo(tokens *googleTokens, req *http.Request, out any) error {
+	token, err := tokens.token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var body struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		if json.Unmarshal(data, &body) != nil {
+			body.Error.Message = strings.TrimSpace(string(data))
+		}
+		return &googleAPIError{Status: resp.Status, Message: body.Error.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+// googleJSON sends a JSON request body, or none when in is nil.
+func googleJSON(ctx context.Context, tokens *googleTokens, method, u string, in, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, googleRequestTimeout)
+	defer cancel()
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = strings.NewReader(string(data))
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return googleDo(tokens, req, out)
+}
+
+// googleDrive is a share's folder in Google Drive.
+type googleDrive struct {
+	cfg    *GoogleDriveConfig
+	tokens *googleTokens
+	photos *googlePhotos // nil unless photos_album is set
+
+	mu      sync.Mutex // held while folders are looked up or created
+	folders map[string]string
+}
+
+// driveFile is the part of a Drive file resource SnapVault asks for.
+type driveFile struct {
+	ID     string `json:"id"`
+	Size   string `json:"size"`
+	MD5    string `json:"md5Checksum"`
+	SHA256 string `json:"sha256Checksum"`
+}
+
+const driveFileFields = "id,size,md5Checksum,sha256Checksum"
+
+func newGoogleDrive(ctx context.Context, cfg *Config, share SMBConfig) (*googleDrive, error) {
+	g := share.GoogleDrive
+	statePath, err := googleStatePath(cfg, share)
+	if err != nil {
+		return nil, fmt.Errorf("locating Google sign-in: %w", err)
+	}
+	var state googleState
+	if err := readStateFile(statePath, &state); err != nil {
+		return nil, err
+	}
+	login := fmt.Sprintf("run snapvault google-login -share %q", shareLabel(share))
+	if state.RefreshToken == "" {
+		return nil, fmt.Errorf("%w; %s", errGoogleSignIn, login)
+	}
+	for _, scope := range googleScopes(g) {
+		if !slices.Contains(state.Scopes, scope) {
+			return nil, fmt.Errorf("signed in to Google without access to %s; %s again", path.Base(scope), login)
+		}
+	}
+	d := &googleDrive{
+		cfg:     g,
+		tokens:  &googleTokens{clientID: g.ClientID, clientSecret: os.ExpandEnv(g.ClientSecret), refresh: state.RefreshToken},
+		folders: map[string]string{},
+	}
+	if _, err := d.tokens.token(ctx); err != nil {
+		return nil, fmt.Errorf("%w; %s", err, login)
+	}
+	if g.PhotosAlbum {
+		d.photos = &googlePhotos{tokens: d.tokens, statePath: statePath, albums: state.Albums}
+	}
+	return d, nil
+}
+
+func (d *googleDrive) kind() string { return "Google Drive" }
+
+// driveQuote quotes s for a Drive search query.
+func driveQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// child finds the file or folder called name in the folder parent.
+func (d *googleDrive) child(ctx context.Context, parent, name string, folder bool) (*driveFile, error) {
+	q := fmt.Sprintf("name = %s and %s in parents and trashed = false", driveQuote(name), driveQuote(parent))
+	if folder {
+		q += " and mimeType = " + driveQuote(googleFolderType)
+	}
+	var list struct {
+		Files []driveFile `json:"files"`
+	}
+	u := googleDriveAPI + "?" + url.Values{"q": {q}, "fields": {"files(" + driveFileFields + ")"}, "spaces": {"drive"}}.Encode()
+	if err := googleJSON(ctx, d.tokens, http.MethodGet, u, nil, &list); err != nil {
+		return nil, err
+	}
+	if len(list.Files) == 0 {
+		return nil, nil
+	}
+	return &list.Files[0], nil
+}
+
+// folderID returns the ID of the folder dir, slash-separated and under the
+// share's folder, creating the folders that are missing when create is set.
+// It returns "" for a missing folder otherwise. Drive allows two folders of
+// the same name side by side, so lookups are serialized.
+func (d *googleDrive) folderID(ctx context.Context, dir string, create bool) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	segs := []string{d.cfg.folder()}
+	for _, s := range strings.Split(strings.Trim(dir, "/"), "/") {
+		if s != "" && s != "." {
+			segs = append(segs, s)
+		}
+	}
+	id, at := "root", ""
+	for _, name := range segs {
+		at = path.Join(at, name)
+		if known, ok := d.folders[at]; ok {
+			id = known
+			continue
+		}
+		f, err := d.child(ctx, id, name, true)
+		if err != nil {
+			return "", fmt.Errorf("looking up folder %s: %w", at, err)
+		}
+		if f == nil {
+			if !create {
+				return "", nil
+			}
+			f = &driveFile{}
+			meta := map[string]any{"name": name, "mimeType": googleFolderType, "parents": []string{id}}
+			if err := googleJSON(ctx, d.tokens, http.MethodPost, googleDriveAPI+"?fields=id", meta, f); err != nil {
+				return "", fmt.Errorf("creating folder %s: %w", at, err)
+			}
+		}
+		d.folders[at] = f.ID
+		id = f.ID
+	}
+	return id, nil
+}
+
+// lookup finds the file or folder p, or returns nil.
+func (d *googleDrive) lookup(ctx context.Context, p string) (*driveFile, error) {
+	parent, err := d.folderID(ctx, path.Dir(p), false)
+	if err != nil || parent == "" {
+		return nil, err
+	}
+	return d.child(ctx, parent, path.Base(p), false)
+}
+
+func (d *googleDrive) exists(ctx context.Context, p string) (bool, error) {
+	f, err := d.lookup(ctx, p)
+	return f != nil, err
+}
+
+// remove moves p to the Drive trash, where it stays for 30 days.
+func (d *googleDrive) remove(ctx context.Context, p string) error {
+	f, err := d.lookup(ctx, p)
+	if err != nil || f == nil {
+		return err
+	}
+	return googleJSON(ctx, d.tokens, http.MethodPatch, googleDriveAPI+"/"+f.ID, map[string]any{"trashed": true}, nil)
+}
+
+// transfer is transferToSMB for Google Drive. The file goes up in one
+// resumable-upload request, through the same edits, checksum and bandwidth
+// limit as an SMB copy, replacing a file of the same name; Drive's MD5 (and
+// SHA-256, when the share uses it) of the result is then checked against
+// what was sent.
+func (d *googleDrive) transfer(ctx context.Context, sourcePath, destPath string, conn *SMBConnection) (copyResult, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: %w", errSourceRead, err)
+	}
+	edit := shareJPEGEdit(conn, sourcePath)
+	size := info.Size()
+	if !edit.none() {
+		// The upload is announced with its size.
+		if size, err = editedSize(ctx, sourcePath, edit); err != nil {
+			return copyResult{}, err
+		}
+	}
+	parent, err := d.folderID(ctx, path.Dir(destPath), true)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("creating directories: %w", err)
+	}
+	existing, err := d.child(ctx, parent, path.Base(destPath), false)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("checking %s: %w", path.Base(destPath), err)
+	}
+
+	// Start the upload session: a new file, or new content for the old one.
+	method, u := http.MethodPost, googleUploadAPI+"?uploadType=resumable&fields="+driveFileFields
+	meta := map[string]any{"name": path.Base(destPath), "modifiedTime": info.ModTime().UTC().Format(time.RFC3339)}
+	if existing != nil {
+		method, u = http.MethodPatch, googleUploadAPI+"/"+existing.ID+"?uploadType=resumable&fields="+driveFileFields
+	} else {
+		meta["parents"] = []string{parent}
+	}
+	data, _ := json.Marshal(meta)
+	startCtx, cancel := context.WithTimeout(ctx, googleRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(startCtx, method, u, strings.NewReader(string(data)))
+	if err != nil {
+		return copyResult{}, err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	session, err := d.startUpload(req)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("starting upload: %w", err)
+	}
+
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
+	}
+	defer src.Close()
+	slog.Debug("Copying file to Google Drive", "source", filepath.Base(sourcePath), "destination", destPath)
+	h, sum := newHasher(conn.hashAlg), md5.New()
+	r := newJPEGEditReader(contextReader{ctx, sourceReader{src}}, edit)
+	pr, pw := io.Pipe()
+	copied := make(chan int64, 1)
+	go func() {
+		n, err := io.Copy(io.MultiWriter(conn.limiter.writer(ctx, pw), h, sum), r)
+		pw.CloseWithError(err)
+		copied <- n
+	}()
+	put, err := http.NewRequestWithContext(ctx, http.MethodPut, session, pr)
+	if err != nil {
+		pr.Close()
+		<-copied
+		return copyResult{}, err
+	}
+	put.ContentLength = size
+	var f driveFile
+	err = googleDo(d.tokens, put, &f)
+	pr.CloseWithError(io.ErrClosedPipe)
+	written := <-copied
+	if err != nil {
+		// An unfinished resumable upload leaves nothing behind.
+		return copyResult{}, fmt.Errorf("copying file: %w", err)
+	}
+	if written-r.grown != info.Size() {
+		d.remove(ctx, destPath)
+		return copyResult{}, fmt.Errorf("%w: wrote %d bytes, source is %d bytes", errSizeMismatch, written-r.grown, info.Size())
+	}
+	if remote, _ := strconv.ParseInt(f.Size, 10, 64); remote != written {
+		return copyResult{}, fmt.Errorf("%w: Drive has %d bytes, %d were sent", errSizeMismatch, remote, written)
+	}
+	if !strings.EqualFold(f.MD5, hex.EncodeToString(sum.Sum(nil))) {
+		return copyResult{}, fmt.Errorf("%w (md5)", errRemoteChecksum)
+	}
+	res := copyResult{DestPath: destPath, Sum: h.Sum(nil), Algorithm: conn.hashAlg}
+	if conn.hashAlg == hashSHA256 && f.SHA256 != "" && !strings.EqualFold(f.SHA256, hex.EncodeToString(res.Sum)) {
+		return copyResult{}, fmt.Errorf("%w (sha256)", errRemoteChecksum)
+	}
+
+	if d.photos != nil && (isJPEG(sourcePath) || videoExtensions[strings.ToLower(filepath.Ext(sourcePath))]) {
+		shoot := strings.SplitN(strings.TrimPrefix(strings.TrimPrefix(destPath, shootRoot(conn, "")), "/"), "/", 2)[0]
+		if err := d.photos.add(ctx, sourcePath, path.Base(destPath), shoot, edit, size); err != nil {
+			// Drive holds the copy; the album is a convenience.
+			slog.Warn("Failed to add file to Google Photos album", "file", path.Base(destPath), "album", shoot, "error", err)
+		}
+	}
+	return res, nil
+}
+
+// startUpload opens a resumable upload session and returns its URL.
+func (d *googleDrive) startUpload(req *http.Request) (string, error) {
+	token, err := d.tokens.token(req.Context())
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return "", &googleAPIError{Status: resp.Status, Message: strings.TrimSpace(string(msg))}
+	}
+	loc := resp.Header.Get("Location")
+	if loc == "" {
+		return "", errors.New("Google returned no upload URL")
+	}
+	return loc, nil
+}
+
+// runGoogleLoginCommand signs a Google Drive share in to its Google account:
+// it opens Google's consent page and waits for the browser to come back to
+// a listener on 127.0.0.1 with the grant.
+func runGoogleLoginCommand(args []string) int {
+	fs := flag.NewFlagSet("google-login", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	shareName := fs.String("share", "", "Google Drive share to sign in, by name")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault google-login -share <share>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *shareName == "" {
+		fs.Usage()
+		return exitUsage
+	}
+	if err := checkConfigPermissions(*common.configPath); err != nil && !*common.insecure {
+		slog.Error("Refusing to use config", "error", err)
+		return exitConfig
+	}
+	config, err := loadConfig(*common.configPath, *common.profile, *common.overrides)
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return exitConfig
+	}
+	var share *SMBConfig
+	for i := range config.SMBShares {
+		if matchesShareName(config.SMBShares[i], *shareName) && config.SMBShares[i].GoogleDrive != nil {
+			share = &config.SMBShares[i]
+			break
+		}
+	}
+	if share == nil {
+		fmt.Fprintf(os.Stderr, "no Google Drive share named %q\n", *shareName)
+		return exitUsage
+	}
+	statePath, err := googleStatePath(config, *share)
+	if err != nil {
+		slog.Error("Failed to locate the state directory", "error", err)
+		return 1
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+	state, err := googleSignIn(ctx, share.GoogleDrive)
+	if err != nil {
+		slog.Error("Google sign-in failed", "error", err)
+		return 1
+	}
+	var old googleState
+	if readStateFile(statePath, &old) == nil {
+		state.Albums = old.Albums
+	}
+	if err := writeStateFile(statePath, state); err != nil {
+		slog.Error("Failed to save Google sign-in", "error", err)
+		return 1
+	}
+	fmt.Printf("Signed in; %s can now receive imports.\n", shareLabel(*share))
+	return 0
+}
+
+// googleSignIn runs the OAuth flow for installed apps, with PKCE.
+func googleSignIn(ctx context.Context, g *GoogleDriveConfig) (*googleState, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	redirect := "http://" + ln.Addr().String() + "/"
+
+	buf := make([]byte, 48)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(buf[:32])
+	stateToken := base64.RawURLEncoding.EncodeToString(buf[32:])
+	challenge := sha256.Sum256([]byte(verifier))
+	scopes := googleScopes(g)
+	authURL := googleAuthURL + "?" + url.Values{
+		"client_id": {g.ClientID}, "redirect_uri": {redirect}, "response_type": {"code"},
+		"scope": {strings.Join(scopes, " ")}, "access_type": {"offline"}, "prompt": {"consent"},
+		"state": {stateToken}, "code_challenge": {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+
+	codes := make(chan string, 1)
+	errs := make(chan error, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		switch {
+		case q.Get("state") != stateToken:
+			http.Error(w, "Unexpected sign-in response.", http.StatusBadRequest)
+			return
+		case q.Get("error") != "":
+			fmt.Fprintln(w, "Sign-in was cancelled. You can close this tab.")
+			errs <- fmt.Errorf("Google sign-in: %s", q.Get("error"))
+			return
+		}
+		fmt.Fprintln(w, "Signed in to SnapVault. You can close this tab.")
+		codes <- q.Get("code")
+	})}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	fmt.Printf("Opening Google sign-in in your browser. If it doesn't open, visit:\n\n  %s\n\n", authURL)
+	openInBrowser(authURL)
+	var code string
+	select {
+	case code = <-codes:
+	case err := <-errs:
+		return nil, err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	tok, err := requestGoogleToken(ctx, url.Values{
+		"client_id": {g.ClientID}, "client_secret": {os.ExpandEnv(g.ClientSecret)},
+		"code": {code}, "code_verifier": {verifier}, "redirect_uri": {redirect},
+		"grant_type": {"authorization_code"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tok.RefreshToken == "" {
+		return nil, errors.New("Google returned no refresh token")
+	}
+	granted := strings.Fields(tok.Scope)
+	for _, scope := range scopes {
+		if !slices.Contains(granted, scope) {
+			return nil, fmt.Errorf("access to %s was not granted", path.Base(scope))
+		}
+	}
+	return &googleState{RefreshToken: tok.RefreshToken, Scopes: granted}, nil
+}
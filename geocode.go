@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/sams96/rgeo"
+	"github.com/twpayne/go-geom"
+)
+
+// placeIndex is the offline reverse geocoder. It is built on first use, which
+// takes a few seconds, so runs whose templates don't use {{.Location}} never
+// pay for it.
+var placeIndex = sync.OnceValues(func() (*rgeo.Rgeo, error) {
+	return rgeo.New(rgeo.Provinces10, rgeo.Cities10)
+})
+
+// placeName is the coarsest useful name for a coordinate: the city when the
+// point lies in a known urban area, otherwise the province or country. Points
+// at sea give "".
+func placeName(lat, long float64) string {
+	r, err := placeIndex()
+	if err != nil {
+		slog.Warn("Reverse geocoding unavailable", "error", err)
+		return ""
+	}
+	loc, err := r.ReverseGeocode(geom.Coord{long, lat})
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{loc.City, loc.Province, loc.Country} {
+		if name = strings.TrimSpace(strings.NewReplacer("/", "-", `\`, "-", ":", "-").Replace(name)); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// photoLocation reads the GPS position from a file's EXIF and names it.
+func photoLocation(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	x, err := exif.Decode(f)
+	if err != nil {
+		return ""
+	}
+	lat, long, err := x.LatLong()
+	if err != nil || (lat == 0 && long == 0) {
+		return ""
+	}
+	return placeName(lat, long)
+}
+
+// locateJobs sets Location on every job with a GPS position. RAW files whose
+// EXIF goexif cannot read take the location of their JPEG sibling.
+func locateJobs(ctx context.Context, jobs []TransferJob) {
+	slog.Info("Looking up photo locations", "files", len(jobs))
+	siblings := map[string]string{}
+	for i := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		jobs[i].Location = photoLocation(jobs[i].SourcePath)
+		if jobs[i].Location != "" {
+			siblings[sequenceKey(jobs[i])] = jobs[i].Location
+		}
+	}
+	for i := range jobs {
+		if jobs[i].Location == "" {
+			jobs[i].Location = siblings[sequenceKey(jobs[i])]
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const googlePhotosAPI = "https://photoslibrary.googleapis.com/v1"
+
+// googlePhotos adds a Google Drive share's JPEGs and videos to one Google
+// Photos album per shoot. Apps may only add to albums they made, so the
+// albums are remembered in the share's googleState rather than looked up.
+type googlePhotos struct {
+	tokens    *googleTokens
+	statePath string
+
+	mu     sync.Mutex
+	albums map[string]string // album ID by shoot folder
+}
+
+// album returns the ID of shoot's album, creating it the first time.
+func (p *googlePhotos) album(ctx context.Context, shoot string) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id := p.albums[shoot]; id != "" {
+		return id, nil
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	body := map[string]any{"album": map[string]string{"title": shoot}}
+	if err := googleJSON(ctx, p.tokens, http.MethodPost, googlePhotosAPI+"/albums", body, &created); err != nil {
+		return "", fmt.Errorf("creating album: %w", err)
+	}
+	if p.albums == nil {
+		p.albums = map[string]string{}
+	}
+	p.albums[shoot] = created.ID
+
+	var state googleState
+	err := readStateFile(p.statePath, &state)
+	if err == nil {
+		state.Albums = p.albums
+		err = writeStateFile(p.statePath, state)
+	}
+	if err != nil {
+		// A later run makes a second album of the same name.
+		return created.ID, fmt.Errorf("remembering album: %w", err)
+	}
+	return created.ID, nil
+}
+
+// add uploads sourcePath, with edit applied and size bytes long, into
+// shoot's album as name.
+func (p *googlePhotos) add(ctx context.Context, sourcePath, name, shoot string, edit jpegEdit, size int64) error {
+	albumID, err := p.album(ctx, shoot)
+	if albumID == "" {
+		return err
+	}
+
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
+	}
+	defer src.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, googlePhotosAPI+"/uploads",
+		io.NopCloser(newJPEGEditReader(contextReader{ctx, sourceReader{src}}, edit)))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Goog-Upload-Protocol", "raw")
+	req.Header.Set("X-Goog-Upload-File-Name", name)
+	if t := mime.TypeByExtension(strings.ToLower(filepath.Ext(name))); t != "" {
+		req.Header.Set("X-Goog-Upload-Content-Type", t)
+	}
+	token, err := p.tokens.token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("uploading: %w", err)
+	}
+	uploadToken, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	if resp.StatusCode >= 300 || len(uploadToken) == 0 {
+		return &googleAPIError{Status: resp.Status, Message: strings.TrimSpace(string(uploadToken))}
+	}
+
+	var result struct {
+		Results []struct {
+			Status struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"status"`
+		} `json:"newMediaItemResults"`
+	}
+	body := map[string]any{
+		"albumId": albumID,
+		"newMediaItems": []map[string]any{{
+			"simpleMediaItem": map[string]string{"uploadToken": string(uploadToken), "fileName": name},
+		}},
+	}
+	if err := googleJSON(ctx, p.tokens, http.MethodPost, googlePhotosAPI+"/mediaItems:batchCreate", body, &result); err != nil {
+		return fmt.Errorf("adding to album: %w", err)
+	}
+	for _, r := range result.Results {
+		if r.Status.Code != 0 {
+			return fmt.Errorf("adding to album: %s (code %s)", r.Status.Message, strconv.Itoa(r.Status.Code))
+		}
+	}
+	return nil
+}
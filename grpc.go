@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/KiranTheRam/SnapVault/controlpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCConfig secures the gRPC control API. Anything that can reach the port
+// can start and cancel imports, so listening beyond loopback requires both
+// a token and TLS.
+type GRPCConfig struct {
+	// Token must be sent with every call as "authorization: Bearer <token>"
+	// metadata. Supports ${ENV} expansion.
+	Token string `yaml:"token,omitempty"`
+	// TLS certificate and key. Both must be set to enable it.
+	TLSCert string `yaml:"tls_cert,omitempty"`
+	TLSKey  string `yaml:"tls_key,omitempty"`
+}
+
+// controlServer exposes the web server's job machinery over gRPC so a central
+// orchestration service can drive several ingest stations.
+type controlServer struct {
+	controlpb.UnimplementedControlServer
+	web *webServer
+}
+
+// startGRPC listens on addr and serves the Control API in the background
+// until the listener fails. It refuses an address reachable from other
+// machines unless cfg sets a token and TLS.
+func startGRPC(addr string, cfg *GRPCConfig, web *webServer) error {
+	if cfg == nil {
+		cfg = &GRPCConfig{}
+	}
+	token := strings.TrimSpace(os.ExpandEnv(cfg.Token))
+	if token != "" && len(token) < minUploadToken {
+		return fmt.Errorf("grpc.token must be at least %d characters", minUploadToken)
+	}
+	useTLS := cfg.TLSCert != "" && cfg.TLSKey != ""
+	if !isLoopbackAddr(addr) && (token == "" || !useTLS) {
+		return fmt.Errorf("-grpc-addr %s is reachable from other machines: set grpc.token, grpc.tls_cert and grpc.tls_key in config, or listen on 127.0.0.1", addr)
+	}
+
+	var opts []grpc.ServerOption
+	if useTLS {
+		creds, err := credentials.NewServerTLSFromFile(cfg.TLSCert, cfg.TLSKey)
+		if err != nil {
+			return fmt.Errorf("loading gRPC TLS certificate: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	if token != "" {
+		auth := grpcTokenAuth(token)
+		opts = append(opts,
+			grpc.UnaryInterceptor(func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+				if err := auth(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.StreamInterceptor(func(srv any, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := auth(ss.Context()); err != nil {
+					return err
+				}
+				return handler(srv, ss)
+			}))
+	}
+
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listening for gRPC: %w", err)
+	}
+	srv := grpc.NewServer(opts...)
+	controlpb.RegisterControlServer(srv, &controlServer{web: web})
+	slog.Info("SnapVault gRPC control API listening", "addr", addr, "tls", useTLS, "token", token != "")
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			slog.Error("gRPC control API stopped", "error", err)
+		}
+	}()
+	return nil
+}
+
+// grpcTokenAuth checks a call's bearer token in constant time.
+func grpcTokenAuth(token string) func(context.Context) error {
+	return func(ctx context.Context) error {
+		md, _ := metadata.FromIncomingContext(ctx)
+		for _, v := range md.Get("authorization") {
+			bearer, ok := strings.CutPrefix(v, "Bearer ")
+			if ok && subtle.ConstantTimeCompare([]byte(strings.TrimSpace(bearer)), []byte(token)) == 1 {
+				return nil
+			}
+		}
+		return status.Error(codes.Unauthenticated, "missing or invalid token")
+	}
+}
+
+// isLoopbackAddr reports whether a listen address only accepts connections
+// from this machine. An empty host listens on every interface.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (c *controlServer) StartImport(ctx context.Context, req *controlpb.StartImportRequest) (*controlpb.Import, error) {
+	mount := strings.TrimSpace(req.GetMount())
+	name := strings.TrimSpace(req.GetName())
+	if mount == "" || name == "" {
+		return nil, status.Error(codes.InvalidArgument, "mount and name are required")
+	}
+	if err := validateMountPath(mount); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid mount path: %v", err)
+	}
+	shares := c.web.resolveShares(req.GetShares())
+	if len(shares) == 0 {
+		return nil, status.Error(codes.FailedPrecondition, "no matching shares are configured")
+	}
+	job, running := c.web.launchJob(mount, name, shares, false)
+	if running != nil {
+		return nil, status.Errorf(codes.AlreadyExists, "import %s is already reading %s", running.id, mount)
+	}
+	return importToProto(job.status()), nil
+}
+
+func (c *controlServer) GetImport(ctx context.Context, req *controlpb.GetImportRequest) (*controlpb.Import, error) {
+	job := c.web.findJob(req.GetId())
+	if job == nil {
+		return nil, status.Error(codes.NotFound, "no such import")
+	}
+	return importToProto(job.status()), nil
+}
+
+func (c *controlServer) ListImports(ctx context.Context, req *controlpb.ListImportsRequest) (*controlpb.ListImportsResponse, error) {
+	c.web.mu.Lock()
+	jobs := append([]*transferJob(nil), c.web.jobs...)
+	c.web.mu.Unlock()
+	resp := &controlpb.ListImportsResponse{}
+	for i := len(jobs) - 1; i >= 0; i-- {
+		resp.Imports = append(resp.Imports, importToProto(jobs[i].status()))
+	}
+	return resp, nil
+}
+
+func (c *controlServer) CancelImport(ctx context.Context, req *controlpb.CancelImportRequest) (*controlpb.Import, error) {
+	job := c.web.findJob(req.GetId())
+	if job == nil {
+		return nil, status.Error(codes.NotFound, "no such import")
+	}
+	if job.isDone() {
+		return nil, status.Error(codes.FailedPrecondition, "import has already finished")
+	}
+	job.requestCancel()
+	return importToProto(job.status()), nil
+}
+
+func (c *controlServer) WatchImport(req *controlpb.WatchImportRequest, stream controlpb.Control_WatchImportServer) error {
+	job := c.web.findJob(req.GetId())
+	if job == nil {
+		return status.Error(codes.NotFound, "no such import")
+	}
+
+	ch, _ := job.subscribe()
+	defer job.unsubscribe(ch)
+
+	send := func(typ string) error {
+		return stream.Send(&controlpb.ImportEvent{Type: typ, Import: importToProto(job.status())})
+	}
+	if err := send("progress"); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case ev, open := <-ch:
+			if !open || ev.Type == "finished" {
+				return send("finished")
+			}
+			if err := send("progress"); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func importToProto(st importStatus) *controlpb.Import {
+	out := &controlpb.Import{
+		Id:              st.ID,
+		State:           st.State,
+		FolderName:      st.FolderName,
+		Mount:           st.Mount,
+		Total:           int32(st.Total),
+		Completed:       int32(st.Completed),
+		CurrentFile:     st.CurrentFile,
+		StartedAtUnixMs: st.StartedAt.UnixMilli(),
+		DurationMs:      st.DurationMs,
+		FatalError:      st.FatalError,
+	}
+	if st.EndedAt != nil {
+		out.EndedAtUnixMs = st.EndedAt.UnixMilli()
+	}
+	for _, e := range st.Errors {
+		out.Errors = append(out.Errors, &controlpb.FileError{File: e.File, Share: e.Share, Error: e.Error})
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"strings"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/zeebo/blake3"
+)
+
+// Supported checksum algorithms for manifests and duplicate detection.
+const (
+	hashSHA256 = "sha256"
+	hashBLAKE3 = "blake3"
+	hashXXH64  = "xxh64"
+)
+
+// normalizeHashAlgorithm maps user spellings onto a supported algorithm;
+// empty means SHA-256.
+func normalizeHashAlgorithm(name string) (string, error) {
+	switch strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), "-", "")) {
+	case "", "sha256":
+		return hashSHA256, nil
+	case "blake3", "b3":
+		return hashBLAKE3, nil
+	case "xxh64", "xxhash", "xxhash64":
+		return hashXXH64, nil
+	default:
+		return "", fmt.Errorf("unknown hash algorithm %q (use sha256, blake3 or xxhash)", name)
+	}
+}
+
+// newHasher returns a fresh hash for a normalized algorithm name.
+func newHasher(alg string) hash.Hash {
+	switch alg {
+	case hashBLAKE3:
+		return blake3.New()
+	case hashXXH64:
+		return xxhash.New()
+	default:
+		return sha256.New()
+	}
+}
+
+// manifestNames returns the folder manifest and sidecar extension matching
+// the naming of each algorithm's usual command-line tool (sha256sum, b3sum, xxhsum).
+func manifestNames(alg string) (folderFile, sidecarExt string) {
+	switch alg {
+	case hashBLAKE3:
+		return "B3SUMS", ".b3"
+	case hashXXH64:
+		return "XXH64SUMS", ".xxh64"
+	default:
+		return "SHA256SUMS", ".sha256"
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runHistoryCommand implements `snapvault history`: past imports from the run
+// journals, optionally narrowed to one shoot or one card.
+func runHistoryCommand(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	limit := fs.Int("n", 20, "Show at most this many runs, newest first (0 for all)")
+	name := fs.String("name", "", "Only runs into shoot folders containing this text")
+	card := fs.String("card", "", "Only runs that imported from this card (volume ID or label)")
+	files := fs.Bool("files", false, "List every file each run copied")
+	all := fs.Bool("all", false, "Include runs that were undone")
+	remote := fs.Bool("remote", false, "List the imports recorded on the shares, from any machine, instead of this machine's journals")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault history [-name <shoot>] [-card <id or label>] [-files] [-n 20]")
+		fmt.Fprintln(fs.Output(), "       snapvault history -remote [-name <shoot>] [-n 20]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *remote {
+		return runRemoteHistory(common, *name, *limit)
+	}
+
+	config, err := loadConfig(*common.configPath, *common.profile, *common.overrides)
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return 1
+	}
+	journals, err := loadJournals(config)
+	if err != nil {
+		slog.Error("Failed to read run journals", "error", err)
+		return 1
+	}
+	catalog, err := readCatalog(config)
+	if err != nil {
+		slog.Error("Failed to read catalog", "error", err)
+		return 1
+	}
+
+	var cardIDs map[string]bool
+	if *card != "" {
+		if cardIDs = matchCards(catalog, *card); len(cardIDs) == 0 {
+			fmt.Fprintf(os.Stderr, "No card %q in the catalog.\n", *card)
+			return 1
+		}
+	}
+
+	shown := 0
+	for _, j := range journals {
+		switch {
+		case j.Undone != nil && !*all:
+			continue
+		case *name != "" && !strings.Contains(strings.ToLower(j.Folder), strings.ToLower(*name)):
+			continue
+		case cardIDs != nil && !j.fromCard(cardIDs, catalog):
+			continue
+		}
+		if *limit > 0 && shown == *limit {
+			fmt.Println("… more runs; use -n 0 to see all")
+			break
+		}
+		shown++
+		printHistoryRun(j, catalog, *files)
+	}
+	if shown == 0 {
+		fmt.Println("No matching runs.")
+	}
+	return 0
+}
+
+// runRemoteHistory lists the import records on the shares, which include
+// runs from machines whose journals this one never saw.
+func runRemoteHistory(common commonFlags, name string, limit int) int {
+	ctx, stop := commandContext()
+	defer stop()
+	_, connections, err := common.connectAll(ctx)
+	if err != nil {
+		slog.Error("Failed to connect to shares", "error", err)
+		return 1
+	}
+	defer closeConnections(connections)
+
+	shown := 0
+	for _, rec := range remoteImportsByRun(ctx, connections) {
+		if name != "" && !strings.Contains(strings.ToLower(rec.Shoot), strings.ToLower(name)) {
+			continue
+		}
+		if limit > 0 && shown == limit {
+			fmt.Println("… more runs; use -n 0 to see all")
+			break
+		}
+		shown++
+		fmt.Printf("%s  %s  %s\n", rec.ID, rec.Started.Format("2006-01-02 15:04"), rec.Shoot)
+		fmt.Printf("  %d files, %s, from %s\n", rec.Files, formatBytes(rec.Bytes), rec.Machine)
+		fmt.Printf("  on %s\n", rec.share)
+	}
+	if shown == 0 {
+		fmt.Println("No matching imports on the shares.")
+	}
+	return 0
+}
+
+// matchCards returns the IDs of the cards whose ID or label is query.
+func matchCards(catalog *catalogData, query string) map[string]bool {
+	ids := map[string]bool{}
+	for id, rec := range catalog.Cards {
+		if strings.EqualFold(id, query) || strings.EqualFold(rec.Label, query) {
+			ids[id] = true
+		}
+	}
+	return ids
+}
+
+// fromCard reports whether the run imported from one of ids. Runs recorded
+// before journals kept card IDs are matched by the mount's name instead.
+func (j *runJournal) fromCard(ids map[string]bool, catalog *catalogData) bool {
+	if len(j.Cards) > 0 {
+		for _, id := range j.Cards {
+			if ids[id] {
+				return true
+			}
+		}
+		return false
+	}
+	for id := range ids {
+		label := catalog.Cards[id].Label
+		for _, src := range j.Sources {
+			if label != "" && strings.EqualFold(filepath.Base(src), label) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func printHistoryRun(j *runJournal, catalog *catalogData, files bool) {
+	sources := map[string]int64{}
+	shares := map[string]int{}
+	for _, f := range j.Files {
+		// Sidecars and proxies share their photo's source; count it once.
+		if f.Size > sources[f.Source] {
+			sources[f.Source] = f.Size
+		}
+		shares[f.Share]++
+	}
+	var bytes int64
+	for _, size := range sources {
+		bytes += size
+	}
+	state := ""
+	if j.Undone != nil {
+		state = "  (undone " + j.Undone.Format("2006-01-02") + ")"
+	}
+	fmt.Printf("%s  %s  %-30s %5d files  %9s%s\n", j.ID, j.StartedAt.Format("2006-01-02 15:04"), j.Folder, len(sources), formatBytes(bytes), state)
+
+	var cards []string
+	for _, id := range j.Cards {
+		label := id
+		if rec := catalog.Cards[id]; rec != nil && rec.Label != "" {
+			label = fmt.Sprintf("%s (%s)", rec.Label, id)
+		}
+		cards = append(cards, label)
+	}
+	if len(cards) == 0 {
+		cards = j.Sources
+	}
+	fmt.Printf("    from %s, took %s\n", strings.Join(cards, ", "), j.EndedAt.Sub(j.StartedAt).Round(time.Second))
+	names := make([]string, 0, len(shares))
+	for share := range shares {
+		names = append(names, share)
+	}
+	sort.Strings(names)
+	for _, share := range names {
+		fmt.Printf("    %-32s %d copies\n", share, shares[share])
+	}
+	if files {
+		entries := append([]journalEntry(nil), j.Files...)
+		sort.Slice(entries, func(a, b int) bool {
+			if entries[a].Path != entries[b].Path {
+				return entries[a].Path < entries[b].Path
+			}
+			return entries[a].Share < entries[b].Share
+		})
+		for _, f := range entries {
+			fmt.Printf("      %s: %s\n", f.Share, f.Path)
+		}
+	}
+}
+
+// runFindCommand implements `snapvault find`: which shares hold a file, by
+// name or checksum, according to the run journals.
+func runFindCommand(args []string) int {
+	fs := flag.NewFlagSet("find", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	all := fs.Bool("all", false, "Include copies removed by undo")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault find [-all] <file name, glob or checksum>")
+		fmt.Fprintln(fs.Output(), "  e.g. snapvault find DSC_0142.NEF, snapvault find 'IMG_12*', snapvault find 9f2c81d0")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	query := fs.Arg(0)
+
+	config, err := loadConfig(*common.configPath, *common.profile, *common.overrides)
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return 1
+	}
+	journals, err := loadJournals(config)
+	if err != nil {
+		slog.Error("Failed to read run journals", "error", err)
+		return 1
+	}
+
+	found := 0
+	for _, j := range journals {
+		if j.Undone != nil && !*all {
+			continue
+		}
+		for _, f := range j.Files {
+			if !matchesFind(f, query) {
+				continue
+			}
+			found++
+			state := ""
+			if j.Undone != nil {
+				state = "  (undone)"
+			}
+			fmt.Printf("%-28s %s  %9s  run %s, %s%s\n", f.Share, f.Path, formatBytes(f.Size), j.ID, filepath.Base(f.Source), state)
+		}
+	}
+	if found == 0 {
+		fmt.Println("Not found in any run journal.")
+		return 1
+	}
+	return 0
+}
+
+// matchesFind compares query with an entry: a hex string of eight or more
+// digits is a checksum prefix, anything else a file name, glob or part of one,
+// ignoring case and Unicode form.
+func matchesFind(f journalEntry, query string) bool {
+	if len(query) >= 8 && isHex(query) && strings.HasPrefix(f.Sum, strings.ToLower(query)) {
+		return true
+	}
+	q := strings.ToLower(nameKey(query))
+	names := []string{path.Base(f.Path)}
+	if strings.EqualFold(path.Ext(f.Path), filepath.Ext(f.Source)) {
+		// Renamed copies are found by their card name too, but not the
+		// sidecars and proxies made from them.
+		names = append(names, filepath.Base(f.Source))
+	}
+	for _, name := range names {
+		name = strings.ToLower(nameKey(name))
+		if strings.ContainsAny(q, "*?[") {
+			if ok, _ := path.Match(q, name); ok {
+				return true
+			}
+		} else if strings.Contains(name, q) {
+			return true
+		}
+	}
+	return false
+}
+
+func isHex(s string) bool {
+	for _, c := range strings.ToLower(s) {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// HTTPReceiverConfig configures the phone upload receiver (-receive-http).
+type HTTPReceiverConfig struct {
+	// Token must be sent with every upload, as "Authorization: Bearer
+	// <token>" or as a "token" form field before the files. Supports ${ENV}
+	// expansion.
+	Token string `yaml:"token"`
+	// Optional HTTPS. Both must be set to enable it.
+	TLSCert string `yaml:"tls_cert,omitempty"`
+	TLSKey  string `yaml:"tls_key,omitempty"`
+	// MaxUploadMB caps one request's size; 4096 when unset.
+	MaxUploadMB int64 `yaml:"max_upload_mb,omitempty"`
+}
+
+// minUploadToken is the shortest token accepted, so a guessable one can't be
+// configured by accident.
+const minUploadToken = 16
+
+// httpReceiver accepts multipart uploads from phones and tablets and fans
+// each file out like the FTP receiver.
+type httpReceiver struct {
+	*liveArchiver
+	token     string
+	maxUpload int64
+}
+
+// uploadResult is one file's outcome in an upload's response.
+type uploadResult struct {
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+	// Skipped is set for files that aren't photos or videos, which are
+	// dropped without failing the upload.
+	Skipped bool   `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func runHTTPReceiver(ctx context.Context, addr string, cfg *Config, folderName string, connections []*SMBConnection) (*transferReport, error) {
+	rc := cfg.HTTPReceiver
+	if rc == nil || len(strings.TrimSpace(os.ExpandEnv(rc.Token))) < minUploadToken {
+		return nil, fmt.Errorf("http_receiver.token must be set in config, at least %d characters", minUploadToken)
+	}
+	live, err := newLiveArchiver(ctx, cfg, folderName, "http://"+addr, connections)
+	if err != nil {
+		return nil, err
+	}
+	r := &httpReceiver{liveArchiver: live, token: strings.TrimSpace(os.ExpandEnv(rc.Token)), maxUpload: rc.MaxUploadMB << 20}
+	if r.maxUpload <= 0 {
+		r.maxUpload = 4096 << 20
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", r.handleForm)
+	mux.HandleFunc("POST /upload", r.handleUpload)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening for uploads: %w", err)
+	}
+	// stopped closes once uploads in flight have finished, so none is still
+	// writing into an archive when finish closes it.
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	scheme := "http"
+	if rc.TLSCert != "" && rc.TLSKey != "" {
+		scheme = "https"
+	}
+	slog.Info("HTTP receiver listening", "addr", addr, "folder", folderName, "https", scheme == "https")
+	fmt.Printf("\n  📱 Receiving uploads on %s://%s into %q\n  Press Ctrl+C to stop.\n\n", scheme, addr, folderName)
+	if scheme == "https" {
+		err = srv.ServeTLS(ln, rc.TLSCert, rc.TLSKey)
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return nil, fmt.Errorf("serving uploads: %w", err)
+	}
+	<-stopped
+	return r.finish(), nil
+}
+
+// authorized checks a token in constant time.
+func (r *httpReceiver) authorized(token string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(r.token)) == 1
+}
+
+// handleUpload takes POST /upload: a multipart form whose file fields, of
+// any name, are each saved and fanned out as they are read. It answers 200
+// when every file was archived, and lists each file's result either way.
+func (r *httpReceiver) handleUpload(w http.ResponseWriter, req *http.Request) {
+	bearer, hasBearer := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if hasBearer && !r.authorized(strings.TrimSpace(bearer)) {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+	authed := hasBearer
+	req.Body = http.MaxBytesReader(w, req.Body, r.maxUpload)
+	mr, err := req.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "expected a multipart/form-data upload")
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp("", "snapvault-http-")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "local error")
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var results []uploadResult
+	failed := false
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "reading upload: "+err.Error())
+			return
+		}
+		if part.FileName() == "" {
+			if part.FormName() == "token" && !authed {
+				value, _ := io.ReadAll(io.LimitReader(part, 1024))
+				authed = r.authorized(strings.TrimSpace(string(value)))
+				if !authed {
+					writeError(w, http.StatusUnauthorized, "invalid token")
+					return
+				}
+			}
+			continue
+		}
+		if !authed {
+			writeError(w, http.StatusUnauthorized, "missing token")
+			return
+		}
+		res := r.receive(req.Context(), tmpDir, part)
+		failed = failed || (!res.OK && !res.Skipped)
+		results = append(results, res)
+	}
+	if !authed {
+		writeError(w, http.StatusUnauthorized, "missing token")
+		return
+	}
+	status := http.StatusOK
+	if failed {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, map[string]any{"files": results})
+}
+
+// receive saves one uploaded file and fans it out.
+func (r *httpReceiver) receive(ctx context.Context, tmpDir string, part *multipart.Part) uploadResult {
+	name := filepath.Base(strings.ReplaceAll(part.FileName(), `\`, "/"))
+	res := uploadResult{Name: name}
+	if name == "." || name == "/" || isSystemMetadata(name) || !photoExtensions[strings.ToLower(filepath.Ext(name))] {
+		io.Copy(io.Discard, part)
+		res.Skipped, res.Error = true, "not a supported photo or video"
+		return res
+	}
+	tmpPath := filepath.Join(tmpDir, name)
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		res.Error = "local error"
+		return res
+	}
+	_, copyErr := io.Copy(f, part)
+	closeErr := f.Close()
+	defer os.Remove(tmpPath)
+	if copyErr != nil || closeErr != nil {
+		res.Error = "upload interrupted"
+		return res
+	}
+	if err := r.fanOut(ctx, tmpPath); err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.OK = true
+	return res
+}
+
+// uploadForm is a bare page for uploading from a phone's browser.
+var uploadForm = template.Must(template.New("upload").Parse(`<!doctype html>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>SnapVault upload</title>
+<h1>{{.}}</h1>
+<form method="post" action="upload" enctype="multipart/form-data">
+<p><input type="password" name="token" placeholder="Token" required>
+<p><input type="file" name="file" accept="image/*,video/*" multiple required>
+<p><button>Upload</button>
+</form>
+`))
+
+func (r *httpReceiver) handleForm(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	uploadForm.Execute(w, r.folderName)
+}
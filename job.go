@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sync"
@@ -31,6 +32,7 @@ type transferErrDTO struct {
 type transferJob struct {
 	id         string
 	folderName string
+	mount      string
 	startedAt  time.Time
 
 	mu          sync.Mutex
@@ -46,10 +48,11 @@ type transferJob struct {
 	subscribers map[chan jobEvent]struct{}
 }
 
-func newTransferJob(folderName string) *transferJob {
+func newTransferJob(folderName, mount string) *transferJob {
 	return &transferJob{
 		id:          fmt.Sprintf("%d", time.Now().UnixNano()),
 		folderName:  folderName,
+		mount:       mount,
 		startedAt:   time.Now(),
 		subscribers: make(map[chan jobEvent]struct{}),
 	}
@@ -138,6 +141,64 @@ func (j *transferJob) finishedEvent() jobEvent {
 	return ev
 }
 
+// importStatus is the REST representation of a job, used by /api/imports.
+type importStatus struct {
+	ID          string           `json:"id"`
+	State       string           `json:"state"` // running | completed | failed | cancelled
+	FolderName  string           `json:"folderName"`
+	Mount       string           `json:"mount"`
+	Total       int              `json:"total"`
+	Completed   int              `json:"completed"`
+	CurrentFile string           `json:"currentFile,omitempty"`
+	StartedAt   time.Time        `json:"startedAt"`
+	EndedAt     *time.Time       `json:"endedAt,omitempty"`
+	DurationMs  int64            `json:"durationMs"`
+	FatalError  string           `json:"fatalError,omitempty"`
+	Errors      []transferErrDTO `json:"errors,omitempty"`
+}
+
+func (j *transferJob) status() importStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	st := importStatus{
+		ID:          j.id,
+		State:       "running",
+		FolderName:  j.folderName,
+		Mount:       j.mount,
+		Total:       j.total,
+		Completed:   j.completed,
+		CurrentFile: j.currentFile,
+		StartedAt:   j.startedAt,
+		DurationMs:  time.Since(j.startedAt).Milliseconds(),
+	}
+	if !j.done {
+		return st
+	}
+	ended := j.endedAt
+	st.EndedAt = &ended
+	st.DurationMs = j.endedAt.Sub(j.startedAt).Milliseconds()
+	st.CurrentFile = ""
+	switch {
+	case errors.Is(j.fatalErr, context.Canceled):
+		st.State = "cancelled"
+	case j.fatalErr != nil || len(j.errors) > 0:
+		st.State = "failed"
+	default:
+		st.State = "completed"
+	}
+	if j.fatalErr != nil {
+		st.FatalError = j.fatalErr.Error()
+	}
+	for _, e := range j.errors {
+		st.Errors = append(st.Errors, transferErrDTO{
+			File:  filepath.Base(e.FilePath),
+			Share: e.Share,
+			Error: e.Error.Error(),
+		})
+	}
+	return st
+}
+
 // snapshot builds the current state as an event for a newly connected client.
 func (j *transferJob) snapshot() jobEvent {
 	j.mu.Lock()
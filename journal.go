@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runJournal records exactly which files one import wrote to which share, so
+// the run can be audited or undone later. Journals live in <state dir>/journals.
+type runJournal struct {
+	ID        string         `json:"id"`
+	Folder    string         `json:"folder"`
+	Sources   []string       `json:"sources"`
+	Cards     []string       `json:"cards,omitempty"` // card IDs, when known
+	StartedAt time.Time      `json:"startedAt"`
+	EndedAt   time.Time      `json:"endedAt"`
+	Files     []journalEntry `json:"files"`
+	Undone    *time.Time     `json:"undone,omitempty"`
+	// Deferred lists the deferred shares owed this run's files.
+	Deferred []deferredCopy `json:"deferred,omitempty"`
+
+	path string
+	mu   sync.Mutex
+}
+
+// journalEntry is one file as it landed on one share.
+type journalEntry struct {
+	Source   string `json:"source"`
+	ShareKey string `json:"shareKey"` // smbShareKey, to find the share again
+	Share    string `json:"share"`    // display label
+	Path     string `json:"path"`     // share-relative, slash-separated
+	Size     int64  `json:"size"`
+	Sum      string `json:"sum,omitempty"`
+	SumAlg   string `json:"sumAlg,omitempty"`
+}
+
+// openRunJournal starts a journal for a run. It returns nil, after logging,
+// when the state dir is unusable: a missing journal must not block an import.
+func openRunJournal(cfg *Config, folder string, sources []string) *runJournal {
+	dir, err := resolveStateDir(cfg)
+	if err == nil {
+		dir = filepath.Join(dir, "journals")
+		err = os.MkdirAll(dir, 0o700)
+	}
+	if err != nil {
+		slog.Warn("Run journal disabled", "error", err)
+		return nil
+	}
+	now := time.Now()
+	id := now.Format("20060102-150405.000")
+	id = strings.Replace(id, ".", "-", 1)
+	return &runJournal{
+		ID:        id,
+		Folder:    folder,
+		Sources:   sources,
+		StartedAt: now,
+		path:      filepath.Join(dir, id+".json"),
+	}
+}
+
+func (j *runJournal) record(conn *SMBConnection, source string, size int64, res copyResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Files = append(j.Files, journalEntry{
+		Source:   source,
+		ShareKey: smbShareKey(conn.Config),
+		Share:    shareLabel(conn.Config),
+		Path:     res.DestPath,
+		Size:     size,
+		Sum:      fmt.Sprintf("%x", res.Sum),
+		SumAlg:   res.Algorithm,
+	})
+}
+
+// save writes the journal; runs that copied nothing leave no journal behind.
+func (j *runJournal) save() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(j.Files) == 0 && j.Undone == nil {
+		return nil
+	}
+	if j.EndedAt.IsZero() {
+		j.EndedAt = time.Now()
+	}
+	return writeStateFile(j.path, j)
+}
+
+// loadJournals returns every journal in the state dir, newest first.
+func loadJournals(cfg *Config) ([]*runJournal, error) {
+	dir, err := resolveStateDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "journals")
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading journals: %w", err)
+	}
+	var out []*runJournal
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		j := &runJournal{path: filepath.Join(dir, e.Name())}
+		if err := readStateFile(j.path, j); err != nil {
+			slog.Warn("Skipping unreadable journal", "file", e.Name(), "error", err)
+			continue
+		}
+		out = append(out, j)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].StartedAt.After(out[b].StartedAt) })
+	return out, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// slow_share modes.
+const (
+	slowShareWarn   = "warn"   // log once and keep copying (default)
+	slowShareDemote = "demote" // stop sending the share files for the rest of the run
+)
+
+// A share is slow when the median time of its recent copies is this many
+// times that of the fastest other destination, once both have enough samples.
+// Medians under slowShareFloor are never slow, so a fast LAN's jitter between
+// 5ms and 50ms doesn't count.
+const (
+	slowShareFactor  = 10
+	slowShareSamples = 16
+	slowShareWindow  = 64
+	slowShareFloor   = 500 * time.Millisecond
+)
+
+// errShareDemoted marks files not sent to a share demoted as too slow.
+var errShareDemoted = errors.New("share demoted as too slow for this run; fill it in later with snapvault repair")
+
+func normalizeSlowShare(mode string) (string, error) {
+	switch m := strings.ToLower(strings.TrimSpace(mode)); m {
+	case "", slowShareWarn:
+		return slowShareWarn, nil
+	case slowShareDemote:
+		return m, nil
+	default:
+		return "", fmt.Errorf("slow_share must be %q or %q, got %q", slowShareWarn, slowShareDemote, mode)
+	}
+}
+
+// latencyTracker times every successful copy per destination, flags a
+// destination that falls far behind the others and logs percentiles at the
+// end of the run.
+type latencyTracker struct {
+	mode    string
+	mu      sync.Mutex
+	all     map[string][]time.Duration // every sample, for the summary
+	recent  map[string][]time.Duration // the last slowShareWindow samples
+	flagged map[string]bool
+	demoted map[string]bool
+	labels  []string
+}
+
+func newLatencyTracker(mode string, labels []string) *latencyTracker {
+	mode, err := normalizeSlowShare(mode)
+	if err != nil {
+		slog.Warn("Invalid slow_share; warning only", "error", err)
+	}
+	return &latencyTracker{
+		mode:    mode,
+		all:     map[string][]time.Duration{},
+		recent:  map[string][]time.Duration{},
+		flagged: map[string]bool{},
+		demoted: map[string]bool{},
+		labels:  labels,
+	}
+}
+
+// isDemoted reports whether label should be skipped for the rest of the run.
+func (l *latencyTracker) isDemoted(label string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.demoted[label]
+}
+
+func (l *latencyTracker) record(label string, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.all[label] = append(l.all[label], d)
+	recent := append(l.recent[label], d)
+	if len(recent) > slowShareWindow {
+		recent = recent[len(recent)-slowShareWindow:]
+	}
+	l.recent[label] = recent
+	if l.flagged[label] || len(recent) < slowShareSamples {
+		return
+	}
+
+	mine := percentile(recent, 50)
+	fastest, fastestLabel := time.Duration(0), ""
+	for _, other := range l.labels {
+		samples := l.recent[other]
+		if other == label || l.demoted[other] || len(samples) < slowShareSamples {
+			continue
+		}
+		if m := percentile(samples, 50); fastestLabel == "" || m < fastest {
+			fastest, fastestLabel = m, other
+		}
+	}
+	if fastestLabel == "" || mine < slowShareFloor || mine < slowShareFactor*fastest {
+		return
+	}
+
+	l.flagged[label] = true
+	attrs := []any{"share", label, "median", mine.Round(time.Millisecond), "p95", percentile(recent, 95).Round(time.Millisecond),
+		"fastest", fastestLabel, "fastest_median", fastest.Round(time.Millisecond)}
+	if l.mode == slowShareDemote {
+		l.demoted[label] = true
+		slog.Warn("Share is much slower than the others; skipping it for the rest of this run", attrs...)
+		return
+	}
+	slog.Warn("Share is much slower than the others; its disk or link may be failing", attrs...)
+}
+
+// logSummary logs the copy time percentiles of every destination.
+func (l *latencyTracker) logSummary() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, label := range l.labels {
+		samples := l.all[label]
+		if len(samples) == 0 {
+			continue
+		}
+		slog.Info("Share copy times", "share", label, "files", len(samples),
+			"p50", percentile(samples, 50).Round(time.Millisecond),
+			"p95", percentile(samples, 95).Round(time.Millisecond),
+			"p99", percentile(samples, 99).Round(time.Millisecond),
+			"slow", l.flagged[label])
+	}
+}
+
+// percentile returns the p-th percentile (nearest rank) of samples.
+func percentile(samples []time.Duration, p int) time.Duration {
+	if len(samples) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	idx := (p*len(sorted)+99)/100 - 1
+	if idx < 0 {
+		idx = 0
+	}
+	return sorted[idx]
+}
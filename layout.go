@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// defaultTypeFolders is the type mapping type_folders splits date folders by.
+// Formats it doesn't list (PNG, TIFF) stay directly in the date folder.
+var defaultTypeFolders = map[string]string{
+	".cr2": "RAW", ".cr3": "RAW", ".nef": "RAW", ".arw": "RAW", ".dng": "RAW", ".orf": "RAW",
+	".rw2": "RAW", ".raf": "RAW", ".pef": "RAW", ".srw": "RAW", ".raw": "RAW",
+	".jpg": "JPEG", ".jpeg": "JPEG", ".heic": "JPEG", ".heif": "JPEG",
+	".mov": "VIDEO", ".mp4": "VIDEO", ".m4v": "VIDEO", ".avi": "VIDEO", ".mts": "VIDEO", ".m2ts": "VIDEO", ".mxf": "VIDEO",
+}
+
+// folderNameData is what folder templates can reference.
+type folderNameData struct {
+	DateFolder string    // the date folder per date_format and session_gap, e.g. 2024-05-11
+	Date       time.Time // capture date
+	Location   string    // place name from GPS, "" when the file has none
+	// Photographer is the naming.photographers name of the camera, "" for
+	// cameras not listed.
+	Photographer string
+}
+
+// dateFormatISOWeek groups files by ISO week, e.g. 2024-W19, which Go's time
+// layouts cannot express.
+const dateFormatISOWeek = "iso-week"
+
+// folderLayout decides which folder under the shoot folder each file lands
+// in. A nil layout is the default: one folder per capture date.
+type folderLayout struct {
+	preserve    bool               // mirror the card's own folders
+	dateFormat  string             // Go time layout or dateFormatISOWeek
+	sessionGap  time.Duration      // split a date folder at capture gaps this long
+	tmpl        *template.Template // renders the date folder; nil uses it as is
+	typeFolders map[string]string  // extension -> subfolder of the date folder
+	// photographers is naming.photographers by normalized serial.
+	photographers map[string]string
+}
+
+// newFolderLayout returns nil when the config keeps the default layout.
+func newFolderLayout(cfg *Config) (*folderLayout, error) {
+	if cfg == nil || cfg.Naming == nil {
+		return nil, nil
+	}
+	if cfg.Naming.PreserveStructure {
+		return &folderLayout{preserve: true}, nil
+	}
+	if !cfg.Naming.TypeFolders && cfg.Naming.DateFormat == "" && cfg.Naming.SessionGap <= 0 && strings.TrimSpace(cfg.Naming.FolderTemplate) == "" {
+		return nil, nil
+	}
+	dateFormat, err := normalizeDateFormat(cfg.Naming.DateFormat)
+	if err != nil {
+		return nil, fmt.Errorf("naming.date_format: %w", err)
+	}
+	l := &folderLayout{dateFormat: dateFormat, sessionGap: cfg.Naming.SessionGap}
+	if strings.TrimSpace(cfg.Naming.FolderTemplate) != "" {
+		l.tmpl, err = template.New("folder").Option("missingkey=error").Parse(cfg.Naming.FolderTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("parsing naming.folder_template: %w", err)
+		}
+		if l.photographers, err = photographerNames(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if !cfg.Naming.TypeFolders {
+		return l, nil
+	}
+	l.typeFolders = map[string]string{}
+	for ext, folder := range defaultTypeFolders {
+		l.typeFolders[ext] = folder
+	}
+	for ext, folder := range cfg.Naming.TypeMap {
+		ext, folder, err := normalizeTypeMapping(ext, folder)
+		if err != nil {
+			return nil, fmt.Errorf("naming.type_map: %w", err)
+		}
+		l.typeFolders[ext] = folder
+	}
+	return l, nil
+}
+
+// normalizeDateFormat checks naming.date_format. Slashes nest folders, as in
+// 2006/01/02; a format must still tell different dates apart.
+func normalizeDateFormat(format string) (string, error) {
+	format = strings.TrimSpace(format)
+	switch {
+	case format == "":
+		return "2006-01-02", nil
+	case strings.EqualFold(format, dateFormatISOWeek):
+		return dateFormatISOWeek, nil
+	}
+	a := time.Date(2024, 5, 11, 0, 0, 0, 0, time.UTC).Format(format)
+	b := time.Date(2025, 12, 28, 0, 0, 0, 0, time.UTC).Format(format)
+	if a == b {
+		return "", fmt.Errorf("%q contains no date fields; use a Go layout such as 2006-01-02 or %s", format, dateFormatISOWeek)
+	}
+	for _, part := range strings.Split(a, "/") {
+		if part == "" || part == "." || part == ".." || strings.Contains(part, `\`) {
+			return "", fmt.Errorf("%q gives the invalid folder %q", format, a)
+		}
+	}
+	return format, nil
+}
+
+// dateFolder formats t as the folder for files captured at t.
+func (l *folderLayout) dateFolder(t time.Time) string {
+	if l == nil {
+		return t.Format("2006-01-02")
+	}
+	if l.dateFormat == dateFormatISOWeek {
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return t.Format(l.dateFormat)
+}
+
+// normalizeTypeMapping checks one naming.type_map entry, accepting the
+// extension with or without its dot and in any case.
+func normalizeTypeMapping(ext, folder string) (string, string, error) {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	if !photoExtensions[ext] {
+		return "", "", fmt.Errorf("%q is not a file type SnapVault imports", ext)
+	}
+	folder = strings.TrimSpace(folder)
+	if strings.ContainsAny(folder, `/\`) || folder == "." || folder == ".." {
+		return "", "", fmt.Errorf("%q is not a valid folder name for %s", folder, ext)
+	}
+	return ext, folder, nil
+}
+
+// usesLocation reports whether the folder template needs GPS place names.
+func (l *folderLayout) usesLocation() bool {
+	return l != nil && templateUses(l.tmpl, "Location")
+}
+
+// photographerNames returns the serial mapping when the folder template
+// uses {{.Photographer}}, else nil.
+func (l *folderLayout) photographerNames() map[string]string {
+	if l == nil || !templateUses(l.tmpl, "Photographer") {
+		return nil
+	}
+	return l.photographers
+}
+
+// assign sets DestDir on every job. With a session gap, a date folder whose
+// captures break for longer than the gap becomes 2024-05-11_session1,
+// 2024-05-11_session2 and so on; dates shot in one go keep the plain folder.
+func (l *folderLayout) assign(jobs []TransferJob) error {
+	dates := make([]string, len(jobs))
+	for i := range jobs {
+		dates[i] = l.dateFolder(jobs[i].PhotoDate)
+	}
+	if l != nil && l.sessionGap > 0 && !l.preserve {
+		splitSessions(jobs, dates, l.sessionGap)
+	}
+	for i := range jobs {
+		dir, err := l.folder(jobs[i], dates[i])
+		if err != nil {
+			return err
+		}
+		jobs[i].DestDir = dir
+	}
+	return nil
+}
+
+// splitSessions appends a session number to the date folder of every job on
+// a date with more than one session.
+func splitSessions(jobs []TransferJob, dates []string, gap time.Duration) {
+	byDate := map[string][]int{}
+	for i, date := range dates {
+		byDate[date] = append(byDate[date], i)
+	}
+	for date, idx := range byDate {
+		sort.SliceStable(idx, func(a, b int) bool { return jobs[idx[a]].PhotoDate.Before(jobs[idx[b]].PhotoDate) })
+		session := make([]int, len(idx))
+		n := 1
+		for k := range idx {
+			if k > 0 && jobs[idx[k]].PhotoDate.Sub(jobs[idx[k-1]].PhotoDate) > gap {
+				n++
+			}
+			session[k] = n
+		}
+		if n == 1 {
+			continue
+		}
+		for k, i := range idx {
+			dates[i] = fmt.Sprintf("%s_session%d", date, session[k])
+		}
+	}
+}
+
+// dir returns the slash-separated folder for job, relative to the shoot
+// folder, for files that arrive one at a time and so have no sessions.
+func (l *folderLayout) dir(job TransferJob) (string, error) {
+	return l.folder(job, l.dateFolder(job.PhotoDate))
+}
+
+func (l *folderLayout) folder(job TransferJob, date string) (string, error) {
+	if l == nil {
+		return date, nil
+	}
+	if l.preserve {
+		// Files at the card root land in the shoot folder itself.
+		if rel, err := filepath.Rel(job.SourceRoot, filepath.Dir(job.SourcePath)); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel), nil
+		}
+		return "", nil
+	}
+	if l.tmpl != nil {
+		var sb strings.Builder
+		err := l.tmpl.Execute(&sb, folderNameData{DateFolder: date, Date: job.PhotoDate, Location: job.Location, Photographer: job.Photographer})
+		if err != nil {
+			return "", fmt.Errorf("rendering folder for %s: %w", filepath.Base(job.SourcePath), err)
+		}
+		// An empty {{.Location}} or {{.Photographer}} must not leave "2024-05-11 " or "/2024-05-11".
+		var parts []string
+		for _, part := range strings.Split(sb.String(), "/") {
+			if part = strings.Trim(part, " _-"); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		date = strings.Join(parts, "/")
+		if date == "" || strings.Contains(date, `\`) || slices.Contains(parts, "..") {
+			return "", fmt.Errorf("folder template produced an invalid folder %q for %s", sb.String(), filepath.Base(job.SourcePath))
+		}
+	}
+	if sub := l.typeFolders[strings.ToLower(filepath.Ext(job.SourcePath))]; sub != "" {
+		return path.Join(date, sub), nil
+	}
+	return date, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// logSettings are the -log-* flags.
+type logSettings struct {
+	format     string // text or json
+	file       string // empty logs to stderr
+	maxSizeMB  int
+	maxBackups int
+	level      string // debug, info, warn or error
+}
+
+// setupLogging installs the default logger. Without -log-format or -log-file
+// the human-readable default output is kept; -log-format json writes one JSON
+// object per line for Loki, ELK and similar, and -log-file writes to a file
+// that is rotated at maxSizeMB, keeping maxBackups old files. Writes are
+// unbuffered, so nothing needs closing on exit.
+func setupLogging(s logSettings) error {
+	if s.format != "text" && s.format != "json" {
+		return fmt.Errorf("-log-format must be text or json, got %q", s.format)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s.level)); err != nil {
+		return fmt.Errorf("-log-level must be debug, info, warn or error, got %q", s.level)
+	}
+	if s.format == "text" && s.file == "" {
+		slog.SetLogLoggerLevel(level)
+		return nil
+	}
+
+	var out io.Writer = os.Stderr
+	if s.file != "" {
+		out = &lumberjack.Logger{
+			Filename:   s.file,
+			MaxSize:    s.maxSizeMB,
+			MaxBackups: s.maxBackups,
+			LocalTime:  true,
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(out, opts)
+	if s.format == "json" {
+		handler = slog.NewJSONHandler(out, opts)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// progressLine keeps one self-updating "files done" line on a terminal, the
+// only output of a -quiet run besides warnings and the final summary.
+type progressLine struct {
+	mu       sync.Mutex
+	out      io.Writer
+	start    time.Time
+	done     int
+	drawn    time.Time
+	visible  bool
+	finished bool
+}
+
+func newProgressLine(out io.Writer) *progressLine {
+	return &progressLine{out: out, start: time.Now()}
+}
+
+// handle is an eventBus subscriber.
+func (p *progressLine) handle(e RunEvent) {
+	switch e := e.(type) {
+	case RunStarted:
+		p.reset()
+	case FileCompleted:
+		p.update(e.Total, e.Completed)
+	}
+}
+
+// reset starts counting again for the next card of a queue.
+func (p *progressLine) reset() {
+	p.finish()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.start, p.done, p.visible, p.finished = time.Now(), 0, false, false
+}
+
+func (p *progressLine) update(total, completed int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if completed > p.done {
+		p.done = completed
+	}
+	// Workers report concurrently; redrawing a few times a second is plenty.
+	if p.done < total && time.Since(p.drawn) < 200*time.Millisecond {
+		return
+	}
+	p.drawn = time.Now()
+	p.visible = true
+	line := fmt.Sprintf("%d/%d files", p.done, total)
+	if total > 0 {
+		line += fmt.Sprintf(" (%d%%)", p.done*100/total)
+	}
+	if p.done > 0 && p.done < total {
+		left := time.Duration(float64(time.Since(p.start)) / float64(p.done) * float64(total-p.done))
+		line += ", about " + left.Round(time.Second).String() + " left"
+	}
+	fmt.Fprintf(p.out, "\r\033[K%s", line)
+}
+
+// finish ends the line so later output starts on a fresh one.
+func (p *progressLine) finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.visible && !p.finished {
+		fmt.Fprintln(p.out)
+	}
+	p.finished = true
+}
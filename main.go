@@ -5,12 +5,15 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"hash"
 	"io"
 	"log/slog"
 	"net"
 	"os"
 	"os/signal"
+	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -19,18 +22,88 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/KiranTheRam/SnapVault/pkg/exifdate"
+	"github.com/KiranTheRam/SnapVault/pkg/ingest"
 	"github.com/hirochachacha/go-smb2"
-	"github.com/rwcarlsen/goexif/exif"
+	"golang.org/x/term"
 	"gopkg.in/yaml.v3"
 )
 
 type SMBConfig struct {
+	// Name labels the share in logs, errors and reports, e.g. "archive-nas".
+	// Without one the share is shown as host/share.
+	Name     string `yaml:"name,omitempty"`
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
 	Share    string `yaml:"share"`
 	Username string `yaml:"username"`
 	Password string `yaml:"password"`
 	BasePath string `yaml:"base_path"` // Base path within the share
+	// HashAlgorithm overrides Config.HashAlgorithm for this share's manifests.
+	HashAlgorithm string `yaml:"hash_algorithm,omitempty"`
+	// Group makes shares with the same name one overflow destination: each
+	// file goes to the first member, in config order, that still has
+	// MinFreeGB free after the copy.
+	Group     string  `yaml:"group,omitempty"`
+	MinFreeGB float64 `yaml:"min_free_gb,omitempty"`
+	// Enabled: false keeps the share in the config but out of imports.
+	Enabled *bool `yaml:"enabled,omitempty"`
+	// AskPass prompts for the password on every run; Password is not used
+	// and the UIs never store one.
+	AskPass bool `yaml:"ask_pass,omitempty"`
+	// Keyring reads the password from the OS keyring (service "snapvault",
+	// account user@host/share) instead of Password.
+	Keyring bool `yaml:"keyring,omitempty"`
+	// StripGPS removes the GPS position from JPEG copies on this share, for
+	// client-facing shares; StripEXIF removes EXIF, XMP and IPTC entirely.
+	StripGPS  bool `yaml:"strip_gps,omitempty"`
+	StripEXIF bool `yaml:"strip_exif,omitempty"`
+	// Preview makes this a derivative destination that only receives
+	// downscaled JPEGs. It is not a backup and never counts toward quorum.
+	Preview *PreviewConfig `yaml:"preview,omitempty"`
+	// Selects makes this a client-delivery share that only receives files
+	// rated or labelled in camera. See SelectsConfig.
+	Selects *SelectsConfig `yaml:"selects,omitempty"`
+	// Deferred, a daily window like "02:00-06:00", keeps the share out of
+	// imports: its copies are queued in the run journal and made inside the
+	// window, from a share that already holds the files.
+	Deferred string `yaml:"deferred,omitempty"`
+	// BWLimit caps the rate copies are written to the share, per second,
+	// like "5MB" or "500KB". Unset or "0" is unlimited.
+	BWLimit string `yaml:"bwlimit,omitempty"`
+	// BWLimitSchedule overrides BWLimit during daily windows; the first
+	// window covering the time of day applies.
+	BWLimitSchedule []BandwidthWindow `yaml:"bwlimit_schedule,omitempty"`
+	// Encrypt makes this an untrusted destination that only receives
+	// age-encrypted copies under random names.
+	Encrypt *EncryptConfig `yaml:"encrypt,omitempty"`
+	// Archive stores each date folder as one "zip" or "tar" archive instead
+	// of loose files, for shares backed by object storage or tape.
+	Archive string `yaml:"archive,omitempty"`
+	// Snapshot takes a ZFS snapshot of the share's dataset after every
+	// import it received in full.
+	Snapshot *SnapshotConfig `yaml:"snapshot,omitempty"`
+	// Rclone makes this an rclone remote, like "b2:bucket/photos", instead
+	// of an SMB share: copies go through the rclone command, and Host,
+	// Share and the login are not used.
+	Rclone string `yaml:"rclone,omitempty"`
+	// GoogleDrive makes this a folder in Google Drive instead of an SMB
+	// share, optionally mirrored into Google Photos albums.
+	GoogleDrive *GoogleDriveConfig `yaml:"google_drive,omitempty"`
+	// Azure makes this a container in Azure Blob Storage instead of an SMB
+	// share.
+	Azure *AzureBlobConfig `yaml:"azure,omitempty"`
+	// B2 makes this a bucket in Backblaze B2 instead of an SMB share.
+	B2 *B2Config `yaml:"b2,omitempty"`
+	// Mount makes this a local directory, normally an NFS export mounted
+	// by the OS, instead of an SMB share.
+	Mount string `yaml:"mount,omitempty"`
+	// FTP makes this a folder on an FTP or FTPS server instead of an SMB
+	// share.
+	FTP *FTPDestConfig `yaml:"ftp,omitempty"`
+	// Synology uses the DSM API of a Synology NAS to index imports and to
+	// read the shared folder's quota.
+	Synology *SynologyConfig `yaml:"synology,omitempty"`
 }
 
 type NtfyConfig struct {
@@ -41,24 +114,253 @@ type NtfyConfig struct {
 	Token    string `yaml:"token,omitempty" json:"token"`
 	Username string `yaml:"username,omitempty" json:"username"`
 	Password string `yaml:"password,omitempty" json:"password"`
+	// Events limits which outcomes are pushed (complete, failure, verify_mismatch,
+	// share_error). Empty means all of them except share_error.
+	Events []string `yaml:"events,omitempty" json:"events,omitempty"`
+}
+
+type PushoverConfig struct {
+	Token  string   `yaml:"token"` // application API token; supports ${ENV} expansion
+	User   string   `yaml:"user"`  // user or group key
+	Events []string `yaml:"events,omitempty"`
+}
+
+type TelegramConfig struct {
+	BotToken string   `yaml:"bot_token"` // supports ${ENV} expansion
+	ChatID   string   `yaml:"chat_id"`
+	Events   []string `yaml:"events,omitempty"`
+}
+
+type EmailConfig struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port"` // 587 (STARTTLS) by default; 465 uses implicit TLS
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"` // supports ${ENV} expansion
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+	Events   []string `yaml:"events,omitempty"`
 }
 
 type Config struct {
-	SMBShares []SMBConfig `yaml:"smb_shares"`
-	Ntfy      *NtfyConfig `yaml:"ntfy,omitempty"`
+	SMBShares []SMBConfig     `yaml:"smb_shares"`
+	Ntfy      *NtfyConfig     `yaml:"ntfy,omitempty"`
+	Pushover  *PushoverConfig `yaml:"pushover,omitempty"`
+	Telegram  *TelegramConfig `yaml:"telegram,omitempty"`
+	Email     *EmailConfig    `yaml:"email,omitempty"`
+
+	FTPReceiver  *FTPReceiverConfig  `yaml:"ftp_receiver,omitempty"`
+	HTTPReceiver *HTTPReceiverConfig `yaml:"http_receiver,omitempty"`
+	GRPC         *GRPCConfig         `yaml:"grpc,omitempty"`
+	API          *APIConfig          `yaml:"api,omitempty"`
+	Naming       *NamingConfig       `yaml:"naming,omitempty"`
+
+	// ChecksumManifest writes checksums next to the copies: "folder" for a
+	// SHA256SUMS (or B3SUMS, XXH64SUMS) per date folder, "sidecar" for one per file.
+	ChecksumManifest string `yaml:"checksum_manifest,omitempty"`
+	// XMPSidecar writes an .xmp with the import's provenance next to the
+	// copies: "lightroom" (IMG_0001.xmp, RAW and video) or "digikam"
+	// (IMG_0001.CR3.xmp, every file).
+	XMPSidecar string `yaml:"xmp_sidecar,omitempty"`
+	// ShootManifest writes MANIFEST.csv or MANIFEST.json ("csv", "json")
+	// listing every file into the root of each shoot folder.
+	ShootManifest string `yaml:"shoot_manifest,omitempty"`
+	// ShootReadme writes a README.txt with the import's statistics into
+	// every shoot folder.
+	ShootReadme *ShootReadmeConfig `yaml:"shoot_readme,omitempty"`
+	// HashAlgorithm is sha256 (default), blake3 or xxhash; used for manifests
+	// and duplicate detection. Shares may override it.
+	HashAlgorithm string `yaml:"hash_algorithm,omitempty"`
+
+	// Workers is the default for -workers.
+	Workers int `yaml:"workers,omitempty"`
+	// WorkerRamp spreads the workers' start over this long, e.g. "30s"
+	// (the default), instead of opening with all of them at once; "0"
+	// starts them together.
+	WorkerRamp *time.Duration `yaml:"worker_ramp,omitempty"`
+	// Quorum counts an import as successful once this many destinations
+	// (shares or overflow groups) received every file, e.g. 2 of 3. Zero
+	// requires all of them.
+	Quorum int `yaml:"quorum,omitempty"`
+
+	// TransferOrder is the order files are copied in: "card" (default),
+	// "jpeg-first", "smallest-first" or "two-phase". See orderJobs.
+	TransferOrder string `yaml:"transfer_order,omitempty"`
+	// FilenameReplacement stands in for each character of a file or folder
+	// name that SMB shares reject (<>:"/\|?* and trailing dots); "_" by
+	// default.
+	FilenameReplacement string `yaml:"filename_replacement,omitempty"`
+	// UnicodeNormalization is the Unicode form of the file and folder names
+	// written to the shares: "nfc" (default), "nfd" or "off" to keep the
+	// card's.
+	UnicodeNormalization string `yaml:"unicode_normalization,omitempty"`
+	// FileTimeout gives up on copying one file to one share after this long,
+	// e.g. "5m"; the file then counts as failed there. Zero means no limit.
+	FileTimeout time.Duration `yaml:"file_timeout,omitempty"`
+	// MinFileSize and MaxFileSize skip card files smaller or larger than
+	// this, like "200KB" or "4GB". -min-size and -max-size override them.
+	MinFileSize string `yaml:"min_file_size,omitempty"`
+	MaxFileSize string `yaml:"max_file_size,omitempty"`
+	// TinyRAW sets, per extension, the size below which a RAW file is
+	// reported as likely corrupt instead of copied, e.g. {".cr3": "4MB"};
+	// "0" turns the check off for that type. 1MB for RAW types by default.
+	TinyRAW map[string]string `yaml:"tiny_raw,omitempty"`
+	// SkipFolders adds card folders never to import from: a name matched at
+	// any depth ("EOSMISC") or a path from the card root
+	// ("PRIVATE/M4ROOT/SUB"), with * and ? as in file globs. Camera
+	// bookkeeping folders such as THMBNL and MISC are skipped by default.
+	SkipFolders []string `yaml:"skip_folders,omitempty"`
+	// KeepFolders imports from folders a skip rule, built-in or not, would
+	// leave out. Same form as SkipFolders.
+	KeepFolders []string `yaml:"keep_folders,omitempty"`
+	// CompanionFiles also imports the voice memos (.wav) and GPS track logs
+	// (.gpx, .log) some cameras record next to the images. A memo goes with
+	// the photo of the same name; a log into the date folder of its first fix.
+	CompanionFiles bool `yaml:"companion_files,omitempty"`
+	// ChunkedUploads copies large videos in checksummed chunks journaled in
+	// the state directory, so a copy cut off by a dropped connection resumes
+	// from the last good chunk on the next run.
+	ChunkedUploads *ChunkedUploadConfig `yaml:"chunked_uploads,omitempty"`
+	// Attribution is written into JPEG copies on every share.
+	Attribution *AttributionConfig `yaml:"attribution,omitempty"`
+	// VideoProxy renders low-resolution copies of imported videos with
+	// ffmpeg onto one share after each import.
+	VideoProxy *VideoProxyConfig `yaml:"video_proxy,omitempty"`
+	// Gallery writes a gallery.html contact sheet into every destination
+	// shoot folder after each import.
+	Gallery *GalleryConfig `yaml:"gallery,omitempty"`
+	// SlowShare is what happens to a share whose copies take ten times as
+	// long as the other destinations': "warn" (default) or "demote", which
+	// stops sending it files for the rest of the run.
+	SlowShare string `yaml:"slow_share,omitempty"`
+
+	// Profiles are named variants of this config, e.g. "studio" or "travel",
+	// selected with -profile. See applyProfile.
+	Profiles map[string]yaml.Node `yaml:"profiles,omitempty"`
+
+	// StateDir holds SnapVault's own bookkeeping (sequence counters and the
+	// like). Defaults to the per-user config directory.
+	StateDir string `yaml:"state_dir,omitempty"`
 }
 
 type SMBConnection struct {
 	Config      SMBConfig
 	Session     *smb2.Session
 	Share       *smb2.Share
-	createdDirs sync.Map // Cache of created directory paths
+	createdDirs sync.Map // Cache of created directory paths on mount and FTP shares
+	dirs        *dirTree // folders known to exist on the SMB share
+	hashAlg     string   // checksum algorithm for this share's copies
+	attribution *AttributionConfig
+	proxyFolder string // set on the share that receives video proxies
+	limiter     *bandwidthLimiter
+	chunks      *chunkedUploads // nil unless chunked_uploads is set
+	encryption  *shareEncryption
+	archives    *archiveSet // nil unless the share takes archives
+	cloud       cloudRemote // set instead of Session and Share on a cloud share
+}
+
+// looseFiles reports whether conn's copies are plain files at their real
+// paths on an SMB share, which checksum manifests, sidecars and shoot
+// reports describe.
+func (c *SMBConnection) looseFiles() bool {
+	return c.encryption == nil && c.archives == nil && c.cloud == nil
 }
 
 type TransferJob struct {
 	SourcePath string
 	FolderName string
 	PhotoDate  time.Time
+	Size       int64
+	// DestName overrides the destination file name; empty keeps the source name.
+	DestName string
+	// DestDir is the slash-separated folder under the shoot folder, set from
+	// TransferOptions.Layout before copying starts.
+	DestDir string
+	// SourceRoot is the mount the file was found under.
+	SourceRoot string
+	ModTime    time.Time
+	// Location is the place name of the file's GPS position, looked up only
+	// when a naming template uses {{.Location}}.
+	Location string
+	// Photographer is the naming.photographers name of the file's camera,
+	// read only when a naming template uses {{.Photographer}}.
+	Photographer string
+	// Rating is the in-camera star rating, -1 for rejected and 0 for
+	// unrated, and Label the color label. Both are read only when a share
+	// has a selects block.
+	Rating int
+	Label  string
+	// Companion is the source path of the photo a voice memo was recorded
+	// for; the memo is filed next to it under the same name.
+	Companion string
+}
+
+// TransferOptions holds the per-run knobs of processPhotos.
+type TransferOptions struct {
+	Workers int
+	// WorkerRamp spreads the workers' start over this long.
+	WorkerRamp time.Duration
+	Hook       *TransferProgressHook
+	// Events, when set, receives the run's events.
+	Events *eventBus
+	// Namer, when set, assigns DestName to every job before copying starts.
+	Namer *fileNamer
+	// Layout assigns DestDir; nil files by capture date.
+	Layout *folderLayout
+	// Replacement stands in for characters the shares reject in names.
+	Replacement string
+	// NameForm is the Unicode normalization of destination names.
+	NameForm string
+	// Include, when set, filters the collected jobs; files it rejects are
+	// neither counted nor copied.
+	Include func(job TransferJob) bool
+	// Sizes skips files outside the configured size range and flags tiny
+	// RAW files; nil applies only the default tiny_raw thresholds.
+	Sizes *sizeFilter
+	// Skip leaves out card folders; nil applies only the built-in rules.
+	Skip *folderSkipper
+	// Companions also imports voice memos and GPS track logs.
+	Companions bool
+	// QuarantineDir, when set, receives a salvage copy of every damaged source file.
+	QuarantineDir string
+	// HashAlgorithm is used for duplicate detection; empty means SHA-256.
+	HashAlgorithm string
+	// Manifests, when set, collects checksums for per-folder manifests.
+	Manifests *manifestWriter
+	// Journal, when set, records every file written so the run can be undone.
+	Journal *runJournal
+	// Sidecars, when set, writes a provenance XMP next to every copy.
+	Sidecars *xmpSidecarWriter
+	// ShootManifests, when set, collects the per-shoot file inventory.
+	ShootManifests *shootManifestWriter
+	// Readmes, when set, collects the statistics for each shoot's README.txt.
+	Readmes *shootReadmeWriter
+	// Gallery, when set, writes a contact sheet to every shoot folder once
+	// the copies are done.
+	Gallery *galleryWriter
+	// FindSimilar runs a perceptual-hash pass over JPEGs alongside the copy
+	// and reports near-duplicate groups through Hook.OnSimilar.
+	FindSimilar bool
+	// Catalog, when set, is the config whose catalog records which overflow
+	// group member received each file. Its state directory also holds the
+	// card locks that keep two runs off the same card.
+	Catalog *Config
+	// Order is the config's transfer_order policy.
+	Order string
+	// Deferred shares are queued in Journal for a later copy instead of
+	// being copied to.
+	Deferred []SMBConfig
+	// VideoProxy, when set, renders proxies of the imported videos once
+	// the copies are done.
+	VideoProxy *VideoProxyConfig
+	// FileTimeout, when positive, limits each file's copy to each share.
+	FileTimeout time.Duration
+	// SlowShare is the config's slow_share mode.
+	SlowShare string
+	// Pause, when set, lets the run be paused between files.
+	Pause *pauseGate
+	// Confirm, when set, sees the final file list before anything is copied;
+	// an error stops the run.
+	Confirm func(jobs []TransferJob) error
 }
 
 type TransferError struct {
@@ -67,9 +369,80 @@ type TransferError struct {
 	Error    error
 }
 
+// shareResult is one file's outcome on one destination, as a copy worker
+// reports it.
+type shareResult struct {
+	source string
+	share  string
+	bytes  int64
+	err    error
+	// retract takes back a copy already counted as delivered, for a file in
+	// an archive that could not be completed.
+	retract bool
+}
+
+// resultAggregator is the one goroutine that owns a run's results: workers
+// send on results, and only the aggregator touches the totals, so nothing
+// is shared between workers. Call wait once every worker has returned.
+type resultAggregator struct {
+	results chan shareResult
+	done    chan struct{}
+
+	errors    []TransferError
+	delivered map[string]int   // destination -> files copied
+	bytes     map[string]int64 // destination -> bytes copied
+}
+
+func newResultAggregator(buffer int) *resultAggregator {
+	a := &resultAggregator{
+		results:   make(chan shareResult, buffer),
+		done:      make(chan struct{}),
+		delivered: map[string]int{},
+		bytes:     map[string]int64{},
+	}
+	go func() {
+		defer close(a.done)
+		for r := range a.results {
+			if r.retract {
+				a.delivered[r.share]--
+				a.bytes[r.share] -= r.bytes
+			}
+			if r.err != nil {
+				a.errors = append(a.errors, TransferError{FilePath: r.source, Share: r.share, Error: r.err})
+				continue
+			}
+			a.delivered[r.share]++
+			a.bytes[r.share] += r.bytes
+		}
+	}()
+	return a
+}
+
+// wait closes results and returns once everything sent has been counted.
+// The workers must all have returned: a send after this would panic.
+func (a *resultAggregator) wait() {
+	close(a.results)
+	<-a.done
+}
+
 type TransferProgressHook struct {
 	OnStart    func(total int)
 	OnProgress func(total, completed int, filePath string)
+	// OnShareResult fires once per file per destination (a share, or an
+	// overflow group); err is nil when the copy succeeded.
+	OnShareResult func(share, filePath string, bytes int64, err error)
+	// OnShareRetracted takes back a copy OnShareResult reported as done, for
+	// a file in an archive that could not be completed; err says why.
+	OnShareRetracted func(share, filePath string, bytes int64, err error)
+	// OnDuplicates fires once, before copying, with files skipped as content duplicates.
+	OnDuplicates func(dups []duplicateFile)
+	// OnSourceProblem fires for each card file skipped as empty or unreadable.
+	OnSourceProblem func(p sourceProblem)
+	// OnSimilar fires once after copying when TransferOptions.FindSimilar is set.
+	OnSimilar func(groups []similarGroup)
+	// OnRenamed fires once, before copying, with files whose names had to
+	// be changed for the shares.
+	OnRenamed func(renamed []renamedFile)
 }
 
 type MountCandidate struct {
@@ -78,80 +451,316 @@ type MountCandidate struct {
 	FSType string
 }
 
-var photoExtensions = map[string]bool{
-	// Stills
-	".jpg":  true,
-	".jpeg": true,
-	".png":  true,
-	".heic": true,
-	".heif": true,
-	".tif":  true,
-	".tiff": true,
-	".cr2":  true,
-	".cr3":  true,
-	".nef":  true,
-	".arw":  true,
-	".dng":  true,
-	".orf":  true,
-	".rw2":  true,
-	".raf":  true,
-	".pef":  true,
-	".srw":  true,
-	".raw":  true,
-	// Video (cameras and action cams)
-	".mov":  true,
-	".mp4":  true,
-	".m4v":  true,
-	".avi":  true,
-	".mts":  true,
-	".m2ts": true,
-	".mxf":  true,
+// photoExtensions are the photo and video files an import picks up, as
+// package ingest defines them.
+var photoExtensions = func() map[string]bool {
+	exts := map[string]bool{}
+	for _, ext := range ingest.MediaExtensions() {
+		exts[ext] = true
+	}
+	return exts
+}()
+
+// listFlag collects a flag that may be repeated or given a comma-separated
+// list, e.g. -mount /Volumes/A,/Volumes/B.
+type listFlag []string
+
+func (m *listFlag) String() string { return strings.Join(*m, ", ") }
+
+func (m *listFlag) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*m = append(*m, part)
+		}
+	}
+	return nil
+}
+
+func (m listFlag) first() string {
+	if len(m) == 0 {
+		return ""
+	}
+	return m[0]
+}
+
+// flagWasSet reports whether the named top-level flag was given explicitly.
+func flagWasSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
 
 func main() {
-	mountPoint := flag.String("mount", "", "SD card mount point")
+	os.Exit(run())
+}
+
+// run is the import command line. It returns the exit code instead of
+// exiting, so deferred cleanup such as removing staging folders and
+// closing share sessions runs on every path.
+func run() int {
+	if code, ok := runSubcommand(os.Args[1:]); ok {
+		return code
+	}
+
+	var mountPoints, onlyShares, skipShares listFlag
+	flag.Var(&mountPoints, "mount", "SD card mount point, a .zip or .tar card backup, or an smb://[user@]host/share/folder network folder; repeat or comma-separate to merge several into one shoot")
 	photoshootName := flag.String("name", "", "Photoshoot name")
 	configPath := flag.String("config", "config.yaml", "Path to SMB config YAML file")
+	profile := flag.String("profile", "", "Named profile from the config's profiles: section to use for this run (default $SNAPVAULT_PROFILE)")
+	var overrides []string
+	flag.Func("set", "Override a config value for this run, e.g. -set smb_shares.0.host=10.0.0.5 or -set quorum=2; repeatable", func(v string) error {
+		overrides = append(overrides, v)
+		return nil
+	})
 	timeout := flag.Duration("timeout", 30*time.Second, "SMB connection timeout")
 	workers := flag.Int("workers", 4, "Number of parallel workers for file transfers")
 	serve := flag.Bool("serve", false, "Run the web UI server instead of the terminal app")
-	addr := flag.String("addr", "127.0.0.1:8080", "Address to bind the web UI server")
+	addr := flag.String("addr", "127.0.0.1:8080", "Address to bind the web UI server (beyond loopback, the import API needs api.token in config)")
 	noOpen := flag.Bool("no-open", false, "Do not open the browser automatically in -serve mode")
+	receiveFTP := flag.String("receive-ftp", "", "Accept camera uploads over FTP on this address (e.g. 0.0.0.0:2121) instead of reading a card; requires -name")
+	receiveHTTP := flag.String("receive-http", "", "Accept uploads from phones over HTTP on this address (e.g. 0.0.0.0:8090) instead of reading a card; requires -name")
+	watchDir := flag.String("watch", "", "Watch this folder, e.g. a tethering capture folder, and archive new files as they appear instead of reading a card; requires -name")
+	watchSettle := flag.Duration("watch-settle", 3*time.Second, "With -watch, how long a file's size must hold still before it is sent")
+	source := flag.String("source", "card", "Where to import from: card (a mounted volume, see -mount) or camera (USB camera over PTP/MTP via gphoto2)")
+	cameraSel := flag.String("camera", "", "With -source camera, the camera to use when several are connected (gphoto2 port or part of the model name)")
+	reviewAddr := flag.String("review-addr", "", "While importing, serve the JPEGs copied so far on this address for review on a tablet (e.g. 0.0.0.0:8090)")
+	findSimilar := flag.Bool("similar", false, "Also hash JPEGs to report near-duplicates and bursts awaiting culling (adds CPU time; nothing is skipped)")
+	incremental := flag.Bool("incremental", false, "Only import files added since this card's last successful offload (cards are recognised by volume UUID)")
+	markCard := flag.Bool("mark-card", false, "After a fully verified import, write a "+importMarkerName+" note to the card root saying it is safe to format")
+	quarantineDir := flag.String("quarantine", "", "Local folder to salvage empty or unreadable card files into (they are never copied to the shares)")
+	autoMount := flag.Bool("auto-mount", false, "Without -mount, import from the mounted card with a DCIM folder, asking which one when there are several")
+	yes := flag.Bool("yes", false, "Start copying without showing the import summary and asking for confirmation")
+	eject := flag.Bool("eject", false, "After a fully verified import, eject the card (macOS, via diskutil)")
+	queue := flag.Bool("queue", false, "Import every detected card (or each -mount) one after another as separate shoots; -name may be a template such as \"Wedding card {{.Index}}\", otherwise names are prompted up front")
+	flag.Var(&onlyShares, "only-share", "Import only to these shares (name, host, share name or host/share); repeat or comma-separate. Also enables shares marked enabled: false")
+	flag.Var(&skipShares, "skip-share", "Leave these shares out of this import; repeat or comma-separate")
+	var askPass listFlag
+	flag.Var(&askPass, "ask-pass", "Prompt for share passwords instead of reading them from the config: \"all\" or share names; repeat or comma-separate")
+	order := flag.String("order", "", "Copy order: card, jpeg-first (previews first), two-phase (all previews, then RAWs) or smallest-first (overrides transfer_order in the config)")
+	preserveStructure := flag.Bool("preserve-structure", false, "Mirror the card's folders (DCIM/100CANON/...) under the shoot folder instead of sorting files into date folders")
+	minSize := flag.String("min-size", "", "Skip card files smaller than this, e.g. 200KB (overrides min_file_size in the config)")
+	maxSize := flag.String("max-size", "", "Skip card files larger than this, e.g. 4GB (overrides max_file_size in the config)")
+	filesFrom := flag.String("files-from", "", "Only import the source files named in this list, one per line or NUL-separated (\"-\" reads stdin); relative paths are from the card root")
+	minRating := flag.Int("min-rating", 0, "Only send files rated at least this many stars in camera to shares with a selects block (overrides their min_rating)")
+	workerRamp := flag.Duration("worker-ramp", defaultWorkerRamp, "Start the workers one by one over this long, e.g. 10s; 0 starts them all at once (overrides worker_ramp in the config)")
+	fileTimeout := flag.Duration("file-timeout", 0, "Give up on copying one file to one share after this long, e.g. 5m (overrides file_timeout in the config; default no limit)")
+	quorum := flag.Int("quorum", 0, "Treat the import as successful when at least this many destinations received every file (overrides the config; default all)")
+	grpcAddr := flag.String("grpc-addr", "", "Also serve the gRPC control API on this address in -serve mode (e.g. 127.0.0.1:9090; other addresses need grpc.token and TLS in config)")
+	var logs logSettings
+	flag.StringVar(&logs.level, "log-level", "info", "Minimum log level: debug (includes every file copied), info, warn or error")
+	quiet := flag.Bool("quiet", false, "Show only a progress line, warnings and the final summary (implies -log-level warn)")
+	flag.StringVar(&logs.format, "log-format", "text", "Log format: text or json (one object per line, for Loki/ELK)")
+	flag.StringVar(&logs.file, "log-file", "", "Write logs to this file instead of stderr, rotating it by size")
+	flag.IntVar(&logs.maxSizeMB, "log-max-size", 50, "With -log-file, rotate the log after this many megabytes")
+	flag.IntVar(&logs.maxBackups, "log-max-backups", 5, "With -log-file, number of rotated logs to keep")
+	insecureConfig := flag.Bool("insecure-config", false, "Run even though the config holds passwords and other users can read it")
 	flag.Parse()
 
+	if *quiet && !flagWasSet("log-level") {
+		logs.level = "warn"
+	}
+	if err := setupLogging(logs); err != nil {
+		slog.Error("Invalid logging flags", "error", err)
+		return exitUsage
+	}
+
+	smbSources := map[string]smbSource{}
+	for i, mp := range mountPoints {
+		if isSMBSource(mp) {
+			src, err := parseSMBSource(mp)
+			if err != nil {
+				slog.Error("Invalid smb:// source", "mount", mp, "error", err)
+				return exitUsage
+			}
+			smbSources[mp] = src
+			continue
+		}
+		mountPoints[i] = normalizeMountPath(mp)
+	}
+
+	if err := checkConfigPermissions(*configPath); err != nil {
+		if !*insecureConfig {
+			slog.Error("Refusing to use config", "error", err)
+			return exitConfig
+		}
+		slog.Warn("Using insecure config", "error", err)
+	}
+
 	if *serve {
-		if err := runWebServer(*configPath, *addr, *timeout, *workers, !*noOpen); err != nil {
+		if err := runWebServer(*configPath, *addr, *grpcAddr, *timeout, *workers, !*noOpen); err != nil {
 			slog.Error("Web server failed", "error", err)
-			os.Exit(1)
+			return 1
+		}
+		return exitOK
+	}
+
+	if *receiveFTP != "" && *photoshootName == "" {
+		slog.Error("-receive-ftp requires -name")
+		return exitUsage
+	}
+	if *receiveHTTP != "" && (*photoshootName == "" || *receiveFTP != "" || *watchDir != "" || len(mountPoints) > 0 || *queue || *source == "camera") {
+		slog.Error("-receive-http requires -name and can't be combined with -mount, -queue, -source camera, -receive-ftp or -watch")
+		return exitUsage
+	}
+	if *watchDir != "" {
+		if *photoshootName == "" || *receiveFTP != "" || len(mountPoints) > 0 || *queue || *source == "camera" {
+			slog.Error("-watch requires -name and can't be combined with -mount, -queue, -source camera or -receive-ftp")
+			return exitUsage
+		}
+		*watchDir = normalizeMountPath(*watchDir)
+		if err := validateMountPath(*watchDir); err != nil {
+			slog.Error("Invalid watch folder", "path", *watchDir, "error", err)
+			return exitUsage
+		}
+	}
+
+	var files *fileList
+	if *filesFrom != "" {
+		if *photoshootName == "" || *queue || *receiveFTP != "" || *receiveHTTP != "" || *watchDir != "" || *incremental || *markCard {
+			slog.Error("-files-from requires -name and can't be combined with -queue, -receive-ftp, -receive-http, -watch, -incremental or -mark-card")
+			return exitUsage
+		}
+		if len(mountPoints) == 0 && !*autoMount && *source != "camera" {
+			slog.Error("-files-from needs a source: -mount, -auto-mount or -source camera")
+			return exitUsage
+		}
+		if *filesFrom == "-" && !*yes {
+			slog.Error("-files-from - reads the list from stdin, so it needs -yes")
+			return exitUsage
+		}
+		var err error
+		if files, err = readFileList(*filesFrom, os.Stdin); err != nil {
+			slog.Error("Invalid -files-from", "error", err)
+			return exitUsage
+		}
+	}
+
+	fromCamera := false
+	switch *source {
+	case "card":
+	case "camera":
+		if *photoshootName == "" {
+			slog.Error("-source camera requires -name")
+			return exitUsage
+		}
+		fromCamera = true
+	default:
+		slog.Error("Unknown -source; use card or camera", "source", *source)
+		return exitUsage
+	}
+
+	if *autoMount && len(mountPoints) == 0 && !*queue && !fromCamera && *receiveFTP == "" && *receiveHTTP == "" && *watchDir == "" {
+		card, err := chooseCardMount(detectCardMounts(), os.Stdin, os.Stdout)
+		if err != nil {
+			slog.Error("Cannot pick a card", "error", err)
+			return 1
+		}
+		mountPoints = listFlag{card}
+	}
+
+	var queuedCards []queuedCard
+	if *queue {
+		cards := []string(mountPoints)
+		if len(cards) == 0 {
+			cards = detectCardMounts()
+		}
+		var err error
+		queuedCards, err = planCardQueue(cards, *photoshootName, os.Stdin, os.Stdout)
+		if err != nil {
+			slog.Error("Cannot start card queue", "error", err)
+			return 1
 		}
-		return
 	}
 
-	if *mountPoint == "" || *photoshootName == "" {
-		err := runInteractiveTUI(*configPath, *mountPoint, *photoshootName, *timeout, *workers)
+	if !*queue && len(mountPoints) > 1 && *photoshootName == "" {
+		slog.Error("Multiple -mount values require -name")
+		return exitUsage
+	}
+	if len(smbSources) > 0 && (*queue || fromCamera || *receiveFTP != "" || *photoshootName == "") {
+		slog.Error("An smb:// -mount requires -name and can't be combined with -queue, -source camera or -receive-ftp")
+		return exitUsage
+	}
+	for _, mp := range mountPoints {
+		if isArchiveSource(mp) && (*queue || fromCamera || *receiveFTP != "" || *photoshootName == "") {
+			slog.Error("An archive -mount requires -name and can't be combined with -queue, -source camera or -receive-ftp")
+			return exitUsage
+		}
+	}
+
+	if *receiveFTP == "" && *receiveHTTP == "" && *watchDir == "" && !fromCamera && !*queue && (len(mountPoints) == 0 || *photoshootName == "") {
+		err := runInteractiveTUI(*configPath, mountPoints.first(), *photoshootName, *timeout, *workers)
 		if err != nil {
 			slog.Error("Interactive session failed", "error", err)
-			os.Exit(1)
+			return 1
 		}
-		return
+		return exitOK
 	}
 
-	config, err := loadConfig(*configPath)
+	config, err := loadConfig(*configPath, *profile, overrides)
 	if err != nil {
 		slog.Error("Failed to load config", "error", err)
-		os.Exit(1)
+		return exitConfig
+	}
+	if !flagWasSet("workers") && config.Workers > 0 {
+		*workers = config.Workers
+	}
+	if flagWasSet("worker-ramp") {
+		config.WorkerRamp = workerRamp
+	}
+	if *quorum > 0 {
+		config.Quorum = *quorum
+	}
+	if *fileTimeout > 0 {
+		config.FileTimeout = *fileTimeout
+	}
+	if *minSize != "" {
+		config.MinFileSize = *minSize
+	}
+	if *maxSize != "" {
+		config.MaxFileSize = *maxSize
+	}
+	if *order != "" {
+		config.TransferOrder = *order
+	}
+	if *preserveStructure {
+		if config.Naming == nil {
+			config.Naming = &NamingConfig{}
+		}
+		config.Naming.PreserveStructure = true
+	}
+	if *minRating != 0 {
+		if err := applyMinRating(config.SMBShares, *minRating); err != nil {
+			slog.Error("Invalid -min-rating", "error", err)
+			return exitUsage
+		}
+	}
+	if _, err := normalizeTransferOrder(config.TransferOrder); err != nil {
+		slog.Error("Invalid transfer order", "error", err)
+		return exitConfig
 	}
 
 	if len(config.SMBShares) == 0 {
 		slog.Error("No SMB shares configured")
-		os.Exit(1)
+		return exitConfig
+	}
+	config.SMBShares, err = selectShares(config.SMBShares, onlyShares, skipShares)
+	if err != nil {
+		slog.Error("Invalid share selection", "error", err)
+		return exitConfig
+	}
+	if err := askPasswords(config.SMBShares, askPass); err != nil {
+		slog.Error("Cannot read share passwords", "error", err)
+		return 1
 	}
 
 	// Create folder name with year prefix
 	currentYear := time.Now().Year()
 	folderName := fmt.Sprintf("%d - %s", currentYear, *photoshootName)
-	slog.Info("Starting photo transfer", "folder", folderName, "mount_point", *mountPoint)
-	startedAt := time.Now()
+	slog.Info("Starting photo transfer", "folder", folderName, "mount_points", mountPoints)
 
 	// Set up context with signal handling
 	ctx, cancel := context.WithCancel(context.Background())
@@ -165,47 +774,427 @@ func main() {
 		cancel()
 	}()
 
-	// Establish all SMB connections upfront
+	// Deferred shares are only queued; connect to the others upfront.
+	var deferred []SMBConfig
+	config.SMBShares, deferred = splitDeferred(config.SMBShares)
+	logDeferredShares(deferred)
 	connections, err := establishConnections(ctx, config, *timeout)
 	if err != nil {
 		slog.Error("Failed to establish SMB connections", "error", err)
-		os.Exit(1)
+		return connectExitCode(err)
 	}
 	defer closeConnections(connections)
 
-	// Process photos, tracking counts so notifications can report them.
-	var totalCount, completedCount int64
-	countHook := &TransferProgressHook{
-		OnStart: func(total int) { atomic.StoreInt64(&totalCount, int64(total)) },
-		OnProgress: func(total, completed int, _ string) {
-			atomic.StoreInt64(&totalCount, int64(total))
-			atomic.StoreInt64(&completedCount, int64(completed))
-		},
+	if *receiveFTP != "" {
+		report, err := runFTPReceiver(ctx, *receiveFTP, config, folderName, connections)
+		if err != nil {
+			slog.Error("FTP receiver failed", "error", err)
+			return 1
+		}
+		notifyTransferResult(config, report)
+		slog.Info("FTP receiver stopped", "files", report.Completed, "errors", len(report.Errors))
+		return exitOK
+	}
+	if *receiveHTTP != "" {
+		report, err := runHTTPReceiver(ctx, *receiveHTTP, config, folderName, connections)
+		if err != nil {
+			slog.Error("HTTP receiver failed", "error", err)
+			return 1
+		}
+		notifyTransferResult(config, report)
+		slog.Info("HTTP receiver stopped", "files", report.Completed, "errors", len(report.Errors))
+		return exitOK
+	}
+	if *watchDir != "" {
+		report, err := runWatchFolder(ctx, *watchDir, *watchSettle, config, folderName, connections)
+		if err != nil {
+			slog.Error("Watching folder failed", "error", err)
+			return 1
+		}
+		notifyTransferResult(config, report)
+		slog.Info("Stopped watching folder", "files", report.Completed, "errors", len(report.Errors))
+		return exitOK
+	}
+
+	manifests, err := newManifestWriter(config.ChecksumManifest)
+	if err != nil {
+		slog.Error("Invalid config", "error", err)
+		return exitConfig
+	}
+	sidecars, err := newXMPSidecarWriter(config.XMPSidecar)
+	if err != nil {
+		slog.Error("Invalid config", "error", err)
+		return exitConfig
+	}
+	shootManifests, err := newShootManifestWriter(config.ShootManifest)
+	if err != nil {
+		slog.Error("Invalid config", "error", err)
+		return exitConfig
+	}
+	readmes, err := newShootReadmeWriter(config.ShootReadme)
+	if err != nil {
+		slog.Error("Invalid config", "error", err)
+		return exitConfig
+	}
+
+	layout, err := newFolderLayout(config)
+	if err != nil {
+		slog.Error("Invalid naming config", "error", err)
+		return exitConfig
+	}
+	sizes, err := newSizeFilter(config)
+	if err != nil {
+		slog.Error("Invalid size filter", "error", err)
+		return exitConfig
+	}
+	skip, err := newFolderSkipper(config)
+	if err != nil {
+		slog.Error("Invalid folder rules", "error", err)
+		return exitConfig
+	}
+
+	events := newEventBus()
+	var progress *progressLine
+	if *quiet && term.IsTerminal(int(os.Stderr.Fd())) {
+		progress = newProgressLine(os.Stderr)
+		events.subscribe(progress.handle)
+	}
+	if *reviewAddr != "" {
+		review, err := startReviewServer(ctx, *reviewAddr)
+		if err != nil {
+			slog.Error("Failed to start review server", "error", err)
+			return 1
+		}
+		events.subscribe(review.handle)
+	}
+	if notify := shareErrorNotifier(config); notify != nil {
+		events.subscribe(notify)
+	}
+	status, pause := newRunStatus(), &pauseGate{}
+	progressHook := status.hook(nil)
+	watchRunSignals(ctx, status, pause)
+
+	if *queue {
+		base := TransferOptions{
+			Hook:           progressHook,
+			Events:         events,
+			Layout:         layout,
+			Sizes:          sizes,
+			Replacement:    config.FilenameReplacement,
+			NameForm:       config.UnicodeNormalization,
+			Skip:           skip,
+			Companions:     config.CompanionFiles,
+			VideoProxy:     config.VideoProxy,
+			Pause:          pause,
+			Order:          config.TransferOrder,
+			FileTimeout:    config.FileTimeout,
+			SlowShare:      config.SlowShare,
+			Workers:        *workers,
+			WorkerRamp:     config.workerRamp(),
+			HashAlgorithm:  config.HashAlgorithm,
+			Manifests:      manifests,
+			Sidecars:       sidecars,
+			ShootManifests: shootManifests,
+			Readmes:        readmes,
+			Gallery:        newGalleryWriter(config.Gallery),
+			FindSimilar:    *findSimilar,
+			QuarantineDir:  *quarantineDir,
+			Deferred:       deferred,
+		}
+		results, err := runCardQueue(ctx, config, queuedCards, connections, base, queueSettings{incremental: *incremental, markCard: *markCard, eject: *eject})
+		if progress != nil {
+			progress.finish()
+		}
+		printQueueSummary(os.Stdout, results)
+		if errors.Is(err, context.Canceled) {
+			slog.Info("Card queue cancelled by user")
+			return exitCancelled
+		}
+		if err != nil {
+			slog.Error("Card queue stopped", "error", err)
+			return exitCode(err)
+		}
+		for _, r := range results {
+			if !r.Report.ok() {
+				return transferExitCode(r.Report.Errors)
+			}
+		}
+		return exitOK
+	}
+
+	if !fromCamera && *receiveFTP == "" {
+		for _, mp := range mountPoints {
+			if isSMBSource(mp) || isArchiveSource(mp) {
+				continue
+			}
+			if err := validateMountPath(mp); err != nil {
+				slog.Error("Invalid mount point", "path", mp, "error", err)
+				return 1
+			}
+		}
+	}
+
+	sourceLabel := mountPoints.String()
+	if fromCamera {
+		cams, err := detectCameras(ctx)
+		if err != nil {
+			slog.Error("Failed to detect cameras", "error", err)
+			return 1
+		}
+		cam, err := selectCamera(cams, *cameraSel)
+		if err != nil {
+			slog.Error("No camera to import from", "error", err)
+			return 1
+		}
+		staging, err := os.MkdirTemp("", "snapvault-camera-")
+		if err != nil {
+			slog.Error("Failed to create staging directory", "error", err)
+			return 1
+		}
+		defer os.RemoveAll(staging)
+
+		slog.Info("Importing from camera", "model", cam.Model, "port", cam.Port)
+		if err := downloadFromCamera(ctx, cam, staging); err != nil {
+			os.RemoveAll(staging)
+			if errors.Is(ctx.Err(), context.Canceled) {
+				slog.Info("Camera download cancelled by user")
+				return exitCancelled
+			}
+			slog.Error("Failed to download from camera", "error", err)
+			return 1
+		}
+		mountPoints = listFlag{staging}
+		sourceLabel = "camera: " + cam.Model
+	}
+	// Network folders and archives are downloaded or extracted first, like a
+	// camera, and imported from the copy; the card-only steps skip them.
+	staged := false
+	for i, mp := range mountPoints {
+		src, ok := smbSources[mp]
+		if !ok {
+			continue
+		}
+		if err := src.login(config.SMBShares); err != nil {
+			slog.Error("Cannot log in to network folder", "source", src.String(), "error", err)
+			return 1
+		}
+		staging, err := os.MkdirTemp("", "snapvault-smb-")
+		if err != nil {
+			slog.Error("Failed to create staging directory", "error", err)
+			return 1
+		}
+		defer os.RemoveAll(staging)
+		n, err := stageSMBSource(ctx, src, staging, *timeout)
+		if err != nil {
+			os.RemoveAll(staging)
+			if errors.Is(ctx.Err(), context.Canceled) {
+				slog.Info("Network folder download cancelled by user")
+				return exitCancelled
+			}
+			slog.Error("Failed to download from network folder", "source", src.String(), "error", err)
+			return 1
+		}
+		slog.Info("Downloaded network folder", "source", src.String(), "files", n)
+		mountPoints[i] = staging
+		staged = true
+	}
+	for i, mp := range mountPoints {
+		if !isArchiveSource(mp) {
+			continue
+		}
+		staging, err := os.MkdirTemp("", "snapvault-archive-")
+		if err != nil {
+			slog.Error("Failed to create staging directory", "error", err)
+			return 1
+		}
+		defer os.RemoveAll(staging)
+		n, err := stageArchiveSource(ctx, mp, staging)
+		if err != nil {
+			os.RemoveAll(staging)
+			if errors.Is(ctx.Err(), context.Canceled) {
+				slog.Info("Archive extraction cancelled by user")
+				return exitCancelled
+			}
+			slog.Error("Failed to extract archive", "source", mp, "error", err)
+			return 1
+		}
+		slog.Info("Extracted archive", "source", mp, "files", n)
+		mountPoints[i] = staging
+		staged = true
+	}
+
+	// Process photos, collecting per-share results so notifications can report them.
+	collector := newReportCollector(folderName, sourceLabel, config.Quorum)
+	namer, err := newFileNamer(config, *photoshootName, folderName)
+	if err != nil {
+		slog.Error("Invalid naming config", "error", err)
+		return exitConfig
+	}
+	opts := TransferOptions{
+		Workers:        *workers,
+		WorkerRamp:     config.workerRamp(),
+		HashAlgorithm:  config.HashAlgorithm,
+		Manifests:      manifests,
+		Sidecars:       sidecars,
+		ShootManifests: shootManifests,
+		Readmes:        readmes,
+		Gallery:        newGalleryWriter(config.Gallery),
+		Journal:        openRunJournal(config, folderName, []string(mountPoints)),
+		Catalog:        config,
+		Hook:           collector.hook(progressHook),
+		Events:         events,
+		Pause:          pause,
+		Order:          config.TransferOrder,
+		FileTimeout:    config.FileTimeout,
+		SlowShare:      config.SlowShare,
+		Namer:          namer,
+		Layout:         layout,
+		Sizes:          sizes,
+		Replacement:    config.FilenameReplacement,
+		NameForm:       config.UnicodeNormalization,
+		Skip:           skip,
+		Companions:     config.CompanionFiles,
+		VideoProxy:     config.VideoProxy,
+		FindSimilar:    *findSimilar,
+		QuarantineDir:  *quarantineDir,
+		Deferred:       deferred,
+	}
+	if !*yes {
+		opts.Confirm = func(jobs []TransferJob) error {
+			if len(jobs) == 0 {
+				return nil
+			}
+			printImportSummary(os.Stdout, jobs, folderName, connections)
+			if !confirm("Start the import?") {
+				return errImportDeclined
+			}
+			return nil
+		}
+	}
+	var memory *cardMemory
+	// A partial import says nothing about the rest of the card, so it
+	// isn't remembered against it.
+	if !fromCamera && !staged && files == nil {
+		memory = newCardMemory(ctx, config, mountPoints, *incremental)
+		opts.Include = memory.include
+		if opts.Journal != nil {
+			opts.Journal.Cards = memory.ids()
+		}
+	}
+	if files != nil {
+		opts.Include = files.include
+		confirmImport := opts.Confirm
+		opts.Confirm = func(jobs []TransferJob) error {
+			if missing := files.missing(); len(missing) > 0 {
+				slog.Warn("Listed files not found on the card", "count", len(missing), "files", missing)
+			}
+			if confirmImport != nil {
+				return confirmImport(jobs)
+			}
+			return nil
+		}
+	}
+	transferErrors, err := processPhotos(ctx, mountPoints, folderName, connections, opts)
+	if progress != nil {
+		progress.finish()
 	}
-	transferErrors, err := processPhotos(ctx, *mountPoint, folderName, connections, *workers, countHook)
 	if err != nil {
 		if errors.Is(err, context.Canceled) {
 			slog.Info("Photo transfer cancelled by user")
-			os.Exit(130)
+			return exitCancelled
+		}
+		if errors.Is(err, errImportDeclined) {
+			slog.Info("Import not started; pass -yes to skip the confirmation")
+			return 1
+		}
+		if memory != nil {
+			memory.remember(config, folderName, false)
 		}
-		notifyTransferResult(config.Ntfy, folderName, int(totalCount), int(completedCount), time.Since(startedAt), err, transferErrors)
+		notifyTransferResult(config, collector.build(err, transferErrors))
 		slog.Error("Failed to process photos", "error", err)
-		os.Exit(1)
+		return exitCode(err)
 	}
 
-	notifyTransferResult(config.Ntfy, folderName, int(totalCount), int(completedCount), time.Since(startedAt), nil, transferErrors)
+	report := collector.build(nil, transferErrors)
+	if memory != nil {
+		memory.remember(config, folderName, report.ok())
+	}
+	if *markCard && !fromCamera && !staged && report.allCopied() {
+		for _, mp := range mountPoints {
+			if err := writeImportMarker(mp, report); err != nil {
+				slog.Warn("Could not mark card as imported (write-protected?)", "mount", mp, "error", err)
+			}
+		}
+	}
+	if *eject && !fromCamera && !staged && report.ok() && report.Completed == report.Total {
+		for _, mp := range mountPoints {
+			if err := ejectCard(ctx, mp); err != nil {
+				slog.Warn("Could not eject card", "mount", mp, "error", err)
+			} else {
+				slog.Info("Card ejected", "mount", mp)
+			}
+		}
+	}
+	notifyTransferResult(config, report)
 
 	// Print summary
+	fmt.Printf("Imported %d of %d files (%s) to %d destination(s) in %s\n",
+		report.Completed, report.Total, formatBytes(report.Bytes), len(report.Shares), report.Duration.Round(time.Second))
+	if len(report.Extensions) > 0 {
+		fmt.Println()
+		writeBreakdown(os.Stdout, "=== By file type ===", report.Extensions)
+	}
+	if len(report.Cameras) > 0 {
+		fmt.Println()
+		writeBreakdown(os.Stdout, "=== By camera ===", report.Cameras)
+	}
+	if len(report.SourceProblems) > 0 {
+		fmt.Printf("\n=== Source problems: %d file(s) not copied ===\n", len(report.SourceProblems))
+		for _, p := range report.SourceProblems {
+			fmt.Printf("%s\n  %s\n", p.Path, p.Reason)
+			if p.Quarantined != "" {
+				fmt.Printf("  salvaged to: %s\n", p.Quarantined)
+			}
+		}
+	}
+	if len(report.Renamed) > 0 {
+		fmt.Printf("\n=== Renamed %d file(s) the shares can't store as-is ===\n", len(report.Renamed))
+		for _, r := range report.Renamed {
+			fmt.Printf("%s\n  stored as: %s\n", r.Path, r.Stored)
+		}
+	}
+	if len(report.Duplicates) > 0 {
+		fmt.Printf("\n=== Skipped %d duplicate file(s) ===\n", len(report.Duplicates))
+		for _, d := range report.Duplicates {
+			fmt.Printf("%s\n  same as: %s\n", d.Path, d.DuplicateOf)
+		}
+	}
+	if len(report.Similar) > 0 {
+		fmt.Printf("\n=== %d near-duplicate group(s), %d photos to cull ===\n", len(report.Similar), report.similarFrames())
+		for _, g := range report.Similar {
+			fmt.Printf("%d frames: %s … %s\n", len(g.Files), filepath.Base(g.Files[0]), filepath.Base(g.Files[len(g.Files)-1]))
+		}
+	}
 	if len(transferErrors) > 0 {
 		slog.Warn("Transfer completed with errors", "failed_count", len(transferErrors))
 		fmt.Println("\n=== Transfer Error Summary ===")
 		for _, te := range transferErrors {
 			fmt.Printf("File: %s\n  Share: %s\n  Error: %v\n\n", te.FilePath, te.Share, te.Error)
 		}
-		os.Exit(1)
+		printErrorHints(os.Stdout, transferErrors)
+		if !report.ok() {
+			return transferExitCode(transferErrors)
+		}
+		slog.Info("Quorum met despite errors", "complete_destinations", report.completeDestinations(), "quorum", report.Quorum)
+	}
+
+	if len(report.SourceProblems) > 0 {
+		slog.Warn("Transfer completed, but some card files are damaged", "count", len(report.SourceProblems))
+		return exitSourceRead
 	}
 
 	slog.Info("Photo transfer completed successfully")
+	return exitOK
 }
 
 func parseManualSMBTarget(value string) (string, int, string, string, error) {
@@ -301,9 +1290,27 @@ func validateMountPath(path string) error {
 	return nil
 }
 
+// normalizeMountPath makes a -mount value absolute, which on Windows also
+// lets paths beyond MAX_PATH be opened. A bare drive letter such as E: means
+// the drive root rather than the current directory on that drive.
+func normalizeMountPath(p string) string {
+	if runtime.GOOS == "windows" && len(p) == 2 && p[1] == ':' {
+		p += `\`
+	}
+	if abs, err := filepath.Abs(p); err == nil {
+		return abs
+	}
+	return p
+}
+
 func detectMountCandidates() []MountCandidate {
 	candidateMap := make(map[string]MountCandidate)
 
+	// Windows drive letters.
+	for _, c := range removableDrives() {
+		candidateMap[c.Path] = c
+	}
+
 	// Linux mount discovery.
 	if data, err := os.ReadFile("/proc/mounts"); err == nil {
 		lines := strings.Split(string(data), "\n")
@@ -339,6 +1346,9 @@ func detectMountCandidates() []MountCandidate {
 				continue
 			}
 			path := filepath.Join(root, entry.Name())
+			if root == "/Volumes" && runtime.GOOS == "darwin" && !darwinIsRemovable(context.Background(), path) {
+				continue
+			}
 			if root == "/media" || strings.HasPrefix(root, "/run/media/") {
 				subEntries, err := os.ReadDir(path)
 				if err == nil {
@@ -400,36 +1410,84 @@ func decodeProcMountField(value string) string {
 	return replacer.Replace(value)
 }
 
-func loadConfig(path string) (*Config, error) {
-	return loadConfigFromFile(path, true)
+// loadConfig reads the config for a run: the named profile (if any, else
+// $SNAPVAULT_PROFILE) is applied, then SNAPVAULT_* variables and the -set
+// overrides, and passwords are expanded. Without a config file the run can
+// be configured entirely from the environment.
+func loadConfig(path, profile string, overrides []string) (*Config, error) {
+	if profile == "" {
+		profile = os.Getenv(envProfile)
+	}
+	env := envOverrides()
+	config, err := loadConfigFromFile(path, profile, false)
+	if errors.Is(err, os.ErrNotExist) && len(env)+len(overrides) > 0 {
+		config, err = &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := config.applyOverrides(append(env, overrides...)); err != nil {
+		return nil, err
+	}
+	expandSharePasswords(config)
+	if err := resolveKeyringPasswords(config); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
+// loadConfigRaw reads the config as written, for the UIs that edit and save it.
 func loadConfigRaw(path string) (*Config, error) {
-	return loadConfigFromFile(path, false)
+	return loadConfigFromFile(path, "", false)
 }
 
-func loadConfigFromFile(path string, expandPasswords bool) (*Config, error) {
+func loadConfigFromFile(path, profile string, expandPasswords bool) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("reading config file: %w", err)
 	}
+	data, err = decryptConfig(path, data)
+	if err != nil {
+		return nil, err
+	}
+	format := configFormat(path)
+	data, err = configToYAML(format, data)
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file: %w", err)
+	}
+	if err := unknownKeysError(data, format == formatYAML); err != nil {
+		return nil, err
+	}
 
 	var config Config
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("parsing config file: %w", err)
 	}
+	if err := config.applyProfile(profile); err != nil {
+		return nil, err
+	}
 
 	if expandPasswords {
-		for i := range config.SMBShares {
-			config.SMBShares[i].Password = os.ExpandEnv(config.SMBShares[i].Password)
-		}
+		expandSharePasswords(&config)
 	}
 
 	return &config, nil
 }
 
+func expandSharePasswords(config *Config) {
+	for i := range config.SMBShares {
+		config.SMBShares[i].Password = os.ExpandEnv(config.SMBShares[i].Password)
+	}
+}
+
 func saveConfig(path string, config *Config) error {
+	if configIsEncrypted(path) {
+		return errEncryptedConfig
+	}
 	data, err := yaml.Marshal(config)
+	if err == nil {
+		data, err = configFromYAML(configFormat(path), data)
+	}
 	if err != nil {
 		return fmt.Errorf("marshaling config: %w", err)
 	}
@@ -443,8 +1501,12 @@ func saveConfig(path string, config *Config) error {
 
 func establishConnections(ctx context.Context, config *Config, timeout time.Duration) ([]*SMBConnection, error) {
 	connections := make([]*SMBConnection, 0, len(config.SMBShares))
+	chunks, err := newChunkedUploads(config)
+	if err != nil {
+		return nil, err
+	}
 
-	for i, smbConfig := range config.SMBShares {
+	for _, smbConfig := range config.SMBShares {
 		select {
 		case <-ctx.Done():
 			closeConnections(connections)
@@ -452,13 +1514,57 @@ func establishConnections(ctx context.Context, config *Config, timeout time.Dura
 		default:
 		}
 
-		slog.Info("Establishing SMB connection", "index", i, "host", smbConfig.Host, "share", smbConfig.Share)
+		label := shareLabel(smbConfig)
 
+		algName := smbConfig.HashAlgorithm
+		if algName == "" {
+			algName = config.HashAlgorithm
+		}
+		hashAlg, err := normalizeHashAlgorithm(algName)
+		if err != nil {
+			closeConnections(connections)
+			return nil, fmt.Errorf("share %s: %w", label, err)
+		}
+		limiter, err := newBandwidthLimiter(smbConfig)
+		if err != nil {
+			closeConnections(connections)
+			return nil, fmt.Errorf("share %s: %w", label, err)
+		}
+		encryption, err := newShareEncryption(config, smbConfig)
+		if err != nil {
+			closeConnections(connections)
+			return nil, fmt.Errorf("share %s: %w", label, err)
+		}
+		archive, err := normalizeArchiveFormat(smbConfig.Archive)
+		if err != nil {
+			closeConnections(connections)
+			return nil, fmt.Errorf("share %s: %w", label, err)
+		}
+		if smbConfig.isCloud() {
+			cloud, err := newCloudRemote(ctx, config, smbConfig)
+			if err != nil {
+				closeConnections(connections)
+				return nil, fmt.Errorf("share %s: %w", label, err)
+			}
+			connections = append(connections, &SMBConnection{
+				Config:  smbConfig,
+				hashAlg: hashAlg,
+				limiter: limiter,
+				cloud:   cloud,
+
+				attribution: config.Attribution,
+				encryption:  encryption,
+			})
+			slog.Info("Using cloud destination", "share", label, "type", cloud.kind())
+			continue
+		}
+
+		slog.Info("Establishing SMB connection", "share", label, "host", smbConfig.Host)
 		session, err := connectSMB(ctx, smbConfig, timeout)
 		if err != nil {
 			// Clean up already established connections
 			closeConnections(connections)
-			return nil, fmt.Errorf("connecting to share %d (%s): %w", i, smbConfig.Host, err)
+			return nil, fmt.Errorf("connecting to share %s: %w", label, classifyError(err))
 		}
 
 		share, err := session.Mount(smbConfig.Share)
@@ -466,25 +1572,46 @@ func establishConnections(ctx context.Context, config *Config, timeout time.Dura
 			session.Logoff()
 			// Clean up already established connections
 			closeConnections(connections)
-			return nil, fmt.Errorf("mounting share %d (%s/%s): %w", i, smbConfig.Host, smbConfig.Share, err)
+			return nil, fmt.Errorf("mounting share %s: %w", label, classifyError(err))
 		}
 
 		conn := &SMBConnection{
 			Config:  smbConfig,
 			Session: session,
 			Share:   share,
+			hashAlg: hashAlg,
+			limiter: limiter,
+			chunks:  chunks,
+
+			attribution: config.Attribution,
+			encryption:  encryption,
+			archives:    newArchiveSet(archive),
+		}
+		if v := config.VideoProxy; v != nil && matchesShareName(smbConfig, v.Share) {
+			conn.proxyFolder = v.folder()
 		}
 		connections = append(connections, conn)
-		slog.Info("Successfully connected to SMB share", "index", i, "host", smbConfig.Host)
+		slog.Info("Successfully connected to SMB share", "share", label)
 	}
+	shareDirTrees(connections)
 
 	return connections, nil
 }
 
 func closeConnections(connections []*SMBConnection) {
-	for i, conn := range connections {
+	for _, conn := range connections {
+		if conn.archives != nil {
+			// Imports and the receivers finish their archives themselves;
+			// anything still open here has nowhere left to be reported.
+			for _, e := range closeArchives(conn) {
+				slog.Error("File lost with its archive; copy it again", "file", e.source, "share", e.share, "error", e.err)
+			}
+		}
+		if conn.encryption != nil {
+			saveEncryptedNames(conn)
+		}
 		if conn.Share != nil {
-			slog.Info("Unmounting share", "index", i, "host", conn.Config.Host)
+			slog.Info("Unmounting share", "share", shareLabel(conn.Config))
 			conn.Share.Umount()
 		}
 		if conn.Session != nil {
@@ -495,33 +1622,197 @@ func closeConnections(connections []*SMBConnection) {
 
 func processPhotos(
 	ctx context.Context,
-	mountPoint, folderName string,
+	mountPoints []string,
+	folderName string,
 	connections []*SMBConnection,
-	workers int,
-	hook *TransferProgressHook,
+	opts TransferOptions,
 ) ([]TransferError, error) {
-	slog.Info("Scanning mount point for photos", "path", mountPoint, "workers", workers)
+	workers, hook := opts.Workers, opts.Hook
+	if len(opts.Deferred) > 0 {
+		if opts.Journal == nil {
+			slog.Warn("No run journal; deferred shares will not receive this import", "shares", len(opts.Deferred))
+		} else {
+			opts.Journal.deferTo(opts.Deferred)
+		}
+	}
+	if opts.Catalog != nil {
+		unlock, err := lockCards(ctx, opts.Catalog, mountPoints, folderName)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+	slog.Info("Scanning mount points for photos", "paths", mountPoints, "workers", workers)
+	locate := opts.Namer.usesLocation() || opts.Layout.usesLocation()
+	if locate {
+		// Loading the place index takes a while; overlap it with the scan.
+		go placeIndex()
+	}
 
 	// Create channels
 	jobs := make(chan TransferJob)
-	tfChan := make(chan TransferError, workers)
 	var workerWG sync.WaitGroup
 	var completedCount int64
 
-	photoJobs, collectErr := collectTransferJobs(ctx, mountPoint, folderName)
-	if collectErr != nil {
-		return nil, collectErr
+	// Cards from one shoot (e.g. RAW on one slot, JPEG on the other) merge into
+	// a single job list so they land in the same destination tree.
+	var photoJobs []TransferJob
+	reportProblem := func(root string, p sourceProblem) {
+		if opts.QuarantineDir != "" {
+			dest, err := quarantineFile(opts.QuarantineDir, folderName, root, p.Path)
+			if err != nil {
+				slog.Warn("Failed to quarantine file", "file", p.Path, "error", err)
+			} else {
+				p.Quarantined = dest
+			}
+		}
+		if hook != nil && hook.OnSourceProblem != nil {
+			hook.OnSourceProblem(p)
+		}
 	}
+	for _, mountPoint := range mountPoints {
+		mountJobs, problems, collectErr := collectTransferJobs(ctx, mountPoint, folderName, opts)
+		if collectErr != nil {
+			return nil, collectErr
+		}
+		photoJobs = append(photoJobs, mountJobs...)
+		for _, p := range problems {
+			reportProblem(mountPoint, p)
+		}
+	}
+	if opts.Sizes != nil && (opts.Sizes.min > 0 || opts.Sizes.max > 0) {
+		kept := photoJobs[:0]
+		for _, job := range photoJobs {
+			if opts.Sizes.inRange(job.Size) {
+				kept = append(kept, job)
+			}
+		}
+		if skipped := len(photoJobs) - len(kept); skipped > 0 {
+			slog.Info("Skipped files outside the size range", "files", skipped, "min_bytes", opts.Sizes.min, "max_bytes", opts.Sizes.max)
+		}
+		photoJobs = kept
+	}
+	if opts.Include != nil {
+		kept := photoJobs[:0]
+		for _, job := range photoJobs {
+			if opts.Include(job) {
+				kept = append(kept, job)
+			}
+		}
+		photoJobs = kept
+	}
+	dedupeAlg, err := normalizeHashAlgorithm(opts.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	photoJobs, duplicates, err := dedupeJobs(ctx, photoJobs, dedupeAlg, reportProblem)
+	if err != nil {
+		return nil, err
+	}
+	if len(duplicates) > 0 && hook != nil && hook.OnDuplicates != nil {
+		hook.OnDuplicates(duplicates)
+	}
+	if locate {
+		locateJobs(ctx, photoJobs)
+	}
+	photographers := opts.Namer.photographerNames()
+	if photographers == nil {
+		photographers = opts.Layout.photographerNames()
+	}
+	if photographers != nil {
+		attributeJobs(ctx, photoJobs, photographers)
+	}
+	if hasSelectsShare(connections) {
+		rateJobs(ctx, photoJobs)
+	}
+	if opts.Namer != nil {
+		if err := opts.Namer.assign(photoJobs); err != nil {
+			return nil, fmt.Errorf("assigning file names: %w", err)
+		}
+	}
+	if err := opts.Layout.assign(photoJobs); err != nil {
+		return nil, fmt.Errorf("assigning folders: %w", err)
+	}
+	if opts.Companions {
+		placeCompanions(photoJobs)
+	}
+	if renamed := sanitizeJobs(photoJobs, opts.Replacement, opts.NameForm); len(renamed) > 0 && hook != nil && hook.OnRenamed != nil {
+		hook.OnRenamed(renamed)
+	}
+	// Ordered after naming so sequence numbers still follow the card.
+	if err := orderJobs(photoJobs, opts.Order); err != nil {
+		return nil, err
+	}
+	if opts.Catalog != nil && len(photoJobs) > 0 {
+		var cards []string
+		if opts.Journal != nil {
+			cards = opts.Journal.Cards
+		}
+		warnRemoteImports(ctx, opts.Catalog, connections, folderName, cards)
+	}
+	if opts.Confirm != nil {
+		if err := opts.Confirm(photoJobs); err != nil {
+			return nil, err
+		}
+	}
+	var totalBytes int64
+	for _, job := range photoJobs {
+		name := job.DestName
+		if name == "" {
+			name = filepath.Base(job.SourcePath)
+		}
+		opts.Events.publish(FileDiscovered{
+			Path:  job.SourcePath,
+			Size:  job.Size,
+			Taken: job.PhotoDate,
+			Dest:  path.Join(job.FolderName, job.DestDir, name),
+		})
+		totalBytes += job.Size
+	}
+	runStarted := time.Now()
+	opts.Events.publish(RunStarted{Folder: folderName, Files: len(photoJobs), Bytes: totalBytes})
 	if hook != nil && hook.OnStart != nil {
 		hook.OnStart(len(photoJobs))
 	}
 
-	// Start worker pool
+	var similar []similarGroup
+	similarDone := make(chan struct{})
+	if opts.FindSimilar {
+		go func() {
+			defer close(similarDone)
+			similar = findSimilarJPEGs(ctx, photoJobs)
+		}()
+	} else {
+		close(similarDone)
+	}
+
+	router := newShareRouter(ctx, connections)
+	labels := make([]string, len(router.targets))
+	for i, t := range router.targets {
+		labels[i] = t.label()
+	}
+	latency := newLatencyTracker(opts.SlowShare, labels)
+	defer latency.logSummary()
+	outages := newShareOutages()
+	agg := newResultAggregator(workers)
+
+	// Start worker pool, ramping up so the shares don't see every worker's
+	// first create at once. Workers still waiting when the last job has
+	// been handed out have nothing left to do.
+	warmUpShares(ctx, connections)
+	queued := make(chan struct{})
 	for i := 0; i < workers; i++ {
 		workerWG.Add(1)
 		go func(workerID int) {
 			defer workerWG.Done()
+			if !waitForRamp(ctx, queued, workerID, workers, opts.WorkerRamp) {
+				return
+			}
 			for {
+				// A paused run finishes the files in flight, then waits here.
+				if opts.Pause.wait(ctx) != nil {
+					return
+				}
 				select {
 				case <-ctx.Done():
 					return
@@ -530,8 +1821,8 @@ func processPhotos(
 						return
 					}
 
-					// Transfer to all SMB shares
-					for i, conn := range connections {
+					// Transfer to every destination
+					for _, target := range router.targets {
 						// Check for cancellation between transfers
 						select {
 						case <-ctx.Done():
@@ -539,19 +1830,100 @@ func processPhotos(
 						default:
 						}
 
-						if err := transferToSMB(ctx, job.SourcePath, job.FolderName, job.PhotoDate, conn); err != nil {
-							slog.Error("Failed to transfer to SMB share", "file", job.SourcePath, "share_index", i, "host", conn.Config.Host, "error", err)
-							tfChan <- TransferError{
-								FilePath: job.SourcePath,
-								Share:    fmt.Sprintf("%s/%s", conn.Config.Host, conn.Config.Share),
-								Error:    err,
+						if !target.members[0].Config.Selects.accepts(job) {
+							continue
+						}
+						var conn *SMBConnection
+						err := outages.check(target.label())
+						if err == nil && latency.isDemoted(target.label()) {
+							err = errShareDemoted
+						}
+						if err == nil {
+							conn, err = router.pick(target, job.Size)
+						}
+						var res copyResult
+						if err == nil {
+							started := time.Now()
+							res, err = transferWithTimeout(ctx, job, conn, opts.FileTimeout)
+							if err == nil {
+								latency.record(target.label(), time.Since(started))
 							}
+						}
+						if err != nil && ctx.Err() != nil {
+							// Cancelled mid-file; the partial copy is gone
+							// and the file was never delivered here.
+							return
+						}
+						if err == nil {
+							router.place(target, conn, res)
+						}
+						// Encrypted and archive shares hold no loose files for
+						// these to describe.
+						plain := err == nil && conn.looseFiles()
+						if plain && opts.Manifests != nil {
+							opts.Manifests.add(ctx, conn, res)
+						}
+						if err == nil && opts.Journal != nil {
+							opts.Journal.record(conn, job.SourcePath, job.Size, res)
+						}
+						if plain && opts.Sidecars != nil {
+							opts.Sidecars.add(ctx, conn, job, res, opts.Journal)
+						}
+						if plain && opts.ShootManifests != nil {
+							opts.ShootManifests.add(conn, job, res)
+						}
+						if plain && opts.Readmes != nil {
+							opts.Readmes.add(conn, job)
+						}
+						if plain && opts.Gallery != nil && !isCompanion(job.SourcePath) {
+							opts.Gallery.add(conn, job, res)
+						}
+						if errors.Is(err, errSourceRead) {
+							// The card is the problem; other shares would fail the same way.
+							slog.Error("Source file is unreadable", "file", job.SourcePath, "error", err)
+							reportProblem(job.SourceRoot, sourceProblem{Path: job.SourcePath, Reason: err.Error()})
+							break
+						}
+						if errors.Is(err, errShareDemoted) || errors.Is(err, errShareDown) {
+							slog.Debug("Skipping share", "file", job.SourcePath, "destination", target.label(), "reason", err)
+						} else if err != nil {
+							slog.Error("Failed to transfer to SMB share", "file", job.SourcePath, "destination", target.label(), "error", err)
+							outages.record(target.label(), err)
+						}
+						agg.results <- shareResult{source: job.SourcePath, share: target.label(), bytes: job.Size, err: err}
+						if err != nil {
+							opts.Events.publish(ShareError{Path: job.SourcePath, Share: target.label(), Err: err})
 						} else {
-							slog.Info("Successfully transferred to SMB share", "file", filepath.Base(job.SourcePath), "share_index", i, "host", conn.Config.Host)
+							slog.Debug("Successfully transferred to SMB share", "file", filepath.Base(job.SourcePath), "share", shareLabel(conn.Config))
+							opts.Events.publish(FileTransferred{Path: job.SourcePath, Share: target.label(), Dest: res.DestPath, Size: job.Size})
+						}
+						if hook != nil && hook.OnShareResult != nil {
+							hook.OnShareResult(target.label(), job.SourcePath, job.Size, err)
+						}
+					}
+
+					// Derivatives are generated right after the originals, while
+					// the file is still in the page cache. They are a convenience,
+					// so failures are logged but don't fail the import.
+					for _, conn := range router.previews {
+						if !isJPEG(job.SourcePath) || ctx.Err() != nil {
+							break
+						}
+						res, err := transferPreview(ctx, job, conn)
+						if err != nil {
+							slog.Warn("Failed to write preview", "file", job.SourcePath, "share", shareLabel(conn.Config), "error", err)
+							continue
+						}
+						if opts.Journal != nil {
+							opts.Journal.record(conn, job.SourcePath, job.Size, res)
+						}
+						if opts.Gallery != nil {
+							opts.Gallery.add(conn, job, res)
 						}
 					}
 
 					processed := int(atomic.AddInt64(&completedCount, 1))
+					opts.Events.publish(FileCompleted{Path: job.SourcePath, Completed: processed, Total: len(photoJobs)})
 					if hook != nil && hook.OnProgress != nil {
 						hook.OnProgress(len(photoJobs), processed, job.SourcePath)
 					}
@@ -560,90 +1932,152 @@ func processPhotos(
 		}(i)
 	}
 
-	// Start error collector
-	var transferErrors []TransferError
-	var collectorWG sync.WaitGroup
-	collectorWG.Add(1)
-	go func() {
-		defer collectorWG.Done()
-		for e := range tfChan {
-			transferErrors = append(transferErrors, e)
+	// Queue jobs. A two-phase import holds the RAWs back until every preview
+	// is done, so the editing share has something to cull straight away.
+	previews := previewPhase(photoJobs, opts.Order)
+	if previews > 0 {
+		slog.Info("Copying previews first", "previews", previews, "remaining", len(photoJobs)-previews)
+	}
+	for i, job := range photoJobs {
+		if i == previews && previews > 0 {
+			if waitCompleted(ctx, &completedCount, previews) == nil {
+				slog.Info("Previews are on every share; copying RAW and video files", "files", len(photoJobs)-previews)
+			}
 		}
-	}()
-
-	// Queue jobs.
-	for _, job := range photoJobs {
 		select {
 		case jobs <- job:
 		case <-ctx.Done():
 			close(jobs)
 			workerWG.Wait()
-			close(tfChan)
-			collectorWG.Wait()
-			return transferErrors, ctx.Err()
+			finishArchives(connections, agg, hook)
+			agg.wait()
+			finishRun(opts, router, connections)
+			opts.Events.publish(RunCompleted{
+				Folder: folderName, Files: int(atomic.LoadInt64(&completedCount)), Failed: len(agg.errors),
+				Delivered: agg.delivered, Duration: time.Since(runStarted), Err: ctx.Err(),
+			})
+			return agg.errors, ctx.Err()
 		}
 	}
 
-	// Close jobs channel.
+	// Workers drain the queue and return; only then can the results close.
+	close(queued)
 	close(jobs)
-
-	// Wait for workers before closing transfer error channel.
 	workerWG.Wait()
-	close(tfChan)
+	finishArchives(connections, agg, hook)
+	agg.wait()
+	for _, label := range labels {
+		slog.Info("Destination finished", "destination", label, "files", agg.delivered[label], "bytes", agg.bytes[label])
+	}
 
-	// Wait for the error collector.
-	collectorWG.Wait()
+	if opts.VideoProxy != nil && ctx.Err() == nil {
+		generateProxies(ctx, opts.VideoProxy, photoJobs, connections, opts.Journal)
+	}
+	if opts.Gallery != nil {
+		opts.Gallery.flush(ctx)
+	}
 
-	return transferErrors, nil
-}
+	finishRun(opts, router, connections)
+	if ctx.Err() == nil {
+		snapshotShares(ctx, folderName, router.targets, agg)
+		indexSynologyShares(ctx, router.targets, agg)
+	}
+	opts.Events.publish(RunCompleted{
+		Folder: folderName, Files: int(completedCount), Failed: len(agg.errors),
+		Delivered: agg.delivered, Duration: time.Since(runStarted), Err: ctx.Err(),
+	})
 
-func collectTransferJobs(ctx context.Context, mountPoint, folderName string) ([]TransferJob, error) {
-	jobs := make([]TransferJob, 0, 1024)
+	<-similarDone
+	if opts.FindSimilar && hook != nil && hook.OnSimilar != nil {
+		hook.OnSimilar(similar)
+	}
 
-	err := filepath.Walk(mountPoint, func(path string, info os.FileInfo, err error) error {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-		}
+	return agg.errors, nil
+}
 
-		if err != nil {
-			slog.Warn("Error accessing path", "path", path, "error", err)
-			return nil
+// finishRun writes the run's manifests, journal, overflow placements and the
+// import records on the shares once copying has stopped.
+func finishRun(opts TransferOptions, router *shareRouter, connections []*SMBConnection) {
+	router.savePlacements(opts.Catalog)
+	if opts.Manifests != nil {
+		opts.Manifests.flush()
+	}
+	if opts.ShootManifests != nil {
+		opts.ShootManifests.flush()
+	}
+	if opts.Readmes != nil {
+		opts.Readmes.flush()
+	}
+	if opts.Journal != nil {
+		if err := opts.Journal.save(); err != nil {
+			slog.Warn("Failed to save run journal", "error", err)
 		}
-		if info.IsDir() {
-			if isMacMetadata(info.Name()) {
-				return filepath.SkipDir
+		publishRemoteImport(connections, opts.Journal)
+	}
+}
+
+// collectTransferJobs walks a card for importable files. Empty, unreadable and
+// suspiciously small RAW files are returned separately as problems rather
+// than jobs.
+func collectTransferJobs(ctx context.Context, mountPoint, folderName string, opts TransferOptions) ([]TransferJob, []sourceProblem, error) {
+	scanner := ingest.Scanner{
+		SkipDir: func(path string) bool {
+			if opts.Skip.skips(mountPoint, path) {
+				slog.Debug("Skipping camera folder", "path", path)
+				return true
 			}
-			return nil
-		}
+			return false
+		},
+		Include: func(path string) bool { return opts.Companions && isCompanion(path) },
+		Suspect: func(path string, size int64) string {
+			ext := strings.ToLower(filepath.Ext(path))
+			if limit := opts.Sizes.tiny(ext, size); limit > 0 {
+				return fmt.Sprintf("only %s, below %s for a %s file; likely corrupt", formatBytes(size), formatBytes(limit), ext)
+			}
+			return ""
+		},
+	}
+	files, found, err := scanner.Scan(ctx, mountPoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	problems := make([]sourceProblem, 0, len(found))
+	for _, p := range found {
+		slog.Warn("Skipping damaged file", "file", p.Path, "reason", p.Reason)
+		problems = append(problems, sourceProblem{Path: p.Path, Reason: p.Reason})
+	}
 
-		if isMacMetadata(info.Name()) {
-			return nil
+	jobs := make([]TransferJob, 0, len(files))
+	for _, f := range files {
+		job := TransferJob{
+			SourcePath: f.Path,
+			FolderName: folderName,
+			PhotoDate:  f.Taken,
+			Size:       f.Size,
+			SourceRoot: mountPoint,
+			ModTime:    f.ModTime,
 		}
-		ext := strings.ToLower(filepath.Ext(path))
-		if !photoExtensions[ext] {
-			return nil
+		if isAVCHDClip(f.Path) {
+			if recorded, err := avchdRecorded(f.Path); err == nil {
+				job.PhotoDate = recorded
+			} else {
+				slog.Debug("Using modification time for AVCHD clip", "file", f.Path, "error", err)
+			}
+			job.DestName = avchdClipName(f.Path, job.PhotoDate)
 		}
-
-		photoDate, dateErr := getPhotoDate(path, info)
-		if dateErr != nil {
-			slog.Warn("Failed to get photo date, using file mod time", "file", path, "error", dateErr)
-			photoDate = info.ModTime()
+		if isCompanion(f.Path) {
+			var ok bool
+			if job, ok = companionJob(job); !ok {
+				continue
+			}
 		}
-
-		jobs = append(jobs, TransferJob{
-			SourcePath: path,
-			FolderName: folderName,
-			PhotoDate:  photoDate,
-		})
-		return nil
-	})
-	if err != nil {
-		return nil, err
+		jobs = append(jobs, job)
+	}
+	if opts.Companions {
+		pairCompanions(jobs)
 	}
 
-	return jobs, nil
+	return jobs, problems, nil
 }
 
 type ScanSummary struct {
@@ -658,7 +2092,7 @@ type ScanSummary struct {
 // For speed it does NOT open files to read EXIF (that can take minutes over a
 // card reader); the per-day breakdown uses the file modification time, which is
 // an approximation. The actual transfer still groups by precise EXIF capture date.
-func scanMedia(ctx context.Context, mountPoint string) (ScanSummary, error) {
+func scanMedia(ctx context.Context, mountPoint string, skip *folderSkipper) (ScanSummary, error) {
 	summary := ScanSummary{ByDate: make(map[string]int)}
 
 	err := filepath.Walk(mountPoint, func(path string, info os.FileInfo, err error) error {
@@ -672,12 +2106,12 @@ func scanMedia(ctx context.Context, mountPoint string) (ScanSummary, error) {
 			return nil
 		}
 		if info.IsDir() {
-			if isMacMetadata(info.Name()) {
+			if isSystemMetadata(info.Name()) || skip.skips(mountPoint, path) {
 				return filepath.SkipDir
 			}
 			return nil
 		}
-		if isMacMetadata(info.Name()) {
+		if isSystemMetadata(info.Name()) {
 			return nil
 		}
 		if !photoExtensions[strings.ToLower(filepath.Ext(path))] {
@@ -696,71 +2130,107 @@ func scanMedia(ctx context.Context, mountPoint string) (ScanSummary, error) {
 	return summary, nil
 }
 
-// isMacMetadata reports whether a file is macOS bookkeeping noise that should
+// isSystemMetadata reports whether a file is OS bookkeeping noise that should
 // never be transferred: AppleDouble resource-fork sidecars (._*), Finder
-// metadata (.DS_Store), and the __MACOSX directory tree created by zip.
-func isMacMetadata(name string) bool {
-	return strings.HasPrefix(name, "._") ||
-		name == ".DS_Store" ||
-		name == "__MACOSX"
+// metadata (.DS_Store), the __MACOSX directory tree created by zip, the
+// Spotlight, FSEvents and Trash folders macOS writes to every volume it
+// mounts, and their Windows counterparts.
+func isSystemMetadata(name string) bool {
+	return ingest.IsSystemFile(name)
 }
 
+// getPhotoDate is the EXIF capture time, or the mod time for files without
+// one.
 func getPhotoDate(path string, info os.FileInfo) (time.Time, error) {
-	// Try to read EXIF data
-	f, err := os.Open(path)
-	if err != nil {
-		return time.Time{}, err
-	}
-	defer f.Close()
+	return exifdate.TakenOrModified(path, info)
+}
 
-	x, err := exif.Decode(f)
-	if err != nil {
-		// If EXIF decode fails, use file mod time
-		return info.ModTime(), nil
-	}
+// errSizeMismatch marks a copy whose destination size did not match the source.
+var errSizeMismatch = errors.New("size mismatch after copy")
 
-	// Try to get DateTime or DateTimeOriginal
-	tm, err := x.DateTime()
-	if err != nil {
-		return info.ModTime(), nil
-	}
-
-	return tm, nil
+// copyResult describes a file that landed on a share.
+type copyResult struct {
+	DestPath  string // share-relative, slash-separated
+	Sum       []byte // checksum of the bytes written
+	Algorithm string // algorithm Sum was computed with
 }
 
-func transferToSMB(ctx context.Context, sourcePath, folderName string, photoDate time.Time, conn *SMBConnection) error {
-	// Create folder structure: basePath/folderName/YYYY-MM-DD/
-	dateFolder := photoDate.Format("2006-01-02")
-	destDir := filepath.Join(conn.Config.BasePath, folderName, dateFolder)
+// transferWithTimeout is transferToSMB limited to timeout, when positive.
+func transferWithTimeout(ctx context.Context, job TransferJob, conn *SMBConnection, timeout time.Duration) (copyResult, error) {
+	if timeout <= 0 {
+		res, err := transferToSMB(ctx, job.SourcePath, job.DestName, job.FolderName, job.DestDir, conn)
+		return res, classifyError(err)
+	}
+	fileCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	res, err := transferToSMB(fileCtx, job.SourcePath, job.DestName, job.FolderName, job.DestDir, conn)
+	if err != nil && ctx.Err() == nil && errors.Is(fileCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("gave up after file_timeout %s: %w", timeout, err)
+	}
+	return res, classifyError(err)
+}
 
-	// Check cache first
-	if _, exists := conn.createdDirs.Load(destDir); !exists {
-		slog.Info("Creating destination directory", "path", destDir)
-		if err := mkdirAllSMB(ctx, conn.Share, destDir); err != nil {
-			return fmt.Errorf("creating directories: %w", err)
+func transferToSMB(ctx context.Context, sourcePath, destName, folderName, subDir string, conn *SMBConnection) (copyResult, error) {
+	if conn.encryption != nil {
+		// Not even the folder names go to an encrypted share.
+		name := destName
+		if name == "" {
+			name = filepath.Base(sourcePath)
+		}
+		return transferEncrypted(ctx, sourcePath, path.Join(folderName, subDir, name), conn)
+	}
+	if conn.cloud != nil {
+		name := destName
+		if name == "" {
+			name = filepath.Base(sourcePath)
+		}
+		return conn.cloud.transfer(ctx, sourcePath, path.Join(shootRoot(conn, folderName), subDir, name), conn)
+	}
+	if conn.archives != nil {
+		name := destName
+		if name == "" {
+			name = filepath.Base(sourcePath)
 		}
-		// Cache the successfully created path
-		conn.createdDirs.Store(destDir, struct{}{})
+		return transferArchived(ctx, sourcePath, name, path.Join(shootRoot(conn, folderName), subDir), conn)
 	}
 
-	// Copy file
-	fileName := filepath.Base(sourcePath)
-	destPath := filepath.Join(destDir, fileName)
+	// Create folder structure: basePath/folderName/subDir/, where subDir is
+	// the job's DestDir (YYYY-MM-DD by default).
+	// SMB paths are slash-separated whatever the local OS; go-smb2 converts them.
+	destDir := path.Join(shootRoot(conn, folderName), subDir)
 
-	slog.Info("Copying file to SMB", "source", fileName, "destination", destPath)
-	written, err := copyFileToSMB(ctx, sourcePath, conn.Share, destPath)
+	if err := conn.mkdirAll(ctx, destDir); err != nil {
+		return copyResult{}, fmt.Errorf("creating directories: %w", err)
+	}
+
+	// Copy file
+	fileName := destName
+	if fileName == "" {
+		fileName = filepath.Base(sourcePath)
+	}
+	destPath := path.Join(destDir, fileName)
+
+	slog.Debug("Copying file to SMB", "source", filepath.Base(sourcePath), "destination", destPath)
+	h := newHasher(conn.hashAlg)
+	var written int64
+	var err error
+	if info, statErr := os.Stat(sourcePath); statErr == nil && conn.chunks.applies(sourcePath, info.Size()) {
+		written, err = copyFileChunked(ctx, sourcePath, info, conn, destPath, h)
+	} else {
+		written, err = copyFileToSMB(ctx, sourcePath, conn, destPath, h, shareJPEGEdit(conn, sourcePath))
+	}
 	if err != nil {
-		return fmt.Errorf("copying file: %w", err)
+		return copyResult{}, fmt.Errorf("copying file: %w", err)
 	}
 
 	// Verify the destination size matches the source to catch truncated/partial writes.
 	if srcInfo, statErr := os.Stat(sourcePath); statErr == nil {
 		if written != srcInfo.Size() {
-			return fmt.Errorf("size mismatch after copy: wrote %d bytes, source is %d bytes", written, srcInfo.Size())
+			return copyResult{}, fmt.Errorf("%w: wrote %d bytes, source is %d bytes", errSizeMismatch, written, srcInfo.Size())
 		}
 	}
 
-	return nil
+	return copyResult{DestPath: filepath.ToSlash(destPath), Sum: h.Sum(nil), Algorithm: conn.hashAlg}, nil
 }
 
 func connectSMB(ctx context.Context, config SMBConfig, timeout time.Duration) (*smb2.Session, error) {
@@ -832,9 +2302,12 @@ func mkdirAllSMB(ctx context.Context, fs *smb2.Share, path string) error {
 	return nil
 }
 
-func copyFileToSMB(ctx context.Context, sourcePath string, fs *smb2.Share, destPath string) (int64, error) {
+// copyFileToSMB copies sourcePath to destPath on conn, applying edit and
+// feeding the written bytes to h when it is non-nil. It returns the number of
+// source bytes copied.
+func copyFileToSMB(ctx context.Context, sourcePath string, conn *SMBConnection, destPath string, h hash.Hash, edit jpegEdit) (int64, error) {
 	// Use context-aware share
-	fs = fs.WithContext(ctx)
+	fs := conn.Share.WithContext(ctx)
 
 	// Normalize path separators
 	destPath = filepath.ToSlash(destPath)
@@ -842,7 +2315,7 @@ func copyFileToSMB(ctx context.Context, sourcePath string, fs *smb2.Share, destP
 	// Open source file
 	src, err := os.Open(sourcePath)
 	if err != nil {
-		return 0, fmt.Errorf("opening source file: %w", err)
+		return 0, fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
 	}
 	defer src.Close()
 
@@ -854,10 +2327,20 @@ func copyFileToSMB(ctx context.Context, sourcePath string, fs *smb2.Share, destP
 	defer dst.Close()
 
 	// Copy data
-	written, err := io.Copy(dst, src)
+	w := conn.limiter.writer(ctx, dst)
+	if h != nil {
+		w = io.MultiWriter(w, h)
+	}
+	r := newJPEGEditReader(contextReader{ctx, sourceReader{src}}, edit)
+	written, err := io.Copy(w, r)
 	if err != nil {
-		return written, fmt.Errorf("copying data: %w", err)
+		if errors.Is(err, errSourceRead) || ctx.Err() != nil {
+			// Don't leave a truncated copy that looks like a real file.
+			dst.Close()
+			removePartial(conn.Share, destPath)
+		}
+		return written - r.grown, fmt.Errorf("copying data: %w", err)
 	}
 
-	return written, nil
+	return written - r.grown, nil
 }
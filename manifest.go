@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Checksum manifest modes for Config.ChecksumManifest.
+const (
+	manifestFolder  = "folder"  // one SHA256SUMS (B3SUMS, XXH64SUMS) per destination date folder
+	manifestSidecar = "sidecar" // a <file>.sha256 (.b3, .xxh64) next to every file
+)
+
+// manifestWriter records the checksum of every file copied so archive tools
+// can verify the shares with `sha256sum -c` (or b3sum/xxhsum) and no SnapVault catalog.
+type manifestWriter struct {
+	mode string
+
+	mu      sync.Mutex
+	pending map[*SMBConnection]map[string]map[string]string // conn -> dir -> file -> hex sum
+}
+
+// newManifestWriter returns nil when manifests are disabled.
+func newManifestWriter(mode string) (*manifestWriter, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case manifestFolder, manifestSidecar:
+		return &manifestWriter{mode: mode, pending: map[*SMBConnection]map[string]map[string]string{}}, nil
+	default:
+		return nil, fmt.Errorf("checksum_manifest must be %q or %q, got %q", manifestFolder, manifestSidecar, mode)
+	}
+}
+
+// add records a finished copy. Sidecars are written straight away; folder
+// manifests are merged and written by flush.
+func (m *manifestWriter) add(ctx context.Context, conn *SMBConnection, res copyResult) {
+	dir, name := path.Split(res.DestPath)
+	sum := hex.EncodeToString(res.Sum)
+	if m.mode == manifestSidecar {
+		line := fmt.Sprintf("%s  %s\n", sum, name)
+		_, ext := manifestNames(res.Algorithm)
+		if err := conn.Share.WithContext(ctx).WriteFile(res.DestPath+ext, []byte(line), 0o644); err != nil {
+			slog.Warn("Failed to write checksum sidecar", "file", res.DestPath, "share", shareLabel(conn.Config), "error", err)
+		}
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dirs := m.pending[conn]
+	if dirs == nil {
+		dirs = map[string]map[string]string{}
+		m.pending[conn] = dirs
+	}
+	files := dirs[dir]
+	if files == nil {
+		files = map[string]string{}
+		dirs[dir] = files
+	}
+	files[name] = sum
+}
+
+// flush writes one manifest per touched folder, merging with any manifest
+// left by an earlier card of the same shoot.
+func (m *manifestWriter) flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for conn, dirs := range m.pending {
+		fileName, _ := manifestNames(conn.hashAlg)
+		for dir, files := range dirs {
+			manifestPath := path.Join(dir, fileName)
+			merged := map[string]string{}
+			if existing, err := conn.Share.ReadFile(manifestPath); err == nil {
+				for name, sum := range parseManifest(string(existing)) {
+					merged[name] = sum
+				}
+			}
+			for name, sum := range files {
+				merged[name] = sum
+			}
+			if err := conn.Share.WriteFile(manifestPath, []byte(formatManifest(merged)), 0o644); err != nil {
+				slog.Warn("Failed to write checksum manifest", "path", manifestPath, "share", shareLabel(conn.Config), "error", err)
+			}
+		}
+	}
+	m.pending = map[*SMBConnection]map[string]map[string]string{}
+}
+
+// parseManifest reads sha256sum-format lines: "<hex>  <name>" (or " *<name>" for binary mode).
+func parseManifest(data string) map[string]string {
+	out := map[string]string{}
+	for _, line := range strings.Split(data, "\n") {
+		sum, name, ok := strings.Cut(strings.TrimRight(line, "\r"), " ")
+		if !ok || sum == "" {
+			continue
+		}
+		name = strings.TrimPrefix(strings.TrimPrefix(name, " "), "*")
+		if name != "" {
+			out[name] = sum
+		}
+	}
+	return out
+}
+
+func formatManifest(entries map[string]string) string {
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%s  %s\n", entries[name], name)
+	}
+	return b.String()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// errStaleHandle means the NFS server no longer knows a file handle the
+// client holds, usually because the export was re-exported or the server
+// restarted. Only remounting fixes it.
+var errStaleHandle = errors.New("stale NFS file handle; remount the export")
+
+// errNotMounted means a mount share's directory is on a local filesystem, so
+// the network mount it should be on is missing.
+var errNotMounted = errors.New("no network filesystem is mounted there")
+
+// networkFSTypes are the /proc/mounts filesystem types of network mounts.
+var networkFSTypes = map[string]bool{
+	"nfs": true, "nfs4": true, "cifs": true, "smb3": true, "fuse.sshfs": true,
+	"ceph": true, "glusterfs": true, "fuse.glusterfs": true, "lustre": true, "9p": true,
+}
+
+// validateMount checks a mount share's directory.
+func validateMount(share SMBConfig) error {
+	if !filepath.IsAbs(share.Mount) {
+		return fmt.Errorf("%q is not an absolute path", share.Mount)
+	}
+	return nil
+}
+
+// mountFSType returns the type of the filesystem holding dir, from
+// /proc/mounts, or "" where there is none to read.
+func mountFSType(dir string) string {
+	data, err := os.ReadFile("/proc/mounts")
+	if err != nil {
+		return ""
+	}
+	dir = filepath.Clean(dir)
+	var best, fsType string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		mount := filepath.Clean(decodeProcMountField(fields[1]))
+		under := mount == "/" || dir == mount || strings.HasPrefix(dir, mount+"/")
+		// Later lines are mounted on top of earlier ones.
+		if under && len(mount) >= len(best) {
+			best, fsType = mount, decodeProcMountField(fields[2])
+		}
+	}
+	return fsType
+}
+
+// mountedDir is a share that is a local directory, normally an NFS export
+// mounted by the OS. Copies go through the local filesystem.
+type mountedDir struct {
+	root string
+}
+
+func newMountedDir(cfg SMBConfig) (*mountedDir, error) {
+	root := filepath.Clean(cfg.Mount)
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, mountError(err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", root)
+	}
+	// An export that failed to mount leaves an empty local directory, and
+	// copies there would only fill the local disk.
+	if fsType := mountFSType(root); fsType != "" && !networkFSTypes[fsType] {
+		return nil, fmt.Errorf("%s is on a local %s filesystem: %w", root, fsType, errNotMounted)
+	}
+	return &mountedDir{root: root}, nil
+}
+
+// mountError marks stale-handle errors with errStaleHandle.
+func mountError(err error) error {
+	if errors.Is(err, syscall.ESTALE) {
+		return fmt.Errorf("%w: %w", errStaleHandle, err)
+	}
+	return err
+}
+
+func (m *mountedDir) kind() string { return "mount" }
+
+// local is the local path of the slash-separated p.
+func (m *mountedDir) local(p string) string {
+	return filepath.Join(m.root, filepath.FromSlash(strings.TrimPrefix(p, "/")))
+}
+
+func (m *mountedDir) exists(ctx context.Context, p string) (bool, error) {
+	_, err := os.Stat(m.local(p))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, mountError(err)
+}
+
+func (m *mountedDir) remove(ctx context.Context, p string) error {
+	err := os.Remove(m.local(p))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return mountError(err)
+}
+
+// transfer is transferToSMB for a mount share. The file is written under a
+// temporary name, synced so the server has it, and renamed into place, so a
+// copy that fails never leaves a partial file at the real name. A stale
+// handle, which a server restart leaves behind, is retried once with fresh
+// lookups from the root.
+func (m *mountedDir) transfer(ctx context.Context, sourcePath, destPath string, conn *SMBConnection) (copyResult, error) {
+	res, err := m.copyFile(ctx, sourcePath, destPath, conn)
+	if errors.Is(err, syscall.ESTALE) && ctx.Err() == nil {
+		slog.Warn("Stale NFS handle, retrying", "share", shareLabel(conn.Config), "path", destPath)
+		conn.createdDirs.Clear()
+		res, err = m.copyFile(ctx, sourcePath, destPath, conn)
+	}
+	return res, mountError(err)
+}
+
+func (m *mountedDir) copyFile(ctx context.Context, sourcePath, destPath string, conn *SMBConnection) (copyResult, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: %w", errSourceRead, err)
+	}
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
+	}
+	defer src.Close()
+
+	dest := m.local(destPath)
+	dir := filepath.Dir(dest)
+	if _, ok := conn.createdDirs.Load(dir); !ok {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return copyResult{}, fmt.Errorf("creating directories: %w", err)
+		}
+		conn.createdDirs.Store(dir, struct{}{})
+	}
+
+	slog.Debug("Copying file to mount", "source", filepath.Base(sourcePath), "destination", dest)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(dest)+".*.partial")
+	if err != nil {
+		return copyResult{}, fmt.Errorf("creating file: %w", err)
+	}
+	// NFS reports some write errors only on sync or close, so both count.
+	h := newHasher(conn.hashAlg)
+	r := newJPEGEditReader(contextReader{ctx, sourceReader{src}}, shareJPEGEdit(conn, sourcePath))
+	written, err := io.Copy(io.MultiWriter(conn.limiter.writer(ctx, tmp), h), r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && written-r.grown != info.Size() {
+		err = fmt.Errorf("%w: wrote %d bytes, source is %d bytes", errSizeMismatch, written-r.grown, info.Size())
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), dest)
+	}
+	if err != nil {
+		if rerr := os.Remove(tmp.Name()); rerr != nil && !errors.Is(rerr, os.ErrNotExist) {
+			slog.Warn("Failed to remove partial copy", "path", tmp.Name(), "error", rerr)
+		}
+		return copyResult{}, fmt.Errorf("copying file: %w", err)
+	}
+	if st, err := os.Stat(dest); err != nil {
+		return copyResult{}, fmt.Errorf("checking copy: %w", err)
+	} else if st.Size() != written {
+		return copyResult{}, fmt.Errorf("%w: mount has %d bytes, %d were written", errSizeMismatch, st.Size(), written)
+	}
+	return copyResult{DestPath: path.Clean(destPath), Sum: h.Sum(nil), Algorithm: conn.hashAlg}, nil
+}
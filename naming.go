@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// NamingConfig controls how files are renamed on the destination. With no
+// file template the card's original file names are kept.
+type NamingConfig struct {
+	// FileTemplate is a Go text/template for the file name without its
+	// extension, e.g. "{{.Shoot}}_{{.Seq}}". The original extension is appended.
+	FileTemplate string `yaml:"file_template,omitempty"`
+	// SequenceDigits zero-pads {{.Seq}}; defaults to 4.
+	SequenceDigits int `yaml:"sequence_digits,omitempty"`
+	// FolderTemplate is a Go text/template for the date folder, e.g.
+	// "{{.DateFolder}} {{.Location}}". See folderNameData.
+	FolderTemplate string `yaml:"folder_template,omitempty"`
+	// DateFormat is the Go time layout of date folders, "2006-01-02" by
+	// default; "2006/01/02" nests year, month and day, and "iso-week" groups
+	// by week as in 2024-W19.
+	DateFormat string `yaml:"date_format,omitempty"`
+	// SessionGap splits a date folder into _session1, _session2, ... where
+	// captures pause for longer than this, e.g. "2h" between a ceremony and
+	// the reception. Zero keeps one folder per date.
+	SessionGap time.Duration `yaml:"session_gap,omitempty"`
+	// PreserveStructure mirrors the card's folders under the shoot folder
+	// instead of sorting files into date folders; type folders don't apply.
+	PreserveStructure bool `yaml:"preserve_structure,omitempty"`
+	// TypeFolders splits each date folder into RAW/, JPEG/ and VIDEO/.
+	TypeFolders bool `yaml:"type_folders,omitempty"`
+	// TypeMap changes the subfolder of a file extension for type_folders,
+	// e.g. {".dng": "DNG", ".tif": "JPEG"}; an empty name keeps that type in
+	// the date folder itself.
+	TypeMap map[string]string `yaml:"type_map,omitempty"`
+	// Photographers maps camera body serial numbers, as in the EXIF data,
+	// to names for {{.Photographer}}, e.g. {"032021001234": "Anna"}.
+	Photographers map[string]string `yaml:"photographers,omitempty"`
+}
+
+// fileNameData is what file templates can reference.
+type fileNameData struct {
+	Shoot    string    // photoshoot name as typed, without the year prefix
+	Folder   string    // destination shoot folder, e.g. "2025 - Wedding"
+	Original string    // source file name without extension
+	Ext      string    // source extension including the dot
+	Seq      string    // zero-padded sequence number, continuous across cards of the shoot
+	Date     time.Time // capture date
+	Location string    // place name from GPS, "" when the file has none
+	// Photographer is the naming.photographers name of the camera, "" for
+	// cameras not listed.
+	Photographer string
+}
+
+// fileNamer renders destination names for one shoot.
+type fileNamer struct {
+	tmpl    *template.Template
+	shoot   string
+	folder  string
+	digits  int
+	seqFile string
+	// photographers is naming.photographers by normalized serial.
+	photographers map[string]string
+}
+
+// newFileNamer returns nil when renaming is not configured.
+func newFileNamer(cfg *Config, shoot, folderName string) (*fileNamer, error) {
+	if cfg == nil || cfg.Naming == nil || strings.TrimSpace(cfg.Naming.FileTemplate) == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("file").Option("missingkey=error").Parse(cfg.Naming.FileTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("parsing naming.file_template: %w", err)
+	}
+	stateDir, err := resolveStateDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	photographers, err := photographerNames(cfg)
+	if err != nil {
+		return nil, err
+	}
+	digits := cfg.Naming.SequenceDigits
+	if digits <= 0 {
+		digits = 4
+	}
+	return &fileNamer{
+		tmpl:          tmpl,
+		shoot:         shoot,
+		folder:        folderName,
+		digits:        digits,
+		seqFile:       filepath.Join(stateDir, "sequences.json"),
+		photographers: photographers,
+	}, nil
+}
+
+// usesLocation reports whether the template needs GPS place names.
+func (n *fileNamer) usesLocation() bool {
+	return n != nil && templateUses(n.tmpl, "Location")
+}
+
+// photographerNames returns the serial mapping when the template uses
+// {{.Photographer}}, else nil.
+func (n *fileNamer) photographerNames() map[string]string {
+	if n == nil || !templateUses(n.tmpl, "Photographer") {
+		return nil
+	}
+	return n.photographers
+}
+
+// templateUses reports whether t refers to the named field anywhere.
+func templateUses(t *template.Template, field string) bool {
+	return t != nil && t.Tree != nil && strings.Contains(t.Tree.Root.String(), "."+field)
+}
+
+// assign sets DestName on every job. Sequence numbers follow capture order and
+// are persisted per shoot folder, so a second card continues where the first
+// stopped and re-importing a card reuses the numbers it was given before.
+func (n *fileNamer) assign(jobs []TransferJob) error {
+	order := make([]int, 0, len(jobs))
+	for i, job := range jobs {
+		// Track logs cover a day rather than a frame and keep their names.
+		if companionExtensions[strings.ToLower(filepath.Ext(job.SourcePath))] == companionTrack {
+			continue
+		}
+		order = append(order, i)
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		ja, jb := jobs[order[a]], jobs[order[b]]
+		if !ja.PhotoDate.Equal(jb.PhotoDate) {
+			return ja.PhotoDate.Before(jb.PhotoDate)
+		}
+		return ja.SourcePath < jb.SourcePath
+	})
+
+	seqs, err := reserveSequences(n.seqFile, n.folder, jobs, order)
+	if err != nil {
+		return err
+	}
+
+	used := make(map[string]string, len(jobs))
+	for _, i := range order {
+		base := filepath.Base(jobs[i].SourcePath)
+		ext := filepath.Ext(base)
+		var sb strings.Builder
+		err := n.tmpl.Execute(&sb, fileNameData{
+			Shoot:        n.shoot,
+			Folder:       n.folder,
+			Original:     strings.TrimSuffix(base, ext),
+			Ext:          ext,
+			Seq:          fmt.Sprintf("%0*d", n.digits, seqs[i]),
+			Date:         jobs[i].PhotoDate,
+			Location:     jobs[i].Location,
+			Photographer: jobs[i].Photographer,
+		})
+		if err != nil {
+			return fmt.Errorf("rendering name for %s: %w", base, err)
+		}
+		name := strings.TrimSpace(sb.String())
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return fmt.Errorf("file template produced an invalid name %q for %s", name, base)
+		}
+		name += ext
+		if prev, dup := used[strings.ToLower(name)]; dup {
+			return fmt.Errorf("file template gives %s and %s the same name %q; include {{.Seq}} or {{.Original}}", prev, base, name)
+		}
+		used[strings.ToLower(name)] = base
+		jobs[i].DestName = name
+	}
+	return nil
+}
+
+// shootSequence is the persisted counter for one shoot folder.
+type shootSequence struct {
+	Next     int            `json:"next"`
+	Assigned map[string]int `json:"assigned"`
+}
+
+var sequenceMu sync.Mutex
+
+// reserveSequences returns a sequence number per job index, allocating new
+// numbers in the given order and saving them before any copy begins.
+func reserveSequences(path, folder string, jobs []TransferJob, order []int) (map[int]int, error) {
+	sequenceMu.Lock()
+	defer sequenceMu.Unlock()
+
+	store := map[string]*shootSequence{}
+	if err := readStateFile(path, &store); err != nil {
+		return nil, err
+	}
+	seq := store[folder]
+	if seq == nil {
+		seq = &shootSequence{}
+		store[folder] = seq
+	}
+	if seq.Next < 1 {
+		seq.Next = 1
+	}
+	if seq.Assigned == nil {
+		seq.Assigned = map[string]int{}
+	}
+
+	out := make(map[int]int, len(jobs))
+	for _, i := range order {
+		key := sequenceKey(jobs[i])
+		n, ok := seq.Assigned[key]
+		if !ok {
+			n = seq.Next
+			seq.Next++
+			seq.Assigned[key] = n
+		}
+		out[i] = n
+	}
+	if len(out) == 0 {
+		return out, nil
+	}
+	if err := writeStateFile(path, store); err != nil {
+		return nil, fmt.Errorf("saving sequence counter: %w", err)
+	}
+	return out, nil
+}
+
+// sequenceKey identifies a frame well enough to recognise it on a re-import.
+// It ignores the extension and the card so RAW+JPEG siblings, even from the
+// two slots of one body, share one number. The folder on the card is part of
+// it, so same-named frames from two bodies (DSC_0001 from 100NIKON and from
+// 100ND850) stay apart.
+func sequenceKey(job TransferJob) string {
+	dir := filepath.Dir(job.SourcePath)
+	if rel, err := filepath.Rel(job.SourceRoot, dir); err == nil && job.SourceRoot != "" {
+		dir = rel
+	}
+	base := filepath.Base(job.SourcePath)
+	return fmt.Sprintf("%s/%s|%d", filepath.ToSlash(dir), strings.TrimSuffix(base, filepath.Ext(base)), job.PhotoDate.Unix())
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSequenceKey(t *testing.T) {
+	taken := time.Date(2026, 5, 1, 10, 2, 3, 0, time.UTC)
+	card := filepath.Join("Volumes", "EOS_DIGITAL")
+	job := func(root string, parts ...string) TransferJob {
+		return TransferJob{SourceRoot: root, SourcePath: filepath.Join(parts...), PhotoDate: taken}
+	}
+	unix := "|1777629723"
+
+	tests := []struct {
+		name string
+		job  TransferJob
+		want string
+	}{
+		{"relative to the card", job(card, card, "DCIM", "100CANON", "IMG_0001.CR3"), "DCIM/100CANON/IMG_0001" + unix},
+		{"extension ignored", job(card, card, "DCIM", "100CANON", "IMG_0001.JPG"), "DCIM/100CANON/IMG_0001" + unix},
+		{"at the card root", job(card, card, "IMG_0001.JPG"), "./IMG_0001" + unix},
+		{"no source root", job("", "DCIM", "100CANON", "IMG_0001.JPG"), "DCIM/100CANON/IMG_0001" + unix},
+	}
+	for _, tt := range tests {
+		if got := sequenceKey(tt.job); got != tt.want {
+			t.Errorf("%s: sequenceKey = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// RAW+JPEG siblings share a key, even from the two slots of one body;
+	// same-named frames from two bodies' folders don't.
+	slot1 := job(card, card, "DCIM", "100NIKON", "DSC_0001.NEF")
+	slot2 := job("SLOT2", "SLOT2", "DCIM", "100NIKON", "DSC_0001.JPG")
+	other := job(card, card, "DCIM", "100ND850", "DSC_0001.NEF")
+	later := slot1
+	later.PhotoDate = taken.Add(time.Second)
+	if sequenceKey(slot1) != sequenceKey(slot2) {
+		t.Errorf("siblings on two cards got different keys: %q, %q", sequenceKey(slot1), sequenceKey(slot2))
+	}
+	if sequenceKey(slot1) == sequenceKey(other) {
+		t.Errorf("frames from two bodies share key %q", sequenceKey(slot1))
+	}
+	if sequenceKey(slot1) == sequenceKey(later) {
+		t.Errorf("frames a second apart share key %q", sequenceKey(slot1))
+	}
+}
@@ -2,14 +2,100 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
+// notifyEvent is the outcome class a notification describes. Each backend can
+// subscribe to a subset via its `events` list.
+type notifyEvent string
+
+const (
+	eventComplete       notifyEvent = "complete"
+	eventFailure        notifyEvent = "failure"
+	eventVerifyMismatch notifyEvent = "verify_mismatch"
+	// eventShareError is pushed while the run is still going, the first time
+	// each destination fails. It is opt-in: an empty events list omits it.
+	eventShareError notifyEvent = "share_error"
+)
+
+// notification is the backend-neutral message built once per finished run.
+// Short push backends use title/message; richer ones (email) render report.
+type notification struct {
+	event   notifyEvent
+	title   string
+	message string
+	report  *transferReport
+}
+
+// notifier is a push backend. Backends are built from config by configuredNotifiers.
+type notifier interface {
+	name() string
+	wants(event notifyEvent) bool
+	send(ctx context.Context, n notification) error
+}
+
+// wantsEvent reports whether a backend's events list includes event. An empty
+// list subscribes to every end-of-run event.
+func wantsEvent(events []string, event notifyEvent) bool {
+	if len(events) == 0 {
+		return event != eventShareError
+	}
+	for _, e := range events {
+		if notifyEvent(strings.ToLower(strings.TrimSpace(e))) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// configuredNotifiers returns a notifier for every backend that is fully configured.
+func configuredNotifiers(cfg *Config) []notifier {
+	if cfg == nil {
+		return nil
+	}
+	var out []notifier
+	if n := cfg.Ntfy; n != nil && strings.TrimSpace(n.Server) != "" && strings.TrimSpace(n.Topic) != "" {
+		out = append(out, ntfyNotifier{cfg: n})
+	}
+	if p := cfg.Pushover; p != nil && strings.TrimSpace(p.Token) != "" && strings.TrimSpace(p.User) != "" {
+		out = append(out, pushoverNotifier{cfg: p})
+	}
+	if t := cfg.Telegram; t != nil && strings.TrimSpace(t.BotToken) != "" && strings.TrimSpace(t.ChatID) != "" {
+		out = append(out, telegramNotifier{cfg: t})
+	}
+	if e := cfg.Email; e != nil && strings.TrimSpace(e.Host) != "" && len(e.To) > 0 {
+		out = append(out, emailNotifier{cfg: e})
+	}
+	return out
+}
+
+// ---- ntfy ----
+
+type ntfyNotifier struct{ cfg *NtfyConfig }
+
+func (n ntfyNotifier) name() string { return "ntfy" }
+
+func (n ntfyNotifier) wants(event notifyEvent) bool { return wantsEvent(n.cfg.Events, event) }
+
+func (n ntfyNotifier) send(ctx context.Context, msg notification) error {
+	tags, priority := "white_check_mark,camera", "default"
+	switch msg.event {
+	case eventFailure:
+		tags, priority = "rotating_light", "high"
+	case eventVerifyMismatch, eventShareError:
+		tags, priority = "warning", "high"
+	}
+	return publishNtfy(ctx, n.cfg, msg.title, msg.message, tags, priority)
+}
+
 // publishNtfy sends a single notification to an ntfy topic. It is a no-op when
 // ntfy is not configured. HTTP headers must be ASCII, so emoji are expressed via
 // the Tags header (ntfy renders known tags as emoji) rather than in the title.
@@ -43,48 +129,185 @@ func publishNtfy(ctx context.Context, cfg *NtfyConfig, title, message, tags, pri
 		req.Header.Set("Priority", priority)
 	}
 
+	return doNotifyRequest(req)
+}
+
+// ---- Pushover ----
+
+type pushoverNotifier struct{ cfg *PushoverConfig }
+
+func (p pushoverNotifier) name() string { return "pushover" }
+
+func (p pushoverNotifier) wants(event notifyEvent) bool { return wantsEvent(p.cfg.Events, event) }
+
+func (p pushoverNotifier) send(ctx context.Context, msg notification) error {
+	priority := "0"
+	if msg.event != eventComplete {
+		priority = "1"
+	}
+	form := url.Values{
+		"token":    {strings.TrimSpace(os.ExpandEnv(p.cfg.Token))},
+		"user":     {strings.TrimSpace(os.ExpandEnv(p.cfg.User))},
+		"title":    {msg.title},
+		"message":  {msg.message},
+		"priority": {priority},
+	}
+	return postForm(ctx, "https://api.pushover.net/1/messages.json", form)
+}
+
+// ---- Telegram ----
+
+type telegramNotifier struct{ cfg *TelegramConfig }
+
+func (t telegramNotifier) name() string { return "telegram" }
+
+func (t telegramNotifier) wants(event notifyEvent) bool { return wantsEvent(t.cfg.Events, event) }
+
+func (t telegramNotifier) send(ctx context.Context, msg notification) error {
+	endpoint := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", strings.TrimSpace(os.ExpandEnv(t.cfg.BotToken)))
+	form := url.Values{
+		"chat_id": {strings.TrimSpace(t.cfg.ChatID)},
+		"text":    {msg.title + "\n" + msg.message},
+	}
+	return postForm(ctx, endpoint, form)
+}
+
+func postForm(ctx context.Context, endpoint string, form url.Values) error {
+	reqCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return doNotifyRequest(req)
+}
+
+func doNotifyRequest(req *http.Request) error {
 	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
+		// Never echo the URL: Telegram embeds the bot token in the path.
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			return uerr.Err
+		}
 		return err
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode >= 300 {
-		return fmt.Errorf("ntfy returned %s", resp.Status)
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
 	}
 	return nil
 }
 
-// notifyTransferResult publishes a completion or failure notification for a
-// finished transfer. Errors are logged but never block the caller.
-func notifyTransferResult(cfg *NtfyConfig, folderName string, total, completed int, dur time.Duration, fatal error, errs []TransferError) {
-	if cfg == nil || strings.TrimSpace(cfg.Topic) == "" {
+// ---- Dispatch ----
+
+// notifyTransferResult publishes a completion, failure or verification-mismatch
+// notification for a finished transfer to every configured backend. Each backend
+// receives at most one message: the most specific event it subscribes to.
+// Errors are logged but never block the caller.
+func notifyTransferResult(cfg *Config, report *transferReport) {
+	notifiers := configuredNotifiers(cfg)
+	if len(notifiers) == 0 {
 		return
 	}
 
-	var (
-		title, tags, priority string
-		body                  strings.Builder
-	)
+	mismatches := 0
+	for _, te := range report.Errors {
+		if errors.Is(te.Error, errSizeMismatch) {
+			mismatches++
+		}
+	}
 
-	if fatal == nil && len(errs) == 0 {
-		title = "SnapVault transfer complete"
-		tags = "white_check_mark,camera"
-		priority = "default"
-		fmt.Fprintf(&body, "%s\n%d files in %s", folderName, completed, dur.Round(time.Second))
+	var body strings.Builder
+	messages := make(map[notifyEvent]notification)
+	if report.ok() {
+		fmt.Fprintf(&body, "%s\n%d files in %s", report.FolderName, report.Completed, report.Duration.Round(time.Second))
+		if len(report.Errors) > 0 {
+			fmt.Fprintf(&body, "\nQuorum met: %d of %d destinations complete, %d file error(s)", report.completeDestinations(), len(report.Shares), len(report.Errors))
+		}
+		messages[eventComplete] = notification{event: eventComplete, title: "SnapVault transfer complete", message: body.String(), report: report}
 	} else {
-		title = "SnapVault transfer failed"
-		tags = "rotating_light"
-		priority = "high"
-		fmt.Fprintf(&body, "%s\n%d of %d files transferred", folderName, completed, total)
-		if fatal != nil {
-			fmt.Fprintf(&body, "\nError: %v", fatal)
+		fmt.Fprintf(&body, "%s\n%d of %d files transferred in %s", report.FolderName, report.Completed, report.Total, report.Duration.Round(time.Second))
+		if report.Fatal != nil {
+			fmt.Fprintf(&body, "\nError: %v", report.Fatal)
 		}
-		if len(errs) > 0 {
-			fmt.Fprintf(&body, "\n%d file error(s)", len(errs))
+		if len(report.Errors) > 0 {
+			fmt.Fprintf(&body, "\n%d file error(s)", len(report.Errors))
+		}
+		if len(report.SourceProblems) > 0 {
+			fmt.Fprintf(&body, "\n%d damaged file(s) on the card", len(report.SourceProblems))
+		}
+		messages[eventFailure] = notification{event: eventFailure, title: "SnapVault transfer failed", message: body.String(), report: report}
+	}
+	if mismatches > 0 {
+		msg := fmt.Sprintf("%s\n%d file(s) failed size verification", report.FolderName, mismatches)
+		messages[eventVerifyMismatch] = notification{event: eventVerifyMismatch, title: "SnapVault verification mismatch", message: msg, report: report}
+	}
+
+	for _, n := range notifiers {
+		for _, ev := range []notifyEvent{eventVerifyMismatch, eventFailure, eventComplete} {
+			msg, ok := messages[ev]
+			if !ok || !n.wants(ev) {
+				continue
+			}
+			if err := n.send(context.Background(), msg); err != nil {
+				slog.Warn("Failed to send notification", "backend", n.name(), "error", err)
+			}
+			break
 		}
 	}
+}
 
-	if err := publishNtfy(context.Background(), cfg, title, body.String(), tags, priority); err != nil {
-		slog.Warn("Failed to send ntfy notification", "error", err)
+// shareErrorNotifier returns an eventBus subscriber that pushes the first
+// failed copy to each destination as it happens, so someone can go and look
+// at the NAS before the card is done. It returns nil when no backend asks for
+// share_error.
+func shareErrorNotifier(cfg *Config) func(RunEvent) {
+	var notifiers []notifier
+	for _, n := range configuredNotifiers(cfg) {
+		if n.wants(eventShareError) {
+			notifiers = append(notifiers, n)
+		}
+	}
+	if len(notifiers) == 0 {
+		return nil
+	}
+	var (
+		mu     sync.Mutex
+		folder string
+		told   map[string]bool
+	)
+	return func(e RunEvent) {
+		switch e := e.(type) {
+		case RunStarted:
+			mu.Lock()
+			folder, told = e.Folder, map[string]bool{}
+			mu.Unlock()
+		case ShareError:
+			mu.Lock()
+			first := told != nil && !told[e.Share]
+			if first {
+				told[e.Share] = true
+			}
+			msg := notification{
+				event:   eventShareError,
+				title:   "SnapVault: copies to " + e.Share + " are failing",
+				message: fmt.Sprintf("%s\n%s: %v", folder, baseName(e.Path), e.Err),
+			}
+			mu.Unlock()
+			if !first {
+				return
+			}
+			// Sent in the background so the copy worker isn't held up.
+			for _, n := range notifiers {
+				go func(n notifier) {
+					if err := n.send(context.Background(), msg); err != nil {
+						slog.Warn("Failed to send notification", "backend", n.name(), "error", err)
+					}
+				}(n)
+			}
+		}
 	}
 }
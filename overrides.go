@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix marks environment variables that override config values.
+// Nesting uses a double underscore, list entries their index:
+// SNAPVAULT_QUORUM=2, SNAPVAULT_SMB_SHARES__0__HOST=nas.local.
+const envPrefix = "SNAPVAULT_"
+
+// envProfile selects a profile when -profile is not given.
+const envProfile = envPrefix + "PROFILE"
+
+// envReserved are SNAPVAULT_* variables SnapVault reads for other purposes;
+// they are not config overrides.
+var envReserved = map[string]bool{
+	envProfile:        true,
+	sourcePasswordEnv: true,
+}
+
+// envOverrides returns the SNAPVAULT_* config overrides in the environment,
+// other than envReserved, as key=value pairs in -set syntax, sorted so that
+// list entries are created in index order.
+func envOverrides() []string {
+	var out []string
+	for _, kv := range os.Environ() {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok || !strings.HasPrefix(name, envPrefix) || envReserved[name] {
+			continue
+		}
+		key := strings.ToLower(strings.TrimPrefix(name, envPrefix))
+		out = append(out, strings.ReplaceAll(key, "__", ".")+"="+value)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// applyOverrides sets config values from key=value pairs such as
+// "smb_shares.0.base_path=Photos" or "workers=8". Keys are the YAML names;
+// a list index one past the end appends a new entry, so a share can be
+// defined entirely from the environment.
+func (c *Config) applyOverrides(overrides []string) error {
+	for _, o := range overrides {
+		key, value, ok := strings.Cut(o, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("override %q: expected key=value", o)
+		}
+		if err := setConfigPath(reflect.ValueOf(c).Elem(), strings.Split(key, "."), value); err != nil {
+			return fmt.Errorf("override %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func setConfigPath(v reflect.Value, path []string, value string) error {
+	for i, key := range path {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		switch v.Kind() {
+		case reflect.Struct:
+			field, ok := fieldByYAMLName(v, key)
+			if !ok {
+				return fmt.Errorf("unknown key %q", strings.Join(path[:i+1], "."))
+			}
+			v = field
+		case reflect.Slice:
+			if v.Type().Elem().Kind() == reflect.String {
+				return fmt.Errorf("%q is a list; set it as a comma-separated value", strings.Join(path[:i], "."))
+			}
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx > v.Len() {
+				return fmt.Errorf("index %q out of range (list has %d entries)", key, v.Len())
+			}
+			if idx == v.Len() {
+				v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			}
+			v = v.Index(idx)
+		default:
+			return fmt.Errorf("%q cannot be overridden", strings.Join(path[:i], "."))
+		}
+	}
+
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String {
+		var list []string
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				list = append(list, part)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+		return nil
+	}
+	if v.Kind() == reflect.String {
+		// Taken literally, so values like "yes" or "0445" survive.
+		v.SetString(value)
+		return nil
+	}
+	target := reflect.New(v.Type())
+	if err := yaml.Unmarshal([]byte(value), target.Interface()); err != nil {
+		return fmt.Errorf("invalid value %q: %w", value, err)
+	}
+	v.Set(target.Elem())
+	return nil
+}
+
+// fieldByYAMLName finds the struct field whose YAML key is name.
+func fieldByYAMLName(v reflect.Value, name string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if key, ok := yamlKey(t.Field(i)); ok && key == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// yamlKey is the key yaml.v3 uses for a struct field; ok is false for fields
+// it never reads.
+func yamlKey(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	tag := f.Tag.Get("yaml")
+	if tag == "-" {
+		return "", false
+	}
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+	return strings.ToLower(f.Name), true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApplyOverrides(t *testing.T) {
+	base := func() *Config {
+		return &Config{SMBShares: []SMBConfig{{Host: "nas.local", Share: "Photos"}}}
+	}
+	tests := []struct {
+		name      string
+		overrides []string
+		check     func(c *Config) bool
+		err       string // substring of the expected error, "" for none
+	}{
+		{
+			name:      "top-level int",
+			overrides: []string{"quorum=2", "workers=8"},
+			check:     func(c *Config) bool { return c.Quorum == 2 && c.Workers == 8 },
+		},
+		{
+			name:      "existing list entry",
+			overrides: []string{"smb_shares.0.base_path=Clients", "smb_shares.0.port=4450"},
+			check: func(c *Config) bool {
+				s := c.SMBShares[0]
+				return s.Host == "nas.local" && s.BasePath == "Clients" && s.Port == 4450
+			},
+		},
+		{
+			name:      "index one past the end appends",
+			overrides: []string{"smb_shares.1.host=backup.local", "smb_shares.1.share=Vault"},
+			check: func(c *Config) bool {
+				return len(c.SMBShares) == 2 && c.SMBShares[1].Host == "backup.local" && c.SMBShares[1].Share == "Vault"
+			},
+		},
+		{
+			name:      "strings are taken literally",
+			overrides: []string{"smb_shares.0.base_path=0445", "hash_algorithm=yes"},
+			check:     func(c *Config) bool { return c.SMBShares[0].BasePath == "0445" && c.HashAlgorithm == "yes" },
+		},
+		{
+			name:      "value may contain =",
+			overrides: []string{"smb_shares.0.base_path=a=b"},
+			check:     func(c *Config) bool { return c.SMBShares[0].BasePath == "a=b" },
+		},
+		{
+			name:      "nil pointers are allocated",
+			overrides: []string{"grpc.token=abcdefghijklmnop", "smb_shares.0.enabled=false"},
+			check: func(c *Config) bool {
+				return c.GRPC != nil && c.GRPC.Token == "abcdefghijklmnop" && !c.SMBShares[0].enabled()
+			},
+		},
+		{
+			name:      "string lists are comma-separated",
+			overrides: []string{"skip_folders=MISC, AVF_INFO,,"},
+			check:     func(c *Config) bool { return reflect.DeepEqual(c.SkipFolders, []string{"MISC", "AVF_INFO"}) },
+		},
+		{name: "missing =", overrides: []string{"quorum"}, err: "expected key=value"},
+		{name: "empty key", overrides: []string{"=2"}, err: "expected key=value"},
+		{name: "unknown key", overrides: []string{"smb_shares.0.hots=x"}, err: `unknown key "smb_shares.0.hots"`},
+		{name: "index past the end", overrides: []string{"smb_shares.2.host=x"}, err: "out of range"},
+		{name: "negative index", overrides: []string{"smb_shares.-1.host=x"}, err: "out of range"},
+		{name: "index into a string list", overrides: []string{"skip_folders.0=MISC"}, err: "comma-separated"},
+		{name: "key below a scalar", overrides: []string{"quorum.x=1"}, err: "cannot be overridden"},
+		{name: "bad value", overrides: []string{"quorum=two"}, err: "invalid value"},
+	}
+	for _, tt := range tests {
+		c := base()
+		err := c.applyOverrides(tt.overrides)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: error %v, want one containing %q", tt.name, err, tt.err)
+		case tt.check != nil && !tt.check(c):
+			t.Errorf("%s: config not as expected: %+v", tt.name, c)
+		}
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	t.Setenv("SNAPVAULT_QUORUM", "2")
+	t.Setenv("SNAPVAULT_SMB_SHARES__0__HOST", "nas.local")
+	t.Setenv(envProfile, "studio")
+	t.Setenv(sourcePasswordEnv, "secret")
+	t.Setenv("OTHER_QUORUM", "3")
+
+	var got []string
+	for _, kv := range envOverrides() {
+		if strings.HasPrefix(kv, "quorum=") || strings.HasPrefix(kv, "smb_shares.") || strings.HasPrefix(kv, "profile=") || strings.Contains(kv, "secret") {
+			got = append(got, kv)
+		}
+	}
+	want := []string{"quorum=2", "smb_shares.0.host=nas.local"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("envOverrides = %q, want %q", got, want)
+	}
+}
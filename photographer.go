@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+)
+
+// normalizeSerial is how camera serials are compared: some bodies pad the
+// EXIF value, and people type them in either case.
+func normalizeSerial(serial string) string {
+	return strings.ToUpper(strings.TrimSpace(serial))
+}
+
+// photographerNames returns naming.photographers keyed by normalized serial.
+// It is never nil, so a template using {{.Photographer}} with no mapping
+// still leaves every file unattributed rather than failing.
+func photographerNames(cfg *Config) (map[string]string, error) {
+	names := map[string]string{}
+	if cfg == nil || cfg.Naming == nil {
+		return names, nil
+	}
+	for serial, name := range cfg.Naming.Photographers {
+		key, name, err := normalizePhotographer(serial, name)
+		if err != nil {
+			return nil, fmt.Errorf("naming.photographers: %w", err)
+		}
+		if prev, dup := names[key]; dup && prev != name {
+			return nil, fmt.Errorf("naming.photographers: camera %s is listed for both %q and %q", serial, prev, name)
+		}
+		names[key] = name
+	}
+	return names, nil
+}
+
+// normalizePhotographer checks one naming.photographers entry. The name
+// ends up in folder and file names, so it can't contain a path separator.
+func normalizePhotographer(serial, name string) (string, string, error) {
+	key, name := normalizeSerial(serial), strings.TrimSpace(name)
+	if key == "" {
+		return "", "", fmt.Errorf("empty camera serial for %q", name)
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return "", "", fmt.Errorf("%q is not a valid name for camera %s", name, serial)
+	}
+	return key, name, nil
+}
+
+// photographerOf is the photographer of the camera that took sourcePath, or
+// "" when its serial can't be read or isn't mapped.
+func photographerOf(names map[string]string, sourcePath string) string {
+	return names[normalizeSerial(cameraSerial(sourcePath))]
+}
+
+// attributeJobs sets Photographer on every job from its camera serial. RAW
+// files whose EXIF goexif cannot read take the photographer of their JPEG
+// sibling, as for locations.
+func attributeJobs(ctx context.Context, jobs []TransferJob, names map[string]string) {
+	slog.Info("Reading camera serials", "files", len(jobs), "photographers", len(names))
+	siblings := map[string]string{}
+	for i := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		jobs[i].Photographer = photographerOf(names, jobs[i].SourcePath)
+		if jobs[i].Photographer != "" {
+			siblings[sequenceKey(jobs[i])] = jobs[i].Photographer
+		}
+	}
+	for i := range jobs {
+		if jobs[i].Photographer == "" {
+			jobs[i].Photographer = siblings[sequenceKey(jobs[i])]
+		}
+	}
+}
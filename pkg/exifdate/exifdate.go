@@ -0,0 +1,56 @@
+// Package exifdate reads when a photo was taken from its EXIF metadata.
+//
+// It is the date logic SnapVault uses to sort files into shoot and day
+// folders, usable without the rest of the tool.
+package exifdate
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ErrNoDate is returned, wrapped, for files without a readable EXIF capture
+// time: videos, most RAW formats goexif can't parse, screenshots.
+var ErrNoDate = errors.New("no EXIF capture time")
+
+// Decode returns the capture time in the EXIF data read from r:
+// DateTimeOriginal, or DateTime when that is missing. Times carry the
+// offset recorded in the file, or local time when there is none.
+func Decode(r io.Reader) (time.Time, error) {
+	x, err := exif.Decode(r)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrNoDate, err)
+	}
+	tm, err := x.DateTime()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %v", ErrNoDate, err)
+	}
+	return tm, nil
+}
+
+// Taken returns the capture time of the file at path. The error wraps
+// ErrNoDate when the file opens but has no capture time.
+func Taken(path string) (time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	return Decode(f)
+}
+
+// TakenOrModified is Taken, falling back to the file's modification time
+// when it has no capture time, which is what cameras set for files without
+// EXIF. It only fails when the file can't be read.
+func TakenOrModified(path string, info os.FileInfo) (time.Time, error) {
+	tm, err := Taken(path)
+	if errors.Is(err, ErrNoDate) {
+		return info.ModTime(), nil
+	}
+	return tm, err
+}
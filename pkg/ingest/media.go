@@ -0,0 +1,70 @@
+package ingest
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// mediaExtensions are the photo and video files an import picks up.
+var mediaExtensions = map[string]bool{
+	// Stills
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".heic": true,
+	".heif": true,
+	".tif":  true,
+	".tiff": true,
+	".cr2":  true,
+	".cr3":  true,
+	".nef":  true,
+	".arw":  true,
+	".dng":  true,
+	".orf":  true,
+	".rw2":  true,
+	".raf":  true,
+	".pef":  true,
+	".srw":  true,
+	".raw":  true,
+	// Video (cameras and action cams)
+	".mov":  true,
+	".mp4":  true,
+	".m4v":  true,
+	".avi":  true,
+	".mts":  true,
+	".m2ts": true,
+	".mxf":  true,
+}
+
+// MediaExtensions returns the lower-case extensions, with the dot, of the
+// files a Scanner picks up.
+func MediaExtensions() []string {
+	exts := make([]string, 0, len(mediaExtensions))
+	for ext := range mediaExtensions {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// IsMedia reports whether the file name has a photo or video extension.
+func IsMedia(name string) bool {
+	return mediaExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// IsSystemFile reports whether a file or folder name is OS bookkeeping that
+// is never imported: AppleDouble resource-fork sidecars (._*), Finder
+// metadata, Spotlight and Trash folders macOS leaves on a card, and the
+// Windows equivalents.
+func IsSystemFile(name string) bool {
+	return strings.HasPrefix(name, "._") ||
+		name == ".DS_Store" ||
+		name == "__MACOSX" ||
+		name == ".Spotlight-V100" ||
+		name == ".fseventsd" ||
+		name == ".Trashes" ||
+		name == ".TemporaryItems" ||
+		name == "System Volume Information" ||
+		strings.EqualFold(name, "$RECYCLE.BIN")
+}
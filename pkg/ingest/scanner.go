@@ -0,0 +1,113 @@
+// Package ingest finds what a card import would copy: a Scanner walks a
+// card for photos and videos, reads when each was taken and sets damaged
+// files aside. It is the scan the snapvault binary runs before every import.
+//
+//	files, problems, err := (&ingest.Scanner{}).Scan(ctx, "/Volumes/EOS_DIGITAL")
+//
+// Copying the files to shares, and everything configured in SnapVault's
+// config.yaml, stays in the binary.
+package ingest
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/KiranTheRam/SnapVault/pkg/exifdate"
+)
+
+// File is a photo or video found on a card.
+type File struct {
+	Path    string // on this machine
+	Rel     string // below the scanned root, slash-separated
+	Size    int64
+	ModTime time.Time
+	// Taken is the EXIF capture time, or ModTime for files without one,
+	// such as most videos.
+	Taken time.Time
+}
+
+// Problem is a card file left out of a scan because it looks damaged:
+// empty, unreadable, or flagged by Scanner.Suspect.
+type Problem struct {
+	Path   string
+	Reason string
+}
+
+// Scanner finds the photos and videos below a card's root. The zero value
+// is ready to use.
+type Scanner struct {
+	// SkipDir, when set, is asked about every folder below the root;
+	// returning true leaves the folder and everything in it out.
+	SkipDir func(path string) bool
+	// Include, when set, picks up files other than photos and videos, such
+	// as sidecars, when it returns true.
+	Include func(path string) bool
+	// Suspect, when set, is asked about every non-empty file picked up; a
+	// non-empty reason leaves it out as a Problem, such as a RAW too small
+	// to be whole.
+	Suspect func(path string, size int64) string
+}
+
+// Scan walks root and returns its photos and videos in walk order, and the
+// ones it left out as damaged. OS bookkeeping files are ignored, and folders
+// that can't be listed are logged and skipped. It only fails when ctx is
+// done or root can't be read.
+func (s *Scanner) Scan(ctx context.Context, root string) ([]File, []Problem, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, nil, err
+	}
+	var files []File
+	var problems []Problem
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			slog.Warn("Error accessing path", "path", p, "error", err)
+			return nil
+		}
+		if info.IsDir() {
+			if p != root && (IsSystemFile(info.Name()) || (s.SkipDir != nil && s.SkipDir(p))) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if IsSystemFile(info.Name()) || !(IsMedia(p) || (s.Include != nil && s.Include(p))) {
+			return nil
+		}
+		if info.Size() == 0 {
+			problems = append(problems, Problem{Path: p, Reason: "zero-byte file"})
+			return nil
+		}
+		if s.Suspect != nil {
+			if reason := s.Suspect(p, info.Size()); reason != "" {
+				problems = append(problems, Problem{Path: p, Reason: reason})
+				return nil
+			}
+		}
+		taken, err := exifdate.TakenOrModified(p, info)
+		if err != nil {
+			problems = append(problems, Problem{Path: p, Reason: "unreadable: " + err.Error()})
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{
+			Path:    p,
+			Rel:     filepath.ToSlash(rel),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Taken:   taken,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return files, problems, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"golang.org/x/image/draw"
+)
+
+// PreviewConfig makes a share a derivative destination: instead of the
+// originals it receives a downscaled, recompressed copy of every JPEG, for a
+// fast web preview share.
+type PreviewConfig struct {
+	// MaxDimension is the longest edge in pixels; 2048 by default. Smaller
+	// images are recompressed but not enlarged.
+	MaxDimension int `yaml:"max_dimension,omitempty"`
+	// Quality is the JPEG quality, 1 to 100; 80 by default.
+	Quality int `yaml:"quality,omitempty"`
+}
+
+const (
+	defaultPreviewDimension = 2048
+	defaultPreviewQuality   = 80
+)
+
+func (p *PreviewConfig) dimension() int {
+	if p.MaxDimension > 0 {
+		return p.MaxDimension
+	}
+	return defaultPreviewDimension
+}
+
+func (p *PreviewConfig) quality() int {
+	if p.Quality > 0 {
+		return p.Quality
+	}
+	return defaultPreviewQuality
+}
+
+// isPreviewShare reports whether the share receives derivatives only.
+func (c SMBConfig) isPreviewShare() bool { return c.Preview != nil }
+
+// transferPreview writes the derivative of job to a preview share, at the
+// same path its original gets on the other shares. The derivative carries no
+// EXIF apart from the share's attribution.
+func transferPreview(ctx context.Context, job TransferJob, conn *SMBConnection) (copyResult, error) {
+	data, err := renderPreview(job.SourcePath, conn.Config.Preview)
+	if err != nil {
+		return copyResult{}, err
+	}
+	data = addAttribution(data, conn.attribution)
+
+	destDir := path.Join(shootRoot(conn, job.FolderName), job.DestDir)
+	if err := conn.mkdirAll(ctx, destDir); err != nil {
+		return copyResult{}, fmt.Errorf("creating directories: %w", err)
+	}
+	fileName := job.DestName
+	if fileName == "" {
+		fileName = filepath.Base(job.SourcePath)
+	}
+	destPath := path.Join(destDir, fileName)
+
+	h := newHasher(conn.hashAlg)
+	h.Write(data)
+	if err := conn.Share.WithContext(ctx).WriteFile(destPath, data, 0o644); err != nil {
+		return copyResult{}, fmt.Errorf("writing preview: %w", err)
+	}
+	return copyResult{DestPath: destPath, Sum: h.Sum(nil), Algorithm: conn.hashAlg}, nil
+}
+
+// renderPreview decodes a JPEG, turns it upright per its EXIF orientation
+// (which the re-encoded file no longer carries), scales it to fit cfg and
+// encodes it again.
+func renderPreview(sourcePath string, cfg *PreviewConfig) ([]byte, error) {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errSourceRead, err)
+	}
+	defer f.Close()
+
+	orientation := 1
+	if x, err := exif.Decode(f); err == nil {
+		if tag, err := x.Get(exif.Orientation); err == nil {
+			if v, err := tag.Int(0); err == nil {
+				orientation = v
+			}
+		}
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		return nil, fmt.Errorf("%w: %w", errSourceRead, err)
+	}
+	src, err := jpeg.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %w", filepath.Base(sourcePath), err)
+	}
+
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if longest, limit := max(w, h), cfg.dimension(); longest > limit {
+		w, h = max(1, w*limit/longest), max(1, h*limit/longest)
+	}
+	scaled := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(scaled, scaled.Bounds(), src, b, draw.Src, nil)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, orient(scaled, orientation), &jpeg.Options{Quality: cfg.quality()}); err != nil {
+		return nil, fmt.Errorf("encoding preview: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// orient applies an EXIF orientation (2-8) to img.
+func orient(img *image.RGBA, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	ow, oh := w, h
+	if orientation >= 5 {
+		ow, oh = h, w
+	}
+	out := image.NewRGBA(image.Rect(0, 0, ow, oh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored upside down
+				dx, dy = x, h-1-y
+			case 5: // mirrored, rotated 90° counter-clockwise
+				dx, dy = y, x
+			case 6: // rotated 90° clockwise
+				dx, dy = h-1-y, x
+			case 7: // mirrored, rotated 90° clockwise
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90° counter-clockwise
+				dx, dy = y, w-1-x
+			}
+			out.SetRGBA(dx, dy, img.RGBAAt(x, y))
+		}
+	}
+	return out
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// applyProfile overlays the named profile on the top-level settings. Every
+// key the profile sets wins; lists such as smb_shares are replaced rather
+// than merged, so each profile carries its own share set. An empty name
+// leaves the config as is.
+func (c *Config) applyProfile(name string) error {
+	if name == "" {
+		return nil
+	}
+	node, ok := c.Profiles[name]
+	if !ok {
+		names := make([]string, 0, len(c.Profiles))
+		for n := range c.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return fmt.Errorf("profile %q requested but the config defines no profiles", name)
+		}
+		return fmt.Errorf("unknown profile %q (available: %s)", name, strings.Join(names, ", "))
+	}
+	profiles := c.Profiles
+	if err := node.Decode(c); err != nil {
+		return fmt.Errorf("applying profile %q: %w", name, err)
+	}
+	c.Profiles = profiles
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// VideoProxyConfig turns on low-resolution proxies of every imported video,
+// rendered with ffmpeg after the copies finish and written to one share, so
+// editing can start on a laptop without pulling the originals.
+type VideoProxyConfig struct {
+	// Share names the share that receives the proxies (name, host, share
+	// name or host/share, as for -only-share).
+	Share string `yaml:"share"`
+	// FFmpeg is the ffmpeg binary; "ffmpeg" from PATH by default.
+	FFmpeg string `yaml:"ffmpeg,omitempty"`
+	// Height of the proxies in pixels; 540 by default. Width keeps the aspect.
+	Height int `yaml:"height,omitempty"`
+	// Folder is created inside each date folder for the proxies; "Proxies"
+	// by default.
+	Folder string `yaml:"folder,omitempty"`
+}
+
+const (
+	defaultProxyHeight = 540
+	defaultProxyFolder = "Proxies"
+)
+
+func (c *VideoProxyConfig) ffmpeg() string {
+	if c.FFmpeg != "" {
+		return os.ExpandEnv(c.FFmpeg)
+	}
+	return "ffmpeg"
+}
+
+func (c *VideoProxyConfig) height() int {
+	if c.Height > 0 {
+		return c.Height
+	}
+	return defaultProxyHeight
+}
+
+func (c *VideoProxyConfig) folder() string {
+	if f := strings.Trim(c.Folder, "/"); f != "" {
+		return f
+	}
+	return defaultProxyFolder
+}
+
+// isProxyFolder reports whether rel, a directory relative to the shoot
+// folder, holds conn's video proxies. They exist on one share only, so check
+// and repair must not treat them as missing everywhere else.
+func (conn *SMBConnection) isProxyFolder(rel string) bool {
+	return conn.proxyFolder != "" && strings.HasSuffix("/"+rel, "/"+conn.proxyFolder)
+}
+
+// generateProxies renders a proxy of every video in jobs and uploads it to
+// the proxy share. Proxies are a convenience: failures are logged, never
+// returned, and the originals are already safe by the time this runs.
+func generateProxies(ctx context.Context, cfg *VideoProxyConfig, jobs []TransferJob, connections []*SMBConnection, journal *runJournal) {
+	var videos []TransferJob
+	for _, job := range jobs {
+		if videoExtensions[strings.ToLower(filepath.Ext(job.SourcePath))] {
+			videos = append(videos, job)
+		}
+	}
+	if len(videos) == 0 {
+		return
+	}
+	var conn *SMBConnection
+	for _, c := range connections {
+		if c.proxyFolder != "" {
+			conn = c
+			break
+		}
+	}
+	if conn == nil {
+		slog.Warn("Video proxy share is not part of this import; no proxies made", "share", cfg.Share)
+		return
+	}
+	if _, err := exec.LookPath(cfg.ffmpeg()); err != nil {
+		slog.Warn("ffmpeg not found; no video proxies made (install it or set video_proxy.ffmpeg)", "error", err)
+		return
+	}
+
+	slog.Info("Generating video proxies", "videos", len(videos), "share", shareLabel(conn.Config), "height", cfg.height())
+	made := 0
+	for i, job := range videos {
+		if ctx.Err() != nil {
+			return
+		}
+		res, err := transferProxy(ctx, cfg, job, conn)
+		if err != nil {
+			slog.Warn("Failed to make video proxy", "file", job.SourcePath, "error", err)
+			continue
+		}
+		if journal != nil {
+			journal.record(conn, job.SourcePath, job.Size, res)
+		}
+		made++
+		slog.Debug("Video proxy written", "file", filepath.Base(job.SourcePath), "proxy", res.DestPath, "done", i+1, "of", len(videos))
+	}
+	slog.Info("Video proxies done", "made", made, "failed", len(videos)-made)
+}
+
+// transferProxy renders one proxy to a temporary file and copies it to
+// <date folder>/Proxies/<name>.mp4 on conn.
+func transferProxy(ctx context.Context, cfg *VideoProxyConfig, job TransferJob, conn *SMBConnection) (copyResult, error) {
+	tmp, err := os.CreateTemp("", "snapvault-proxy-*.mp4")
+	if err != nil {
+		return copyResult{}, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	if err := runFFmpeg(ctx, cfg, job.SourcePath, tmp.Name()); err != nil {
+		return copyResult{}, err
+	}
+
+	name := job.DestName
+	if name == "" {
+		name = filepath.Base(job.SourcePath)
+	}
+	name = strings.TrimSuffix(name, filepath.Ext(name)) + ".mp4"
+	destDir := path.Join(shootRoot(conn, job.FolderName), job.DestDir, conn.proxyFolder)
+	if err := conn.mkdirAll(ctx, destDir); err != nil {
+		return copyResult{}, fmt.Errorf("creating directories: %w", err)
+	}
+	destPath := path.Join(destDir, name)
+	h := newHasher(conn.hashAlg)
+	if _, err := copyFileToSMB(ctx, tmp.Name(), conn, destPath, h, jpegEdit{}); err != nil {
+		return copyResult{}, err
+	}
+	return copyResult{DestPath: destPath, Sum: h.Sum(nil), Algorithm: conn.hashAlg}, nil
+}
+
+func runFFmpeg(ctx context.Context, cfg *VideoProxyConfig, source, dest string) error {
+	cmd := exec.CommandContext(ctx, cfg.ffmpeg(),
+		"-hide_banner", "-loglevel", "error", "-y",
+		"-i", source,
+		"-vf", "scale=-2:"+strconv.Itoa(cfg.height()),
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "28", "-pix_fmt", "yuv420p",
+		"-c:a", "aac", "-b:a", "128k",
+		"-movflags", "+faststart",
+		dest,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return errors.New("ffmpeg: " + msg)
+		}
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+	return nil
+}
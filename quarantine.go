@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// errSourceRead marks a copy that failed because the card itself could not be
+// read, as opposed to a network or share problem.
+var errSourceRead = errors.New("reading source")
+
+// sourceProblem is a file on the card that was not copied because it looks
+// damaged: empty, or failing with read errors.
+type sourceProblem struct {
+	Path        string
+	Reason      string
+	Quarantined string // local copy of whatever could be read, if quarantining
+}
+
+// sourceReader tags read errors so transfer failures caused by bad card
+// sectors can be told apart from destination failures.
+type sourceReader struct {
+	r io.Reader
+}
+
+func (s sourceReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = fmt.Errorf("%w: %w", errSourceRead, err)
+	}
+	return n, err
+}
+
+// quarantineFile copies what can be read of a damaged file into
+// dir/<folder>/<path relative to the card>, for later recovery attempts.
+func quarantineFile(dir, folderName, root, sourcePath string) (string, error) {
+	rel, err := filepath.Rel(root, sourcePath)
+	if err != nil || rel == "" {
+		rel = filepath.Base(sourcePath)
+	}
+	dest := filepath.Join(dir, folderName, rel)
+	if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+		return "", fmt.Errorf("creating quarantine folder: %w", err)
+	}
+	out, err := os.Create(dest)
+	if err != nil {
+		return "", fmt.Errorf("creating quarantine file: %w", err)
+	}
+	defer out.Close()
+
+	if src, err := os.Open(sourcePath); err == nil {
+		// Salvage as much as the card gives us; the read error is already known.
+		if _, err := io.Copy(out, src); err != nil {
+			slog.Debug("Quarantine copy is partial", "file", sourcePath, "error", err)
+		}
+		src.Close()
+	}
+	return dest, nil
+}
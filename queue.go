@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// queuedCard is one card in an unattended multi-card run.
+type queuedCard struct {
+	Mount string
+	Shoot string
+}
+
+// queueNameData is available to -name templates in -queue mode.
+type queueNameData struct {
+	Index  int    // 1-based position in the queue
+	Volume string // last path element of the mount, e.g. "EOS_DIGITAL"
+	Date   string // today, YYYY-MM-DD
+}
+
+// planCardQueue decides the shoot name for every card before anything is
+// copied, so the user can walk away once the queue starts. A non-empty
+// nameTmpl (e.g. "Wedding card {{.Index}}") names every card; otherwise the
+// user is prompted per card and an empty answer skips it.
+func planCardQueue(mounts []string, nameTmpl string, in io.Reader, out io.Writer) ([]queuedCard, error) {
+	if len(mounts) == 0 {
+		return nil, errors.New("no cards detected; insert cards or pass them with -mount")
+	}
+
+	var tmpl *template.Template
+	if strings.TrimSpace(nameTmpl) != "" {
+		var err error
+		tmpl, err = template.New("name").Option("missingkey=error").Parse(nameTmpl)
+		if err != nil {
+			return nil, fmt.Errorf("parsing -name template: %w", err)
+		}
+	}
+
+	reader := bufio.NewReader(in)
+	today := time.Now().Format("2006-01-02")
+	cards := make([]queuedCard, 0, len(mounts))
+	for i, mount := range mounts {
+		var shoot string
+		if tmpl != nil {
+			var sb strings.Builder
+			data := queueNameData{Index: i + 1, Volume: filepath.Base(mount), Date: today}
+			if err := tmpl.Execute(&sb, data); err != nil {
+				return nil, fmt.Errorf("rendering name for %s: %w", mount, err)
+			}
+			shoot = strings.TrimSpace(sb.String())
+		} else {
+			fmt.Fprintf(out, "Shoot name for %s (blank to skip): ", mount)
+			line, err := reader.ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, fmt.Errorf("reading shoot name: %w", err)
+			}
+			shoot = strings.TrimSpace(line)
+		}
+		if shoot == "" {
+			slog.Info("Skipping card", "mount", mount)
+			continue
+		}
+		cards = append(cards, queuedCard{Mount: mount, Shoot: shoot})
+	}
+	if len(cards) == 0 {
+		return nil, errors.New("every card was skipped")
+	}
+	return cards, nil
+}
+
+// detectCardMounts narrows the mount candidates to volumes with a DCIM folder,
+// so the system disk and other attached drives are never queued.
+func detectCardMounts() []string {
+	var cards []string
+	for _, c := range detectMountCandidates() {
+		if info, err := os.Stat(filepath.Join(c.Path, "DCIM")); err == nil && info.IsDir() {
+			cards = append(cards, c.Path)
+		}
+	}
+	return cards
+}
+
+// chooseCardMount picks the card for -auto-mount: the only one detected, or
+// the one the user selects from a numbered list.
+func chooseCardMount(cards []string, in io.Reader, out io.Writer) (string, error) {
+	switch len(cards) {
+	case 0:
+		return "", errors.New("no card with a DCIM folder is mounted; insert one or pass -mount")
+	case 1:
+		fmt.Fprintf(out, "Using card %s\n", cards[0])
+		return cards[0], nil
+	}
+	for i, card := range cards {
+		fmt.Fprintf(out, "  %d) %s\n", i+1, card)
+	}
+	reader := bufio.NewReader(in)
+	for {
+		fmt.Fprintf(out, "Import which card? [1-%d]: ", len(cards))
+		line, err := reader.ReadString('\n')
+		if n, convErr := strconv.Atoi(strings.TrimSpace(line)); convErr == nil && n >= 1 && n <= len(cards) {
+			return cards[n-1], nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("%d cards are mounted; pick one with -mount", len(cards))
+		}
+	}
+}
+
+// queueResult summarises one card of the queue.
+type queueResult struct {
+	Card   queuedCard
+	Report *transferReport
+}
+
+// queueSettings are the per-card behaviours that apply to every card in the queue.
+type queueSettings struct {
+	incremental bool
+	markCard    bool
+	eject       bool
+}
+
+// runCardQueue imports the cards one after another over the already-open
+// connections. A failing card does not stop the queue; cancellation does.
+func runCardQueue(ctx context.Context, config *Config, cards []queuedCard, connections []*SMBConnection, base TransferOptions, settings queueSettings) ([]queueResult, error) {
+	results := make([]queueResult, 0, len(cards))
+	for i, card := range cards {
+		folderName := fmt.Sprintf("%d - %s", time.Now().Year(), card.Shoot)
+		slog.Info("Starting queued card", "position", i+1, "of", len(cards), "mount", card.Mount, "folder", folderName)
+
+		if err := validateMountPath(card.Mount); err != nil {
+			report := &transferReport{FolderName: folderName, Mount: card.Mount, StartedAt: time.Now(), Fatal: err}
+			notifyTransferResult(config, report)
+			results = append(results, queueResult{Card: card, Report: report})
+			slog.Error("Card is no longer readable", "mount", card.Mount, "error", err)
+			continue
+		}
+
+		collector := newReportCollector(folderName, card.Mount, config.Quorum)
+		namer, err := newFileNamer(config, card.Shoot, folderName)
+		if err != nil {
+			return results, err
+		}
+		memory := newCardMemory(ctx, config, []string{card.Mount}, settings.incremental)
+		opts := base
+		opts.Hook = collector.hook(base.Hook)
+		opts.Namer = namer
+		opts.Include = memory.include
+		opts.Journal = openRunJournal(config, folderName, []string{card.Mount})
+		if opts.Journal != nil {
+			opts.Journal.Cards = memory.ids()
+		}
+		opts.Catalog = config
+		transferErrors, err := processPhotos(ctx, []string{card.Mount}, folderName, connections, opts)
+		if errors.Is(err, context.Canceled) {
+			return results, err
+		}
+		report := collector.build(err, transferErrors)
+		memory.remember(config, folderName, report.ok())
+		if settings.markCard && report.allCopied() {
+			if err := writeImportMarker(card.Mount, report); err != nil {
+				slog.Warn("Could not mark card as imported (write-protected?)", "mount", card.Mount, "error", err)
+			}
+		}
+		if settings.eject && report.ok() && report.Completed == report.Total {
+			if err := ejectCard(ctx, card.Mount); err != nil {
+				slog.Warn("Could not eject card", "mount", card.Mount, "error", err)
+			}
+		}
+		notifyTransferResult(config, report)
+		results = append(results, queueResult{Card: card, Report: report})
+		if err != nil {
+			slog.Error("Queued card failed", "mount", card.Mount, "error", err)
+		}
+	}
+	return results, nil
+}
+
+// printQueueSummary writes one line per card once the queue has drained.
+func printQueueSummary(w io.Writer, results []queueResult) {
+	fmt.Fprintln(w, "\n=== Card Queue Summary ===")
+	for _, r := range results {
+		status := "ok"
+		switch {
+		case r.Report.Fatal != nil:
+			status = "FAILED: " + r.Report.Fatal.Error()
+		case len(r.Report.Errors) > 0:
+			status = fmt.Sprintf("%d errors", len(r.Report.Errors))
+		case len(r.Report.SourceProblems) > 0:
+			status = fmt.Sprintf("%d damaged source files", len(r.Report.SourceProblems))
+		}
+		fmt.Fprintf(w, "%-28s %-30s %d/%d files  %s\n", r.Card.Mount, r.Report.FolderName, r.Report.Completed, r.Report.Total, status)
+	}
+}
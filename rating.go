@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// SelectsConfig makes a share a client-delivery destination that only
+// receives the frames culled in camera. Files rejected in camera never go
+// to it. A selects share holds part of each shoot, so it never counts
+// toward quorum.
+type SelectsConfig struct {
+	// MinRating is the fewest stars a file needs, 1 to 5; -min-rating
+	// overrides it for one run. Zero lets any rating through.
+	MinRating int `yaml:"min_rating,omitempty"`
+	// Labels, when set, also requires one of these color labels, e.g.
+	// [Green, Blue]. Labels are compared ignoring case.
+	Labels []string `yaml:"labels,omitempty"`
+}
+
+func (c SMBConfig) isSelectsShare() bool { return c.Selects != nil }
+
+// validate checks the block as written in the config.
+func (s *SelectsConfig) validate() error {
+	if s.MinRating < 0 || s.MinRating > 5 {
+		return fmt.Errorf("min_rating must be between 1 and 5")
+	}
+	for _, l := range s.Labels {
+		if strings.TrimSpace(l) == "" {
+			return fmt.Errorf("labels must not be empty")
+		}
+	}
+	return nil
+}
+
+// accepts reports whether job goes to the share.
+func (s *SelectsConfig) accepts(job TransferJob) bool {
+	if s == nil {
+		return true
+	}
+	if job.Rating < 0 || job.Rating < s.MinRating {
+		return false
+	}
+	if len(s.Labels) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(s.Labels, func(l string) bool {
+		return strings.EqualFold(strings.TrimSpace(l), job.Label)
+	})
+}
+
+// describe summarises the filter for the import summary, e.g. "★3+, Green".
+func (s *SelectsConfig) describe() string {
+	var parts []string
+	if s.MinRating > 0 {
+		parts = append(parts, fmt.Sprintf("★%d+", s.MinRating))
+	}
+	if len(s.Labels) > 0 {
+		parts = append(parts, strings.Join(s.Labels, "/"))
+	}
+	if len(parts) == 0 {
+		return "every rating"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// applyMinRating sets -min-rating on every selects share.
+func applyMinRating(shares []SMBConfig, stars int) error {
+	if stars < 1 || stars > 5 {
+		return fmt.Errorf("%d is not between 1 and 5", stars)
+	}
+	found := false
+	for i, share := range shares {
+		if share.Selects == nil {
+			continue
+		}
+		sel := *share.Selects
+		sel.MinRating = stars
+		shares[i].Selects = &sel
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("no share has a selects block to apply it to")
+	}
+	return nil
+}
+
+// hasSelectsShare reports whether any connection filters by rating, so
+// ratings need to be read.
+func hasSelectsShare(connections []*SMBConnection) bool {
+	return slices.ContainsFunc(connections, func(c *SMBConnection) bool { return c.Config.isSelectsShare() })
+}
+
+// EXIF tag 0x4746, Rating, in IFD0; goexif doesn't load it.
+const tagRating = 0x4746
+
+// ratingScanBytes is how much of a file is searched for an XMP packet.
+// Cameras put it near the start: in a JPEG's APP1 segment, or in a RAW's
+// header ahead of the image data.
+const ratingScanBytes = 1 << 20
+
+var (
+	xmpRatingPattern = regexp.MustCompile(`xmp:Rating(?:="|>)\s*(-?\d+)`)
+	xmpLabelPattern  = regexp.MustCompile(`xmp:Label(?:="|>)([^"<]*)`)
+)
+
+// photoRating reads the in-camera star rating and color label of a file:
+// from an XMP sidecar next to it when there is one, else from the XMP
+// packet in the file, else from the EXIF Rating tag. A rating of -1 means
+// rejected, 0 unrated.
+func photoRating(sourcePath string) (int, string) {
+	base := strings.TrimSuffix(sourcePath, filepath.Ext(sourcePath))
+	for _, sidecar := range []string{base + ".xmp", base + ".XMP"} {
+		if data, err := os.ReadFile(sidecar); err == nil {
+			if rating, label, ok := parseXMPRating(data); ok {
+				return rating, label
+			}
+		}
+	}
+
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return 0, ""
+	}
+	defer f.Close()
+	head, err := io.ReadAll(io.LimitReader(f, ratingScanBytes))
+	if err != nil {
+		return 0, ""
+	}
+	if rating, label, ok := parseXMPRating(head); ok {
+		return rating, label
+	}
+	x, err := exif.Decode(bytes.NewReader(head))
+	if err != nil || x.Tiff == nil || len(x.Tiff.Dirs) == 0 {
+		return 0, ""
+	}
+	for _, tag := range x.Tiff.Dirs[0].Tags {
+		if tag.Id == tagRating {
+			if v, err := tag.Int(0); err == nil {
+				return int(int16(v)), ""
+			}
+		}
+	}
+	return 0, ""
+}
+
+// parseXMPRating finds xmp:Rating and xmp:Label in an XMP packet, written
+// either as attributes or as elements.
+func parseXMPRating(data []byte) (int, string, bool) {
+	m := xmpRatingPattern.FindSubmatch(data)
+	l := xmpLabelPattern.FindSubmatch(data)
+	if m == nil && l == nil {
+		return 0, "", false
+	}
+	rating := 0
+	if m != nil {
+		rating, _ = strconv.Atoi(string(m[1]))
+	}
+	label := ""
+	if l != nil {
+		label = strings.TrimSpace(string(l[1]))
+	}
+	return rating, label, true
+}
+
+// rateJobs sets Rating and Label on every job. Cameras that write the
+// rating into only one file of a RAW+JPEG pair, or a RAW whose rating can't
+// be read, give both files the rating found.
+func rateJobs(ctx context.Context, jobs []TransferJob) {
+	slog.Info("Reading in-camera ratings", "files", len(jobs))
+	type rated struct {
+		rating int
+		label  string
+	}
+	siblings := map[string]rated{}
+	for i := range jobs {
+		if ctx.Err() != nil {
+			return
+		}
+		jobs[i].Rating, jobs[i].Label = photoRating(jobs[i].SourcePath)
+		if jobs[i].Rating != 0 || jobs[i].Label != "" {
+			siblings[sequenceKey(jobs[i])] = rated{jobs[i].Rating, jobs[i].Label}
+		}
+	}
+	for i := range jobs {
+		if jobs[i].Rating == 0 && jobs[i].Label == "" {
+			r := siblings[sequenceKey(jobs[i])]
+			jobs[i].Rating, jobs[i].Label = r.rating, r.label
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// errRcloneMissing means a share uses an rclone remote but the rclone
+// command isn't installed.
+var errRcloneMissing = errors.New("rclone is not installed or not on PATH; see https://rclone.org/install/")
+
+// errRemoteChecksum means the remote reports a different checksum for a copy
+// than the bytes that were sent.
+var errRemoteChecksum = errors.New("checksum on the remote differs from the copy")
+
+func (c SMBConfig) isRclone() bool { return strings.TrimSpace(c.Rclone) != "" }
+
+// validateRclone checks an rclone share's remote.
+func validateRclone(share SMBConfig) error {
+	remote := strings.TrimSpace(share.Rclone)
+	switch {
+	case !strings.Contains(remote, ":"):
+		return fmt.Errorf("%q is not an rclone remote like b2:bucket/photos", share.Rclone)
+	case strings.HasPrefix(remote, "-"):
+		return fmt.Errorf("%q is not an rclone remote", share.Rclone)
+	}
+	return nil
+}
+
+// rcloneRemote runs the rclone command against one remote. The remote is
+// configured in rclone itself (rclone config); SnapVault only adds paths
+// under it.
+type rcloneRemote struct {
+	bin    string
+	remote string // like "b2:bucket/photos", without a trailing slash
+}
+
+func newRcloneRemote(cfg SMBConfig) (*rcloneRemote, error) {
+	bin, err := exec.LookPath("rclone")
+	if err != nil {
+		return nil, errRcloneMissing
+	}
+	remote := strings.TrimSpace(cfg.Rclone)
+	if !strings.HasSuffix(remote, ":") {
+		remote = strings.TrimRight(remote, "/")
+	}
+	return &rcloneRemote{bin: bin, remote: remote}, nil
+}
+
+// path is p, slash-separated and relative to the remote, as rclone names it.
+func (r *rcloneRemote) path(p string) string {
+	p = strings.TrimPrefix(p, "/")
+	if strings.HasSuffix(r.remote, ":") {
+		return r.remote + p
+	}
+	return r.remote + "/" + p
+}
+
+// run runs rclone with args, returning its output. A failure carries the
+// last line rclone printed, which is its error message.
+func (r *rcloneRemote) run(ctx context.Context, stdin io.Reader, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, r.bin, args...)
+	cmd.Stdin = stdin
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		if msg := strings.TrimSpace(lines[len(lines)-1]); msg != "" {
+			return nil, fmt.Errorf("rclone %s: %s", args[0], msg)
+		}
+		return nil, fmt.Errorf("rclone %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// rcloneEntry is one object as rclone lsjson describes it.
+type rcloneEntry struct {
+	Size    int64             `json:"Size"`
+	ModTime time.Time         `json:"ModTime"`
+	IsDir   bool              `json:"IsDir"`
+	Hashes  map[string]string `json:"Hashes"`
+}
+
+// stat describes p on the remote, with the hashes the backend has at hand
+// when withHashes is set. A missing object is an os.ErrNotExist.
+func (r *rcloneRemote) stat(ctx context.Context, p string, withHashes bool) (rcloneEntry, error) {
+	args := []string{"lsjson", "--stat", "--no-mimetype"}
+	if withHashes {
+		args = append(args, "--hash")
+	}
+	out, err := r.run(ctx, nil, append(args, r.path(p))...)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return rcloneEntry{}, fmt.Errorf("%s: %w", p, os.ErrNotExist)
+		}
+		return rcloneEntry{}, err
+	}
+	var e rcloneEntry
+	if err := json.Unmarshal(out, &e); err != nil {
+		return rcloneEntry{}, fmt.Errorf("reading rclone lsjson output: %w", err)
+	}
+	return e, nil
+}
+
+func (r *rcloneRemote) kind() string { return "rclone" }
+
+func (r *rcloneRemote) exists(ctx context.Context, p string) (bool, error) {
+	_, err := r.stat(ctx, p, false)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// remove deletes p from the remote.
+func (r *rcloneRemote) remove(ctx context.Context, p string) error {
+	_, err := r.run(ctx, nil, "deletefile", r.path(p))
+	return err
+}
+
+// removePartial is the rclone counterpart of removePartial.
+func (r *rcloneRemote) removePartial(p string) {
+	ctx, cancel := context.WithTimeout(context.Background(), partialCleanupTimeout)
+	defer cancel()
+	if _, err := r.stat(ctx, p, false); errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err := r.remove(ctx, p); err != nil {
+		slog.Warn("Failed to remove partial copy", "path", r.path(p), "error", err)
+	}
+}
+
+// rcloneHashNames maps SnapVault's checksum algorithms to rclone's names for
+// them, for backends that can report one.
+var rcloneHashNames = map[string]string{hashSHA256: "sha256"}
+
+// transfer is transferToSMB for an rclone share. The file is streamed
+// to rclone rcat, through the same edits, checksum and bandwidth limit as an
+// SMB copy, and the object is then checked on the remote: its size always,
+// and its checksum when the backend reports the one the share uses.
+func (rc *rcloneRemote) transfer(ctx context.Context, sourcePath, destPath string, conn *SMBConnection) (copyResult, error) {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: %w", errSourceRead, err)
+	}
+	src, err := os.Open(sourcePath)
+	if err != nil {
+		return copyResult{}, fmt.Errorf("%w: opening source file: %w", errSourceRead, err)
+	}
+	defer src.Close()
+
+	slog.Debug("Copying file to rclone remote", "source", filepath.Base(sourcePath), "destination", rc.path(destPath))
+	h := newHasher(conn.hashAlg)
+	r := newJPEGEditReader(contextReader{ctx, sourceReader{src}}, shareJPEGEdit(conn, sourcePath))
+	pr, pw := io.Pipe()
+	copied := make(chan int64, 1)
+	go func() {
+		n, err := io.Copy(io.MultiWriter(conn.limiter.writer(ctx, pw), h), r)
+		pw.CloseWithError(err)
+		copied <- n
+	}()
+	_, err = rc.run(ctx, pr, "rcat", rc.path(destPath))
+	// Unblocks the copy when rclone stopped reading early.
+	pr.CloseWithError(io.ErrClosedPipe)
+	written := <-copied
+	if err != nil {
+		if errors.Is(err, errSourceRead) || ctx.Err() != nil {
+			rc.removePartial(destPath)
+		}
+		return copyResult{}, fmt.Errorf("copying file: %w", err)
+	}
+	if written-r.grown != info.Size() {
+		rc.removePartial(destPath)
+		return copyResult{}, fmt.Errorf("%w: wrote %d bytes, source is %d bytes", errSizeMismatch, written-r.grown, info.Size())
+	}
+
+	sum := h.Sum(nil)
+	name := rcloneHashNames[conn.hashAlg]
+	e, err := rc.stat(ctx, destPath, name != "")
+	if err != nil {
+		return copyResult{}, fmt.Errorf("checking copy: %w", err)
+	}
+	if e.Size != written {
+		return copyResult{}, fmt.Errorf("%w: remote has %d bytes, %d were sent", errSizeMismatch, e.Size, written)
+	}
+	if remote := e.Hashes[name]; remote != "" && !strings.EqualFold(remote, hex.EncodeToString(sum)) {
+		return copyResult{}, fmt.Errorf("%w (%s)", errRemoteChecksum, name)
+	}
+	return copyResult{DestPath: path.Clean(destPath), Sum: sum, Algorithm: conn.hashAlg}, nil
+}
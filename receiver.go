@@ -0,0 +1,579 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FTPReceiverConfig configures the camera upload receiver (-receive-ftp).
+type FTPReceiverConfig struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"` // supports ${ENV} expansion
+	// Optional explicit FTPS (AUTH TLS). Both must be set to enable it.
+	TLSCert string `yaml:"tls_cert,omitempty"`
+	TLSKey  string `yaml:"tls_key,omitempty"`
+	// Optional passive data port range, e.g. 50000-50100, for firewalled hosts.
+	PassivePorts string `yaml:"passive_ports,omitempty"`
+}
+
+// minFTPPassword is the shortest ftp_receiver password accepted. It is
+// shorter than minUploadToken because it is typed into camera menus.
+const minFTPPassword = 12
+
+// ftpReceiver accepts files pushed by cameras over FTP and fans each one out to
+// every SMB share using the same foldering as a card import.
+type ftpReceiver struct {
+	*liveArchiver
+	cfg       FTPReceiverConfig
+	tlsConfig *tls.Config
+	pasvMin   int
+	pasvMax   int
+}
+
+// liveArchiver fans single files out to every share as they arrive, for the
+// modes that archive during a shoot rather than from a whole card.
+type liveArchiver struct {
+	folderName  string
+	connections []*SMBConnection
+	layout      *folderLayout
+	router      *shareRouter
+	collector   *reportCollector
+	catalog     *Config
+	replacement string // filename_replacement
+	nameForm    string // unicode_normalization
+
+	mu       sync.Mutex
+	received int
+	errs     []TransferError
+}
+
+func newLiveArchiver(ctx context.Context, cfg *Config, folderName, source string, connections []*SMBConnection) (*liveArchiver, error) {
+	layout, err := newFolderLayout(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &liveArchiver{
+		folderName:  folderName,
+		connections: connections,
+		layout:      layout,
+		router:      newShareRouter(ctx, connections),
+		collector:   newReportCollector(folderName, source, cfg.Quorum),
+		catalog:     cfg,
+		replacement: cfg.FilenameReplacement,
+		nameForm:    cfg.UnicodeNormalization,
+	}, nil
+}
+
+// finish closes the shares' archives, taking back the files of any that
+// could not be completed, and returns the run's report.
+func (r *liveArchiver) finish() *transferReport {
+	hook := r.collector.hook(nil)
+	for _, conn := range r.connections {
+		if conn.archives == nil {
+			continue
+		}
+		for _, e := range closeArchives(conn) {
+			hook.OnShareRetracted(e.share, e.source, e.bytes, e.err)
+			r.mu.Lock()
+			r.errs = append(r.errs, TransferError{FilePath: e.source, Share: e.share, Error: e.err})
+			r.mu.Unlock()
+		}
+	}
+	r.router.savePlacements(r.catalog)
+	r.mu.Lock()
+	errs := append([]TransferError(nil), r.errs...)
+	r.mu.Unlock()
+	return r.collector.build(nil, errs)
+}
+
+func runFTPReceiver(ctx context.Context, addr string, cfg *Config, folderName string, connections []*SMBConnection) (*transferReport, error) {
+	if cfg.FTPReceiver == nil || cfg.FTPReceiver.Username == "" {
+		return nil, errors.New("ftp_receiver.username must be set in config")
+	}
+	// Anyone who can reach the port and knows the user name could otherwise
+	// upload into the shares.
+	password := os.ExpandEnv(cfg.FTPReceiver.Password)
+	if len(password) < minFTPPassword {
+		return nil, fmt.Errorf("ftp_receiver.password must be set in config, at least %d characters", minFTPPassword)
+	}
+	live, err := newLiveArchiver(ctx, cfg, folderName, "ftp://"+addr, connections)
+	if err != nil {
+		return nil, err
+	}
+	r := &ftpReceiver{liveArchiver: live, cfg: *cfg.FTPReceiver}
+	r.cfg.Password = password
+	if r.cfg.TLSCert != "" && r.cfg.TLSKey != "" {
+		cert, err := tls.LoadX509KeyPair(r.cfg.TLSCert, r.cfg.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("loading FTPS certificate: %w", err)
+		}
+		r.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	if r.cfg.PassivePorts != "" {
+		lo, hi, ok := strings.Cut(r.cfg.PassivePorts, "-")
+		first, err1 := strconv.Atoi(strings.TrimSpace(lo))
+		last, err2 := strconv.Atoi(strings.TrimSpace(hi))
+		if !ok || err1 != nil || err2 != nil || first <= 0 || last < first || last > 65535 {
+			return nil, fmt.Errorf("invalid ftp_receiver.passive_ports %q", r.cfg.PassivePorts)
+		}
+		r.pasvMin, r.pasvMax = first, last
+	}
+
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening for FTP: %w", err)
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+
+	slog.Info("FTP receiver listening", "addr", addr, "folder", folderName, "ftps", r.tlsConfig != nil)
+	fmt.Printf("\n  📡 Receiving camera uploads on ftp://%s into %q\n  Press Ctrl+C to stop.\n\n", addr, folderName)
+
+	var wg sync.WaitGroup
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			return nil, fmt.Errorf("accepting FTP connection: %w", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.serve(ctx, conn)
+		}()
+	}
+	wg.Wait()
+	return r.finish(), nil
+}
+
+// ftpSession is the state of one control connection.
+type ftpSession struct {
+	r        *ftpReceiver
+	ctrl     net.Conn
+	rw       *bufio.ReadWriter
+	user     string
+	authed   bool
+	secure   bool // control connection upgraded by AUTH TLS
+	cwd      string
+	protData bool // PROT P: wrap data connections in TLS
+	pasv     net.Listener
+	port     string // active-mode target from PORT
+}
+
+func (r *ftpReceiver) serve(ctx context.Context, conn net.Conn) {
+	s := &ftpSession{r: r, ctrl: conn, cwd: "/"}
+	s.setConn(conn)
+	defer func() {
+		s.closePasv()
+		s.ctrl.Close()
+	}()
+	slog.Info("FTP client connected", "remote", conn.RemoteAddr())
+
+	s.reply(220, "SnapVault FTP receiver ready")
+	for {
+		_ = s.ctrl.SetReadDeadline(time.Now().Add(10 * time.Minute))
+		line, err := s.rw.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if ctx.Err() != nil {
+			s.reply(421, "Service shutting down")
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimRight(line, "\r\n"), " ")
+		if !s.handle(ctx, strings.ToUpper(cmd), arg) {
+			return
+		}
+	}
+}
+
+func (s *ftpSession) setConn(c net.Conn) {
+	s.ctrl = c
+	s.rw = bufio.NewReadWriter(bufio.NewReader(c), bufio.NewWriter(c))
+}
+
+func (s *ftpSession) reply(code int, msg string) {
+	fmt.Fprintf(s.rw, "%d %s\r\n", code, msg)
+	s.rw.Flush()
+}
+
+// handle runs one command; it returns false when the session should end.
+func (s *ftpSession) handle(ctx context.Context, cmd, arg string) bool {
+	// Commands allowed before login.
+	switch cmd {
+	case "AUTH":
+		if s.r.tlsConfig == nil || !strings.EqualFold(arg, "TLS") {
+			s.reply(504, "AUTH not supported")
+			return true
+		}
+		s.reply(234, "Proceed with TLS")
+		tlsConn := tls.Server(s.ctrl, s.r.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			slog.Warn("FTPS handshake failed", "error", err)
+			return false
+		}
+		s.setConn(tlsConn)
+		s.secure = true
+		return true
+	case "USER":
+		s.user = arg
+		s.reply(331, "Password required")
+		return true
+	case "PASS":
+		// With FTPS configured, don't let a misconfigured camera send the
+		// password in the clear.
+		if s.r.tlsConfig != nil && !s.secure {
+			s.reply(530, "Use AUTH TLS before logging in")
+			return true
+		}
+		userOK := subtle.ConstantTimeCompare([]byte(s.user), []byte(s.r.cfg.Username)) == 1
+		passOK := subtle.ConstantTimeCompare([]byte(arg), []byte(s.r.cfg.Password)) == 1
+		if userOK && passOK {
+			s.authed = true
+			s.reply(230, "Logged in")
+		} else {
+			s.reply(530, "Login incorrect")
+		}
+		return true
+	case "QUIT":
+		s.reply(221, "Goodbye")
+		return false
+	case "FEAT":
+		feats := []string{"211-Features:", " PASV", " EPSV", " UTF8"}
+		if s.r.tlsConfig != nil {
+			feats = append(feats, " AUTH TLS", " PBSZ", " PROT")
+		}
+		fmt.Fprintf(s.rw, "%s\r\n211 End\r\n", strings.Join(feats, "\r\n"))
+		s.rw.Flush()
+		return true
+	case "SYST":
+		s.reply(215, "UNIX Type: L8")
+		return true
+	case "NOOP":
+		s.reply(200, "OK")
+		return true
+	case "OPTS":
+		s.reply(200, "OK")
+		return true
+	case "PBSZ":
+		s.reply(200, "PBSZ=0")
+		return true
+	case "PROT":
+		s.protData = strings.EqualFold(arg, "P")
+		s.reply(200, "Protection level set")
+		return true
+	}
+
+	if !s.authed {
+		s.reply(530, "Please login with USER and PASS")
+		return true
+	}
+
+	switch cmd {
+	case "PWD", "XPWD":
+		s.reply(257, fmt.Sprintf("%q is the current directory", s.cwd))
+	case "CWD", "XCWD":
+		s.cwd = s.resolve(arg)
+		s.reply(250, "Directory changed")
+	case "CDUP", "XCUP":
+		s.cwd = path.Dir(s.cwd)
+		s.reply(250, "Directory changed")
+	case "MKD", "XMKD":
+		// Directories are virtual; the destination layout is SnapVault's own.
+		s.reply(257, fmt.Sprintf("%q created", s.resolve(arg)))
+	case "TYPE", "MODE", "STRU", "ALLO":
+		s.reply(200, "OK")
+	case "SIZE", "MDTM", "RETR":
+		s.reply(550, "File not available")
+	case "DELE", "RMD", "RNFR", "RNTO", "SITE":
+		s.reply(502, "Command not implemented")
+	case "PASV":
+		s.enterPassive(false)
+	case "EPSV":
+		s.enterPassive(true)
+	case "PORT":
+		s.setActive(arg)
+	case "LIST", "NLST", "MLSD":
+		s.sendListing()
+	case "STOR":
+		s.store(ctx, arg)
+	default:
+		s.reply(502, "Command not implemented")
+	}
+	return true
+}
+
+func (s *ftpSession) resolve(p string) string {
+	if p == "" {
+		return s.cwd
+	}
+	if !strings.HasPrefix(p, "/") {
+		p = path.Join(s.cwd, p)
+	}
+	return path.Clean(p)
+}
+
+func (s *ftpSession) closePasv() {
+	if s.pasv != nil {
+		s.pasv.Close()
+		s.pasv = nil
+	}
+}
+
+func (s *ftpSession) enterPassive(extended bool) {
+	s.closePasv()
+	s.port = ""
+	host, _, _ := net.SplitHostPort(s.ctrl.LocalAddr().String())
+
+	var ln net.Listener
+	var err error
+	if s.r.pasvMin > 0 {
+		for p := s.r.pasvMin; p <= s.r.pasvMax; p++ {
+			if ln, err = net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(p))); err == nil {
+				break
+			}
+		}
+	} else {
+		ln, err = net.Listen("tcp", net.JoinHostPort(host, "0"))
+	}
+	if err != nil || ln == nil {
+		s.reply(425, "Cannot open passive connection")
+		return
+	}
+	s.pasv = ln
+	port := ln.Addr().(*net.TCPAddr).Port
+
+	if extended {
+		s.reply(229, fmt.Sprintf("Entering Extended Passive Mode (|||%d|)", port))
+		return
+	}
+	ip := net.ParseIP(host).To4()
+	if ip == nil {
+		s.reply(425, "PASV requires IPv4; use EPSV")
+		return
+	}
+	s.reply(227, fmt.Sprintf("Entering Passive Mode (%d,%d,%d,%d,%d,%d)", ip[0], ip[1], ip[2], ip[3], port>>8, port&0xff))
+}
+
+// setActive takes a PORT target. Only the client's own address is
+// accepted, so the receiver can't be used to connect to other hosts (an FTP
+// bounce).
+func (s *ftpSession) setActive(arg string) {
+	parts := strings.Split(arg, ",")
+	if len(parts) != 6 {
+		s.reply(501, "Invalid PORT")
+		return
+	}
+	hi, err1 := strconv.Atoi(parts[4])
+	lo, err2 := strconv.Atoi(parts[5])
+	ip := net.ParseIP(strings.Join(parts[:4], "."))
+	if err1 != nil || err2 != nil || ip == nil || hi < 0 || hi > 255 || lo < 0 || lo > 255 {
+		s.reply(501, "Invalid PORT")
+		return
+	}
+	if peer, ok := s.ctrl.RemoteAddr().(*net.TCPAddr); !ok || !peer.IP.Equal(ip) {
+		slog.Warn("Refused PORT to another host", "remote", s.ctrl.RemoteAddr(), "target", ip)
+		s.reply(500, "PORT must name the client's own address")
+		return
+	}
+	s.closePasv()
+	s.port = net.JoinHostPort(ip.String(), strconv.Itoa(hi<<8|lo))
+	s.reply(200, "PORT command successful")
+}
+
+// dataConn opens the data connection negotiated by PASV/EPSV or PORT.
+func (s *ftpSession) dataConn() (net.Conn, error) {
+	var conn net.Conn
+	var err error
+	switch {
+	case s.pasv != nil:
+		if tl, ok := s.pasv.(*net.TCPListener); ok {
+			_ = tl.SetDeadline(time.Now().Add(30 * time.Second))
+		}
+		conn, err = s.pasv.Accept()
+		s.closePasv()
+	case s.port != "":
+		conn, err = net.DialTimeout("tcp", s.port, 30*time.Second)
+	default:
+		return nil, errors.New("use PASV or PORT first")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.protData && s.r.tlsConfig != nil {
+		tlsConn := tls.Server(conn, s.r.tlsConfig)
+		if err := tlsConn.Handshake(); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	}
+	return conn, nil
+}
+
+// sendListing answers directory listings with an empty directory; cameras only
+// list to probe that the server works.
+func (s *ftpSession) sendListing() {
+	s.reply(150, "Opening data connection")
+	conn, err := s.dataConn()
+	if err != nil {
+		s.reply(425, "Cannot open data connection")
+		return
+	}
+	conn.Close()
+	s.reply(226, "Transfer complete")
+}
+
+// store receives one upload into a private temp dir (so EXIF can be read and the
+// size verified) and then fans it out to every share before acknowledging.
+func (s *ftpSession) store(ctx context.Context, arg string) {
+	name := path.Base(s.resolve(arg))
+	if name == "/" || name == "." || isSystemMetadata(name) {
+		s.reply(553, "File name not allowed")
+		return
+	}
+
+	s.reply(150, "Ok to send data")
+	conn, err := s.dataConn()
+	if err != nil {
+		s.reply(425, "Cannot open data connection")
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp("", "snapvault-ftp-")
+	if err != nil {
+		conn.Close()
+		s.reply(451, "Local error")
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpPath := filepath.Join(tmpDir, name)
+	f, err := os.Create(tmpPath)
+	if err != nil {
+		conn.Close()
+		s.reply(451, "Local error")
+		return
+	}
+	_, copyErr := io.Copy(f, conn)
+	conn.Close()
+	closeErr := f.Close()
+	if copyErr != nil || closeErr != nil {
+		s.reply(426, "Transfer aborted")
+		return
+	}
+
+	if !photoExtensions[strings.ToLower(filepath.Ext(name))] {
+		slog.Warn("Ignoring uploaded file with unsupported extension", "file", name)
+		s.reply(226, "Transfer complete (ignored: unsupported type)")
+		return
+	}
+
+	if err := s.r.fanOut(ctx, tmpPath); err != nil {
+		s.reply(451, fmt.Sprintf("Archiving failed: %v", err))
+		return
+	}
+	s.reply(226, "Transfer complete")
+}
+
+// fanOut copies filePath to every share, into the folder its date gives it,
+// and to one member of each overflow group, as an import would.
+func (r *liveArchiver) fanOut(ctx context.Context, filePath string) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	photoDate, dateErr := getPhotoDate(filePath, info)
+	if dateErr != nil {
+		photoDate = info.ModTime()
+	}
+
+	job := TransferJob{SourcePath: filePath, PhotoDate: photoDate}
+	if r.layout.usesLocation() {
+		job.Location = photoLocation(filePath)
+	}
+	if names := r.layout.photographerNames(); names != nil {
+		job.Photographer = photographerOf(names, filePath)
+	}
+	if hasSelectsShare(r.connections) {
+		job.Rating, job.Label = photoRating(filePath)
+	}
+	subDir, err := r.layout.dir(job)
+	if err != nil {
+		return err
+	}
+	subDir = sanitizeDir(normalizeName(subDir, r.nameForm), r.replacement)
+
+	hook := r.collector.hook(nil)
+	normal := normalizeName(filepath.Base(filePath), r.nameForm)
+	if normal != filepath.Base(filePath) {
+		job.DestName = normal
+	}
+	if name := sanitizeName(normal, r.replacement); name != normal {
+		job.DestName = name
+		slog.Info("Renamed file the shares can't store as-is", "file", filePath, "stored_as", path.Join(subDir, name))
+		hook.OnRenamed([]renamedFile{{Path: filePath, Stored: path.Join(subDir, name)}})
+	}
+
+	var failed []string
+	for _, target := range r.router.targets {
+		if !target.members[0].Config.Selects.accepts(job) {
+			continue
+		}
+		conn, err := r.router.pick(target, info.Size())
+		if err == nil {
+			var res copyResult
+			res, err = transferToSMB(ctx, filePath, job.DestName, r.folderName, subDir, conn)
+			if err == nil {
+				r.router.place(target, conn, res)
+			}
+		}
+		hook.OnShareResult(target.label(), filePath, info.Size(), err)
+		if err != nil {
+			slog.Error("Failed to archive file", "file", filepath.Base(filePath), "destination", target.label(), "error", err)
+			failed = append(failed, target.label())
+			r.mu.Lock()
+			r.errs = append(r.errs, TransferError{FilePath: filePath, Share: target.label(), Error: err})
+			r.mu.Unlock()
+		}
+	}
+	if isJPEG(filePath) {
+		preview := job
+		preview.FolderName, preview.DestDir = r.folderName, subDir
+		for _, conn := range r.router.previews {
+			if _, err := transferPreview(ctx, preview, conn); err != nil {
+				slog.Warn("Failed to write preview", "file", filepath.Base(filePath), "share", shareLabel(conn.Config), "error", err)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	r.received++
+	n := r.received
+	r.mu.Unlock()
+	hook.OnProgress(n, n, filePath)
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d share(s) failed: %s", len(failed), strings.Join(failed, ", "))
+	}
+	slog.Info("Archived file", "file", filepath.Base(filePath), "destinations", len(r.router.targets))
+	return nil
+}
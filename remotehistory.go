@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// remoteMetaDir is SnapVault's folder at each share's base path. Its
+// imports/ folder holds one remoteImport per run that wrote to the share, so
+// any machine can tell what is already there without the local catalog.
+const remoteMetaDir = ".snapvault"
+
+// remoteHistoryTimeout bounds writing the import record once copying has
+// stopped, which may be because the run was cancelled.
+const remoteHistoryTimeout = 30 * time.Second
+
+// remoteImport is the record of one run on one share, written to
+// .snapvault/imports/<run id>.json.
+type remoteImport struct {
+	ID      string    `json:"id"`
+	Shoot   string    `json:"shoot"`
+	Machine string    `json:"machine,omitempty"`
+	Cards   []string  `json:"cards,omitempty"`
+	Started time.Time `json:"started"`
+	Ended   time.Time `json:"ended"`
+	Files   int       `json:"files"`
+	Bytes   int64     `json:"bytes"`
+
+	share string // label of the share it was read from
+}
+
+// remoteImportsDir is the share-relative folder of conn's import records.
+func remoteImportsDir(conn *SMBConnection) string {
+	return shootRoot(conn, remoteMetaDir+"/imports")
+}
+
+// publishRemoteImport writes j's record to every share that received files.
+// A share that can't take it is logged and skipped: the copies are what
+// matter.
+func publishRemoteImport(connections []*SMBConnection, j *runJournal) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	base := remoteImport{ID: j.ID, Shoot: j.Folder, Cards: j.Cards, Started: j.StartedAt, Ended: j.EndedAt}
+	perShare := map[string]*remoteImport{}
+	for _, f := range j.Files {
+		rec := perShare[f.ShareKey]
+		if rec == nil {
+			copied := base
+			rec = &copied
+			perShare[f.ShareKey] = rec
+		}
+		rec.Files++
+		rec.Bytes += f.Size
+	}
+	j.mu.Unlock()
+	if len(perShare) == 0 {
+		return
+	}
+
+	machine, _ := os.Hostname()
+	ctx, cancel := context.WithTimeout(context.Background(), remoteHistoryTimeout)
+	defer cancel()
+	for _, conn := range connections {
+		rec := perShare[smbShareKey(conn.Config)]
+		if rec == nil || conn.Config.isEncrypted() || conn.cloud != nil {
+			// An encrypted share must not learn the shoot's name, and a
+			// cloud share has no room for the history.
+			continue
+		}
+		rec.Machine = machine
+		if rec.Ended.IsZero() {
+			rec.Ended = time.Now()
+		}
+		if err := writeRemoteImport(ctx, conn, rec); err != nil {
+			slog.Warn("Failed to record import on share", "share", shareLabel(conn.Config), "error", err)
+		}
+	}
+}
+
+func writeRemoteImport(ctx context.Context, conn *SMBConnection, rec *remoteImport) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	fs := conn.Share.WithContext(ctx)
+	dir := remoteImportsDir(conn)
+	if err := fs.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("creating %s: %w", dir, err)
+	}
+	return fs.WriteFile(path.Join(dir, rec.ID+".json"), data, 0o644)
+}
+
+// readRemoteImports returns the import records on conn. A share without any
+// yields none, not an error, as does a cloud share; unreadable records are
+// skipped.
+func readRemoteImports(ctx context.Context, conn *SMBConnection) ([]*remoteImport, error) {
+	if conn.cloud != nil {
+		return nil, nil
+	}
+	fs := conn.Share.WithContext(ctx)
+	dir := remoteImportsDir(conn)
+	entries, err := fs.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", dir, err)
+	}
+	var out []*remoteImport
+	for _, e := range entries {
+		if e.IsDir() || path.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := fs.ReadFile(path.Join(dir, e.Name()))
+		if err != nil {
+			slog.Debug("Skipping unreadable import record", "share", shareLabel(conn.Config), "file", e.Name(), "error", err)
+			continue
+		}
+		rec := &remoteImport{share: shareLabel(conn.Config)}
+		if err := json.Unmarshal(data, rec); err != nil {
+			slog.Debug("Skipping unreadable import record", "share", shareLabel(conn.Config), "file", e.Name(), "error", err)
+			continue
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+// removeRemoteImport deletes run id's record from conn, for undo.
+func removeRemoteImport(ctx context.Context, conn *SMBConnection, id string) {
+	err := conn.Share.WithContext(ctx).Remove(path.Join(remoteImportsDir(conn), id+".json"))
+	if err != nil && !os.IsNotExist(err) {
+		slog.Warn("Failed to remove import record", "share", shareLabel(conn.Config), "run", id, "error", err)
+	}
+}
+
+// remoteImportsByRun reads the records on every share and merges them by run,
+// newest first. Each record's share lists every share that holds it, and
+// its counts are those of the share that received the most.
+func remoteImportsByRun(ctx context.Context, connections []*SMBConnection) []*remoteImport {
+	byID := map[string]*remoteImport{}
+	for _, conn := range connections {
+		recs, err := readRemoteImports(ctx, conn)
+		if err != nil {
+			slog.Warn("Failed to read import history on share", "share", shareLabel(conn.Config), "error", err)
+			continue
+		}
+		for _, rec := range recs {
+			if seen := byID[rec.ID]; seen != nil {
+				seen.share += ", " + rec.share
+				if rec.Files > seen.Files {
+					seen.Files, seen.Bytes = rec.Files, rec.Bytes
+				}
+				continue
+			}
+			byID[rec.ID] = rec
+		}
+	}
+	out := make([]*remoteImport, 0, len(byID))
+	for _, rec := range byID {
+		out = append(out, rec)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Started.After(out[b].Started) })
+	return out
+}
+
+// warnRemoteImports logs earlier imports, found on the shares but unknown to
+// the local journals, into the same shoot folder or from the same cards:
+// the sign that another machine already offloaded them.
+func warnRemoteImports(ctx context.Context, cfg *Config, connections []*SMBConnection, folder string, cards []string) {
+	local := map[string]bool{}
+	journals, err := loadJournals(cfg)
+	if err != nil {
+		slog.Debug("Run journals unavailable", "error", err)
+	}
+	for _, j := range journals {
+		local[j.ID] = true
+	}
+	ours := map[string]bool{}
+	for _, id := range cards {
+		ours[id] = true
+	}
+	for _, rec := range remoteImportsByRun(ctx, connections) {
+		if local[rec.ID] {
+			continue
+		}
+		sameCard := false
+		for _, id := range rec.Cards {
+			sameCard = sameCard || ours[id]
+		}
+		switch {
+		case sameCard:
+			slog.Warn("This card was already imported from another machine",
+				"shoot", rec.Shoot, "machine", rec.Machine, "imported", rec.Started.Format(time.DateTime), "files", rec.Files, "shares", rec.share)
+		case strings.EqualFold(rec.Shoot, folder):
+			slog.Warn("This shoot already exists on the shares from another machine",
+				"machine", rec.Machine, "imported", rec.Started.Format(time.DateTime), "files", rec.Files, "shares", rec.share)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// runRepairCommand heals a shoot folder by copying missing or damaged files
+// from a share that holds a good copy, so a partially failed import can be
+// fixed long after the card has been formatted.
+func runRepairCommand(args []string) int {
+	fs := flag.NewFlagSet("repair", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	name := fs.String("name", "", `Shoot folder to repair, as it appears on the shares (e.g. "2025 - Smith Wedding")`)
+	deep := fs.Bool("deep", false, "Also re-hash every copy against its checksum manifest (reads all files over the network)")
+	dryRun := fs.Bool("dry-run", false, "Show what would be copied without changing anything")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault repair -name <shoot folder> [-deep] [-dry-run]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	folder := strings.TrimSpace(*name)
+	if folder == "" {
+		fs.Usage()
+		return 2
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	_, connections, err := common.connectAll(ctx)
+	if err != nil {
+		slog.Error("Failed to connect to shares", "error", err)
+		return 1
+	}
+	defer closeConnections(connections)
+	if len(connections) < 2 {
+		slog.Error("Repair needs at least two shares to copy between")
+		return 1
+	}
+
+	invs, err := inventoryAll(ctx, connections, folder)
+	if err != nil {
+		slog.Error("Failed to list shoot folder", "error", err)
+		return 1
+	}
+	verdicts, err := compareInventories(ctx, invs, compareOptions{Manifest: *deep})
+	if err != nil {
+		slog.Error("Failed to compare shares", "error", err)
+		return 1
+	}
+
+	repaired, failed, unrecoverable := 0, 0, 0
+	for _, v := range verdicts {
+		if v.healthy() {
+			continue
+		}
+		if len(v.Good) == 0 {
+			unrecoverable++
+			fmt.Printf("UNRECOVERABLE %s: no share has a good copy\n", v.Path)
+			continue
+		}
+		// Repair from an untouched copy, so metadata a share strips isn't
+		// lost on the others.
+		source := invs[v.Good[0]]
+		for _, i := range v.Good {
+			if shareScrub(invs[i].conn.Config, v.Path) == scrubNone {
+				source = invs[i]
+				break
+			}
+		}
+		targets := append([]int(nil), v.Missing...)
+		for i := range v.Corrupt {
+			targets = append(targets, i)
+		}
+		for _, i := range targets {
+			target := invs[i]
+			reason := "missing"
+			if r, ok := v.Corrupt[i]; ok {
+				reason = r
+			}
+			action := fmt.Sprintf("%s: %s -> %s (%s)", v.Path, shareLabel(source.conn.Config), shareLabel(target.conn.Config), reason)
+			if *dryRun {
+				fmt.Println("would copy", action)
+				continue
+			}
+			if err := copyBetweenShares(ctx, source, target, v.Path, v.Size, nil); err != nil {
+				failed++
+				fmt.Printf("FAILED %s: %v\n", action, err)
+				continue
+			}
+			repaired++
+			fmt.Println("repaired", action)
+		}
+	}
+
+	fmt.Printf("\n%d files checked on %d shares: %d repaired, %d failed, %d unrecoverable\n",
+		len(verdicts), len(invs), repaired, failed, unrecoverable)
+	if len(verdicts) == 0 {
+		fmt.Fprintf(os.Stderr, "No files found under %q on any share; check the folder name.\n", folder)
+		return 1
+	}
+	if failed > 0 || unrecoverable > 0 {
+		return 1
+	}
+	return 0
+}
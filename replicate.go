@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runReplicateCommand copies already-imported shoots from one share to
+// others, through this machine, so the slow offsite copy can run overnight
+// after a fast import to the local NAS. Files the target already holds at
+// the same size are skipped, so an interrupted run picks up where it stopped.
+func runReplicateCommand(args []string) int {
+	fs := flag.NewFlagSet("replicate", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	var names []string
+	fs.Func("name", `Shoot folder to replicate (e.g. "2026 - Smith Wedding"); repeatable`, func(v string) error {
+		if v = strings.TrimSpace(v); v != "" {
+			names = append(names, v)
+		}
+		return nil
+	})
+	since := fs.String("since", "", `Also replicate every shoot this machine imported within this age, e.g. "24h" or "7d"`)
+	from := fs.String("from", "", "Share to copy from, by name or host/share")
+	var to listFlag
+	fs.Var(&to, "to", "Shares to copy to; repeat or comma-separate")
+	dryRun := fs.Bool("dry-run", false, "Show what would be copied without changing anything")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault replicate -from <share> -to <share> (-name <shoot folder> | -since 24h) [-dry-run]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *from == "" || len(to) == 0 || (len(names) == 0 && *since == "") {
+		fs.Usage()
+		return exitUsage
+	}
+	var cutoff time.Time
+	if *since != "" {
+		var err error
+		if cutoff, err = parseAge(*since); err != nil {
+			fmt.Fprintf(os.Stderr, "-since: %v\n", err)
+			return exitUsage
+		}
+	}
+
+	// Connect to just these shares, including one disabled for imports,
+	// such as an offsite NAS.
+	*common.onlyShares = append(*common.onlyShares, *from)
+	*common.onlyShares = append(*common.onlyShares, to...)
+
+	ctx, stop := commandContext()
+	defer stop()
+	config, connections, err := common.connectAll(ctx)
+	if err != nil {
+		slog.Error("Failed to connect to shares", "error", err)
+		return connectExitCode(err)
+	}
+	defer closeConnections(connections)
+
+	source, targets, err := replicationShares(connections, *from, to)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitUsage
+	}
+	if !cutoff.IsZero() {
+		journals, err := loadJournals(config)
+		if err != nil {
+			slog.Error("Failed to read run journals", "error", err)
+			return 1
+		}
+		names = append(names, shootsSince(journals, cutoff)...)
+	}
+	names = uniqueStrings(names)
+	if len(names) == 0 {
+		fmt.Println("No shoots to replicate.")
+		return 0
+	}
+
+	manifests, err := newManifestWriter(config.ChecksumManifest)
+	if err != nil {
+		slog.Error("Invalid config", "error", err)
+		return exitConfig
+	}
+	var copied, failed int
+	for _, folder := range names {
+		c, f, err := replicateShoot(ctx, config, folder, source, targets, manifests, *dryRun)
+		copied += c
+		failed += f
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			slog.Error("Failed to replicate shoot", "folder", folder, "error", err)
+			failed++
+		}
+	}
+	if manifests != nil {
+		manifests.flush()
+	}
+
+	if *dryRun {
+		return 0
+	}
+	fmt.Printf("\n%d shoot(s): %d files copied, %d failed\n", len(names), copied, failed)
+	switch {
+	case ctx.Err() != nil:
+		return exitCancelled
+	case failed > 0:
+		return exitPartial
+	}
+	return 0
+}
+
+// replicationShares picks the source and target connections by name. Only
+// complete copies qualify: an overflow group member holds part of a shoot
+// and a preview share holds derivatives.
+func replicationShares(connections []*SMBConnection, from string, to []string) (*SMBConnection, []*SMBConnection, error) {
+	find := func(name string) (*SMBConnection, error) {
+		for _, conn := range connections {
+			if !matchesShareName(conn.Config, name) {
+				continue
+			}
+			switch {
+			case conn.Config.Group != "":
+				return nil, fmt.Errorf("share %q is in overflow group %q and holds only part of each shoot", name, conn.Config.Group)
+			case conn.Config.isPreviewShare():
+				return nil, fmt.Errorf("share %q is a preview share", name)
+			case conn.Config.isSelectsShare():
+				return nil, fmt.Errorf("share %q holds only the selects of each shoot", name)
+			case conn.Config.isEncrypted():
+				return nil, fmt.Errorf("share %q is encrypted", name)
+			case conn.archives != nil:
+				return nil, fmt.Errorf("share %q stores archives", name)
+			case conn.cloud != nil:
+				return nil, fmt.Errorf("share %q is a %s destination", name, conn.cloud.kind())
+			}
+			return conn, nil
+		}
+		return nil, fmt.Errorf("no connected share named %q", name)
+	}
+	source, err := find(from)
+	if err != nil {
+		return nil, nil, err
+	}
+	var targets []*SMBConnection
+	for _, name := range to {
+		conn, err := find(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if conn == source {
+			return nil, nil, fmt.Errorf("share %q is both -from and -to", name)
+		}
+		targets = append(targets, conn)
+	}
+	return source, targets, nil
+}
+
+// shootsSince returns the shoot folders of the runs started after cutoff that
+// were not undone.
+func shootsSince(journals []*runJournal, cutoff time.Time) []string {
+	var out []string
+	for _, j := range journals {
+		if j.Undone == nil && j.StartedAt.After(cutoff) {
+			out = append(out, j.Folder)
+		}
+	}
+	return out
+}
+
+// uniqueStrings returns list sorted and without repeats.
+func uniqueStrings(list []string) []string {
+	sort.Strings(list)
+	out := list[:0]
+	for i, s := range list {
+		if i == 0 || s != list[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// replicateShoot copies what the targets lack of one shoot. The copies are
+// journaled like an import's, so undo, history and find know about them,
+// and recorded in the targets' .snapvault folder.
+func replicateShoot(ctx context.Context, cfg *Config, folder string, source *SMBConnection, targets []*SMBConnection, manifests *manifestWriter, dryRun bool) (copied, failed int, err error) {
+	from, err := inventoryShare(ctx, source, folder)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(from.files) == 0 {
+		return 0, 0, fmt.Errorf("%q is empty or missing on %s", folder, shareLabel(source.Config))
+	}
+	rels := make([]string, 0, len(from.files))
+	for rel := range from.files {
+		rels = append(rels, rel)
+	}
+	sort.Strings(rels)
+
+	var journal *runJournal
+	if !dryRun {
+		journal = openRunJournal(cfg, folder, []string{"share: " + shareLabel(source.Config)})
+	}
+	for _, conn := range targets {
+		label := shareLabel(conn.Config)
+		to, err := inventoryShare(ctx, conn, folder)
+		if err != nil {
+			slog.Error("Failed to list shoot folder", "share", label, "folder", folder, "error", err)
+			failed++
+			continue
+		}
+		pending := 0
+		for _, rel := range rels {
+			if ctx.Err() != nil {
+				break
+			}
+			size := from.files[rel]
+			if have, ok := to.files[rel]; ok {
+				// Scrubbed or credited JPEGs differ by design; their presence is
+				// enough.
+				edited := !shareJPEGEdit(source, rel).none() || !shareJPEGEdit(conn, rel).none()
+				if have == size || edited {
+					continue
+				}
+			}
+			pending++
+			if dryRun {
+				fmt.Printf("would copy %s: %s -> %s\n", path.Join(folder, rel), shareLabel(source.Config), label)
+				continue
+			}
+			h := newHasher(conn.hashAlg)
+			if err := copyBetweenShares(ctx, from, to, rel, size, h); err != nil {
+				slog.Error("Failed to replicate file", "share", label, "path", rel, "error", classifyError(err))
+				failed++
+				continue
+			}
+			res := copyResult{DestPath: path.Join(to.root, rel), Sum: h.Sum(nil), Algorithm: conn.hashAlg}
+			if manifests != nil {
+				manifests.add(ctx, conn, res)
+			}
+			if journal != nil {
+				journal.record(conn, shareLabel(source.Config)+":"+path.Join(from.root, rel), size, res)
+			}
+			copied++
+		}
+		if pending == 0 {
+			fmt.Printf("%s is up to date on %s\n", folder, label)
+		}
+	}
+	if journal != nil {
+		if err := journal.save(); err != nil {
+			slog.Warn("Failed to save run journal", "error", err)
+		}
+		publishRemoteImport(targets, journal)
+	}
+	return copied, failed, nil
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// transferReport is the end-of-run summary handed to notifiers.
+type transferReport struct {
+	FolderName string
+	Mount      string
+	StartedAt  time.Time
+	Duration   time.Duration
+	Total      int
+	Completed  int
+	Bytes      int64 // source bytes of files that reached at least one share
+	Shares     []shareReport
+	Fatal      error
+	Errors     []TransferError
+	Duplicates []duplicateFile // identical copies on the card that were not transferred
+	Similar    []similarGroup  // near-duplicate runs, when the similarity pass ran
+	// SourceProblems are card files that were skipped as empty or unreadable.
+	SourceProblems []sourceProblem
+	// Renamed are files stored under a name the shares accept.
+	Renamed []renamedFile
+	// Quorum is how many destinations must be complete for file errors
+	// elsewhere to be tolerated; zero means none are.
+	Quorum int
+	// Extensions and Cameras break the run down by file extension and by
+	// camera body; a body with fewer files than expected often means one
+	// of its card slots was not imported.
+	Extensions []breakdownRow
+	Cameras    []breakdownRow
+}
+
+// breakdownRow counts the files of one extension or camera. Files and Bytes
+// cover files that reached at least one share; Failed counts files that
+// failed on any share or were damaged on the card.
+type breakdownRow struct {
+	Name   string
+	Files  int
+	Bytes  int64
+	Failed int
+}
+
+type shareReport struct {
+	Share  string
+	Files  int
+	Bytes  int64
+	Failed int
+	// Complete is set when this destination received every delivered file.
+	Complete bool
+}
+
+// reportCollector accumulates per-share results from the transfer pipeline.
+// Attach it with hook() and call build() once the run has finished.
+type reportCollector struct {
+	mu        sync.Mutex
+	folder    string
+	mount     string
+	startedAt time.Time
+	quorum    int
+	total     int
+	completed int
+	shares    map[string]*shareReport
+	delivered map[string]int64  // file -> size, for files that reached any share
+	failed    map[string]bool   // files that failed on at least one share
+	cameras   map[string]string // file -> camera body, "" when unknown
+	dups      []duplicateFile
+	similar   []similarGroup
+	problems  []sourceProblem
+	renamed   []renamedFile
+}
+
+func newReportCollector(folderName, mount string, quorum int) *reportCollector {
+	return &reportCollector{
+		folder:    folderName,
+		mount:     mount,
+		startedAt: time.Now(),
+		quorum:    quorum,
+		shares:    make(map[string]*shareReport),
+		delivered: make(map[string]int64),
+		failed:    make(map[string]bool),
+		cameras:   make(map[string]string),
+	}
+}
+
+// hook wraps an existing progress hook (which may be nil) so that both the
+// caller's callbacks and the collector see every event.
+func (c *reportCollector) hook(next *TransferProgressHook) *TransferProgressHook {
+	if next == nil {
+		next = &TransferProgressHook{}
+	}
+	return &TransferProgressHook{
+		OnStart: func(total int) {
+			c.mu.Lock()
+			c.total = total
+			c.mu.Unlock()
+			if next.OnStart != nil {
+				next.OnStart(total)
+			}
+		},
+		OnProgress: func(total, completed int, filePath string) {
+			c.mu.Lock()
+			c.total, c.completed = total, completed
+			c.mu.Unlock()
+			if next.OnProgress != nil {
+				next.OnProgress(total, completed, filePath)
+			}
+		},
+		OnShareResult: func(share, filePath string, bytes int64, err error) {
+			c.record(share, filePath, bytes, err)
+			if next.OnShareResult != nil {
+				next.OnShareResult(share, filePath, bytes, err)
+			}
+		},
+		OnShareRetracted: func(share, filePath string, bytes int64, err error) {
+			c.retract(share, filePath, bytes)
+			if next.OnShareRetracted != nil {
+				next.OnShareRetracted(share, filePath, bytes, err)
+			}
+		},
+		OnDuplicates: func(dups []duplicateFile) {
+			c.mu.Lock()
+			c.dups = append(c.dups, dups...)
+			c.mu.Unlock()
+			if next.OnDuplicates != nil {
+				next.OnDuplicates(dups)
+			}
+		},
+		OnSourceProblem: func(p sourceProblem) {
+			c.mu.Lock()
+			c.problems = append(c.problems, p)
+			c.mu.Unlock()
+			if next.OnSourceProblem != nil {
+				next.OnSourceProblem(p)
+			}
+		},
+		OnRenamed: func(renamed []renamedFile) {
+			c.mu.Lock()
+			c.renamed = append(c.renamed, renamed...)
+			c.mu.Unlock()
+			if next.OnRenamed != nil {
+				next.OnRenamed(renamed)
+			}
+		},
+		OnSimilar: func(groups []similarGroup) {
+			c.mu.Lock()
+			c.similar = groups
+			c.mu.Unlock()
+			if next.OnSimilar != nil {
+				next.OnSimilar(groups)
+			}
+		},
+	}
+}
+
+func (c *reportCollector) record(share, filePath string, bytes int64, err error) {
+	c.mu.Lock()
+	_, known := c.cameras[filePath]
+	c.mu.Unlock()
+	camera := ""
+	if !known && !videoExtensions[strings.ToLower(filepath.Ext(filePath))] {
+		camera = cameraName(filePath)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !known {
+		c.cameras[filePath] = camera
+	}
+	sr, ok := c.shares[share]
+	if !ok {
+		sr = &shareReport{Share: share}
+		c.shares[share] = sr
+	}
+	if err != nil {
+		sr.Failed++
+		c.failed[filePath] = true
+		return
+	}
+	sr.Files++
+	sr.Bytes += bytes
+	c.delivered[filePath] = bytes
+}
+
+// retract turns a copy recorded as done into a failure, so the share no
+// longer counts as complete.
+func (c *reportCollector) retract(share, filePath string, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sr, ok := c.shares[share]
+	if !ok {
+		sr = &shareReport{Share: share}
+		c.shares[share] = sr
+	}
+	sr.Files--
+	sr.Bytes -= bytes
+	sr.Failed++
+	c.failed[filePath] = true
+}
+
+func (c *reportCollector) build(fatal error, errs []TransferError) *transferReport {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := &transferReport{
+		FolderName: c.folder,
+		Mount:      c.mount,
+		StartedAt:  c.startedAt,
+		Duration:   time.Since(c.startedAt),
+		Total:      c.total,
+		Completed:  c.completed,
+		Fatal:      fatal,
+		Errors:     errs,
+		Duplicates: c.dups,
+		Similar:    c.similar,
+
+		SourceProblems: c.problems,
+		Renamed:        c.renamed,
+		Quorum:         c.quorum,
+	}
+	for _, size := range c.delivered {
+		r.Bytes += size
+	}
+	for _, sr := range c.shares {
+		s := *sr
+		s.Complete = s.Failed == 0 && s.Files == len(c.delivered)
+		r.Shares = append(r.Shares, s)
+	}
+	sort.Slice(r.Shares, func(i, j int) bool { return r.Shares[i].Share < r.Shares[j].Share })
+	r.Extensions, r.Cameras = c.breakdowns()
+	return r
+}
+
+// breakdowns groups every file the run touched by extension and by camera.
+// Clips and other files without readable EXIF take the camera of a photo
+// with the same name in the same folder (C0001.MP4 next to C0001.JPG);
+// the camera breakdown is left empty when no file named its body.
+func (c *reportCollector) breakdowns() (exts, cameras []breakdownRow) {
+	byExt, byCamera := map[string]*breakdownRow{}, map[string]*breakdownRow{}
+	damaged := map[string]bool{}
+	for _, p := range c.problems {
+		damaged[p.Path] = true
+	}
+	add := func(m map[string]*breakdownRow, name, file string) {
+		row := m[name]
+		if row == nil {
+			row = &breakdownRow{Name: name}
+			m[name] = row
+		}
+		if size, ok := c.delivered[file]; ok {
+			row.Files++
+			row.Bytes += size
+		}
+		if c.failed[file] || damaged[file] {
+			row.Failed++
+		}
+	}
+
+	bySibling := map[string]string{}
+	for file, camera := range c.cameras {
+		if camera != "" {
+			bySibling[siblingStem(file)] = camera
+		}
+	}
+	files := map[string]bool{}
+	for file := range c.delivered {
+		files[file] = true
+	}
+	for file := range c.failed {
+		files[file] = true
+	}
+	for file := range damaged {
+		files[file] = true
+	}
+	named := false
+	for file := range files {
+		ext := strings.ToUpper(strings.TrimPrefix(filepath.Ext(file), "."))
+		if ext == "" {
+			ext = "(none)"
+		}
+		add(byExt, ext, file)
+		camera := c.cameras[file]
+		if camera == "" {
+			camera = bySibling[siblingStem(file)]
+		}
+		if camera == "" {
+			camera = "unknown"
+		} else {
+			named = true
+		}
+		add(byCamera, camera, file)
+	}
+	exts = sortedBreakdown(byExt)
+	if named {
+		cameras = sortedBreakdown(byCamera)
+	}
+	return exts, cameras
+}
+
+func siblingStem(file string) string {
+	return strings.ToLower(strings.TrimSuffix(file, filepath.Ext(file)))
+}
+
+// sortedBreakdown orders rows by file count, largest first.
+func sortedBreakdown(m map[string]*breakdownRow) []breakdownRow {
+	out := make([]breakdownRow, 0, len(m))
+	for _, row := range m {
+		out = append(out, *row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if a, b := out[i].Files+out[i].Failed, out[j].Files+out[j].Failed; a != b {
+			return a > b
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// writeBreakdown prints one breakdown table under title; nothing for no rows.
+func writeBreakdown(w io.Writer, title string, rows []breakdownRow) {
+	if len(rows) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "%s\n", title)
+	for _, row := range rows {
+		line := fmt.Sprintf("  %-24s %5d files  %10s", row.Name, row.Files, formatBytes(row.Bytes))
+		if row.Failed > 0 {
+			line += fmt.Sprintf("  %d failed", row.Failed)
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+// ok reports whether the run finished without any fatal or per-file error,
+// or with per-file errors but at least Quorum complete destinations.
+// Damaged source files count as errors: the card is not safe to format.
+func (r *transferReport) ok() bool {
+	if r.Fatal != nil || len(r.SourceProblems) > 0 {
+		return false
+	}
+	return len(r.Errors) == 0 || r.quorumMet()
+}
+
+// allCopied reports whether every file reached every share it was meant
+// for: no copy failed anywhere, not even on a share the quorum let the run
+// do without. Only then is a card safe to format.
+func (r *transferReport) allCopied() bool {
+	if !r.ok() || len(r.Errors) > 0 || r.Total == 0 || r.Completed != r.Total {
+		return false
+	}
+	for _, sr := range r.Shares {
+		if sr.Failed > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// quorumMet reports whether a configured quorum was reached.
+func (r *transferReport) quorumMet() bool {
+	return r.Quorum > 0 && r.completeDestinations() >= r.Quorum
+}
+
+func (r *transferReport) completeDestinations() int {
+	n := 0
+	for _, sr := range r.Shares {
+		if sr.Complete {
+			n++
+		}
+	}
+	return n
+}
+
+// similarFrames counts the frames beyond the first in each near-duplicate
+// group, i.e. how many shots culling could drop.
+func (r *transferReport) similarFrames() int {
+	n := 0
+	for _, g := range r.Similar {
+		n += len(g.Files) - 1
+	}
+	return n
+}
+
+// formatBytes renders a byte count with a binary unit, matching the web UI's fmtBytes.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
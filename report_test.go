@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+// shareCopy is one OnShareResult call.
+type shareCopy struct {
+	share, file string
+	bytes       int64
+	err         error
+}
+
+func TestReportCollectorBuild(t *testing.T) {
+	errCopy := errors.New("copy failed")
+	tests := []struct {
+		name      string
+		quorum    int
+		total     int
+		copies    []shareCopy
+		retracted []shareCopy
+		errs      []TransferError
+
+		complete  map[string]bool // share -> Complete
+		bytes     int64
+		ok        bool
+		allCopied bool
+	}{
+		{
+			name:  "every file on every share",
+			total: 2,
+			copies: []shareCopy{
+				{"nas", "a.jpg", 10, nil}, {"nas", "b.mov", 20, nil},
+				{"vault", "a.jpg", 10, nil}, {"vault", "b.mov", 20, nil},
+			},
+			complete:  map[string]bool{"nas": true, "vault": true},
+			bytes:     30,
+			ok:        true,
+			allCopied: true,
+		},
+		{
+			name:  "one failure without a quorum",
+			total: 2,
+			copies: []shareCopy{
+				{"nas", "a.jpg", 10, nil}, {"nas", "b.mov", 20, nil},
+				{"vault", "a.jpg", 10, nil}, {"vault", "b.mov", 20, errCopy},
+			},
+			errs:     []TransferError{{FilePath: "b.mov", Share: "vault", Error: errCopy}},
+			complete: map[string]bool{"nas": true, "vault": false},
+			bytes:    30,
+		},
+		{
+			name:   "one failure within the quorum",
+			quorum: 1,
+			total:  2,
+			copies: []shareCopy{
+				{"nas", "a.jpg", 10, nil}, {"nas", "b.mov", 20, nil},
+				{"vault", "a.jpg", 10, nil}, {"vault", "b.mov", 20, errCopy},
+			},
+			errs:     []TransferError{{FilePath: "b.mov", Share: "vault", Error: errCopy}},
+			complete: map[string]bool{"nas": true, "vault": false},
+			bytes:    30,
+			ok:       true,
+		},
+		{
+			name:   "quorum not reached",
+			quorum: 2,
+			total:  2,
+			copies: []shareCopy{
+				{"nas", "a.jpg", 10, nil}, {"nas", "b.mov", 20, nil},
+				{"vault", "a.jpg", 10, nil}, {"vault", "b.mov", 20, errCopy},
+			},
+			errs:     []TransferError{{FilePath: "b.mov", Share: "vault", Error: errCopy}},
+			complete: map[string]bool{"nas": true, "vault": false},
+			bytes:    30,
+		},
+		{
+			name:   "retracted archive entries",
+			quorum: 2,
+			total:  2,
+			copies: []shareCopy{
+				{"nas", "a.jpg", 10, nil}, {"nas", "b.mov", 20, nil},
+				{"glacier", "a.jpg", 10, nil}, {"glacier", "b.mov", 20, nil},
+			},
+			retracted: []shareCopy{{"glacier", "a.jpg", 10, errCopy}, {"glacier", "b.mov", 20, errCopy}},
+			errs: []TransferError{
+				{FilePath: "a.jpg", Share: "glacier", Error: errCopy},
+				{FilePath: "b.mov", Share: "glacier", Error: errCopy},
+			},
+			complete: map[string]bool{"nas": true, "glacier": false},
+			bytes:    30,
+		},
+		{
+			name:      "nothing to copy",
+			complete:  map[string]bool{},
+			ok:        true,
+			allCopied: false,
+		},
+	}
+	for _, tt := range tests {
+		c := newReportCollector("2026 - Test", "/Volumes/CARD", tt.quorum)
+		hook := c.hook(nil)
+		hook.OnStart(tt.total)
+		for _, r := range tt.copies {
+			hook.OnShareResult(r.share, r.file, r.bytes, r.err)
+		}
+		for _, r := range tt.retracted {
+			hook.OnShareRetracted(r.share, r.file, r.bytes, r.err)
+		}
+		hook.OnProgress(tt.total, tt.total, "")
+		report := c.build(nil, tt.errs)
+
+		if len(report.Shares) != len(tt.complete) {
+			t.Errorf("%s: %d shares in the report, want %d", tt.name, len(report.Shares), len(tt.complete))
+		}
+		for _, sr := range report.Shares {
+			if want, ok := tt.complete[sr.Share]; !ok || sr.Complete != want {
+				t.Errorf("%s: share %s Complete = %v, want %v", tt.name, sr.Share, sr.Complete, want)
+			}
+		}
+		if report.Bytes != tt.bytes {
+			t.Errorf("%s: Bytes = %d, want %d", tt.name, report.Bytes, tt.bytes)
+		}
+		if got := report.ok(); got != tt.ok {
+			t.Errorf("%s: ok() = %v, want %v", tt.name, got, tt.ok)
+		}
+		if got := report.allCopied(); got != tt.allCopied {
+			t.Errorf("%s: allCopied() = %v, want %v", tt.name, got, tt.allCopied)
+		}
+	}
+}
+
+func TestQuorumMet(t *testing.T) {
+	shares := func(complete ...bool) []shareReport {
+		out := make([]shareReport, len(complete))
+		for i, c := range complete {
+			out[i] = shareReport{Complete: c}
+		}
+		return out
+	}
+	tests := []struct {
+		quorum int
+		shares []shareReport
+		want   bool
+	}{
+		{0, shares(true, true), false},
+		{1, shares(true, false), true},
+		{2, shares(true, false), false},
+		{2, shares(true, true, false), true},
+		{1, nil, false},
+	}
+	for _, tt := range tests {
+		r := &transferReport{Quorum: tt.quorum, Shares: tt.shares}
+		if got := r.quorumMet(); got != tt.want {
+			t.Errorf("quorum %d over %+v: quorumMet() = %v, want %v", tt.quorum, tt.shares, got, tt.want)
+		}
+	}
+}
+
+func TestReportOKWithSourceProblems(t *testing.T) {
+	r := &transferReport{
+		Total: 1, Completed: 1, Quorum: 1,
+		Shares:         []shareReport{{Share: "nas", Files: 1, Complete: true}},
+		SourceProblems: []sourceProblem{{Path: "bad.cr3", Reason: "zero-byte file"}},
+	}
+	if r.ok() || r.allCopied() {
+		t.Errorf("a run with damaged card files must not be ok: ok %v, allCopied %v", r.ok(), r.allCopied())
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// reviewThumbnailSize is the longest edge of the thumbnails on the review page.
+const reviewThumbnailSize = 320
+
+// reviewServer serves the JPEGs an import has copied so far, so the shoot can
+// be reviewed on a tablet while the card is still offloading. Files are read
+// from the card, not the NAS, and only once a share holds them.
+type reviewServer struct {
+	mu     sync.Mutex
+	files  []reviewFile
+	seen   map[string]bool
+	thumbs map[int][]byte
+}
+
+type reviewFile struct {
+	Path  string    `json:"-"`
+	Name  string    `json:"name"`
+	Taken time.Time `json:"taken"`
+}
+
+// startReviewServer listens on addr until ctx ends.
+func startReviewServer(ctx context.Context, addr string) (*reviewServer, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", addr, err)
+	}
+	rs := &reviewServer{seen: map[string]bool{}, thumbs: map[int][]byte{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", rs.handlePage)
+	mux.HandleFunc("GET /files", rs.handleFiles)
+	mux.HandleFunc("GET /thumb/{i}", rs.handleThumb)
+	mux.HandleFunc("GET /photo/{i}", rs.handlePhoto)
+	httpServer := &http.Server{Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+	go func() {
+		if err := httpServer.Serve(lis); err != nil && err != http.ErrServerClosed {
+			slog.Error("Review server stopped", "error", err)
+		}
+	}()
+	slog.Info("Review copied photos in a browser", "url", fmt.Sprintf("http://%s/", lis.Addr()))
+	return rs, nil
+}
+
+// handle is an eventBus subscriber that adds every JPEG to the page as soon
+// as one destination has it.
+func (rs *reviewServer) handle(e RunEvent) {
+	if t, ok := e.(FileTransferred); ok && isJPEG(t.Path) {
+		rs.add(t.Path)
+	}
+}
+
+func (rs *reviewServer) add(filePath string) {
+	rs.mu.Lock()
+	seen := rs.seen[filePath]
+	rs.seen[filePath] = true
+	rs.mu.Unlock()
+	if seen {
+		return
+	}
+	f := reviewFile{Path: filePath, Name: filepath.Base(filePath)}
+	if info, err := os.Stat(filePath); err == nil {
+		f.Taken, _ = getPhotoDate(filePath, info)
+	}
+	rs.mu.Lock()
+	rs.files = append(rs.files, f)
+	rs.mu.Unlock()
+}
+
+// file returns the i-th copied file from the request's {i}.
+func (rs *reviewServer) file(r *http.Request) (int, reviewFile, bool) {
+	i, err := strconv.Atoi(r.PathValue("i"))
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if err != nil || i < 0 || i >= len(rs.files) {
+		return 0, reviewFile{}, false
+	}
+	return i, rs.files[i], true
+}
+
+// handleFiles lists the files copied from index ?from on, for the page to poll.
+func (rs *reviewServer) handleFiles(w http.ResponseWriter, r *http.Request) {
+	from, _ := strconv.Atoi(r.URL.Query().Get("from"))
+	rs.mu.Lock()
+	files := []reviewFile{}
+	if from >= 0 && from < len(rs.files) {
+		files = append(files, rs.files[from:]...)
+	}
+	rs.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(files)
+}
+
+func (rs *reviewServer) handleThumb(w http.ResponseWriter, r *http.Request) {
+	i, f, ok := rs.file(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	rs.mu.Lock()
+	data := rs.thumbs[i]
+	rs.mu.Unlock()
+	if data == nil {
+		if data = galleryThumbnail(f.Path, reviewThumbnailSize); data == nil {
+			http.Error(w, "no thumbnail", http.StatusNotFound)
+			return
+		}
+		rs.mu.Lock()
+		rs.thumbs[i] = data
+		rs.mu.Unlock()
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Write(data)
+}
+
+func (rs *reviewServer) handlePhoto(w http.ResponseWriter, r *http.Request) {
+	_, f, ok := rs.file(r)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeFile(w, r, f.Path)
+}
+
+func (rs *reviewServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, reviewPage)
+}
+
+// reviewPage polls /files and appends new thumbnails without reloading, so
+// the scroll position survives.
+const reviewPage = `<!DOCTYPE html>
+<html lang="en"><head><meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>SnapVault review</title>
+<style>body{font:14px system-ui,sans-serif;margin:1rem;background:#111;color:#ddd}
+main{display:grid;grid-template-columns:repeat(auto-fill,minmax(200px,1fr));gap:.75rem}
+figure{margin:0}img{width:100%;aspect-ratio:3/2;object-fit:contain;background:#222;display:block}
+figcaption{font-size:12px;overflow-wrap:anywhere;margin-top:.25rem}time{color:#888}a{color:inherit}</style>
+</head><body>
+<h1>SnapVault review</h1>
+<p id="count">Waiting for the first copies…</p>
+<main id="grid"></main>
+<script>
+let next = 0;
+async function poll() {
+  try {
+    const files = await (await fetch("files?from=" + next)).json();
+    for (const f of files) {
+      const i = next++;
+      const fig = document.createElement("figure");
+      const a = document.createElement("a");
+      a.href = "photo/" + i;
+      const img = document.createElement("img");
+      img.loading = "lazy";
+      img.alt = "";
+      img.src = "thumb/" + i;
+      a.append(img);
+      const cap = document.createElement("figcaption");
+      const t = document.createElement("time");
+      t.textContent = new Date(f.taken).toLocaleString();
+      cap.append(f.name, document.createElement("br"), t);
+      fig.append(a, cap);
+      document.getElementById("grid").append(fig);
+    }
+    if (next > 0) document.getElementById("count").textContent = next + " photos copied";
+  } catch (e) {
+    document.getElementById("count").textContent = "Import finished or SnapVault stopped; " + next + " photos copied";
+    return;
+  }
+  setTimeout(poll, 3000);
+}
+poll();
+</script>
+</body></html>
+`
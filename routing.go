@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errGroupFull means no member of an overflow group has room for a file
+// above its free-space floor.
+var errGroupFull = errors.New("every share in the overflow group is at its free-space floor")
+
+// shareTarget is one destination for every file: a plain share, or an
+// overflow group whose members are filled in config order.
+type shareTarget struct {
+	group   string
+	members []*SMBConnection
+}
+
+// label names the destination in reports and errors.
+func (t shareTarget) label() string {
+	if t.group == "" {
+		return shareLabel(t.members[0].Config)
+	}
+	return "group " + t.group
+}
+
+// shareRouter picks, per file, which share of each overflow group receives it.
+// Free space is read once per share and then counted down as files are
+// placed, so parallel workers never overshoot a floor between them.
+type shareRouter struct {
+	targets  []shareTarget
+	previews []*SMBConnection // derivative destinations, outside targets
+
+	mu       sync.Mutex
+	room     map[*SMBConnection]int64 // bytes left above the floor
+	placed   map[string]map[string]*placementRecord
+	lastFull map[string]*SMBConnection // member last reported full, per group
+}
+
+// newShareRouter groups connections by SMBConfig.Group. Shares without a
+// group each stay a destination of their own.
+func newShareRouter(ctx context.Context, connections []*SMBConnection) *shareRouter {
+	r := &shareRouter{
+		room:     map[*SMBConnection]int64{},
+		placed:   map[string]map[string]*placementRecord{},
+		lastFull: map[string]*SMBConnection{},
+	}
+	groups := map[string]int{}
+	for _, conn := range connections {
+		if conn.Config.isPreviewShare() {
+			r.previews = append(r.previews, conn)
+			continue
+		}
+		group := strings.TrimSpace(conn.Config.Group)
+		if group == "" {
+			r.targets = append(r.targets, shareTarget{members: []*SMBConnection{conn}})
+			continue
+		}
+		if i, ok := groups[group]; ok {
+			r.targets[i].members = append(r.targets[i].members, conn)
+		} else {
+			groups[group] = len(r.targets)
+			r.targets = append(r.targets, shareTarget{group: group, members: []*SMBConnection{conn}})
+		}
+
+		free, err := shareFreeBytes(ctx, conn)
+		if err != nil {
+			// Without a reading the share is treated as having room; the
+			// copy itself fails if it really is full.
+			slog.Warn("Could not read free space; overflow floor not enforced", "share", shareLabel(conn.Config), "error", err)
+			r.room[conn] = -1
+			continue
+		}
+		floor := int64(conn.Config.MinFreeGB * (1 << 30))
+		room := free - floor
+		if room < 0 {
+			room = 0
+		}
+		r.room[conn] = room
+		slog.Info("Overflow group member", "group", group, "share", shareLabel(conn.Config), "free_bytes", free, "floor_bytes", floor)
+	}
+	return r
+}
+
+// pick reserves space for a file of size bytes and returns the connection
+// that should receive it.
+func (r *shareRouter) pick(t shareTarget, size int64) (*SMBConnection, error) {
+	if t.group == "" {
+		return t.members[0], nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, conn := range t.members {
+		room := r.room[conn]
+		if room < 0 {
+			return conn, nil
+		}
+		if room >= size {
+			r.room[conn] = room - size
+			return conn, nil
+		}
+		if r.lastFull[t.group] != conn {
+			r.lastFull[t.group] = conn
+			slog.Info("Share reached its free-space floor; overflowing to the next group member", "group", t.group, "share", shareLabel(conn.Config))
+		}
+	}
+	return nil, errGroupFull
+}
+
+// place remembers where a grouped file landed, for the catalog.
+func (r *shareRouter) place(t shareTarget, conn *SMBConnection, res copyResult) {
+	if t.group == "" {
+		return
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(res.DestPath, shootRoot(conn, "")), "/")
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.placed[t.group] == nil {
+		r.placed[t.group] = map[string]*placementRecord{}
+	}
+	r.placed[t.group][rel] = &placementRecord{
+		Share:    shareLabel(conn.Config),
+		ShareKey: smbShareKey(conn.Config),
+		Stored:   time.Now(),
+	}
+}
+
+// savePlacements merges this run's placements into the catalog.
+func (r *shareRouter) savePlacements(cfg *Config) {
+	if cfg == nil || len(r.placed) == 0 {
+		return
+	}
+	err := updateCatalog(cfg, func(c *catalogData) error {
+		if c.Placements == nil {
+			c.Placements = map[string]map[string]*placementRecord{}
+		}
+		for group, files := range r.placed {
+			if c.Placements[group] == nil {
+				c.Placements[group] = map[string]*placementRecord{}
+			}
+			for rel, p := range files {
+				c.Placements[group][rel] = p
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Warn("Failed to record overflow placements in catalog", "error", err)
+	}
+}
+
+// shareFreeBytes reports the space available to this user on the share. A
+// Synology shared folder's quota counts when it leaves less than the volume.
+func shareFreeBytes(ctx context.Context, conn *SMBConnection) (int64, error) {
+	info, err := conn.Share.WithContext(ctx).Statfs(".")
+	if err != nil {
+		return 0, err
+	}
+	free := int64(info.AvailableBlockCount() * info.BlockSize())
+	if s := conn.Config.Synology; s != nil && s.Quota {
+		room, ok, err := synologyQuotaBytes(ctx, conn)
+		switch {
+		case err != nil:
+			slog.Warn("Could not read Synology quota; using the volume's free space", "share", shareLabel(conn.Config), "error", err)
+		case ok && room < free:
+			free = room
+		}
+	}
+	return free, nil
+}
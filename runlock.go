@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// errCardLocked is returned when another SnapVault process is already
+// importing from a card.
+var errCardLocked = errors.New("card is already being imported")
+
+// cardLock is the content of a lock file under the state directory's locks/.
+type cardLock struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Mount   string    `json:"mount"`
+	Folder  string    `json:"folder"`
+	Started time.Time `json:"started"`
+}
+
+// lockCards takes a lock per card in mounts for the length of a run, so two
+// accidental invocations can't copy the same card at once. A card is keyed by
+// its fingerprint when it has one, so the lock holds even when it is mounted
+// at a second path, and by its path otherwise. Locks left by a process that
+// is no longer running are taken over. The returned function releases them.
+func lockCards(ctx context.Context, cfg *Config, mounts []string, folder string) (release func(), err error) {
+	dir, err := resolveStateDir(cfg)
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "locks")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("creating lock dir: %w", err)
+	}
+
+	type target struct{ path, mount string }
+	targets := make([]target, 0, len(mounts))
+	for _, mount := range mounts {
+		key := normalizeMountPath(mount)
+		if fp, err := cardFingerprint(ctx, mount); err == nil {
+			key = fp
+		}
+		sum := sha256.Sum256([]byte(key))
+		targets = append(targets, target{filepath.Join(dir, hex.EncodeToString(sum[:8])+".lock"), mount})
+	}
+	// A fixed order keeps two runs over overlapping cards from each holding
+	// half of the locks.
+	sort.Slice(targets, func(i, j int) bool { return targets[i].path < targets[j].path })
+
+	host, _ := os.Hostname()
+	var held []string
+	release = func() {
+		for _, path := range held {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				slog.Warn("Failed to remove card lock", "path", path, "error", err)
+			}
+		}
+	}
+	for i, t := range targets {
+		if i > 0 && t.path == targets[i-1].path {
+			continue // the same card given twice
+		}
+		lock := cardLock{PID: os.Getpid(), Host: host, Mount: t.mount, Folder: folder, Started: time.Now()}
+		if err := createLock(t.path, lock); err != nil {
+			release()
+			return nil, err
+		}
+		held = append(held, t.path)
+	}
+	return release, nil
+}
+
+// createLock writes lock to path unless a live process already holds it.
+func createLock(path string, lock cardLock) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return err
+	}
+	for attempt := 0; ; attempt++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			_, err = f.Write(data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return fmt.Errorf("writing card lock: %w", err)
+			}
+			return nil
+		}
+		if !os.IsExist(err) {
+			return fmt.Errorf("creating card lock: %w", err)
+		}
+
+		var holder cardLock
+		if err := readStateFile(path, &holder); err != nil {
+			return fmt.Errorf("%w: unreadable lock %s (%v)", errCardLocked, path, err)
+		}
+		// Another machine's process can't be checked from here, and a second
+		// failed takeover means someone else is racing for the same lock.
+		if holder.Host != lock.Host || attempt > 0 || processAlive(holder.PID) {
+			return fmt.Errorf("%w by process %d on %s since %s (importing %s into %q); remove %s if it is not running",
+				errCardLocked, holder.PID, holder.Host, holder.Started.Format(time.DateTime), holder.Mount, holder.Folder, path)
+		}
+		slog.Info("Taking over stale card lock", "mount", holder.Mount, "pid", holder.PID)
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("removing stale card lock: %w", err)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchRunSignals serves the run-control signals of a command-line import
+// until ctx ends: SIGUSR1 prints a progress snapshot to stderr, SIGTSTP
+// (Ctrl+Z) pauses the workers after the files in flight, or resumes them
+// when already paused, and SIGCONT resumes. The process itself keeps running,
+// so SMB sessions stay open while paused.
+func watchRunSignals(ctx context.Context, status *runStatus, gate *pauseGate) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGTSTP, syscall.SIGCONT)
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-ch:
+				switch sig {
+				case syscall.SIGUSR1:
+					status.print(os.Stderr, gate.isPaused())
+				case syscall.SIGTSTP:
+					if gate.toggle() {
+						fmt.Fprintf(os.Stderr, "\nPaused after the files in flight; press Ctrl+Z again or run kill -CONT %d to resume\n", os.Getpid())
+					} else {
+						fmt.Fprintln(os.Stderr, "\nResumed")
+					}
+				case syscall.SIGCONT:
+					gate.setPaused(false)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "context"
+
+// watchRunSignals does nothing on Windows, which has no SIGUSR1 or SIGTSTP.
+func watchRunSignals(ctx context.Context, status *runStatus, gate *pauseGate) {}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// pauseGate holds the workers between files while a run is paused. A nil
+// gate never pauses.
+type pauseGate struct {
+	mu     sync.Mutex
+	paused bool
+	resume chan struct{}
+}
+
+// wait blocks while the gate is paused. It returns ctx.Err() if the run is
+// cancelled meanwhile.
+func (g *pauseGate) wait(ctx context.Context) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	if !g.paused {
+		g.mu.Unlock()
+		return nil
+	}
+	resume := g.resume
+	g.mu.Unlock()
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// toggle pauses a running gate or resumes a paused one and reports whether
+// it is now paused.
+func (g *pauseGate) toggle() bool {
+	paused := !g.isPaused()
+	g.setPaused(paused)
+	return paused
+}
+
+func (g *pauseGate) isPaused() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.paused
+}
+
+func (g *pauseGate) setPaused(paused bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if paused == g.paused {
+		return
+	}
+	g.paused = paused
+	if paused {
+		g.resume = make(chan struct{})
+	} else {
+		close(g.resume)
+	}
+}
+
+// runStatus follows a command-line import so a snapshot can be printed on
+// request (SIGUSR1) while it runs.
+type runStatus struct {
+	mu     sync.Mutex
+	start  time.Time
+	total  int
+	done   int
+	bytes  map[string]int64
+	failed map[string]int
+}
+
+func newRunStatus() *runStatus {
+	return &runStatus{start: time.Now(), bytes: map[string]int64{}, failed: map[string]int{}}
+}
+
+// hook wraps next (which may be nil) like reportCollector.hook does.
+func (s *runStatus) hook(next *TransferProgressHook) *TransferProgressHook {
+	if next == nil {
+		next = &TransferProgressHook{}
+	}
+	h := *next
+	h.OnStart = func(total int) {
+		s.mu.Lock()
+		s.start, s.total, s.done = time.Now(), total, 0
+		s.bytes, s.failed = map[string]int64{}, map[string]int{}
+		s.mu.Unlock()
+		if next.OnStart != nil {
+			next.OnStart(total)
+		}
+	}
+	h.OnProgress = func(total, completed int, filePath string) {
+		s.mu.Lock()
+		if completed > s.done {
+			s.done = completed
+		}
+		s.mu.Unlock()
+		if next.OnProgress != nil {
+			next.OnProgress(total, completed, filePath)
+		}
+	}
+	h.OnShareResult = func(share, filePath string, bytes int64, err error) {
+		s.mu.Lock()
+		if err != nil {
+			s.failed[share]++
+		} else {
+			s.bytes[share] += bytes
+		}
+		s.mu.Unlock()
+		if next.OnShareResult != nil {
+			next.OnShareResult(share, filePath, bytes, err)
+		}
+	}
+	h.OnShareRetracted = func(share, filePath string, bytes int64, err error) {
+		s.mu.Lock()
+		s.bytes[share] -= bytes
+		s.failed[share]++
+		s.mu.Unlock()
+		if next.OnShareRetracted != nil {
+			next.OnShareRetracted(share, filePath, bytes, err)
+		}
+	}
+	return &h
+}
+
+// print writes the snapshot: files done and remaining, then bytes per share.
+func (s *runStatus) print(w io.Writer, paused bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var b strings.Builder
+	state := "running"
+	if paused {
+		state = "paused"
+	}
+	fmt.Fprintf(&b, "\n=== Progress (%s, %s elapsed) ===\n", state, time.Since(s.start).Round(time.Second))
+	fmt.Fprintf(&b, "%d of %d files done, %d remaining\n", s.done, s.total, s.total-s.done)
+	shares := make([]string, 0, len(s.bytes))
+	for share := range s.bytes {
+		shares = append(shares, share)
+	}
+	for share := range s.failed {
+		if _, ok := s.bytes[share]; !ok {
+			shares = append(shares, share)
+		}
+	}
+	sort.Strings(shares)
+	for _, share := range shares {
+		fmt.Fprintf(&b, "  %-24s %10s", share, formatBytes(s.bytes[share]))
+		if n := s.failed[share]; n > 0 {
+			fmt.Fprintf(&b, "  (%d failed)", n)
+		}
+		b.WriteByte('\n')
+	}
+	io.WriteString(w, b.String())
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Cards written by phones, scanners and some cameras' Wi-Fi transfers
+// occasionally carry names an SMB share or NTFS volume won't take: a colon
+// from a timestamp, a question mark, a trailing dot. The copy would fail
+// on every share, so those names are rewritten before copying instead.
+
+// invalidNameChars are the characters Windows and SMB servers reject in a
+// file or folder name, besides control characters.
+const invalidNameChars = `<>:"/\|?*`
+
+// defaultNameReplacement stands in for each invalid character.
+const defaultNameReplacement = "_"
+
+// reservedNames are DOS device names Windows won't use as a file name,
+// whatever the extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// renamedFile is a card file stored under a different name because its
+// own was not valid on the shares.
+type renamedFile struct {
+	Path   string // source path
+	Stored string // destination path below the shoot folder
+}
+
+// validNameReplacement reports why repl can't stand in for an invalid
+// character, or nil.
+func validNameReplacement(repl string) error {
+	if repl == "" {
+		return nil
+	}
+	if sanitizeName(repl, defaultNameReplacement) != repl || strings.TrimSpace(repl) == "" {
+		return fmt.Errorf("%q is not valid in a file name itself", repl)
+	}
+	return nil
+}
+
+// sanitizeName returns name as SMB and NTFS accept it: invalid and control
+// characters and trailing dots and spaces each become repl ("_" when
+// empty), and a reserved device name gets repl appended to its stem
+// (CON.jpg -> CON_.jpg).
+func sanitizeName(name, repl string) string {
+	repl = cmp.Or(repl, defaultNameReplacement)
+	var b strings.Builder
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(invalidNameChars, r) {
+			b.WriteString(repl)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	s := b.String()
+	if trimmed := strings.TrimRight(s, ". "); trimmed != s {
+		s = trimmed + strings.Repeat(repl, len(s)-len(trimmed))
+	}
+	stem, _, _ := strings.Cut(s, ".")
+	if reservedNames[strings.ToUpper(strings.TrimRight(stem, " "))] {
+		s = stem + repl + s[len(stem):]
+	}
+	return s
+}
+
+// sanitizeDir applies sanitizeName to every element of a slash-separated
+// destination folder.
+func sanitizeDir(dir, repl string) string {
+	if dir == "" {
+		return dir
+	}
+	parts := strings.Split(dir, "/")
+	for i, p := range parts {
+		if p != "" {
+			parts[i] = sanitizeName(p, repl)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// sanitizeJobs puts every destination name and folder in the Unicode form
+// mode asks for, rewrites those the shares would reject and returns the
+// files rewritten; a change of form alone is not reported. A rewritten name
+// that would land on another file's gets a ~2, ~3, ... suffix.
+func sanitizeJobs(jobs []TransferJob, repl, mode string) []renamedFile {
+	stored := func(job TransferJob) string {
+		name := job.DestName
+		if name == "" {
+			name = filepath.Base(job.SourcePath)
+		}
+		return path.Join(job.DestDir, name)
+	}
+
+	key := func(job TransferJob) string {
+		return strings.ToLower(nameKey(stored(job)))
+	}
+
+	used := make(map[string]bool, len(jobs))
+	var changed []int
+	for i, job := range jobs {
+		name := job.DestName
+		if name == "" {
+			name = filepath.Base(job.SourcePath)
+		}
+		normalDir, normalName := normalizeName(job.DestDir, mode), normalizeName(name, mode)
+		dir, clean := sanitizeDir(normalDir, repl), sanitizeName(normalName, repl)
+		jobs[i].DestDir = dir
+		if clean != filepath.Base(job.SourcePath) {
+			jobs[i].DestName = clean
+		}
+		if dir == normalDir && clean == normalName {
+			used[key(jobs[i])] = true
+			continue
+		}
+		changed = append(changed, i)
+	}
+
+	renamed := make([]renamedFile, 0, len(changed))
+	for _, i := range changed {
+		job := &jobs[i]
+		ext := path.Ext(job.DestName)
+		stem := strings.TrimSuffix(job.DestName, ext)
+		for n := 2; used[key(*job)]; n++ {
+			job.DestName = fmt.Sprintf("%s~%d%s", stem, n, ext)
+		}
+		used[key(*job)] = true
+		renamed = append(renamed, renamedFile{Path: job.SourcePath, Stored: stored(*job)})
+		slog.Info("Renamed file the shares can't store as-is", "file", job.SourcePath, "stored_as", stored(*job))
+	}
+	return renamed
+}
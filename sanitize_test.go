@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func TestSanitizeName(t *testing.T) {
+	tests := []struct {
+		name, repl, want string
+	}{
+		{"IMG_0001.JPG", "", "IMG_0001.JPG"},
+		{"2026-05-01 10:02:03.jpg", "", "2026-05-01 10_02_03.jpg"},
+		{`a<b>c"d|e?f*g.jpg`, "", "a_b_c_d_e_f_g.jpg"},
+		{"what?.jpg", "-", "what-.jpg"},
+		{"tab\there.jpg", "", "tab_here.jpg"},
+		{"del\x7f.jpg", "", "del_.jpg"},
+		{"trailing.", "", "trailing_"},
+		{"trailing. .", "", "trailing___"},
+		{"CON.jpg", "", "CON_.jpg"},
+		{"con.tar.gz", "", "con_.tar.gz"},
+		{"LPT1", "", "LPT1_"},
+		{"CONSOLE.jpg", "", "CONSOLE.jpg"},
+		{"Café.jpg", "", "Café.jpg"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeName(tt.name, tt.repl); got != tt.want {
+			t.Errorf("sanitizeName(%q, %q) = %q, want %q", tt.name, tt.repl, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeDir(t *testing.T) {
+	tests := []struct {
+		dir, want string
+	}{
+		{"", ""},
+		{"2026-05-01", "2026-05-01"},
+		{"Paris: day 1/RAW", "Paris_ day 1/RAW"},
+		{"AUX/CON.", "AUX_/CON_"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeDir(tt.dir, ""); got != tt.want {
+			t.Errorf("sanitizeDir(%q) = %q, want %q", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestValidNameReplacement(t *testing.T) {
+	tests := []struct {
+		repl string
+		ok   bool
+	}{
+		{"", true},
+		{"_", true},
+		{"-", true},
+		{":", false},
+		{" ", false},
+		{"a/b", false},
+	}
+	for _, tt := range tests {
+		if err := validNameReplacement(tt.repl); (err == nil) != tt.ok {
+			t.Errorf("validNameReplacement(%q) = %v, want ok %v", tt.repl, err, tt.ok)
+		}
+	}
+}
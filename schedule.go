@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// transfer_order policies decide which files are copied first.
+const (
+	orderCard     = "card"           // as found on the card (default)
+	orderJPEG     = "jpeg-first"     // JPEG and HEIC before RAW and video, for quick client previews
+	orderSmallest = "smallest-first" // most files safe as early as possible
+	orderTwoPhase = "two-phase"      // every JPEG and HEIC on every share before the first RAW starts
+)
+
+// previewExtensions are the formats jpeg-first sends ahead of everything else.
+var previewExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".heic": true, ".heif": true}
+
+func normalizeTransferOrder(order string) (string, error) {
+	switch o := strings.ToLower(strings.TrimSpace(order)); o {
+	case "":
+		return orderCard, nil
+	case orderCard, orderJPEG, orderSmallest, orderTwoPhase:
+		return o, nil
+	default:
+		return "", fmt.Errorf("transfer_order must be %q, %q, %q or %q, got %q", orderCard, orderJPEG, orderSmallest, orderTwoPhase, order)
+	}
+}
+
+func isPreviewFile(path string) bool {
+	return previewExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// orderJobs sorts jobs in place for the given policy. Ties keep card order.
+func orderJobs(jobs []TransferJob, order string) error {
+	order, err := normalizeTransferOrder(order)
+	if err != nil {
+		return err
+	}
+	switch order {
+	case orderJPEG, orderTwoPhase:
+		sort.SliceStable(jobs, func(i, j int) bool {
+			return isPreviewFile(jobs[i].SourcePath) && !isPreviewFile(jobs[j].SourcePath)
+		})
+	case orderSmallest:
+		sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].Size < jobs[j].Size })
+	}
+	return nil
+}
+
+// previewPhase returns how many of the ordered jobs make up the first pass of a
+// two-phase import, or 0 when the run has a single pass.
+func previewPhase(jobs []TransferJob, order string) int {
+	if order, _ := normalizeTransferOrder(order); order != orderTwoPhase {
+		return 0
+	}
+	n := 0
+	for n < len(jobs) && isPreviewFile(jobs[n].SourcePath) {
+		n++
+	}
+	if n == len(jobs) {
+		return 0
+	}
+	return n
+}
+
+// waitCompleted blocks until the workers have finished n jobs, so the second
+// pass of a two-phase import only starts once every preview has been copied.
+func waitCompleted(ctx context.Context, completed *int64, n int) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for atomic.LoadInt64(completed) < int64(n) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
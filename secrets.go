@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/zalando/go-keyring"
+)
+
+// An encrypted config is decrypted in memory on every load and never written
+// back in plaintext. age files are decrypted here; SOPS files are handed to
+// the sops binary, which also covers its KMS and PGP backends. Both read the
+// age identity from SOPS_AGE_KEY or SOPS_AGE_KEY_FILE, falling back to the
+// sops default of <user config dir>/sops/age/keys.txt.
+
+var (
+	ageHeader      = []byte("age-encryption.org/")
+	ageArmorHeader = []byte(armor.Header)
+	// SOPS keeps its metadata under a top-level "sops" key holding a "mac".
+	sopsYAMLMarker = regexp.MustCompile(`(?m)^sops:\s*$`)
+	sopsJSONMarker = regexp.MustCompile(`"sops"\s*:\s*\{`)
+)
+
+// errEncryptedConfig stops the UIs from overwriting an encrypted config.
+var errEncryptedConfig = errors.New("config file is encrypted; edit it with age or sops instead")
+
+func isAgeEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, ageHeader) || bytes.HasPrefix(bytes.TrimSpace(data), ageArmorHeader)
+}
+
+func isSOPSEncrypted(data []byte) bool {
+	return (sopsYAMLMarker.Match(data) || sopsJSONMarker.Match(data)) && bytes.Contains(data, []byte("mac"))
+}
+
+// decryptConfig returns the plaintext of an encrypted config, or data
+// unchanged when it is not encrypted.
+func decryptConfig(path string, data []byte) ([]byte, error) {
+	switch {
+	case isAgeEncrypted(data):
+		return decryptAge(data)
+	case isSOPSEncrypted(data):
+		return decryptSOPS(path)
+	default:
+		return data, nil
+	}
+}
+
+func decryptAge(data []byte) ([]byte, error) {
+	identities, err := ageIdentities()
+	if err != nil {
+		return nil, fmt.Errorf("config is age-encrypted: %w", err)
+	}
+	var in io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), ageArmorHeader) {
+		in = armor.NewReader(bytes.NewReader(bytes.TrimSpace(data)))
+	}
+	r, err := age.Decrypt(in, identities...)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting config with age: %w", err)
+	}
+	plain, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting config with age: %w", err)
+	}
+	return plain, nil
+}
+
+// ageIdentities loads the age identities from the sops environment variables
+// or default key file.
+func ageIdentities() ([]age.Identity, error) {
+	if key := os.Getenv("SOPS_AGE_KEY"); key != "" {
+		ids, err := age.ParseIdentities(strings.NewReader(key))
+		if err != nil {
+			return nil, fmt.Errorf("parsing SOPS_AGE_KEY: %w", err)
+		}
+		return ids, nil
+	}
+	keyFile := os.Getenv("SOPS_AGE_KEY_FILE")
+	if keyFile == "" {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return nil, fmt.Errorf("no age identity is set (SOPS_AGE_KEY_FILE): %w", err)
+		}
+		keyFile = filepath.Join(dir, "sops", "age", "keys.txt")
+	}
+	f, err := os.Open(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading age identity: %w (set SOPS_AGE_KEY_FILE)", err)
+	}
+	defer f.Close()
+	ids, err := age.ParseIdentities(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing age identity %s: %w", keyFile, err)
+	}
+	return ids, nil
+}
+
+func decryptSOPS(path string) ([]byte, error) {
+	if _, err := exec.LookPath("sops"); err != nil {
+		return nil, errors.New("config is SOPS-encrypted; install sops (https://github.com/getsops/sops) to read it")
+	}
+	format := configFormat(path)
+	cmd := exec.Command("sops", "--decrypt", "--input-type", format, "--output-type", format, path)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("sops: %s", msg)
+		}
+		return nil, fmt.Errorf("sops: %w", err)
+	}
+	return out, nil
+}
+
+// configIsEncrypted reports whether the config at path is stored encrypted.
+// A missing file is not.
+func configIsEncrypted(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	return isAgeEncrypted(data) || isSOPSEncrypted(data)
+}
+
+// envReference matches a value that only names an environment variable.
+var envReference = regexp.MustCompile(`^\$\{?[A-Za-z_][A-Za-z0-9_]*\}?$`)
+
+// checkConfigPermissions refuses, like ssh does for private keys, a config
+// that other users can read when it holds literal secrets. Encrypted files
+// and secrets given as ${ENV} references are fine. Windows is not checked.
+func checkConfigPermissions(path string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	perm := info.Mode().Perm()
+	if perm&0o077 == 0 || configIsEncrypted(path) {
+		return nil
+	}
+	cfg, err := loadConfigRaw(path)
+	if err != nil {
+		return nil
+	}
+	secrets := configSecrets(cfg)
+	for name := range cfg.Profiles {
+		profiled, err := loadConfigFromFile(path, name, false)
+		if err == nil {
+			secrets = append(secrets, configSecrets(profiled)...)
+		}
+	}
+	if len(secrets) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s has mode %04o, so other users can read the %s in it; run chmod 600 %q, use ${ENV} references, or pass -insecure-config",
+		path, perm, strings.Join(dedupeStrings(secrets), ", "), path)
+}
+
+// configSecrets names the settings that hold a literal secret.
+func configSecrets(cfg *Config) []string {
+	var out []string
+	add := func(name, value string) {
+		if v := strings.TrimSpace(value); v != "" && !envReference.MatchString(v) {
+			out = append(out, name)
+		}
+	}
+	for _, s := range cfg.SMBShares {
+		if !s.AskPass && !s.Keyring {
+			add(fmt.Sprintf("password of share %s", shareLabel(s)), s.Password)
+		}
+		if s.Snapshot != nil {
+			add(fmt.Sprintf("snapshot api_key of share %s", shareLabel(s)), s.Snapshot.APIKey)
+		}
+		if s.GoogleDrive != nil {
+			add(fmt.Sprintf("google_drive client_secret of share %s", shareLabel(s)), s.GoogleDrive.ClientSecret)
+		}
+		if s.Azure != nil {
+			add(fmt.Sprintf("azure key of share %s", shareLabel(s)), s.Azure.Key)
+			add(fmt.Sprintf("azure sas_token of share %s", shareLabel(s)), s.Azure.SASToken)
+		}
+		if s.B2 != nil {
+			add(fmt.Sprintf("b2 key of share %s", shareLabel(s)), s.B2.Key)
+		}
+		if s.FTP != nil {
+			add(fmt.Sprintf("ftp password of share %s", shareLabel(s)), s.FTP.Password)
+		}
+		if s.Synology != nil {
+			add(fmt.Sprintf("synology password of share %s", shareLabel(s)), s.Synology.Password)
+		}
+	}
+	if cfg.Ntfy != nil {
+		add("ntfy token", cfg.Ntfy.Token)
+		add("ntfy password", cfg.Ntfy.Password)
+	}
+	if cfg.Pushover != nil {
+		add("pushover token", cfg.Pushover.Token)
+	}
+	if cfg.Telegram != nil {
+		add("telegram bot_token", cfg.Telegram.BotToken)
+	}
+	if cfg.Email != nil {
+		add("email password", cfg.Email.Password)
+	}
+	if cfg.FTPReceiver != nil {
+		add("ftp_receiver password", cfg.FTPReceiver.Password)
+	}
+	if cfg.HTTPReceiver != nil {
+		add("http_receiver token", cfg.HTTPReceiver.Token)
+	}
+	if cfg.GRPC != nil {
+		add("grpc token", cfg.GRPC.Token)
+	}
+	if cfg.API != nil {
+		add("api token", cfg.API.Token)
+	}
+	return out
+}
+
+func dedupeStrings(in []string) []string {
+	seen := map[string]bool{}
+	out := in[:0]
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// keyringService is the OS keyring service SnapVault stores passwords under.
+const keyringService = "snapvault"
+
+// keyringAccount identifies a share's password in the keyring.
+func keyringAccount(c SMBConfig) string {
+	return fmt.Sprintf("%s@%s/%s", c.Username, c.Host, c.Share)
+}
+
+// resolveKeyringPasswords fills in the password of every share marked
+// keyring: true from the OS keyring (macOS Keychain, Secret Service, Windows
+// Credential Manager).
+func resolveKeyringPasswords(cfg *Config) error {
+	for i := range cfg.SMBShares {
+		c := &cfg.SMBShares[i]
+		if !c.Keyring || c.AskPass {
+			continue
+		}
+		pw, err := keyring.Get(keyringService, keyringAccount(*c))
+		if err != nil {
+			return fmt.Errorf("reading password for %s from the keyring: %w", shareLabel(*c), err)
+		}
+		c.Password = pw
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
@@ -14,6 +15,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/zalando/go-keyring"
 )
 
 //go:embed web
@@ -24,13 +27,21 @@ type webServer struct {
 	configPath string
 	timeout    time.Duration
 	workers    int
+	// apiToken guards the import API; apiLoopback is set when the server
+	// only listens on this machine, where it may go without one.
+	apiToken    string
+	apiLoopback bool
 
 	mu     sync.Mutex
 	config *Config
-	job    *transferJob
+	job    *transferJob   // the wizard's current transfer
+	jobs   []*transferJob // every job started this session, oldest first
 }
 
-func runWebServer(configPath, addr string, timeout time.Duration, workers int, openBrowser bool) error {
+// maxJobHistory bounds how many finished jobs the server remembers.
+const maxJobHistory = 50
+
+func runWebServer(configPath, addr, grpcAddr string, timeout time.Duration, workers int, openBrowser bool) error {
 	configData, err := loadConfigRaw(configPath)
 	if err != nil {
 		// Missing config is fine; the user can add shares in the UI.
@@ -43,6 +54,16 @@ func runWebServer(configPath, addr string, timeout time.Duration, workers int, o
 		workers:    workers,
 		config:     configData,
 	}
+	if configData.API != nil {
+		srv.apiToken = strings.TrimSpace(os.ExpandEnv(configData.API.Token))
+	}
+	if srv.apiToken != "" && len(srv.apiToken) < minUploadToken {
+		return fmt.Errorf("api.token must be at least %d characters", minUploadToken)
+	}
+	srv.apiLoopback = isLoopbackAddr(addr)
+	if srv.apiToken == "" && !srv.apiLoopback {
+		slog.Warn("Import API disabled: -addr is reachable from other machines and api.token is not set", "addr", addr)
+	}
 
 	mux := http.NewServeMux()
 
@@ -56,6 +77,7 @@ func runWebServer(configPath, addr string, timeout time.Duration, workers int, o
 	mux.HandleFunc("/api/shares", srv.handleShares)
 	mux.HandleFunc("/api/shares/test", srv.handleTestShare)
 	mux.HandleFunc("/api/shares/delete", srv.handleDeleteShare)
+	mux.HandleFunc("/api/shares/health", srv.handleShareHealth)
 	mux.HandleFunc("/api/mounts", srv.handleMounts)
 	mux.HandleFunc("/api/browse", srv.handleBrowse)
 	mux.HandleFunc("/api/scan", srv.handleScan)
@@ -64,6 +86,8 @@ func runWebServer(configPath, addr string, timeout time.Duration, workers int, o
 	mux.HandleFunc("/api/transfer/events", srv.handleEvents)
 	mux.HandleFunc("/api/settings", srv.handleSettings)
 	mux.HandleFunc("/api/settings/ntfy/test", srv.handleNtfyTest)
+	mux.HandleFunc("/api/imports", srv.requireAPIToken(srv.handleImports))
+	mux.HandleFunc("/api/imports/{id}", srv.requireAPIToken(srv.handleImport))
 
 	httpServer := &http.Server{
 		Addr:    addr,
@@ -74,9 +98,16 @@ func runWebServer(configPath, addr string, timeout time.Duration, workers int, o
 	slog.Info("SnapVault web UI listening", "url", url)
 	fmt.Printf("\n  📸 SnapVault is running at %s\n  Press Ctrl+C to stop.\n\n", url)
 
+	if grpcAddr != "" {
+		if err := startGRPC(grpcAddr, configData.GRPC, srv); err != nil {
+			return err
+		}
+	}
+
 	if openBrowser {
 		go openInBrowser(url)
 	}
+	go runDeferredLoop(context.Background(), configPath, timeout)
 
 	return httpServer.ListenAndServe()
 }
@@ -86,12 +117,14 @@ func runWebServer(configPath, addr string, timeout time.Duration, workers int, o
 // shareDTO is the share representation sent to the browser. It never includes a password.
 type shareDTO struct {
 	Key      string `json:"key"`
+	Name     string `json:"name,omitempty"`
 	Host     string `json:"host"`
 	Port     int    `json:"port"`
 	Share    string `json:"share"`
 	BasePath string `json:"basePath"`
 	Username string `json:"username"`
 	Display  string `json:"display"`
+	Enabled  bool   `json:"enabled"`
 }
 
 func toShareDTO(c SMBConfig) shareDTO {
@@ -101,12 +134,14 @@ func toShareDTO(c SMBConfig) shareDTO {
 	}
 	return shareDTO{
 		Key:      smbShareKey(c),
+		Name:     c.Name,
 		Host:     c.Host,
 		Port:     port,
 		Share:    c.Share,
 		BasePath: c.BasePath,
 		Username: c.Username,
 		Display:  formatShareForDisplay(c),
+		Enabled:  c.enabled(),
 	}
 }
 
@@ -235,6 +270,10 @@ func (s *webServer) handleSettings(w http.ResponseWriter, r *http.Request) {
 			if body.Password == "" {
 				body.Password = prev.Password
 			}
+			// The form doesn't edit event filters; keep whatever the YAML says.
+			if body.Events == nil {
+				body.Events = prev.Events
+			}
 		}
 		if body.Server == "" && body.Topic == "" {
 			s.config.Ntfy = nil // clearing disables notifications
@@ -372,7 +411,14 @@ func (s *webServer) handleScan(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Minute)
 	defer cancel()
 
-	summary, err := scanMedia(ctx, mount)
+	s.mu.Lock()
+	skip, err := newFolderSkipper(s.config)
+	s.mu.Unlock()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	summary, err := scanMedia(ctx, mount, skip)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, fmt.Sprintf("scan failed: %v", err))
 		return
@@ -408,85 +454,234 @@ func (s *webServer) handleStartTransfer(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	s.mu.Lock()
-	if s.job != nil && !s.job.isDone() {
-		s.mu.Unlock()
-		writeError(w, http.StatusConflict, "a transfer is already in progress")
-		return
-	}
-
 	// Resolve selected shares from the saved config.
-	wanted := make(map[string]bool, len(body.ShareKeys))
-	for _, k := range body.ShareKeys {
-		wanted[k] = true
-	}
-	var shares []SMBConfig
-	for _, c := range s.config.SMBShares {
-		if wanted[smbShareKey(c)] {
-			shares = append(shares, expandShare(c))
-		}
-	}
-	s.mu.Unlock()
+	shares := s.resolveShares(body.ShareKeys)
 
 	if len(shares) == 0 {
 		writeError(w, http.StatusBadRequest, "none of the selected shares were found in config")
 		return
 	}
 
-	folderName := fmt.Sprintf("%d - %s", time.Now().Year(), body.Name)
-	job := newTransferJob(folderName)
+	job, running := s.launchJob(body.Mount, body.Name, shares, true)
+	if running != nil {
+		writeError(w, http.StatusConflict, "a transfer is already in progress")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"jobId": job.id, "folderName": job.folderName})
+}
+
+// launchJob registers a new transfer in the job history and starts it in
+// the background, unless a job is still reading from mount; that job is
+// returned instead. A job for the web UI also waits for the UI's previous
+// one and becomes its current job. The check and the launch happen under
+// one lock, so two requests for the same card can't both start.
+func (s *webServer) launchJob(mount, name string, shares []SMBConfig, ui bool) (job, running *transferJob) {
+	folderName := fmt.Sprintf("%d - %s", time.Now().Year(), name)
 
 	s.mu.Lock()
-	s.job = job
+	for _, j := range s.jobs {
+		if j.mount == mount && !j.isDone() {
+			running = j
+			break
+		}
+	}
+	if running == nil && ui && s.job != nil && !s.job.isDone() {
+		running = s.job
+	}
+	if running != nil {
+		s.mu.Unlock()
+		return nil, running
+	}
+	job = newTransferJob(folderName, mount)
+	s.jobs = append(s.jobs, job)
+	s.trimJobHistory()
+	if ui {
+		s.job = job
+	}
 	s.mu.Unlock()
 
-	go s.runJob(job, body.Mount, folderName, shares)
+	go s.runJob(job, mount, name, folderName, shares)
+	return job, nil
+}
+
+// trimJobHistory drops the oldest finished jobs beyond maxJobHistory. Jobs
+// still running are kept however many there are. s.mu must be held.
+func (s *webServer) trimJobHistory() {
+	excess := len(s.jobs) - maxJobHistory
+	if excess <= 0 {
+		return
+	}
+	kept := s.jobs[:0]
+	for _, j := range s.jobs {
+		if excess > 0 && j.isDone() {
+			excess--
+			continue
+		}
+		kept = append(kept, j)
+	}
+	clear(s.jobs[len(kept):])
+	s.jobs = kept
+}
 
-	writeJSON(w, http.StatusOK, map[string]any{"jobId": job.id, "folderName": folderName})
+// findJob looks up a job from this session's history by id.
+func (s *webServer) findJob(id string) *transferJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.id == id {
+			return j
+		}
+	}
+	return nil
 }
 
-func (s *webServer) runJob(job *transferJob, mount, folderName string, shares []SMBConfig) {
+func (s *webServer) runJob(job *transferJob, mount, shoot, folderName string, shares []SMBConfig) {
 	ctx, cancel := context.WithCancel(context.Background())
 	job.setCancel(cancel)
 	defer cancel()
 
 	job.broadcast(jobEvent{Type: "started", FolderName: folderName})
 
-	config := &Config{SMBShares: shares}
-	connections, err := establishConnections(ctx, config, s.timeout)
+	s.mu.Lock()
+	journal := openRunJournal(s.config, folderName, []string{mount})
+	namer, err := newFileNamer(s.config, shoot, folderName)
+	layout, layoutErr := newFolderLayout(s.config)
+	sizes, sizesErr := newSizeFilter(s.config)
+	skip, skipErr := newFolderSkipper(s.config)
+	companions := s.config.CompanionFiles
+	manifestMode, sidecarMode, shootManifestMode := s.config.ChecksumManifest, s.config.XMPSidecar, s.config.ShootManifest
+	readmeCfg := s.config.ShootReadme
+	hashAlg := s.config.HashAlgorithm
+	videoProxy := s.config.VideoProxy
+	gallery := newGalleryWriter(s.config.Gallery)
+	// The import runs with the whole config, as the CLI does, so chunked
+	// uploads, the state dir and every other share-level setting apply.
+	config := *s.config
+	quorum := s.config.Quorum
+	fileTimeout, slowShare, order := s.config.FileTimeout, s.config.SlowShare, s.config.TransferOrder
+	workerRamp := s.config.workerRamp()
+	nameReplacement, nameForm := s.config.FilenameReplacement, s.config.UnicodeNormalization
+	s.mu.Unlock()
+	if err == nil {
+		err = layoutErr
+	}
+	if err == nil {
+		err = sizesErr
+	}
+	if err == nil {
+		err = skipErr
+	}
 	if err != nil {
-		job.finish(fmt.Errorf("establishing SMB connections: %w", err), nil)
+		job.finish(err, nil)
 		return
 	}
-	defer closeConnections(connections)
-
-	hook := &TransferProgressHook{
-		OnStart: func(total int) {
-			job.setTotal(total)
-			job.broadcast(jobEvent{Type: "progress", Total: total, Completed: 0})
-		},
-		OnProgress: func(total, completed int, filePath string) {
-			job.setProgress(total, completed, filePath)
-			job.broadcast(jobEvent{Type: "progress", Total: total, Completed: completed, File: baseName(filePath)})
-		},
+	manifests, err := newManifestWriter(manifestMode)
+	if err != nil {
+		job.finish(err, nil)
+		return
+	}
+	sidecars, err := newXMPSidecarWriter(sidecarMode)
+	if err != nil {
+		job.finish(err, nil)
+		return
+	}
+	shootManifests, err := newShootManifestWriter(shootManifestMode)
+	if err != nil {
+		job.finish(err, nil)
+		return
+	}
+	readmes, err := newShootReadmeWriter(readmeCfg)
+	if err != nil {
+		job.finish(err, nil)
+		return
 	}
 
-	transferErrors, err := processPhotos(ctx, mount, folderName, connections, s.workers, hook)
+	shares, deferred := splitDeferred(shares)
+	if len(shares) == 0 {
+		job.finish(errors.New("every selected share is deferred; select one to import to now"), nil)
+		return
+	}
+	logDeferredShares(deferred)
+	config.SMBShares = shares
+	connections, err := establishConnections(ctx, &config, s.timeout)
+	if err != nil {
+		job.finish(fmt.Errorf("establishing SMB connections: %w", err), nil)
+		return
+	}
+	defer closeConnections(connections)
 
-	total, completed := job.progress()
-	notifyTransferResult(s.ntfyConfig(), folderName, total, completed, time.Since(job.startedAt), err, transferErrors)
+	collector := newReportCollector(folderName, mount, quorum)
+	events := newEventBus()
+	if notify := shareErrorNotifier(s.notifyConfig()); notify != nil {
+		events.subscribe(notify)
+	}
+	events.subscribe(func(e RunEvent) {
+		switch e := e.(type) {
+		case RunStarted:
+			job.setTotal(e.Files)
+			job.broadcast(jobEvent{Type: "progress", Total: e.Files, Completed: 0})
+		case FileCompleted:
+			job.setProgress(e.Total, e.Completed, e.Path)
+			job.broadcast(jobEvent{Type: "progress", Total: e.Total, Completed: e.Completed, File: baseName(e.Path)})
+		}
+	})
+
+	transferErrors, err := processPhotos(ctx, []string{mount}, folderName, connections, TransferOptions{
+		Workers:        s.workers,
+		WorkerRamp:     workerRamp,
+		Replacement:    nameReplacement,
+		NameForm:       nameForm,
+		Hook:           collector.hook(nil),
+		Events:         events,
+		Namer:          namer,
+		Layout:         layout,
+		Sizes:          sizes,
+		Skip:           skip,
+		Companions:     companions,
+		HashAlgorithm:  hashAlg,
+		Manifests:      manifests,
+		Sidecars:       sidecars,
+		ShootManifests: shootManifests,
+		Readmes:        readmes,
+		Gallery:        gallery,
+		Journal:        journal,
+		Catalog:        &config,
+		Order:          order,
+		FileTimeout:    fileTimeout,
+		SlowShare:      slowShare,
+		VideoProxy:     videoProxy,
+		Deferred:       deferred,
+	})
+
+	notifyTransferResult(s.notifyConfig(), collector.build(err, transferErrors))
 
 	job.finish(err, transferErrors)
 }
 
-func (s *webServer) ntfyConfig() *NtfyConfig {
+// notifyConfig returns a copy of just the notification backends, safe to use
+// after the lock is released.
+func (s *webServer) notifyConfig() *Config {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if s.config.Ntfy == nil {
-		return nil
+	out := &Config{}
+	if s.config.Ntfy != nil {
+		c := *s.config.Ntfy
+		out.Ntfy = &c
 	}
-	c := *s.config.Ntfy
-	return &c
+	if s.config.Pushover != nil {
+		c := *s.config.Pushover
+		out.Pushover = &c
+	}
+	if s.config.Telegram != nil {
+		c := *s.config.Telegram
+		out.Telegram = &c
+	}
+	if s.config.Email != nil {
+		c := *s.config.Email
+		out.Email = &c
+	}
+	return out
 }
 
 func (s *webServer) handleCancelTransfer(w http.ResponseWriter, r *http.Request) {
@@ -554,6 +749,11 @@ func (s *webServer) handleEvents(w http.ResponseWriter, r *http.Request) {
 
 func expandShare(c SMBConfig) SMBConfig {
 	c.Password = os.ExpandEnv(c.Password)
+	if c.Keyring {
+		if pw, err := keyring.Get(keyringService, keyringAccount(c)); err == nil {
+			c.Password = pw
+		}
+	}
 	return c
 }
 
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// enabled reports whether the share takes part in imports; shares are
+// enabled unless the config says `enabled: false`.
+func (c SMBConfig) enabled() bool {
+	return c.Enabled == nil || *c.Enabled
+}
+
+// matchesShareName reports whether a -only-share/-skip-share value refers to
+// this share: its name, host/share, host, share name or rclone remote,
+// ignoring case.
+func matchesShareName(c SMBConfig, name string) bool {
+	for _, candidate := range []string{c.Name, c.Host + "/" + c.Share, c.Host, c.Share, strings.TrimSpace(c.Rclone)} {
+		if candidate != "" && strings.EqualFold(candidate, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectShares applies the enabled flags and the command-line filters.
+// Naming a disabled share in only turns it back on for this run. A name that
+// matches no share is an error, so a typo can't silently skip a backup.
+func selectShares(shares []SMBConfig, only, skip []string) ([]SMBConfig, error) {
+	for _, name := range append(append([]string(nil), only...), skip...) {
+		found := false
+		for _, c := range shares {
+			if matchesShareName(c, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no configured share matches %q", name)
+		}
+	}
+
+	var selected []SMBConfig
+	for _, c := range shares {
+		named := func(names []string) bool {
+			for _, name := range names {
+				if matchesShareName(c, name) {
+					return true
+				}
+			}
+			return false
+		}
+		switch {
+		case named(skip):
+			continue
+		case len(only) > 0:
+			if named(only) {
+				selected = append(selected, c)
+			}
+		case c.enabled():
+			selected = append(selected, c)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no shares left after applying enabled flags and share filters")
+	}
+	return selected, nil
+}
+
+// askPasswords prompts on the terminal for the password of every share that
+// has ask_pass set or is named in names ("all" for every share), so the
+// config never has to hold them. Shares on the same host with the same user
+// are asked once.
+func askPasswords(shares []SMBConfig, names []string) error {
+	all := false
+	for _, n := range names {
+		if strings.EqualFold(n, "all") {
+			all = true
+		}
+	}
+	if !all {
+		for _, n := range names {
+			found := false
+			for _, c := range shares {
+				found = found || matchesShareName(c, n)
+			}
+			if !found {
+				return fmt.Errorf("-ask-pass: no selected share matches %q", n)
+			}
+		}
+	}
+
+	asked := map[string]string{}
+	var stdin *bufio.Reader
+	for i := range shares {
+		c := &shares[i]
+		wanted := all || c.AskPass
+		for _, n := range names {
+			wanted = wanted || matchesShareName(*c, n)
+		}
+		if !wanted || c.isCloud() {
+			continue
+		}
+		key := strings.ToLower(c.Host + "|" + c.Username)
+		if pw, ok := asked[key]; ok {
+			c.Password = pw
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "Password for %s (%s@%s): ", shareLabel(*c), c.Username, c.Host)
+		var pw string
+		if term.IsTerminal(int(os.Stdin.Fd())) {
+			b, err := term.ReadPassword(int(os.Stdin.Fd()))
+			fmt.Fprintln(os.Stderr)
+			if err != nil {
+				return fmt.Errorf("reading password: %w", err)
+			}
+			pw = string(b)
+		} else {
+			// Piped input, one password per line, for scripts.
+			if stdin == nil {
+				stdin = bufio.NewReader(os.Stdin)
+			}
+			line, err := stdin.ReadString('\n')
+			if err != nil && line == "" {
+				return fmt.Errorf("reading password: %w", err)
+			}
+			pw = strings.TrimRight(line, "\r\n")
+		}
+		c.Password = pw
+		asked[key] = pw
+	}
+	return nil
+}
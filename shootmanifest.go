@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+	"github.com/rwcarlsen/goexif/mknote"
+	"github.com/rwcarlsen/goexif/tiff"
+)
+
+// Shoot manifest formats for Config.ShootManifest.
+const (
+	shootManifestCSV  = "csv"
+	shootManifestJSON = "json"
+)
+
+// shootManifestName is the file in the shoot root, plus the format's extension.
+const shootManifestName = "MANIFEST"
+
+// shootManifestEntry is one file of a shoot manifest.
+type shootManifestEntry struct {
+	Path         string    `json:"path"` // relative to the shoot folder
+	Size         int64     `json:"size"`
+	Algorithm    string    `json:"algorithm"`
+	Checksum     string    `json:"checksum"`
+	Captured     time.Time `json:"captured"`
+	CameraSerial string    `json:"cameraSerial,omitempty"`
+	SourcePath   string    `json:"sourcePath"`
+
+	key string // sequenceKey
+}
+
+var shootManifestHeader = []string{"path", "size", "algorithm", "checksum", "captured", "camera_serial", "source_path"}
+
+// shootManifestWriter lists every file a share received, with its checksum,
+// capture time, camera serial and card path, in one CSV or JSON file at the
+// root of the shoot folder. Unlike checksum manifests it is one file per
+// shoot, for archive policies that want an inventory next to the data.
+type shootManifestWriter struct {
+	format string
+
+	mu      sync.Mutex
+	pending map[*SMBConnection]map[string][]shootManifestEntry // conn -> shoot root -> files
+	serials map[string]string                                  // source -> camera serial
+}
+
+// newShootManifestWriter returns nil when shoot manifests are disabled.
+func newShootManifestWriter(format string) (*shootManifestWriter, error) {
+	switch format {
+	case "":
+		return nil, nil
+	case shootManifestCSV, shootManifestJSON:
+		return &shootManifestWriter{
+			format:  format,
+			pending: map[*SMBConnection]map[string][]shootManifestEntry{},
+			serials: map[string]string{},
+		}, nil
+	default:
+		return nil, fmt.Errorf("shoot_manifest must be %q or %q, got %q", shootManifestCSV, shootManifestJSON, format)
+	}
+}
+
+// add records a finished copy. The camera serial is read while the file is
+// still in the page cache, once per source.
+func (m *shootManifestWriter) add(conn *SMBConnection, job TransferJob, res copyResult) {
+	m.mu.Lock()
+	serial, ok := m.serials[job.SourcePath]
+	m.mu.Unlock()
+	if !ok {
+		serial = cameraSerial(job.SourcePath)
+	}
+
+	root := shootRoot(conn, job.FolderName)
+	e := shootManifestEntry{
+		Path:         strings.TrimPrefix(strings.TrimPrefix(res.DestPath, root), "/"),
+		Size:         job.Size,
+		Algorithm:    res.Algorithm,
+		Checksum:     hex.EncodeToString(res.Sum),
+		Captured:     job.PhotoDate,
+		CameraSerial: serial,
+		SourcePath:   job.SourcePath,
+		key:          sequenceKey(job),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.serials[job.SourcePath] = serial
+	roots := m.pending[conn]
+	if roots == nil {
+		roots = map[string][]shootManifestEntry{}
+		m.pending[conn] = roots
+	}
+	roots[root] = append(roots[root], e)
+}
+
+// flush writes one manifest per shoot folder per share, merging with the
+// manifest an earlier card of the same shoot left there. RAW files whose
+// serial goexif can't read take their JPEG sibling's.
+func (m *shootManifestWriter) flush() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bySibling := map[string]string{}
+	for _, roots := range m.pending {
+		for _, entries := range roots {
+			for _, e := range entries {
+				if e.CameraSerial != "" {
+					bySibling[e.key] = e.CameraSerial
+				}
+			}
+		}
+	}
+
+	name := shootManifestName + "." + m.format
+	for conn, roots := range m.pending {
+		fs := conn.Share
+		for root, entries := range roots {
+			manifestPath := path.Join(root, name)
+			merged := map[string]shootManifestEntry{}
+			if existing, err := fs.ReadFile(manifestPath); err == nil {
+				old, err := m.parse(existing)
+				if err != nil {
+					slog.Warn("Replacing unreadable shoot manifest", "path", manifestPath, "share", shareLabel(conn.Config), "error", err)
+				}
+				for _, e := range old {
+					merged[e.Path] = e
+				}
+			}
+			for _, e := range entries {
+				if e.CameraSerial == "" {
+					e.CameraSerial = bySibling[e.key]
+				}
+				merged[e.Path] = e
+			}
+			data, err := m.render(path.Base(root), merged)
+			if err == nil {
+				err = fs.WriteFile(manifestPath, data, 0o644)
+			}
+			if err != nil {
+				slog.Warn("Failed to write shoot manifest", "path", manifestPath, "share", shareLabel(conn.Config), "error", err)
+			}
+		}
+	}
+	m.pending = map[*SMBConnection]map[string][]shootManifestEntry{}
+	m.serials = map[string]string{}
+}
+
+// shootManifestJSONFile is the layout of MANIFEST.json.
+type shootManifestJSONFile struct {
+	Shoot   string               `json:"shoot"`
+	Updated time.Time            `json:"updated"`
+	Files   []shootManifestEntry `json:"files"`
+}
+
+func (m *shootManifestWriter) parse(data []byte) ([]shootManifestEntry, error) {
+	if m.format == shootManifestJSON {
+		var f shootManifestJSONFile
+		err := json.Unmarshal(data, &f)
+		return f.Files, err
+	}
+	rows, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var out []shootManifestEntry
+	for i, row := range rows {
+		if i == 0 || len(row) != len(shootManifestHeader) {
+			continue
+		}
+		size, _ := strconv.ParseInt(row[1], 10, 64)
+		captured, _ := time.Parse(time.RFC3339, row[4])
+		out = append(out, shootManifestEntry{
+			Path: row[0], Size: size, Algorithm: row[2], Checksum: row[3],
+			Captured: captured, CameraSerial: row[5], SourcePath: row[6],
+		})
+	}
+	return out, nil
+}
+
+// render lays the manifest out sorted by path.
+func (m *shootManifestWriter) render(shoot string, entries map[string]shootManifestEntry) ([]byte, error) {
+	files := make([]shootManifestEntry, 0, len(entries))
+	for _, e := range entries {
+		files = append(files, e)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	if m.format == shootManifestJSON {
+		return json.MarshalIndent(shootManifestJSONFile{Shoot: shoot, Updated: time.Now().UTC(), Files: files}, "", "  ")
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(shootManifestHeader)
+	for _, e := range files {
+		w.Write([]string{
+			e.Path, strconv.FormatInt(e.Size, 10), e.Algorithm, e.Checksum,
+			e.Captured.Format(time.RFC3339), e.CameraSerial, e.SourcePath,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// EXIF tag 0xA431, BodySerialNumber, in the Exif sub-IFD. goexif doesn't
+// load it.
+const tagBodySerialNumber = 0xA431
+
+// cameraSerial reads the body serial number from a file's EXIF: the standard
+// tag first, then Canon and Nikon maker notes, which older bodies use.
+func cameraSerial(sourcePath string) string {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	x, err := exif.Decode(f)
+	if err != nil {
+		return ""
+	}
+	if ptr, err := x.Get(exif.ExifIFDPointer); err == nil {
+		if off, err := ptr.Int64(0); err == nil && off > 0 && off < int64(len(x.Raw)) {
+			r := bytes.NewReader(x.Raw)
+			r.Seek(off, 0)
+			if dir, _, err := tiff.DecodeDir(r, x.Tiff.Order); err == nil {
+				for _, tag := range dir.Tags {
+					if tag.Id == tagBodySerialNumber {
+						if s := tagText(tag); s != "" {
+							return s
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if m, err := x.Get(exif.MakerNote); err == nil && len(m.Val) >= 10 {
+		mknote.Canon.Parse(x)
+		mknote.NikonV3.Parse(x)
+		for _, field := range []exif.FieldName{mknote.SerialNumber, mknote.Nikon_SerialNO} {
+			if tag, err := x.Get(field); err == nil {
+				if s := strings.TrimPrefix(tagText(tag), "NO="); s != "" {
+					return strings.TrimSpace(s)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func tagText(tag *tiff.Tag) string {
+	if s, err := tag.StringVal(); err == nil {
+		return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+	}
+	if v, err := tag.Int64(0); err == nil && v > 0 {
+		return strconv.FormatInt(v, 10)
+	}
+	return ""
+}
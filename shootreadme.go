@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// ShootReadmeConfig writes a README.txt summing up each import into the
+// shoot folder, for whoever opens the folder years later.
+type ShootReadmeConfig struct {
+	// Template is a Go text/template for the summary; empty uses the
+	// built-in one. See shootReadmeData for the fields.
+	Template string `yaml:"template,omitempty"`
+	// TemplateFile reads the template from a file instead.
+	TemplateFile string `yaml:"template_file,omitempty"`
+}
+
+const shootReadmeFile = "README.txt"
+
+const defaultShootReadme = `{{.Shoot}}
+
+Captured   {{.First.Format "2006-01-02 15:04"}} to {{.Last.Format "2006-01-02 15:04"}}
+Files      {{.Files}} ({{bytes .Bytes}})
+
+By camera
+{{range .Cameras}}  {{printf "%-30s %6d" .Name .Count}}
+{{end}}
+By type
+{{range .Types}}  {{printf "%-30s %6d" .Name .Count}}
+{{end}}
+Imported   {{.Imported.Format "2006-01-02 15:04"}} on {{.Machine}} in {{.Duration}}
+From       {{join .Sources ", "}}
+`
+
+// shootReadmeData is what a README template sees.
+type shootReadmeData struct {
+	Shoot       string
+	First, Last time.Time // earliest and latest capture time
+	Files       int
+	Bytes       int64
+	Cameras     []shootCount // by file count, most first
+	Types       []shootCount // by extension, e.g. "CR3"
+	Machine     string
+	Imported    time.Time // when the copy finished
+	Duration    time.Duration
+	Sources     []string // card mounts
+}
+
+type shootCount struct {
+	Name  string
+	Count int
+}
+
+// shootReadmeWriter collects what each share received during a run and
+// writes the summaries when it ends. A later import into the same shoot adds
+// its summary below the earlier ones.
+type shootReadmeWriter struct {
+	tmpl *template.Template
+
+	mu      sync.Mutex
+	started time.Time
+	pending map[*SMBConnection]map[string][]readmeItem // conn -> shoot root -> files
+	cameras map[string]string                          // source -> camera
+}
+
+type readmeItem struct {
+	job    TransferJob
+	camera string
+}
+
+// newShootReadmeWriter returns nil when cfg is nil.
+func newShootReadmeWriter(cfg *ShootReadmeConfig) (*shootReadmeWriter, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	text := cfg.Template
+	if cfg.TemplateFile != "" {
+		data, err := os.ReadFile(os.ExpandEnv(cfg.TemplateFile))
+		if err != nil {
+			return nil, fmt.Errorf("shoot_readme.template_file: %w", err)
+		}
+		text = string(data)
+	}
+	if text == "" {
+		text = defaultShootReadme
+	}
+	tmpl, err := parseShootReadme(text)
+	if err != nil {
+		return nil, fmt.Errorf("parsing shoot_readme template: %w", err)
+	}
+	return &shootReadmeWriter{
+		tmpl:    tmpl,
+		pending: map[*SMBConnection]map[string][]readmeItem{},
+		cameras: map[string]string{},
+	}, nil
+}
+
+func parseShootReadme(text string) (*template.Template, error) {
+	return template.New("readme").Funcs(template.FuncMap{
+		"bytes": formatBytes,
+		"join":  strings.Join,
+	}).Parse(text)
+}
+
+// add records a finished copy.
+func (w *shootReadmeWriter) add(conn *SMBConnection, job TransferJob) {
+	w.mu.Lock()
+	camera, ok := w.cameras[job.SourcePath]
+	w.mu.Unlock()
+	if !ok {
+		camera = cameraName(job.SourcePath)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.started.IsZero() {
+		w.started = time.Now()
+	}
+	w.cameras[job.SourcePath] = camera
+	root := shootRoot(conn, job.FolderName)
+	roots := w.pending[conn]
+	if roots == nil {
+		roots = map[string][]readmeItem{}
+		w.pending[conn] = roots
+	}
+	roots[root] = append(roots[root], readmeItem{job: job, camera: camera})
+}
+
+// flush writes the summaries of the run.
+func (w *shootReadmeWriter) flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	defer func() {
+		w.pending = map[*SMBConnection]map[string][]readmeItem{}
+		w.cameras = map[string]string{}
+		w.started = time.Time{}
+	}()
+
+	bySibling := map[string]string{}
+	for _, roots := range w.pending {
+		for _, items := range roots {
+			for _, it := range items {
+				if it.camera != "" {
+					bySibling[sequenceKey(it.job)] = it.camera
+				}
+			}
+		}
+	}
+	machine, _ := os.Hostname()
+	now := time.Now()
+
+	for conn, roots := range w.pending {
+		for root, items := range roots {
+			data := shootReadmeData{
+				Shoot:    path.Base(root),
+				Files:    len(items),
+				Machine:  machine,
+				Imported: now,
+				Duration: now.Sub(w.started).Round(time.Second),
+			}
+			cameras, types, sources := map[string]int{}, map[string]int{}, map[string]bool{}
+			for _, it := range items {
+				j := it.job
+				data.Bytes += j.Size
+				if data.First.IsZero() || j.PhotoDate.Before(data.First) {
+					data.First = j.PhotoDate
+				}
+				if j.PhotoDate.After(data.Last) {
+					data.Last = j.PhotoDate
+				}
+				camera := it.camera
+				if camera == "" {
+					camera = bySibling[sequenceKey(j)]
+				}
+				if camera == "" {
+					camera = "unknown"
+				}
+				cameras[camera]++
+				types[strings.ToUpper(strings.TrimPrefix(filepath.Ext(j.SourcePath), "."))]++
+				if j.SourceRoot != "" {
+					sources[j.SourceRoot] = true
+				}
+			}
+			data.Cameras, data.Types = sortedCounts(cameras), sortedCounts(types)
+			for s := range sources {
+				data.Sources = append(data.Sources, s)
+			}
+			sort.Strings(data.Sources)
+
+			var buf bytes.Buffer
+			if err := w.tmpl.Execute(&buf, data); err != nil {
+				slog.Warn("Failed to render shoot README", "folder", root, "error", err)
+				continue
+			}
+			readmePath := path.Join(root, shootReadmeFile)
+			text := buf.Bytes()
+			if existing, err := conn.Share.ReadFile(readmePath); err == nil && len(existing) > 0 {
+				text = append(append(bytes.TrimRight(existing, "\n"), "\n\n"...), text...)
+			}
+			if err := conn.Share.WriteFile(readmePath, text, 0o644); err != nil {
+				slog.Warn("Failed to write shoot README", "path", readmePath, "share", shareLabel(conn.Config), "error", err)
+			}
+		}
+	}
+}
+
+func sortedCounts(m map[string]int) []shootCount {
+	out := make([]shootCount, 0, len(m))
+	for name, n := range m {
+		out = append(out, shootCount{name, n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+// cameraName is the camera body from a file's EXIF, e.g. "Canon EOS R5", or
+// "" when the file has none SnapVault can read.
+func cameraName(sourcePath string) string {
+	f, err := os.Open(sourcePath)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	x, err := exif.Decode(f)
+	if err != nil {
+		return ""
+	}
+	var maker, model string
+	if tag, err := x.Get(exif.Make); err == nil {
+		maker = tagText(tag)
+	}
+	if tag, err := x.Get(exif.Model); err == nil {
+		model = tagText(tag)
+	}
+	if maker == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(strings.Fields(maker)[0])) {
+		return model
+	}
+	return strings.TrimSpace(maker + " " + model)
+}
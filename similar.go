@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/jpeg"
+	"log/slog"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// similarThreshold is the largest Hamming distance between two 64-bit
+// difference hashes still treated as the same scene.
+const similarThreshold = 10
+
+// similarGroup is a run of consecutive near-identical frames, typically a burst.
+type similarGroup struct {
+	Files []string
+}
+
+// findSimilarJPEGs groups JPEGs whose perceptual hashes are within
+// similarThreshold of the previous frame in capture order. It is an estimate of
+// how much culling awaits, not a decision: nothing is skipped because of it.
+func findSimilarJPEGs(ctx context.Context, jobs []TransferJob) []similarGroup {
+	type hashed struct {
+		job  TransferJob
+		hash uint64
+	}
+	var frames []hashed
+	for _, job := range jobs {
+		if ctx.Err() != nil {
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(job.SourcePath))
+		if ext != ".jpg" && ext != ".jpeg" {
+			continue
+		}
+		h, err := jpegDHash(job.SourcePath)
+		if err != nil {
+			slog.Debug("Skipping similarity hash", "file", job.SourcePath, "error", err)
+			continue
+		}
+		frames = append(frames, hashed{job: job, hash: h})
+	}
+	sort.SliceStable(frames, func(i, j int) bool {
+		if !frames[i].job.PhotoDate.Equal(frames[j].job.PhotoDate) {
+			return frames[i].job.PhotoDate.Before(frames[j].job.PhotoDate)
+		}
+		return frames[i].job.SourcePath < frames[j].job.SourcePath
+	})
+
+	var groups []similarGroup
+	var current []string
+	flush := func() {
+		if len(current) > 1 {
+			groups = append(groups, similarGroup{Files: current})
+		}
+		current = nil
+	}
+	for i, f := range frames {
+		if i > 0 && bits.OnesCount64(f.hash^frames[i-1].hash) > similarThreshold {
+			flush()
+		}
+		current = append(current, f.job.SourcePath)
+	}
+	flush()
+	return groups
+}
+
+// jpegDHash computes a 64-bit difference hash. The EXIF thumbnail is used when
+// present since decoding a full-size frame for a 9x8 grid is wasted work.
+func jpegDHash(path string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var img image.Image
+	if x, err := exif.Decode(f); err == nil {
+		if thumb, err := x.JpegThumbnail(); err == nil {
+			img, _ = jpeg.Decode(bytes.NewReader(thumb))
+		}
+	}
+	if img == nil {
+		if _, err := f.Seek(0, 0); err != nil {
+			return 0, err
+		}
+		if img, err = jpeg.Decode(f); err != nil {
+			return 0, err
+		}
+	}
+	return dHash(img), nil
+}
+
+// dHash shrinks img to a 9x8 grayscale grid by area averaging and sets one bit
+// per horizontally adjacent pair whose left cell is brighter.
+func dHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	b := img.Bounds()
+	var grid [h][w]float64
+	for gy := 0; gy < h; gy++ {
+		y0 := b.Min.Y + gy*b.Dy()/h
+		y1 := max(y0+1, b.Min.Y+(gy+1)*b.Dy()/h)
+		for gx := 0; gx < w; gx++ {
+			x0 := b.Min.X + gx*b.Dx()/w
+			x1 := max(x0+1, b.Min.X+(gx+1)*b.Dx()/w)
+			var sum float64
+			var n int
+			// Sample a sparse lattice within the cell; full averaging of a
+			// 45MP frame would dominate the pass.
+			stepY := max(1, (y1-y0)/8)
+			stepX := max(1, (x1-x0)/8)
+			for y := y0; y < y1; y += stepY {
+				for x := x0; x < x1; x += stepX {
+					r, g, bl, _ := img.At(x, y).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+					n++
+				}
+			}
+			grid[gy][gx] = sum / float64(n)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if grid[y][x] > grid[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
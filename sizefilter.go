@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultTinyRAW is the size below which a RAW file is taken to be damaged,
+// such as a write cut short by pulling the card. The smallest compressed
+// RAW of a current body is several megabytes.
+const defaultTinyRAW = 1 << 20
+
+// sizeFilter skips files outside min_file_size and max_file_size, and holds
+// the tiny_raw thresholds.
+type sizeFilter struct {
+	min, max int64            // 0 is no limit
+	tinyRAW  map[string]int64 // extension -> threshold
+}
+
+// newSizeFilter reads the size settings from cfg.
+func newSizeFilter(cfg *Config) (*sizeFilter, error) {
+	f := &sizeFilter{tinyRAW: map[string]int64{}}
+	for ext, folder := range defaultTypeFolders {
+		if folder == "RAW" {
+			f.tinyRAW[ext] = defaultTinyRAW
+		}
+	}
+	if cfg == nil {
+		return f, nil
+	}
+	var err error
+	if cfg.MinFileSize != "" {
+		if f.min, err = parseByteSize(cfg.MinFileSize); err != nil {
+			return nil, fmt.Errorf("min_file_size: %w", err)
+		}
+	}
+	if cfg.MaxFileSize != "" {
+		if f.max, err = parseByteSize(cfg.MaxFileSize); err != nil {
+			return nil, fmt.Errorf("max_file_size: %w", err)
+		}
+	}
+	if f.max > 0 && f.min > f.max {
+		return nil, fmt.Errorf("min_file_size %s is above max_file_size %s", cfg.MinFileSize, cfg.MaxFileSize)
+	}
+	for ext, size := range cfg.TinyRAW {
+		ext, n, err := normalizeTinyRAW(ext, size)
+		if err != nil {
+			return nil, fmt.Errorf("tiny_raw: %w", err)
+		}
+		f.tinyRAW[ext] = n
+	}
+	return f, nil
+}
+
+// normalizeTinyRAW checks one tiny_raw entry, accepting the extension with
+// or without its dot and in any case.
+func normalizeTinyRAW(ext, size string) (string, int64, error) {
+	ext = strings.ToLower(strings.TrimSpace(ext))
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	if !photoExtensions[ext] {
+		return "", 0, fmt.Errorf("%q is not a file type SnapVault imports", ext)
+	}
+	n, err := parseByteSize(size)
+	if err != nil {
+		return "", 0, fmt.Errorf("%s: %w", ext, err)
+	}
+	return ext, n, nil
+}
+
+// inRange reports whether a file of size bytes is imported at all.
+func (f *sizeFilter) inRange(size int64) bool {
+	if f == nil {
+		return true
+	}
+	return size >= f.min && (f.max == 0 || size <= f.max)
+}
+
+// tiny returns the threshold a file of size bytes falls below, or 0 when it
+// is large enough for its type. A nil filter uses the defaults.
+func (f *sizeFilter) tiny(ext string, size int64) int64 {
+	var limit int64
+	if f == nil {
+		if defaultTypeFolders[ext] == "RAW" {
+			limit = defaultTinyRAW
+		}
+	} else {
+		limit = f.tinyRAW[ext]
+	}
+	if size < limit {
+		return limit
+	}
+	return 0
+}
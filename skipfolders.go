@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// defaultSkipFolders are the folders cameras fill with their own
+// bookkeeping. Some of it has photo extensions, like Sony's video thumbnail
+// JPEGs, and would otherwise be imported as if it were a shot.
+var defaultSkipFolders = []string{
+	"THMBNL",   // Sony XAVC clip thumbnails
+	"MISC",     // DPOF print orders
+	"CANONMSC", // Canon folder numbering
+	"PRIVATE/AVCHD/AVCHDTN",
+	"PRIVATE/AVCHD/BDMV/BACKUP",
+	"PRIVATE/AVCHD/BDMV/CLIPINF",
+	"PRIVATE/AVCHD/BDMV/PLAYLIST",
+}
+
+// defaultFolderSkipper applies only the built-in rules, for commands that
+// don't read a config.
+var defaultFolderSkipper = &folderSkipper{skip: defaultSkipFolders}
+
+// folderSkipper decides which card folders are never walked. A rule without
+// a slash matches a folder name at any depth; one with a slash matches the
+// path from the card root. Both compare ignoring case, as on the card.
+type folderSkipper struct {
+	skip []string
+	keep []string
+}
+
+// newFolderSkipper combines the built-in rules with skip_folders and
+// keep_folders from cfg.
+func newFolderSkipper(cfg *Config) (*folderSkipper, error) {
+	s := &folderSkipper{skip: slices.Clone(defaultSkipFolders)}
+	if cfg == nil {
+		return s, nil
+	}
+	for _, field := range []struct {
+		key   string
+		rules []string
+		into  *[]string
+	}{
+		{"skip_folders", cfg.SkipFolders, &s.skip},
+		{"keep_folders", cfg.KeepFolders, &s.keep},
+	} {
+		for _, rule := range field.rules {
+			rule, err := normalizeFolderRule(rule)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", field.key, err)
+			}
+			*field.into = append(*field.into, rule)
+		}
+	}
+	return s, nil
+}
+
+// normalizeFolderRule checks one skip_folders or keep_folders entry.
+func normalizeFolderRule(rule string) (string, error) {
+	rule = strings.Trim(strings.ReplaceAll(strings.TrimSpace(rule), `\`, "/"), "/")
+	if rule == "" || rule == "." {
+		return "", fmt.Errorf("empty folder rule")
+	}
+	if _, err := path.Match(rule, ""); err != nil {
+		return "", fmt.Errorf("%q: %w", rule, err)
+	}
+	return path.Clean(rule), nil
+}
+
+// skips reports whether the folder dir, under the card root, is left out. A
+// nil skipper applies the built-in rules.
+func (s *folderSkipper) skips(root, dir string) bool {
+	if s == nil {
+		s = defaultFolderSkipper
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = strings.ToLower(filepath.ToSlash(rel))
+	return matchesFolderRule(s.skip, rel) && !matchesFolderRule(s.keep, rel)
+}
+
+func matchesFolderRule(rules []string, rel string) bool {
+	for _, rule := range rules {
+		rule = strings.ToLower(rule)
+		target := rel
+		if !strings.Contains(rule, "/") {
+			target = path.Base(rel)
+		}
+		if ok, _ := path.Match(rule, target); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+	"golang.org/x/term"
+)
+
+// sourcePasswordEnv holds the password of an smb:// source when no
+// configured share on the same server has one.
+const sourcePasswordEnv = "SNAPVAULT_SOURCE_PASSWORD"
+
+// isSMBSource reports whether a -mount value is an smb:// URL rather than a
+// local folder.
+func isSMBSource(mount string) bool {
+	return strings.HasPrefix(strings.ToLower(mount), "smb://")
+}
+
+// smbSource is a network folder to import from.
+type smbSource struct {
+	config SMBConfig // Host, Port, Share and the login
+	dir    string    // folder within the share, slash-separated
+}
+
+// parseSMBSource parses smb://[user@]host[:port]/share[/folder]. A password
+// in the URL is refused, since it would show up in logs and process lists.
+func parseSMBSource(raw string) (smbSource, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return smbSource{}, err
+	}
+	if _, ok := u.User.Password(); ok {
+		return smbSource{}, fmt.Errorf("put the password in $%s or a configured share, not in the URL", sourcePasswordEnv)
+	}
+	share, dir, _ := strings.Cut(strings.Trim(u.Path, "/"), "/")
+	if u.Hostname() == "" || share == "" {
+		return smbSource{}, errors.New("expected smb://[user@]host[:port]/share[/folder]")
+	}
+	s := smbSource{config: SMBConfig{Host: u.Hostname(), Share: share, Username: u.User.Username()}, dir: dir}
+	if p := u.Port(); p != "" {
+		if s.config.Port, err = strconv.Atoi(p); err != nil {
+			return smbSource{}, fmt.Errorf("port %q is not a number", p)
+		}
+	}
+	return s, nil
+}
+
+// String is the source's URL, for logs and reports.
+func (s smbSource) String() string {
+	u := url.URL{Scheme: "smb", Host: s.config.Host, Path: "/" + path.Join(s.config.Share, s.dir)}
+	if s.config.Port != 0 {
+		u.Host += ":" + strconv.Itoa(s.config.Port)
+	}
+	if s.config.Username != "" {
+		u.User = url.User(s.config.Username)
+	}
+	return u.String()
+}
+
+// login fills in the source's credentials: from a configured share on the
+// same server (and with the same user, when the URL names one), else from
+// $SNAPVAULT_SOURCE_PASSWORD, else asked for on a terminal.
+func (s *smbSource) login(shares []SMBConfig) error {
+	for _, c := range shares {
+		if c.isCloud() || !strings.EqualFold(c.Host, s.config.Host) || c.Password == "" {
+			continue
+		}
+		if s.config.Username == "" || strings.EqualFold(c.Username, s.config.Username) {
+			s.config.Username, s.config.Password = c.Username, c.Password
+			return nil
+		}
+	}
+	if pw, ok := os.LookupEnv(sourcePasswordEnv); ok {
+		s.config.Password = pw
+		return nil
+	}
+	if s.config.Username == "" || !term.IsTerminal(int(os.Stdin.Fd())) {
+		// Guest access, or a server that needs no password.
+		return nil
+	}
+	fmt.Fprintf(os.Stderr, "Password for %s: ", s)
+	b, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return fmt.Errorf("reading password: %w", err)
+	}
+	s.config.Password = string(b)
+	return nil
+}
+
+// stageSMBSource downloads the photos, videos and companion files under the
+// source folder into staging, keeping the folder structure and modification
+// times so dates and the rest of the pipeline work as for a card. It returns
+// the number of files downloaded.
+func stageSMBSource(ctx context.Context, src smbSource, staging string, timeout time.Duration) (int, error) {
+	session, err := connectSMB(ctx, src.config, timeout)
+	if err != nil {
+		return 0, fmt.Errorf("connecting to %s: %w", src, classifyError(err))
+	}
+	defer session.Logoff()
+	share, err := session.Mount(src.config.Share)
+	if err != nil {
+		return 0, fmt.Errorf("mounting %s: %w", src, classifyError(err))
+	}
+	defer share.Umount()
+	share = share.WithContext(ctx)
+
+	root := src.dir
+	if root == "" {
+		root = "."
+	}
+	if info, err := share.Stat(root); err != nil {
+		return 0, fmt.Errorf("opening %s: %w", src, err)
+	} else if !info.IsDir() {
+		return 0, fmt.Errorf("%s is not a folder", src)
+	}
+
+	count := 0
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := share.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("listing %s: %w", dir, err)
+		}
+		for _, e := range entries {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if isSystemMetadata(e.Name()) {
+				continue
+			}
+			remote := path.Join(dir, e.Name())
+			if e.IsDir() {
+				if err := walk(remote); err != nil {
+					return err
+				}
+				continue
+			}
+			if !importableExtension(path.Ext(e.Name())) {
+				continue
+			}
+			rel := remote
+			if root != "." {
+				rel = strings.TrimPrefix(remote, root+"/")
+			}
+			local := filepath.Join(staging, filepath.FromSlash(rel))
+			if err := downloadSMBFile(share, remote, local, e); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	}
+	slog.Info("Downloading from network folder", "source", src.String())
+	if err := walk(root); err != nil {
+		return count, err
+	}
+	return count, nil
+}
+
+// downloadSMBFile copies the file remote to local, with its modification
+// time, and checks the size.
+func downloadSMBFile(share *smb2.Share, remote, local string, info os.FileInfo) error {
+	if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return fmt.Errorf("creating staging folder: %w", err)
+	}
+	in, err := share.Open(remote)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", remote, err)
+	}
+	defer in.Close()
+	out, err := os.Create(local)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", local, err)
+	}
+	n, err := io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n != info.Size() {
+		err = fmt.Errorf("%w: read %d bytes, file is %d bytes", errSizeMismatch, n, info.Size())
+	}
+	if err != nil {
+		return fmt.Errorf("downloading %s: %w", remote, err)
+	}
+	return os.Chtimes(local, info.ModTime(), info.ModTime())
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// SnapshotConfig takes a ZFS snapshot of the dataset behind a share after
+// every import it received in full, so each shoot gets a point the files can
+// be recovered from even after they are deleted or encrypted by ransomware.
+type SnapshotConfig struct {
+	// Dataset is the ZFS dataset holding the share, e.g. "tank/photos".
+	Dataset string `yaml:"dataset"`
+	// TrueNAS is the address of a TrueNAS server, e.g.
+	// "https://truenas.local", to snapshot through its API with APIKey.
+	TrueNAS string `yaml:"truenas,omitempty"`
+	APIKey  string `yaml:"api_key,omitempty"`
+	// InsecureTLS accepts a self-signed TrueNAS certificate.
+	InsecureTLS bool `yaml:"insecure_tls,omitempty"`
+	// SSH runs zfs snapshot on this host instead, e.g. "root@nas.local",
+	// with the ssh command and its keys.
+	SSH string `yaml:"ssh,omitempty"`
+	// Recursive also snapshots the dataset's children.
+	Recursive bool `yaml:"recursive,omitempty"`
+}
+
+// snapshotTimeout bounds one snapshot request.
+const snapshotTimeout = 30 * time.Second
+
+// zfsDataset is what a dataset name may look like. It is passed to a remote
+// shell over SSH, so anything else is refused.
+var zfsDataset = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:/-]*$`)
+
+func (s *SnapshotConfig) validate() error {
+	switch {
+	case !zfsDataset.MatchString(s.Dataset):
+		return fmt.Errorf("dataset %q is not a ZFS dataset name like tank/photos", s.Dataset)
+	case (s.TrueNAS == "") == (s.SSH == ""):
+		return errors.New("needs exactly one of truenas and ssh")
+	case s.TrueNAS != "" && strings.TrimSpace(s.APIKey) == "":
+		return errors.New("truenas needs an api_key")
+	case s.SSH != "" && strings.HasPrefix(s.SSH, "-"):
+		return fmt.Errorf("ssh %q is not a host", s.SSH)
+	}
+	return nil
+}
+
+// snapshotName is the snapshot's name for an import into folder: the folder
+// reduced to the characters ZFS allows, and the time.
+func snapshotName(folder string, t time.Time) string {
+	var name strings.Builder
+	for _, r := range folder {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_':
+			name.WriteRune(r)
+		case !strings.HasSuffix(name.String(), "-"):
+			name.WriteByte('-')
+		}
+	}
+	return "snapvault-" + strings.Trim(name.String(), "-") + "-" + t.Format("20060102-150405")
+}
+
+// snapshotShares snapshots the datasets behind the destinations that
+// received every file of the import without an error. A dataset shared by
+// several shares is snapshotted once. Failures are logged: the copies are
+// made either way.
+func snapshotShares(ctx context.Context, folder string, targets []shareTarget, agg *resultAggregator) {
+	failed := map[string]bool{}
+	for _, te := range agg.errors {
+		failed[te.Share] = true
+	}
+	name := snapshotName(folder, time.Now())
+	done := map[string]bool{}
+	for _, t := range targets {
+		if failed[t.label()] || agg.delivered[t.label()] == 0 {
+			continue
+		}
+		for _, conn := range t.members {
+			s := conn.Config.Snapshot
+			if s == nil {
+				continue
+			}
+			key := s.TrueNAS + s.SSH + "|" + s.Dataset
+			if done[key] {
+				continue
+			}
+			done[key] = true
+			if err := takeSnapshot(ctx, s, name); err != nil {
+				slog.Error("Failed to snapshot dataset", "share", shareLabel(conn.Config), "dataset", s.Dataset, "error", err)
+				continue
+			}
+			slog.Info("Snapshot taken", "share", shareLabel(conn.Config), "snapshot", s.Dataset+"@"+name)
+		}
+	}
+}
+
+func takeSnapshot(ctx context.Context, s *SnapshotConfig, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, snapshotTimeout)
+	defer cancel()
+	if s.SSH != "" {
+		args := []string{"-o", "BatchMode=yes", s.SSH, "zfs", "snapshot"}
+		if s.Recursive {
+			args = append(args, "-r")
+		}
+		out, err := exec.CommandContext(ctx, "ssh", append(args, s.Dataset+"@"+name)...).CombinedOutput()
+		if err != nil {
+			if msg := strings.TrimSpace(string(out)); msg != "" {
+				return fmt.Errorf("ssh %s: %s", s.SSH, msg)
+			}
+			return fmt.Errorf("ssh %s: %w", s.SSH, err)
+		}
+		return nil
+	}
+	return trueNASSnapshot(ctx, s, name)
+}
+
+// trueNASSnapshot creates the snapshot through the TrueNAS REST API. Newer
+// releases moved the endpoint from zfs/snapshot to pool/snapshot, so the
+// second is tried when the first is missing.
+func trueNASSnapshot(ctx context.Context, s *SnapshotConfig, name string) error {
+	body, err := json.Marshal(map[string]any{"dataset": s.Dataset, "name": name, "recursive": s.Recursive})
+	if err != nil {
+		return err
+	}
+	client := http.DefaultClient
+	if s.InsecureTLS {
+		client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	}
+	base := strings.TrimRight(strings.TrimSpace(s.TrueNAS), "/") + "/api/v2.0/"
+	for _, endpoint := range []string{"zfs/snapshot", "pool/snapshot"} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, base+endpoint, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(os.ExpandEnv(s.APIKey)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		switch {
+		case resp.StatusCode == http.StatusNotFound && endpoint == "zfs/snapshot":
+			continue
+		case resp.StatusCode >= 300:
+			if m := strings.TrimSpace(string(msg)); m != "" {
+				return fmt.Errorf("TrueNAS returned %s: %s", resp.Status, m)
+			}
+			return fmt.Errorf("TrueNAS returned %s", resp.Status)
+		}
+		return nil
+	}
+	return errors.New("TrueNAS has no snapshot API")
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// videoExtensions are the entries of photoExtensions that are video clips.
+var videoExtensions = map[string]bool{
+	".mov": true, ".mp4": true, ".m4v": true, ".avi": true, ".mts": true, ".m2ts": true, ".mxf": true,
+}
+
+// sourceSummary describes what a card holds or an import will copy.
+type sourceSummary struct {
+	Photos int
+	Videos int
+	Others int // voice memos and track logs
+	Bytes  int64
+	First  time.Time
+	Last   time.Time
+}
+
+func (s sourceSummary) dateRange() string {
+	if s.First.IsZero() {
+		return "no media"
+	}
+	first, last := s.First.Format("2006-01-02"), s.Last.Format("2006-01-02")
+	if first == last {
+		return first
+	}
+	return first + " to " + last
+}
+
+// summarizeSource counts the importable files under mount. Dates are file
+// modification times, like scanMedia, so it never opens every file.
+func summarizeSource(ctx context.Context, mount string) (sourceSummary, error) {
+	var s sourceSummary
+	err := filepath.Walk(mount, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if isSystemMetadata(info.Name()) || defaultFolderSkipper.skips(mount, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if isSystemMetadata(info.Name()) || !photoExtensions[ext] || info.Size() == 0 {
+			return nil
+		}
+		if videoExtensions[ext] {
+			s.Videos++
+		} else {
+			s.Photos++
+		}
+		s.Bytes += info.Size()
+		mod := info.ModTime()
+		if s.First.IsZero() || mod.Before(s.First) {
+			s.First = mod
+		}
+		if mod.After(s.Last) {
+			s.Last = mod
+		}
+		return nil
+	})
+	return s, err
+}
+
+// volumeLabel is the filesystem label of the volume mounted at mount, falling
+// back to the mount directory's name (which is the label on macOS and for
+// desktop automounts on Linux).
+func volumeLabel(mount string) string {
+	if label := osVolumeLabel(mount); label != "" {
+		return label
+	}
+	return filepath.Base(mount)
+}
+
+// mountDevice returns the block device mounted at mount on Linux, or "".
+func mountDevice(mount string) string {
+	data, err := os.ReadFile("/proc/mounts")
+	if err != nil {
+		return ""
+	}
+	var device string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && filepath.Clean(decodeProcMountField(fields[1])) == filepath.Clean(mount) {
+			device = decodeProcMountField(fields[0])
+		}
+	}
+	if device == "" {
+		return ""
+	}
+	if resolved, err := filepath.EvalSymlinks(device); err == nil {
+		device = resolved
+	}
+	return device
+}
+
+// runSourcesCommand implements `snapvault sources`: every card that could be
+// imported, with its label, size and contents, to confirm the right card is in
+// the reader before starting.
+func runSourcesCommand(args []string) int {
+	fs := flag.NewFlagSet("sources", flag.ExitOnError)
+	all := fs.Bool("all", false, "List every mounted removable volume, not just those with a DCIM folder")
+	fs.Parse(args)
+
+	mounts := fs.Args()
+	if len(mounts) == 0 {
+		if *all {
+			for _, c := range detectMountCandidates() {
+				mounts = append(mounts, c.Path)
+			}
+		} else {
+			mounts = detectCardMounts()
+		}
+	}
+	if len(mounts) == 0 {
+		fmt.Println("No cards found. Insert a card, or pass -all to list every removable volume.")
+		return 1
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+
+	for _, mount := range mounts {
+		fmt.Printf("%s  [%s]", mount, volumeLabel(mount))
+		if total, free, err := volumeSpace(mount); err == nil {
+			fmt.Printf("  %s, %s free", formatBytes(int64(total)), formatBytes(int64(free)))
+		}
+		fmt.Println()
+		s, err := summarizeSource(ctx, mount)
+		if err != nil {
+			fmt.Printf("    cannot read: %v\n", err)
+			if ctx.Err() != nil {
+				return 130
+			}
+			continue
+		}
+		fmt.Printf("    %d photos, %d videos, %s, %s\n", s.Photos, s.Videos, formatBytes(s.Bytes), s.dateRange())
+	}
+	return 0
+}
+
+// errImportDeclined is returned when the user answers no to the import summary.
+var errImportDeclined = errors.New("import declined")
+
+// printImportSummary describes what an import is about to do: how much of
+// what, from when, and the folders it will create on each share.
+func printImportSummary(w io.Writer, jobs []TransferJob, folderName string, connections []*SMBConnection) {
+	var s sourceSummary
+	folders := map[string]bool{}
+	for _, job := range jobs {
+		switch {
+		case isCompanion(job.SourcePath):
+			s.Others++
+		case videoExtensions[strings.ToLower(filepath.Ext(job.SourcePath))]:
+			s.Videos++
+		default:
+			s.Photos++
+		}
+		s.Bytes += job.Size
+		if s.First.IsZero() || job.PhotoDate.Before(s.First) {
+			s.First = job.PhotoDate
+		}
+		if job.PhotoDate.After(s.Last) {
+			s.Last = job.PhotoDate
+		}
+		folders[job.DestDir] = true
+	}
+	dirs := make([]string, 0, len(folders))
+	for d := range folders {
+		if d == "" {
+			d = "."
+		}
+		dirs = append(dirs, d)
+	}
+	sort.Strings(dirs)
+
+	counts := fmt.Sprintf("%d photos and %d videos", s.Photos, s.Videos)
+	if s.Others > 0 {
+		counts = fmt.Sprintf("%d photos, %d videos and %d memos and track logs", s.Photos, s.Videos, s.Others)
+	}
+	fmt.Fprintf(w, "\nAbout to import %s (%s), taken %s\n", counts, formatBytes(s.Bytes), s.dateRange())
+	fmt.Fprintln(w, "into:")
+	for _, conn := range connections {
+		dest := path.Join(conn.Config.Host, conn.Config.Share, filepath.ToSlash(conn.Config.BasePath), folderName)
+		if conn.Config.Group != "" {
+			dest += "  (overflow group " + conn.Config.Group + ")"
+		}
+		if conn.Config.isPreviewShare() {
+			dest += "  (JPEG previews only)"
+		}
+		if s := conn.Config.Selects; s != nil {
+			dest += "  (selects: " + s.describe() + ")"
+		}
+		if conn.Config.isEncrypted() {
+			dest += "  (encrypted)"
+		}
+		if conn.archives != nil {
+			dest += "  (" + conn.archives.format + " per date folder)"
+		}
+		if conn.cloud != nil {
+			dest += "  (" + conn.cloud.kind() + ")"
+		}
+		fmt.Fprintf(w, "  %-20s //%s\n", shareLabel(conn.Config), dest)
+	}
+	if len(dirs) > 0 {
+		fmt.Fprintf(w, "folders: %s\n", strings.Join(dirs, ", "))
+	}
+}
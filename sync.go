@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// syncAction is one change sync makes to one share.
+type syncAction struct {
+	inv    *shareInventory
+	rel    string // below the shoot folder, slash-separated
+	local  string // local file to copy; empty for a deletion
+	reason string // "new", "changed" or "deleted locally"
+}
+
+// runSyncCommand makes a shoot folder on the shares match a local working
+// copy: new and changed files are copied up and, with -delete, files that
+// are gone locally are removed. It is for after culling or renaming on the
+// laptop, when the NAS copies should follow.
+func runSyncCommand(args []string) int {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	dir := fs.String("dir", "", "Local folder holding the shoot's working copy")
+	name := fs.String("name", "", `Shoot folder on the shares (default: the local folder's name)`)
+	del := fs.Bool("delete", false, "Also delete files from the shares that are no longer in the local folder")
+	checksum := fs.Bool("checksum", false, "Compare same-size files by checksum instead of trusting the size (reads them over the network)")
+	dryRun := fs.Bool("dry-run", false, "Show what would change without changing anything")
+	yes := fs.Bool("yes", false, "Do not ask for confirmation")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault sync -dir <local folder> [-name <shoot folder>] [-delete] [-checksum] [-dry-run] [-yes]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *dir == "" {
+		fs.Usage()
+		return 2
+	}
+	root, err := filepath.Abs(*dir)
+	if err != nil {
+		slog.Error("Invalid folder", "dir", *dir, "error", err)
+		return 2
+	}
+	folder := strings.TrimSpace(*name)
+	if folder == "" {
+		folder = filepath.Base(root)
+	}
+
+	local, err := localShootFiles(root)
+	if err != nil {
+		slog.Error("Failed to read local folder", "error", err)
+		return 1
+	}
+	if len(local) == 0 && *del {
+		// An empty or mistyped folder would otherwise wipe the shoot.
+		fmt.Fprintf(os.Stderr, "%s holds no files; refusing to -delete everything in %q.\n", root, folder)
+		return 1
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+	config, connections, err := common.connectAll(ctx)
+	if err != nil {
+		slog.Error("Failed to connect to shares", "error", err)
+		return connectExitCode(err)
+	}
+	defer closeConnections(connections)
+
+	invs, err := inventoryAll(ctx, connections, folder)
+	if err != nil {
+		slog.Error("Failed to list shoot folder", "error", err)
+		return 1
+	}
+	actions, err := planSync(ctx, root, local, invs, *del, *checksum, config.UnicodeNormalization)
+	if err != nil {
+		if ctx.Err() != nil {
+			return exitCancelled
+		}
+		slog.Error("Failed to compare with the shares", "error", err)
+		return 1
+	}
+	if len(actions) == 0 {
+		fmt.Printf("%q is up to date on %d share(s).\n", folder, len(invs))
+		return 0
+	}
+	deletions := 0
+	for _, a := range actions {
+		verb := "copy"
+		if a.local == "" {
+			verb = "delete"
+			deletions++
+		}
+		prefix := ""
+		if *dryRun {
+			prefix = "would "
+		}
+		fmt.Printf("%s%s %s: %s (%s)\n", prefix, verb, shareLabel(a.inv.conn.Config), a.rel, a.reason)
+	}
+	if *dryRun {
+		return 0
+	}
+	if deletions > 0 && !*yes && !confirm(fmt.Sprintf("Delete %d file(s) from the shares?", deletions)) {
+		fmt.Println("Aborted.")
+		return 1
+	}
+
+	manifests, err := newManifestWriter(config.ChecksumManifest)
+	if err != nil {
+		slog.Error("Invalid config", "error", err)
+		return exitConfig
+	}
+	copied, deleted, failed := applySync(ctx, folder, actions, manifests)
+	if manifests != nil {
+		manifests.flush()
+	}
+	fmt.Printf("\n%d copied, %d deleted, %d failed\n", copied, deleted, failed)
+	switch {
+	case ctx.Err() != nil:
+		return exitCancelled
+	case failed > 0:
+		return 1
+	}
+	return 0
+}
+
+// localShootFiles lists the files under root that sync compares, keyed by
+// slash-separated path, with their sizes. It leaves out what the share
+// inventory leaves out, so both sides are comparable.
+func localShootFiles(root string) (map[string]int64, error) {
+	files := map[string]int64{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if isSystemMetadata(d.Name()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if (!strings.Contains(rel, "/") && isShootReport(rel)) || isChecksumFile(d.Name()) ||
+			strings.EqualFold(path.Ext(rel), ".xmp") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files[rel] = info.Size()
+		return nil
+	})
+	return files, err
+}
+
+// planSync compares the local files with each share's inventory. A JPEG the
+// share scrubs or credits differs from the local file by design, so only its
+// presence is compared. Names match in either Unicode form, so a folder on
+// a Mac lines up with its copy; new files are written in form nameForm.
+func planSync(ctx context.Context, root string, local map[string]int64, invs []*shareInventory, del, checksum bool, nameForm string) ([]syncAction, error) {
+	rels := make([]string, 0, len(local))
+	localKeys := make(map[string]bool, len(local))
+	for rel := range local {
+		rels = append(rels, rel)
+		localKeys[nameKey(rel)] = true
+	}
+	sort.Strings(rels)
+
+	var actions []syncAction
+	for _, inv := range invs {
+		remoteRels := make(map[string]string, len(inv.files))
+		for rel := range inv.files {
+			remoteRels[nameKey(rel)] = rel
+		}
+		for _, rel := range rels {
+			if inv.conn.isProxyFolder(path.Dir(rel)) {
+				continue
+			}
+			a := syncAction{inv: inv, rel: normalizeName(rel, nameForm), local: filepath.Join(root, filepath.FromSlash(rel))}
+			remoteRel, ok := remoteRels[nameKey(rel)]
+			if ok {
+				// Replace the copy under the name it already has.
+				a.rel = remoteRel
+			}
+			remote := inv.files[remoteRel]
+			switch {
+			case !ok:
+				a.reason = "new"
+			case !shareJPEGEdit(inv.conn, rel).none():
+				continue
+			case remote != local[rel]:
+				a.reason = "changed"
+			case checksum:
+				same, err := sameContent(ctx, inv, remoteRel, a.local)
+				if err != nil {
+					return nil, err
+				}
+				if same {
+					continue
+				}
+				a.reason = "changed"
+			default:
+				continue
+			}
+			actions = append(actions, a)
+		}
+		if !del {
+			continue
+		}
+		var extra []string
+		for rel := range inv.files {
+			if !localKeys[nameKey(rel)] {
+				extra = append(extra, rel)
+			}
+		}
+		sort.Strings(extra)
+		for _, rel := range extra {
+			actions = append(actions, syncAction{inv: inv, rel: rel, reason: "deleted locally"})
+		}
+	}
+	return actions, nil
+}
+
+// sameContent compares a local file with its copy on inv, using the share's
+// manifest when it has a checksum of the right kind.
+func sameContent(ctx context.Context, inv *shareInventory, rel, localPath string) (bool, error) {
+	alg := inv.conn.hashAlg
+	remote := ""
+	if entry, ok := inv.sums[rel]; ok {
+		alg, remote = entry.alg, entry.sum
+	}
+	f, err := os.Open(localPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	h := newHasher(alg)
+	if _, err := io.Copy(h, contextReader{ctx, f}); err != nil {
+		return false, fmt.Errorf("reading %s: %w", localPath, err)
+	}
+	if remote == "" {
+		if remote, err = hashShareFile(ctx, inv, rel, alg); err != nil {
+			return false, err
+		}
+	}
+	return strings.EqualFold(hex.EncodeToString(h.Sum(nil)), remote), nil
+}
+
+// applySync carries out the plan, recording the checksums of new copies and
+// dropping those of deleted files.
+func applySync(ctx context.Context, folder string, actions []syncAction, manifests *manifestWriter) (copied, deleted, failed int) {
+	emptied := map[*SMBConnection]map[string][]string{}
+	defer func() {
+		for conn, dirs := range emptied {
+			removeEmptyDirs(ctx, conn, dirs)
+		}
+	}()
+	for _, a := range actions {
+		if ctx.Err() != nil {
+			return
+		}
+		conn := a.inv.conn
+		label := shareLabel(conn.Config)
+		p := path.Join(a.inv.root, a.rel)
+		if a.local == "" {
+			if err := conn.Share.WithContext(ctx).Remove(p); err != nil && !os.IsNotExist(err) {
+				slog.Error("Failed to delete file", "share", label, "path", p, "error", err)
+				failed++
+				continue
+			}
+			forgetChecksum(ctx, conn, p)
+			if emptied[conn] == nil {
+				emptied[conn] = map[string][]string{}
+			}
+			dir, base := path.Split(p)
+			emptied[conn][dir] = append(emptied[conn][dir], base)
+			deleted++
+			continue
+		}
+		if a.reason == "changed" {
+			// The old checksum would fail check -deep until replaced.
+			forgetChecksum(ctx, conn, p)
+		}
+		res, err := transferToSMB(ctx, a.local, path.Base(a.rel), folder, path.Dir(a.rel), conn)
+		if err != nil {
+			slog.Error("Failed to copy file", "share", label, "path", a.rel, "error", classifyError(err))
+			failed++
+			continue
+		}
+		if manifests != nil {
+			manifests.add(ctx, conn, res)
+		}
+		copied++
+	}
+	return
+}
+
+// forgetChecksum removes p's checksum sidecars and folder manifest lines.
+func forgetChecksum(ctx context.Context, conn *SMBConnection, p string) {
+	for _, alg := range []string{hashSHA256, hashBLAKE3, hashXXH64} {
+		_, ext := manifestNames(alg)
+		_ = conn.Share.WithContext(ctx).Remove(p + ext)
+	}
+	dir, base := path.Split(p)
+	pruneManifests(ctx, conn, dir, []string{base})
+}
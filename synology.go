@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SynologyConfig connects to the DSM web API of a Synology NAS behind a
+// share, to have new imports indexed and to read the share's quota.
+type SynologyConfig struct {
+	// URL is DSM's address; "https://<host>:5001" when unset.
+	URL string `yaml:"url,omitempty"`
+	// Username and Password log in to DSM; the share's own when unset.
+	// Password supports ${ENV} expansion.
+	Username string `yaml:"username,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	// InsecureTLS accepts DSM's self-signed certificate.
+	InsecureTLS bool `yaml:"insecure_tls,omitempty"`
+	// Index re-runs DSM's media indexing after every import that copied
+	// files to the share, so Synology Photos and the media server pick
+	// them up. It needs an administrator account.
+	Index bool `yaml:"index,omitempty"`
+	// Quota reads the shared folder's quota, so the free-space check sees
+	// the quota's room when it is less than the volume's.
+	Quota bool `yaml:"quota,omitempty"`
+}
+
+// dsmTimeout bounds one DSM API request.
+const dsmTimeout = 30 * time.Second
+
+var errDSMLogin = errors.New("DSM login failed")
+
+func (s *SynologyConfig) validate() error {
+	if !s.Index && !s.Quota {
+		return errors.New("has no effect without index or quota")
+	}
+	if s.URL != "" {
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url %q is not a DSM address like https://nas.local:5001", s.URL)
+		}
+	}
+	return nil
+}
+
+// dsmSession is a logged-in DSM API session.
+type dsmSession struct {
+	base   string
+	client *http.Client
+	sid    string
+}
+
+// dsmAddress is the DSM web address of cfg's NAS.
+func dsmAddress(cfg SMBConfig) string {
+	if u := strings.TrimRight(strings.TrimSpace(cfg.Synology.URL), "/"); u != "" {
+		return u
+	}
+	return "https://" + net.JoinHostPort(cfg.Host, "5001")
+}
+
+// dsmLogin logs in to the DSM behind cfg's share.
+func dsmLogin(ctx context.Context, cfg SMBConfig) (*dsmSession, error) {
+	s := cfg.Synology
+	d := &dsmSession{base: dsmAddress(cfg), client: http.DefaultClient}
+	if s.InsecureTLS {
+		d.client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	}
+	user, pass := s.Username, os.ExpandEnv(s.Password)
+	if user == "" {
+		user, pass = cfg.Username, cfg.Password
+	}
+	var login struct {
+		SID string `json:"sid"`
+	}
+	err := d.call(ctx, "auth.cgi", url.Values{
+		"api": {"SYNO.API.Auth"}, "version": {"6"}, "method": {"login"},
+		"account": {user}, "passwd": {pass}, "session": {"SnapVault"}, "format": {"sid"},
+	}, &login)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errDSMLogin, err)
+	}
+	d.sid = login.SID
+	return d, nil
+}
+
+func (d *dsmSession) logout(ctx context.Context) {
+	err := d.call(ctx, "auth.cgi", url.Values{
+		"api": {"SYNO.API.Auth"}, "version": {"6"}, "method": {"logout"}, "session": {"SnapVault"},
+	}, nil)
+	if err != nil {
+		slog.Debug("DSM logout failed", "url", d.base, "error", err)
+	}
+}
+
+// call posts one API request and decodes its data into out. Parameters go in
+// the body, so the password never shows up in a URL.
+func (d *dsmSession) call(ctx context.Context, cgi string, params url.Values, out any) error {
+	if d.sid != "" {
+		params.Set("_sid", d.sid)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.base+"/webapi/"+cgi, strings.NewReader(params.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("DSM returned %s", resp.Status)
+	}
+	var body struct {
+		Success bool            `json:"success"`
+		Data    json.RawMessage `json:"data"`
+		Error   struct {
+			Code int `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&body); err != nil {
+		return fmt.Errorf("reading DSM response: %w", err)
+	}
+	if !body.Success {
+		return fmt.Errorf("%s returned error %d", params.Get("api"), body.Error.Code)
+	}
+	if out == nil || len(body.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body.Data, out)
+}
+
+// synologyQuotaBytes reads the room left in the quota of conn's shared
+// folder. ok is false when the folder has no quota.
+func synologyQuotaBytes(ctx context.Context, conn *SMBConnection) (room int64, ok bool, err error) {
+	ctx, cancel := context.WithTimeout(ctx, dsmTimeout)
+	defer cancel()
+	d, err := dsmLogin(ctx, conn.Config)
+	if err != nil {
+		return 0, false, err
+	}
+	defer d.logout(ctx)
+	var data struct {
+		Shares []struct {
+			// Both in MB; a quota of 0 is none.
+			Quota json.Number `json:"quota_value"`
+			Used  json.Number `json:"share_quota_used"`
+		} `json:"shares"`
+	}
+	err = d.call(ctx, "entry.cgi", url.Values{
+		"api": {"SYNO.Core.Share"}, "version": {"1"}, "method": {"get"},
+		"name": {strconv.Quote(conn.Config.Share)}, "additional": {`["share_quota"]`},
+	}, &data)
+	if err != nil {
+		return 0, false, err
+	}
+	if len(data.Shares) == 0 {
+		return 0, false, fmt.Errorf("DSM has no shared folder %q", conn.Config.Share)
+	}
+	quota, _ := data.Shares[0].Quota.Float64()
+	used, _ := data.Shares[0].Used.Float64()
+	if quota <= 0 {
+		return 0, false, nil
+	}
+	room = int64((quota - used) * (1 << 20))
+	if room < 0 {
+		room = 0
+	}
+	return room, true, nil
+}
+
+// indexSynologyShares re-runs media indexing on the NASes behind the
+// destinations that received files. Each NAS is asked once. Failures are
+// logged: the copies are made either way.
+func indexSynologyShares(ctx context.Context, targets []shareTarget, agg *resultAggregator) {
+	done := map[string]bool{}
+	for _, t := range targets {
+		if agg.delivered[t.label()] == 0 {
+			continue
+		}
+		for _, conn := range t.members {
+			s := conn.Config.Synology
+			if s == nil || !s.Index {
+				continue
+			}
+			key := strings.ToLower(dsmAddress(conn.Config))
+			if done[key] {
+				continue
+			}
+			done[key] = true
+			if err := synologyReindex(ctx, conn.Config); err != nil {
+				slog.Error("Failed to start Synology indexing", "share", shareLabel(conn.Config), "error", err)
+				continue
+			}
+			slog.Info("Synology indexing started", "share", shareLabel(conn.Config))
+		}
+	}
+}
+
+func synologyReindex(ctx context.Context, cfg SMBConfig) error {
+	ctx, cancel := context.WithTimeout(ctx, dsmTimeout)
+	defer cancel()
+	d, err := dsmLogin(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer d.logout(ctx)
+	return d.call(ctx, "entry.cgi", url.Values{
+		"api": {"SYNO.Core.MediaIndexing"}, "version": {"1"}, "method": {"reindex"},
+	}, nil)
+}
@@ -456,7 +456,11 @@ func (m *snapVaultTUI) renderContentPanel() string {
 			if m.selectedShares[smbShareKey(share)] {
 				checked = "x"
 			}
-			lines = append(lines, fmt.Sprintf("%s [%s] %s", cursor, checked, formatShareForDisplay(share)))
+			disabled := ""
+			if !share.enabled() {
+				disabled = " (disabled)"
+			}
+			lines = append(lines, fmt.Sprintf("%s [%s] %s%s", cursor, checked, formatShareForDisplay(share), disabled))
 		}
 		addIdx := len(m.availableShares)
 		continueIdx := len(m.availableShares) + 1
@@ -856,13 +860,14 @@ func (m *snapVaultTUI) startTransfer() (tea.Model, tea.Cmd) {
 	m.transferErrors = nil
 	m.transferEvents = make(chan tea.Msg, 256)
 
-	go runTransferWorkflow(ctx, m.transferEvents, m.resultMount, m.resultName, selected, m.timeout, m.workers)
+	go runTransferWorkflow(ctx, m.transferEvents, m.configData, m.resultMount, m.resultName, selected, m.timeout, m.workers)
 	return m, waitForTransferMsg(m.transferEvents)
 }
 
 func runTransferWorkflow(
 	ctx context.Context,
 	events chan<- tea.Msg,
+	settings *Config,
 	mountPoint, photoshootName string,
 	shares []SMBConfig,
 	timeout time.Duration,
@@ -873,7 +878,71 @@ func runTransferWorkflow(
 	folderName := fmt.Sprintf("%d - %s", time.Now().Year(), photoshootName)
 	events <- transferStartedMsg{folderName: folderName}
 
-	config := &Config{SMBShares: shares}
+	namer, err := newFileNamer(settings, photoshootName, folderName)
+	if err != nil {
+		events <- transferFinishedMsg{err: err}
+		return
+	}
+	layout, err := newFolderLayout(settings)
+	if err != nil {
+		events <- transferFinishedMsg{err: err}
+		return
+	}
+	sizes, err := newSizeFilter(settings)
+	if err != nil {
+		events <- transferFinishedMsg{err: err}
+		return
+	}
+	skip, err := newFolderSkipper(settings)
+	if err != nil {
+		events <- transferFinishedMsg{err: err}
+		return
+	}
+	var manifestMode, sidecarMode, shootManifestMode, hashAlg, slowShare, order string
+	var fileTimeout time.Duration
+	var companions bool
+	var nameReplacement, nameForm string
+	var attribution *AttributionConfig
+	var videoProxy *VideoProxyConfig
+	var gallery *galleryWriter
+	var readmeCfg *ShootReadmeConfig
+	if settings != nil {
+		attribution, videoProxy = settings.Attribution, settings.VideoProxy
+		gallery = newGalleryWriter(settings.Gallery)
+		readmeCfg = settings.ShootReadme
+		manifestMode, sidecarMode, shootManifestMode = settings.ChecksumManifest, settings.XMPSidecar, settings.ShootManifest
+		hashAlg = settings.HashAlgorithm
+		fileTimeout, slowShare, order = settings.FileTimeout, settings.SlowShare, settings.TransferOrder
+		companions = settings.CompanionFiles
+		nameReplacement, nameForm = settings.FilenameReplacement, settings.UnicodeNormalization
+	}
+	manifests, err := newManifestWriter(manifestMode)
+	if err != nil {
+		events <- transferFinishedMsg{err: err}
+		return
+	}
+	sidecars, err := newXMPSidecarWriter(sidecarMode)
+	if err != nil {
+		events <- transferFinishedMsg{err: err}
+		return
+	}
+	shootManifests, err := newShootManifestWriter(shootManifestMode)
+	if err != nil {
+		events <- transferFinishedMsg{err: err}
+		return
+	}
+	readmes, err := newShootReadmeWriter(readmeCfg)
+	if err != nil {
+		events <- transferFinishedMsg{err: err}
+		return
+	}
+
+	shares, deferred := splitDeferred(shares)
+	if len(shares) == 0 {
+		events <- transferFinishedMsg{err: errors.New("every selected share is deferred; select one to import to now")}
+		return
+	}
+	config := &Config{SMBShares: shares, HashAlgorithm: hashAlg, Attribution: attribution, VideoProxy: videoProxy}
 	connections, err := establishConnections(ctx, config, timeout)
 	if err != nil {
 		events <- transferFinishedMsg{err: fmt.Errorf("establishing SMB connections: %w", err)}
@@ -890,7 +959,31 @@ func runTransferWorkflow(
 		},
 	}
 
-	transferErrors, err := processPhotos(ctx, mountPoint, folderName, connections, workers, hook)
+	transferErrors, err := processPhotos(ctx, []string{mountPoint}, folderName, connections, TransferOptions{
+		Workers:        workers,
+		WorkerRamp:     settings.workerRamp(),
+		Replacement:    nameReplacement,
+		NameForm:       nameForm,
+		Hook:           hook,
+		Namer:          namer,
+		Layout:         layout,
+		Sizes:          sizes,
+		Skip:           skip,
+		Companions:     companions,
+		HashAlgorithm:  hashAlg,
+		Manifests:      manifests,
+		Sidecars:       sidecars,
+		ShootManifests: shootManifests,
+		Readmes:        readmes,
+		Gallery:        gallery,
+		Journal:        openRunJournal(settings, folderName, []string{mountPoint}),
+		Catalog:        settings,
+		Order:          order,
+		FileTimeout:    fileTimeout,
+		SlowShare:      slowShare,
+		VideoProxy:     videoProxy,
+		Deferred:       deferred,
+	})
 	events <- transferFinishedMsg{err: err, errors: transferErrors}
 }
 
@@ -938,9 +1031,7 @@ func (m *snapVaultTUI) selectedSharesForRuntime() []SMBConfig {
 		if !m.selectedShares[smbShareKey(share)] {
 			continue
 		}
-		resolved := share
-		resolved.Password = os.ExpandEnv(resolved.Password)
-		selected = append(selected, resolved)
+		selected = append(selected, expandShare(share))
 	}
 	return selected
 }
@@ -949,6 +1040,24 @@ func upsertShareConfig(shares []SMBConfig, newShare SMBConfig) []SMBConfig {
 	key := smbShareKey(newShare)
 	for i, share := range shares {
 		if smbShareKey(share) == key {
+			// The UIs don't edit per-share tuning; keep what the YAML had.
+			if newShare.HashAlgorithm == "" {
+				newShare.HashAlgorithm = share.HashAlgorithm
+			}
+			if newShare.Name == "" {
+				newShare.Name = share.Name
+			}
+			newShare.AskPass = newShare.AskPass || share.AskPass
+			newShare.Keyring = newShare.Keyring || share.Keyring
+			if newShare.Enabled == nil {
+				newShare.Enabled = share.Enabled
+			}
+			if newShare.Group == "" {
+				newShare.Group, newShare.MinFreeGB = share.Group, share.MinFreeGB
+			}
+			if newShare.AskPass || newShare.Keyring {
+				newShare.Password = ""
+			}
 			shares[i] = newShare
 			return shares
 		}
@@ -957,6 +1066,24 @@ func upsertShareConfig(shares []SMBConfig, newShare SMBConfig) []SMBConfig {
 }
 
 func smbShareKey(share SMBConfig) string {
+	if share.isRclone() {
+		return "rclone|" + strings.TrimSpace(share.Rclone) + "|" + share.BasePath
+	}
+	if g := share.GoogleDrive; g != nil {
+		return strings.ToLower("gdrive|" + g.ClientID + "|" + g.folder() + "|" + share.BasePath)
+	}
+	if a := share.Azure; a != nil {
+		return "azure|" + strings.ToLower(a.Account) + "|" + a.Container + "|" + share.BasePath
+	}
+	if b := share.B2; b != nil {
+		return "b2|" + b.Bucket + "|" + share.BasePath
+	}
+	if share.Mount != "" {
+		return "mount|" + filepath.Clean(share.Mount) + "|" + share.BasePath
+	}
+	if f := share.FTP; f != nil {
+		return strings.ToLower("ftp|" + f.addr() + "|" + f.Username + "|" + share.BasePath)
+	}
 	port := share.Port
 	if port == 0 {
 		port = 445
@@ -965,6 +1092,36 @@ func smbShareKey(share SMBConfig) string {
 }
 
 func formatShareForDisplay(share SMBConfig) string {
+	if share.isRclone() {
+		target := strings.TrimSpace(share.Rclone)
+		if share.BasePath != "" {
+			target = target + " " + strings.TrimPrefix(filepathToSlash(share.BasePath), "/")
+		}
+		if share.Name != "" {
+			return fmt.Sprintf("%s: %s (rclone)", share.Name, target)
+		}
+		return target + " (rclone)"
+	}
+	if share.Azure != nil || share.B2 != nil || share.Mount != "" || share.FTP != nil {
+		target := shareLabel(SMBConfig{Azure: share.Azure, B2: share.B2, Mount: share.Mount, FTP: share.FTP})
+		if share.BasePath != "" {
+			target = target + "/" + strings.TrimPrefix(filepathToSlash(share.BasePath), "/")
+		}
+		if share.Name != "" {
+			return share.Name + ": " + target
+		}
+		return target
+	}
+	if share.GoogleDrive != nil {
+		target := "Google Drive/" + share.GoogleDrive.folder()
+		if share.BasePath != "" {
+			target = target + "/" + strings.TrimPrefix(filepathToSlash(share.BasePath), "/")
+		}
+		if share.Name != "" {
+			return share.Name + ": " + target
+		}
+		return target
+	}
 	port := share.Port
 	if port == 0 {
 		port = 445
@@ -973,9 +1130,43 @@ func formatShareForDisplay(share SMBConfig) string {
 	if share.BasePath != "" {
 		target = target + "/" + strings.TrimPrefix(filepathToSlash(share.BasePath), "/")
 	}
+	if share.Name != "" {
+		return fmt.Sprintf("%s: %s (user=%s)", share.Name, target, share.Username)
+	}
 	return fmt.Sprintf("%s (user=%s)", target, share.Username)
 }
 
+// shareLabel is the short name used in logs, error lists and reports: the
+// configured name, or host/share.
+func shareLabel(share SMBConfig) string {
+	if share.Name != "" {
+		return share.Name
+	}
+	if share.isRclone() {
+		return strings.TrimSpace(share.Rclone)
+	}
+	if share.GoogleDrive != nil {
+		return "Google Drive/" + share.GoogleDrive.folder()
+	}
+	if a := share.Azure; a != nil {
+		return "azure:" + a.Account + "/" + a.Container
+	}
+	if b := share.B2; b != nil {
+		return "b2:" + b.Bucket
+	}
+	if share.Mount != "" {
+		return filepath.Clean(share.Mount)
+	}
+	if f := share.FTP; f != nil {
+		scheme := "ftp://"
+		if f.TLS != "" {
+			scheme = "ftps://"
+		}
+		return scheme + f.addr()
+	}
+	return fmt.Sprintf("%s/%s", share.Host, share.Share)
+}
+
 func formatMountCandidate(candidate MountCandidate) string {
 	if candidate.Source != "" && candidate.FSType != "" {
 		return fmt.Sprintf("%s [device=%s, fs=%s]", candidate.Path, candidate.Source, candidate.FSType)
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hirochachacha/go-smb2"
+)
+
+// runUndoCommand removes exactly the files a previous run wrote, on every
+// share, using that run's journal.
+func runUndoCommand(args []string) int {
+	fs := flag.NewFlagSet("undo", flag.ExitOnError)
+	common := addCommonFlags(fs)
+	runID := fs.String("run", "", "Journal ID of the run to undo (see -list)")
+	name := fs.String("name", "", "Undo the most recent run into this shoot folder")
+	last := fs.Bool("last", false, "Undo the most recent run")
+	list := fs.Bool("list", false, "List recent runs that can be undone")
+	dryRun := fs.Bool("dry-run", false, "Show what would be deleted without deleting")
+	yes := fs.Bool("yes", false, "Do not ask for confirmation")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: snapvault undo (-last | -run <id> | -name <shoot folder>) [-dry-run] [-yes]")
+		fmt.Fprintln(fs.Output(), "       snapvault undo -list")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	config, err := loadConfig(*common.configPath, *common.profile, *common.overrides)
+	if err != nil {
+		slog.Error("Failed to load config", "error", err)
+		return 1
+	}
+	journals, err := loadJournals(config)
+	if err != nil {
+		slog.Error("Failed to read run journals", "error", err)
+		return 1
+	}
+
+	if *list {
+		printJournalList(journals)
+		return 0
+	}
+
+	journal := pickJournal(journals, *runID, strings.TrimSpace(*name), *last)
+	if journal == nil {
+		fmt.Fprintln(os.Stderr, "No matching run to undo. Use -list to see recent runs.")
+		return 1
+	}
+	if journal.Undone != nil {
+		fmt.Fprintf(os.Stderr, "Run %s was already undone on %s.\n", journal.ID, journal.Undone.Format(time.RFC1123))
+		return 1
+	}
+
+	byShare := map[string][]journalEntry{}
+	labels := map[string]string{}
+	for _, f := range journal.Files {
+		byShare[f.ShareKey] = append(byShare[f.ShareKey], f)
+		labels[f.ShareKey] = f.Share
+	}
+	fmt.Printf("Run %s imported %q from %s\n", journal.ID, journal.Folder, strings.Join(journal.Sources, ", "))
+	for key, files := range byShare {
+		fmt.Printf("  %-32s %d files\n", labels[key], len(files))
+	}
+
+	if *dryRun {
+		for _, f := range journal.Files {
+			fmt.Printf("would delete %s: %s\n", f.Share, f.Path)
+		}
+		return 0
+	}
+	if !*yes && !confirm(fmt.Sprintf("Delete these %d files from every share?", len(journal.Files))) {
+		fmt.Println("Aborted.")
+		return 1
+	}
+
+	ctx, stop := commandContext()
+	defer stop()
+	_, connections, err := common.connectAll(ctx)
+	if err != nil {
+		slog.Error("Failed to connect to shares", "error", err)
+		return 1
+	}
+	defer closeConnections(connections)
+	conns := map[string]*SMBConnection{}
+	for _, c := range connections {
+		conns[smbShareKey(c.Config)] = c
+	}
+
+	var removed, kept, failed int
+	for key, files := range byShare {
+		conn := conns[key]
+		if conn == nil {
+			slog.Error("Share from the journal is no longer configured; skipping its files", "share", labels[key], "files", len(files))
+			failed += len(files)
+			continue
+		}
+		if conn.cloud != nil {
+			for _, f := range files {
+				if err := conn.cloud.remove(ctx, f.Path); err != nil {
+					slog.Error("Failed to delete file", "share", f.Share, "path", f.Path, "error", err)
+					failed++
+					continue
+				}
+				removed++
+			}
+			continue
+		}
+		fs := conn.Share.WithContext(ctx)
+		dirs := map[string][]string{}
+		archives := map[string]int{} // archive -> entries the run wrote into it
+		for _, f := range files {
+			if isArchiveEntry(f) {
+				archives[f.Path]++
+				continue
+			}
+			// Encrypted copies have names no other run can reuse; anything
+			// else may have been overwritten since, so it is only deleted
+			// while it is still the copy this run made.
+			if conn.encryption == nil {
+				same, err := copyUnchanged(fs, f)
+				if os.IsNotExist(err) {
+					continue
+				}
+				if err != nil {
+					slog.Error("Failed to check file before deleting it", "share", f.Share, "path", f.Path, "error", err)
+					failed++
+					continue
+				}
+				if !same {
+					slog.Warn("File changed since the run; leaving it", "share", f.Share, "path", f.Path)
+					kept++
+					continue
+				}
+			}
+			if err := fs.Remove(f.Path); err != nil && !os.IsNotExist(err) {
+				slog.Error("Failed to delete file", "share", f.Share, "path", f.Path, "error", err)
+				failed++
+				continue
+			}
+			removed++
+			for _, alg := range []string{hashSHA256, hashBLAKE3, hashXXH64} {
+				_, ext := manifestNames(alg)
+				_ = fs.Remove(f.Path + ext)
+			}
+			dir, base := path.Split(f.Path)
+			dirs[dir] = append(dirs[dir], base)
+		}
+		for archive, entries := range archives {
+			n, err := archiveEntries(fs, archive)
+			switch {
+			case os.IsNotExist(err):
+				continue
+			case err != nil:
+				slog.Error("Failed to read archive before deleting it", "share", labels[key], "archive", archive, "error", err)
+				failed += entries
+				continue
+			case n != entries:
+				slog.Warn("Archive holds other files than this run's; leaving it", "share", labels[key], "archive", archive, "entries", n, "run_entries", entries)
+				kept += entries
+				continue
+			}
+			if err := fs.Remove(archive); err != nil && !os.IsNotExist(err) {
+				slog.Error("Failed to delete archive", "share", labels[key], "archive", archive, "error", err)
+				failed += entries
+				continue
+			}
+			removed += entries
+			dir, base := path.Split(archive)
+			dirs[dir] = append(dirs[dir], base)
+		}
+		for dir, names := range dirs {
+			pruneManifests(ctx, conn, dir, names)
+		}
+		removeEmptyDirs(ctx, conn, dirs)
+		removeRemoteImport(ctx, conn, journal.ID)
+	}
+
+	now := time.Now()
+	journal.Undone = &now
+	if err := journal.save(); err != nil {
+		slog.Warn("Failed to mark journal as undone", "error", err)
+	}
+	if kept > 0 {
+		fmt.Printf("Left %d file(s) that changed since the run.\n", kept)
+	}
+	if failed > 0 || kept > 0 {
+		fmt.Printf("Undo finished with %d file(s) removed and %d not removed.\n", removed, failed+kept)
+		return 1
+	}
+	fmt.Printf("Removed %d files.\n", removed)
+	return 0
+}
+
+// isArchiveEntry reports whether f was written into an archive share's zip
+// or tar rather than as a file of its own.
+func isArchiveEntry(f journalEntry) bool {
+	ext := strings.ToLower(path.Ext(f.Path))
+	return (ext == "."+archiveZip || ext == "."+archiveTar) && ext != strings.ToLower(path.Ext(f.Source))
+}
+
+// copyUnchanged reports whether the file at f.Path is still the copy the
+// run wrote: it has the journaled checksum, or size for entries without one.
+func copyUnchanged(fs *smb2.Share, f journalEntry) (bool, error) {
+	file, err := fs.Open(f.Path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	if f.Sum == "" || f.SumAlg == "" {
+		info, err := file.Stat()
+		if err != nil {
+			return false, err
+		}
+		return info.Size() == f.Size, nil
+	}
+	h := newHasher(f.SumAlg)
+	if _, err := io.Copy(h, file); err != nil {
+		return false, err
+	}
+	return hex.EncodeToString(h.Sum(nil)) == f.Sum, nil
+}
+
+// archiveEntries counts the entries of the zip or tar archive at name.
+func archiveEntries(fs *smb2.Share, name string) (int, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if strings.EqualFold(path.Ext(name), "."+archiveZip) {
+		info, err := f.Stat()
+		if err != nil {
+			return 0, err
+		}
+		zr, err := zip.NewReader(f, info.Size())
+		if err != nil {
+			return 0, err
+		}
+		return len(zr.File), nil
+	}
+	// Next seeks past each entry's data rather than reading it.
+	tr := tar.NewReader(f)
+	for n := 0; ; n++ {
+		if _, err := tr.Next(); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return 0, err
+		}
+	}
+}
+
+func pickJournal(journals []*runJournal, id, folder string, last bool) *runJournal {
+	for _, j := range journals {
+		switch {
+		case id != "" && j.ID == id:
+			return j
+		case id == "" && folder != "" && j.Folder == folder && j.Undone == nil:
+			return j
+		case id == "" && folder == "" && last:
+			return j
+		}
+	}
+	return nil
+}
+
+func printJournalList(journals []*runJournal) {
+	if len(journals) == 0 {
+		fmt.Println("No runs recorded yet.")
+		return
+	}
+	for i, j := range journals {
+		if i == 20 {
+			fmt.Printf("… and %d older runs\n", len(journals)-i)
+			break
+		}
+		state := ""
+		if j.Undone != nil {
+			state = " (undone)"
+		}
+		fmt.Printf("%s  %-30s %5d copies  %s%s\n", j.ID, j.Folder, len(j.Files), strings.Join(j.Sources, ", "), state)
+	}
+}
+
+// pruneManifests drops deleted files from any folder manifest in dir, removing
+// the manifest when nothing is left in it.
+func pruneManifests(ctx context.Context, conn *SMBConnection, dir string, removed []string) {
+	fs := conn.Share.WithContext(ctx)
+	gone := map[string]bool{}
+	for _, n := range removed {
+		gone[n] = true
+	}
+	for _, alg := range []string{hashSHA256, hashBLAKE3, hashXXH64} {
+		name, _ := manifestNames(alg)
+		p := path.Join(dir, name)
+		data, err := fs.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		entries := parseManifest(string(data))
+		for n := range entries {
+			if gone[n] {
+				delete(entries, n)
+			}
+		}
+		if len(entries) == 0 {
+			_ = fs.Remove(p)
+			continue
+		}
+		if err := fs.WriteFile(p, []byte(formatManifest(entries)), 0o644); err != nil {
+			slog.Warn("Failed to update checksum manifest", "path", p, "error", err)
+		}
+	}
+}
+
+// removeEmptyDirs removes date folders, and then their shoot folders, that the
+// undo left empty. SMB refuses to remove non-empty directories, so anything
+// another run put there survives.
+func removeEmptyDirs(ctx context.Context, conn *SMBConnection, dirs map[string][]string) {
+	fs := conn.Share.WithContext(ctx)
+	var list []string
+	for d := range dirs {
+		list = append(list, strings.TrimSuffix(d, "/"))
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(list)))
+	parents := map[string]bool{}
+	for _, d := range list {
+		if d == "" {
+			continue
+		}
+		if fs.Remove(d) == nil {
+			parents[path.Dir(d)] = true
+		}
+	}
+	base := strings.Trim(strings.ReplaceAll(conn.Config.BasePath, "\\", "/"), "/")
+	for p := range parents {
+		if p != "." && p != base {
+			_ = fs.Remove(p)
+		}
+	}
+}
+
+func confirm(prompt string) bool {
+	fmt.Printf("%s [y/N] ", prompt)
+	line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// macOS hands out file names in decomposed form (NFD: "e" followed by a
+// combining accent) while Linux, Windows and most NAS software use the
+// composed form (NFC: a single "é"). The two look identical but are
+// different names on the share, so a shoot imported or synced from a Mac
+// could end up with two "Café.jpg" files side by side.
+
+// Values of unicode_normalization.
+const (
+	unicodeNFC = "nfc"
+	unicodeNFD = "nfd"
+	unicodeOff = "off"
+)
+
+func normalizeUnicodeMode(mode string) (string, error) {
+	switch m := strings.ToLower(strings.TrimSpace(mode)); m {
+	case "", unicodeNFC:
+		return unicodeNFC, nil
+	case unicodeNFD, unicodeOff:
+		return m, nil
+	default:
+		return "", fmt.Errorf("unicode_normalization must be %q, %q or %q, got %q", unicodeNFC, unicodeNFD, unicodeOff, mode)
+	}
+}
+
+// normalizeName puts a destination name or path in the form unicode_normalization
+// asks for; NFC unless it says otherwise.
+func normalizeName(name, mode string) string {
+	m, err := normalizeUnicodeMode(mode)
+	if err != nil {
+		m = unicodeNFC
+	}
+	switch m {
+	case unicodeNFD:
+		return norm.NFD.String(name)
+	case unicodeOff:
+		return name
+	default:
+		return norm.NFC.String(name)
+	}
+}
+
+// nameKey is name as compared with other names: the same in either form,
+// whatever unicode_normalization writes.
+func nameKey(name string) string {
+	return norm.NFC.String(name)
+}
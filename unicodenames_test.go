@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestNormalizeName(t *testing.T) {
+	const (
+		nfc = "Caf\u00e9.jpg"
+		nfd = "Cafe\u0301.jpg"
+	)
+	tests := []struct {
+		name, mode, want string
+	}{
+		{nfd, "", nfc},
+		{nfd, "nfc", nfc},
+		{nfd, "NFC", nfc},
+		{nfc, "nfd", nfd},
+		{nfd, "off", nfd},
+		{nfc, "off", nfc},
+		{nfd, "bogus", nfc},
+		{"IMG_0001.JPG", "nfd", "IMG_0001.JPG"},
+	}
+	for _, tt := range tests {
+		if got := normalizeName(tt.name, tt.mode); got != tt.want {
+			t.Errorf("normalizeName(%+q, %q) = %+q, want %+q", tt.name, tt.mode, got, tt.want)
+		}
+	}
+	if nameKey(nfc) != nameKey(nfd) {
+		t.Errorf("nameKey(%+q) != nameKey(%+q)", nfc, nfd)
+	}
+}
+
+func TestNormalizeUnicodeMode(t *testing.T) {
+	tests := []struct {
+		mode, want string
+		ok         bool
+	}{
+		{"", "nfc", true},
+		{" NFD ", "nfd", true},
+		{"off", "off", true},
+		{"nfkc", "", false},
+	}
+	for _, tt := range tests {
+		got, err := normalizeUnicodeMode(tt.mode)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("normalizeUnicodeMode(%q) = %q, %v; want %q, ok %v", tt.mode, got, err, tt.want, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,740 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// configProblem is one finding of `snapvault config validate`. Line is 0 when
+// the problem has no single place in the file.
+type configProblem struct {
+	Line int
+	Path string // e.g. smb_shares[1].port
+	Msg  string
+}
+
+// runConfigCommand implements `snapvault config validate`.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "validate" {
+		fmt.Fprintln(os.Stderr, "Usage: snapvault config validate [-config config.yaml]")
+		return 2
+	}
+	fs := flag.NewFlagSet("config validate", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "Path to the config file (YAML, TOML or JSON)")
+	fs.Parse(args[1:])
+
+	data, err := os.ReadFile(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+		return 1
+	}
+	if data, err = decryptConfig(*configPath, data); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", *configPath, err)
+		return 1
+	}
+	var problems []configProblem
+	if err := checkConfigPermissions(*configPath); err != nil {
+		problems = append(problems, configProblem{Msg: err.Error()})
+	}
+	format := configFormat(*configPath)
+	if converted, err := configToYAML(format, data); err != nil {
+		problems = append(problems, yamlProblem(strings.TrimPrefix(err.Error(), "toml: ")))
+	} else {
+		problems = append(problems, validateConfigData(converted)...)
+		if format != formatYAML {
+			// Lines would refer to the converted YAML, not the file as written.
+			for i := range problems {
+				problems[i].Line = 0
+			}
+		}
+	}
+
+	for _, p := range problems {
+		loc := *configPath
+		if p.Line > 0 {
+			loc = fmt.Sprintf("%s:%d", loc, p.Line)
+		}
+		if p.Path != "" {
+			fmt.Printf("%s: %s: %s\n", loc, p.Path, p.Msg)
+		} else {
+			fmt.Printf("%s: %s\n", loc, p.Msg)
+		}
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problem(s) found\n", len(problems))
+		return 1
+	}
+	fmt.Printf("%s: OK\n", *configPath)
+	return 0
+}
+
+var yamlLinePrefix = regexp.MustCompile(`^(?:yaml: )?line (\d+)(?: \(last key "[^"]*"\))?: `)
+
+// validateConfigData checks a config file without connecting to anything:
+// syntax, unknown keys, field types, required share fields, port ranges,
+// duplicate shares, enum values and templates, in the top level and in every
+// profile.
+func validateConfigData(data []byte) []configProblem {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return []configProblem{yamlProblem(err.Error())}
+	}
+	if len(root.Content) == 0 {
+		return []configProblem{{Msg: "file is empty"}}
+	}
+	doc := root.Content[0]
+
+	var problems []configProblem
+	checkKnownKeys(doc, reflect.TypeOf(Config{}), "", &problems)
+
+	var cfg Config
+	if err := doc.Decode(&cfg); err != nil {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			for _, msg := range typeErr.Errors {
+				problems = append(problems, yamlProblem(msg))
+			}
+		} else {
+			problems = append(problems, yamlProblem(err.Error()))
+		}
+		return sortProblems(problems)
+	}
+
+	base := cfg
+	base.Profiles = nil
+	if len(base.SMBShares) > 0 || len(cfg.Profiles) == 0 {
+		checkConfigValues(&base, []*yaml.Node{doc}, "", &problems)
+	}
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	profilesNode := lookupNode(doc, "profiles")
+	for _, name := range names {
+		var effective Config
+		if err := doc.Decode(&effective); err != nil {
+			continue
+		}
+		if err := effective.applyProfile(name); err != nil {
+			problems = append(problems, configProblem{Line: lookupNode(profilesNode, name).Line, Path: "profiles." + name, Msg: err.Error()})
+			continue
+		}
+		// Settings the profile doesn't override point back at the top level.
+		nodes := []*yaml.Node{lookupNode(profilesNode, name), doc}
+		checkConfigValues(&effective, nodes, "profiles."+name+".", &problems)
+	}
+	return sortProblems(problems)
+}
+
+func yamlProblem(msg string) configProblem {
+	p := configProblem{Msg: strings.TrimPrefix(msg, "yaml: ")}
+	if m := yamlLinePrefix.FindStringSubmatch(msg); m != nil {
+		p.Line, _ = strconv.Atoi(m[1])
+		p.Msg = msg[len(m[0]):]
+	}
+	return p
+}
+
+// sortProblems orders problems by line and drops repeats, which happen when a
+// profile inherits a faulty top-level setting.
+func sortProblems(problems []configProblem) []configProblem {
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	seen := map[string]bool{}
+	out := problems[:0]
+	for _, p := range problems {
+		key := fmt.Sprintf("%d|%s", p.Line, p.Msg)
+		if p.Line > 0 && seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, p)
+	}
+	return out
+}
+
+// checkKnownKeys reports mapping keys that no field of t accepts, walking
+// nested structs, lists and maps. Profiles are checked as configs of their own.
+func checkKnownKeys(node *yaml.Node, t reflect.Type, path string, problems *[]configProblem) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if node == nil {
+		return
+	}
+	if t == reflect.TypeOf(yaml.Node{}) {
+		t = reflect.TypeOf(Config{})
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := map[string]reflect.Type{}
+		for i := 0; i < t.NumField(); i++ {
+			if name, ok := yamlKey(t.Field(i)); ok {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			ft, ok := fields[key.Value]
+			if !ok {
+				msg := "unknown key"
+				if s := suggestKey(key.Value, fields); s != "" {
+					msg = fmt.Sprintf("unknown key (did you mean %s?)", s)
+				}
+				*problems = append(*problems, configProblem{Line: key.Line, Path: joinConfigPath(path, key.Value), Msg: msg})
+				continue
+			}
+			checkKnownKeys(value, ft, joinConfigPath(path, key.Value), problems)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			checkKnownKeys(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), problems)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkKnownKeys(node.Content[i+1], t.Elem(), joinConfigPath(path, node.Content[i].Value), problems)
+		}
+	}
+}
+
+// unknownKeysError rejects a config with keys SnapVault doesn't read: a typo
+// such as basepath for base_path would otherwise be dropped silently and the
+// photos land in the share root. lines is false when the data was converted
+// from TOML or JSON, whose line numbers don't match.
+func unknownKeysError(data []byte, lines bool) error {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil || len(root.Content) == 0 {
+		return nil // reported by the decoder
+	}
+	var problems []configProblem
+	checkKnownKeys(root.Content[0], reflect.TypeOf(Config{}), "", &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	msgs := make([]string, len(problems))
+	for i, p := range sortProblems(problems) {
+		msgs[i] = fmt.Sprintf("%s: %s", p.Path, p.Msg)
+		if lines && p.Line > 0 {
+			msgs[i] = fmt.Sprintf("line %d: %s", p.Line, msgs[i])
+		}
+	}
+	return fmt.Errorf("config file: %s", strings.Join(msgs, "; "))
+}
+
+// suggestKey returns the known key closest to a misspelled one, or "" when
+// nothing is close: same letters ignoring case, _ and -, or at most two edits.
+func suggestKey(key string, fields map[string]reflect.Type) string {
+	norm := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(s))
+	}
+	best, bestDist := "", 3
+	for name := range fields {
+		if norm(name) == norm(key) {
+			return name
+		}
+		if d := editDistance(key, name); d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// lookupNode follows mapping keys and sequence indices ("smb_shares", "1",
+// "port") from node. It returns nil when the path does not exist.
+func lookupNode(node *yaml.Node, keys ...string) *yaml.Node {
+	for _, key := range keys {
+		if node == nil {
+			return nil
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			var next *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == key {
+					next = node.Content[i+1]
+					break
+				}
+			}
+			node = next
+		case yaml.SequenceNode:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node.Content) {
+				return nil
+			}
+			node = node.Content[i]
+		default:
+			return nil
+		}
+	}
+	return node
+}
+
+// checkConfigValues validates an effective (profile-applied) config. nodes are
+// searched in order for the line a value came from.
+func checkConfigValues(cfg *Config, nodes []*yaml.Node, prefix string, problems *[]configProblem) {
+	report := func(keys []string, format string, args ...any) {
+		line := 0
+		for _, n := range nodes {
+			if found := lookupNode(n, keys...); found != nil {
+				line = found.Line
+				break
+			}
+		}
+		path := ""
+		for _, k := range keys {
+			if _, err := strconv.Atoi(k); err == nil {
+				path += "[" + k + "]"
+			} else {
+				path = joinConfigPath(path, k)
+			}
+		}
+		*problems = append(*problems, configProblem{Line: line, Path: prefix + path, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	if len(cfg.SMBShares) == 0 {
+		report(nil, "no smb_shares configured")
+	}
+	keys := map[string]int{}
+	names := map[string]int{}
+	destinations := map[string]bool{}
+	for i, share := range cfg.SMBShares {
+		at := func(field string) []string {
+			if field == "" {
+				return []string{"smb_shares", strconv.Itoa(i)}
+			}
+			return []string{"smb_shares", strconv.Itoa(i), field}
+		}
+		if share.isCloud() {
+			if err := validateCloud(share); err != nil {
+				report(at(""), "a cloud share %v", err)
+			}
+			if share.isRclone() {
+				if err := validateRclone(share); err != nil {
+					report(at("rclone"), "%v", err)
+				}
+			}
+			if g := share.GoogleDrive; g != nil {
+				if err := g.validate(); err != nil {
+					report(at("google_drive"), "%v", err)
+				}
+			}
+			if a := share.Azure; a != nil {
+				if err := a.validate(); err != nil {
+					report(at("azure"), "%v", err)
+				}
+			}
+			if b := share.B2; b != nil {
+				if err := b.validate(); err != nil {
+					report(at("b2"), "%v", err)
+				}
+			}
+			if share.Mount != "" {
+				if err := validateMount(share); err != nil {
+					report(at("mount"), "%v", err)
+				}
+			}
+			if f := share.FTP; f != nil {
+				if err := f.validate(); err != nil {
+					report(at("ftp"), "%v", err)
+				}
+			}
+		} else {
+			if strings.TrimSpace(share.Host) == "" {
+				report(at(""), "host is required")
+			}
+			if strings.TrimSpace(share.Share) == "" {
+				report(at(""), "share is required")
+			}
+		}
+		if share.AskPass && share.Password != "" {
+			report(at("password"), "is ignored because ask_pass is set; remove it")
+		} else if share.Keyring && share.Password != "" {
+			report(at("password"), "is ignored because keyring is set; remove it")
+		}
+		if share.Port < 0 || share.Port > 65535 {
+			report(at("port"), "%d is not a valid port (1-65535, or omit for 445)", share.Port)
+		}
+		if share.HashAlgorithm != "" {
+			if _, err := normalizeHashAlgorithm(share.HashAlgorithm); err != nil {
+				report(at("hash_algorithm"), "%v", err)
+			}
+		}
+		if share.MinFreeGB < 0 {
+			report(at("min_free_gb"), "must not be negative")
+		} else if share.MinFreeGB > 0 && share.Group == "" {
+			report(at("min_free_gb"), "has no effect without group")
+		}
+		key := smbShareKey(share)
+		if j, dup := keys[key]; dup {
+			report(at(""), "duplicate of smb_shares[%d]", j)
+		} else {
+			keys[key] = i
+		}
+		if share.Name != "" {
+			lower := strings.ToLower(share.Name)
+			if j, dup := names[lower]; dup {
+				report(at("name"), "name %q is already used by smb_shares[%d]", share.Name, j)
+			} else {
+				names[lower] = i
+			}
+		}
+		if p := share.Preview; p != nil {
+			if share.Group != "" {
+				report(at("preview"), "a preview share cannot be in an overflow group")
+			}
+			if p.MaxDimension < 0 {
+				report(at("preview"), "max_dimension must not be negative")
+			}
+			if p.Quality < 0 || p.Quality > 100 {
+				report(at("preview"), "quality must be between 1 and 100")
+			}
+		}
+		if s := share.Selects; s != nil {
+			if err := s.validate(); err != nil {
+				report(at("selects"), "%v", err)
+			}
+			switch {
+			case share.Group != "":
+				report(at("selects"), "an overflow group member cannot be a selects share")
+			case share.isPreviewShare():
+				report(at("selects"), "a preview share cannot also be a selects share")
+			}
+		}
+		if share.Deferred != "" {
+			if _, err := parseDailyWindow(share.Deferred); err != nil {
+				report(at("deferred"), "%v", err)
+			}
+			switch {
+			case share.Group != "":
+				report(at("deferred"), "an overflow group member cannot be deferred")
+			case share.isPreviewShare():
+				report(at("deferred"), "a preview share cannot be deferred")
+			case share.isSelectsShare():
+				report(at("deferred"), "a selects share cannot be deferred")
+			case share.AskPass:
+				report(at("deferred"), "needs a stored password; ask_pass can't prompt inside the window")
+			}
+		}
+		if e := share.Encrypt; e != nil {
+			if _, err := e.recipients(); err != nil {
+				report(at("encrypt"), "%v", err)
+			}
+			switch {
+			case share.Group != "":
+				report(at("encrypt"), "an overflow group member cannot be encrypted")
+			case share.isPreviewShare():
+				report(at("encrypt"), "a preview share cannot be encrypted")
+			case share.isDeferred():
+				report(at("encrypt"), "a deferred share cannot be encrypted")
+			case share.GoogleDrive != nil && share.GoogleDrive.PhotosAlbum:
+				report(at("encrypt"), "photos_album can't be used on an encrypted share; Google Photos can't show encrypted files")
+			}
+		}
+		if share.Archive != "" {
+			if _, err := normalizeArchiveFormat(share.Archive); err != nil {
+				report(at("archive"), "%v", err)
+			}
+			switch {
+			case share.Group != "":
+				report(at("archive"), "an overflow group member cannot store archives")
+			case share.isPreviewShare():
+				report(at("archive"), "a preview share cannot store archives")
+			case share.isDeferred():
+				report(at("archive"), "a deferred share cannot store archives")
+			case share.isEncrypted():
+				report(at("archive"), "an encrypted share cannot store archives")
+			}
+		}
+		if s := share.Snapshot; s != nil {
+			if err := s.validate(); err != nil {
+				report(at("snapshot"), "%v", err)
+			}
+		}
+		if s := share.Synology; s != nil {
+			if err := s.validate(); err != nil {
+				report(at("synology"), "%v", err)
+			} else if s.Index && (share.isEncrypted() || share.Archive != "") {
+				report(append(at("synology"), "index"), "has nothing to index on an encrypted or archive share")
+			} else if s.Quota && share.Group == "" {
+				report(append(at("synology"), "quota"), "has no effect without group")
+			}
+		}
+		if share.BWLimit != "" {
+			if _, err := parseByteRate(share.BWLimit); err != nil {
+				report(at("bwlimit"), "%v", err)
+			}
+		}
+		for j, entry := range share.BWLimitSchedule {
+			if _, err := parseDailyWindow(entry.Hours); err != nil {
+				report(append(at("bwlimit_schedule"), strconv.Itoa(j), "hours"), "%v", err)
+			}
+			if _, err := parseByteRate(entry.Limit); err != nil {
+				report(append(at("bwlimit_schedule"), strconv.Itoa(j), "limit"), "%v", err)
+			}
+		}
+		switch {
+		case !share.enabled(), share.isPreviewShare(), share.isSelectsShare(), share.isDeferred():
+		case share.Group != "":
+			destinations["group:"+share.Group] = true
+		default:
+			destinations["share:"+key] = true
+		}
+	}
+
+	if _, err := normalizeHashAlgorithm(cfg.HashAlgorithm); err != nil {
+		report([]string{"hash_algorithm"}, "%v", err)
+	}
+	if _, err := newManifestWriter(cfg.ChecksumManifest); err != nil {
+		report([]string{"checksum_manifest"}, "%v", err)
+	}
+	if _, err := newXMPSidecarWriter(cfg.XMPSidecar); err != nil {
+		report([]string{"xmp_sidecar"}, "%v", err)
+	}
+	if _, err := newShootManifestWriter(cfg.ShootManifest); err != nil {
+		report([]string{"shoot_manifest"}, "%v", err)
+	}
+	if _, err := newShootReadmeWriter(cfg.ShootReadme); err != nil {
+		report([]string{"shoot_readme"}, "%v", err)
+	}
+	if _, err := normalizeTransferOrder(cfg.TransferOrder); err != nil {
+		report([]string{"transfer_order"}, "%v", err)
+	}
+	if _, err := normalizeSlowShare(cfg.SlowShare); err != nil {
+		report([]string{"slow_share"}, "%v", err)
+	}
+	if cfg.FileTimeout < 0 {
+		report([]string{"file_timeout"}, "must not be negative")
+	}
+	if err := validNameReplacement(cfg.FilenameReplacement); err != nil {
+		report([]string{"filename_replacement"}, "%v", err)
+	}
+	if _, err := normalizeUnicodeMode(cfg.UnicodeNormalization); err != nil {
+		report([]string{"unicode_normalization"}, "%v", err)
+	}
+	if cfg.WorkerRamp != nil && *cfg.WorkerRamp < 0 {
+		report([]string{"worker_ramp"}, "must not be negative")
+	}
+	var minSize, maxSize int64
+	if cfg.MinFileSize != "" {
+		n, err := parseByteSize(cfg.MinFileSize)
+		if err != nil {
+			report([]string{"min_file_size"}, "%v", err)
+		}
+		minSize = n
+	}
+	if cfg.MaxFileSize != "" {
+		n, err := parseByteSize(cfg.MaxFileSize)
+		if err != nil {
+			report([]string{"max_file_size"}, "%v", err)
+		}
+		maxSize = n
+	}
+	if maxSize > 0 && minSize > maxSize {
+		report([]string{"min_file_size"}, "is above max_file_size")
+	}
+	for i, rule := range cfg.SkipFolders {
+		if _, err := normalizeFolderRule(rule); err != nil {
+			report([]string{"skip_folders", strconv.Itoa(i)}, "%v", err)
+		}
+	}
+	for i, rule := range cfg.KeepFolders {
+		if _, err := normalizeFolderRule(rule); err != nil {
+			report([]string{"keep_folders", strconv.Itoa(i)}, "%v", err)
+		}
+	}
+	for ext, size := range cfg.TinyRAW {
+		if _, _, err := normalizeTinyRAW(ext, size); err != nil {
+			report([]string{"tiny_raw", ext}, "%v", err)
+		}
+	}
+	if c := cfg.ChunkedUploads; c != nil {
+		if c.MinSize != "" {
+			if _, err := parseByteSize(c.MinSize); err != nil {
+				report([]string{"chunked_uploads", "min_size"}, "%v", err)
+			}
+		}
+		if c.ChunkSize != "" {
+			if n, err := parseByteSize(c.ChunkSize); err != nil {
+				report([]string{"chunked_uploads", "chunk_size"}, "%v", err)
+			} else if n <= 0 {
+				report([]string{"chunked_uploads", "chunk_size"}, "must be positive")
+			}
+		}
+	}
+	for i, share := range cfg.SMBShares {
+		if share.enabled() && share.isDeferred() && len(destinations) == 0 {
+			report([]string{"smb_shares", strconv.Itoa(i), "deferred"}, "needs another enabled share that imports straight away, to copy from later")
+			break
+		}
+	}
+	if cfg.Quorum < 0 {
+		report([]string{"quorum"}, "must not be negative")
+	} else if cfg.Quorum > len(destinations) {
+		report([]string{"quorum"}, "%d can never be met with %d enabled destination(s)", cfg.Quorum, len(destinations))
+	}
+	if cfg.Naming != nil {
+		if _, err := template.New("file").Parse(cfg.Naming.FileTemplate); err != nil {
+			report([]string{"naming", "file_template"}, "%v", err)
+		}
+		if cfg.Naming.SequenceDigits < 0 || cfg.Naming.SequenceDigits > 12 {
+			report([]string{"naming", "sequence_digits"}, "must be between 1 and 12")
+		}
+		if _, err := template.New("folder").Parse(cfg.Naming.FolderTemplate); err != nil {
+			report([]string{"naming", "folder_template"}, "%v", err)
+		}
+		if _, err := normalizeDateFormat(cfg.Naming.DateFormat); err != nil {
+			report([]string{"naming", "date_format"}, "%v", err)
+		}
+		if cfg.Naming.SessionGap < 0 {
+			report([]string{"naming", "session_gap"}, "must not be negative")
+		}
+		for ext, folder := range cfg.Naming.TypeMap {
+			if _, _, err := normalizeTypeMapping(ext, folder); err != nil {
+				report([]string{"naming", "type_map", ext}, "%v", err)
+			}
+		}
+		for serial, name := range cfg.Naming.Photographers {
+			if _, _, err := normalizePhotographer(serial, name); err != nil {
+				report([]string{"naming", "photographers", serial}, "%v", err)
+			}
+		}
+	}
+
+	if v := cfg.VideoProxy; v != nil {
+		found := false
+		for _, share := range cfg.SMBShares {
+			found = found || matchesShareName(share, v.Share)
+		}
+		switch {
+		case strings.TrimSpace(v.Share) == "":
+			report([]string{"video_proxy", "share"}, "must name the share that receives the proxies")
+		case !found:
+			report([]string{"video_proxy", "share"}, "%q matches no configured share", v.Share)
+		}
+		for _, share := range cfg.SMBShares {
+			if matchesShareName(share, v.Share) && share.isEncrypted() {
+				report([]string{"video_proxy", "share"}, "%q is encrypted; proxies are for editing from", v.Share)
+				break
+			}
+			if matchesShareName(share, v.Share) && share.Archive != "" {
+				report([]string{"video_proxy", "share"}, "%q stores archives; proxies are for editing from", v.Share)
+				break
+			}
+			if matchesShareName(share, v.Share) && share.isCloud() {
+				report([]string{"video_proxy", "share"}, "%q is a cloud share; proxies are for editing from", v.Share)
+				break
+			}
+		}
+		if v.Height < 0 {
+			report([]string{"video_proxy", "height"}, "must not be negative")
+		}
+	}
+
+	if cfg.Gallery != nil && cfg.Gallery.ThumbnailSize < 0 {
+		report([]string{"gallery", "thumbnail_size"}, "must not be negative")
+	}
+
+	events := map[string][]string{}
+	if cfg.Ntfy != nil {
+		events["ntfy"] = cfg.Ntfy.Events
+	}
+	if cfg.Pushover != nil {
+		events["pushover"] = cfg.Pushover.Events
+	}
+	if cfg.Telegram != nil {
+		events["telegram"] = cfg.Telegram.Events
+	}
+	if cfg.Email != nil {
+		events["email"] = cfg.Email.Events
+		if cfg.Email.Port < 0 || cfg.Email.Port > 65535 {
+			report([]string{"email", "port"}, "%d is not a valid port", cfg.Email.Port)
+		}
+	}
+	for backend, list := range events {
+		for i, e := range list {
+			switch notifyEvent(strings.ToLower(strings.TrimSpace(e))) {
+			case eventComplete, eventFailure, eventVerifyMismatch, eventShareError:
+			default:
+				report([]string{backend, "events", strconv.Itoa(i)}, "unknown event %q (use complete, failure, verify_mismatch or share_error)", e)
+			}
+		}
+	}
+	if f := cfg.FTPReceiver; f != nil {
+		if (f.TLSCert == "") != (f.TLSKey == "") {
+			report([]string{"ftp_receiver"}, "tls_cert and tls_key must be set together")
+		}
+		if p := f.Password; !envReference.MatchString(strings.TrimSpace(p)) && len(p) < minFTPPassword {
+			report([]string{"ftp_receiver", "password"}, "must be at least %d characters", minFTPPassword)
+		}
+	}
+	if h := cfg.HTTPReceiver; h != nil {
+		if (h.TLSCert == "") != (h.TLSKey == "") {
+			report([]string{"http_receiver"}, "tls_cert and tls_key must be set together")
+		}
+		if t := strings.TrimSpace(h.Token); t != "" && !envReference.MatchString(t) && len(t) < minUploadToken {
+			report([]string{"http_receiver", "token"}, "must be at least %d characters", minUploadToken)
+		}
+		if h.MaxUploadMB < 0 {
+			report([]string{"http_receiver", "max_upload_mb"}, "must not be negative")
+		}
+	}
+	if g := cfg.GRPC; g != nil {
+		if (g.TLSCert == "") != (g.TLSKey == "") {
+			report([]string{"grpc"}, "tls_cert and tls_key must be set together")
+		}
+		if t := strings.TrimSpace(g.Token); t != "" && !envReference.MatchString(t) && len(t) < minUploadToken {
+			report([]string{"grpc", "token"}, "must be at least %d characters", minUploadToken)
+		}
+	}
+	if a := cfg.API; a != nil {
+		if t := strings.TrimSpace(a.Token); t != "" && !envReference.MatchString(t) && len(t) < minUploadToken {
+			report([]string{"api", "token"}, "must be at least %d characters", minUploadToken)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// volumeSpace returns the size and free bytes of the filesystem holding path.
+func volumeSpace(path string) (total, free uint64, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Blocks * uint64(st.Bsize), st.Bavail * uint64(st.Bsize), nil
+}
+
+// removableDrives lists removable drives that have no mount directory to
+// scan; on Unix every volume has one, so there are none.
+func removableDrives() []MountCandidate {
+	return nil
+}
+
+// osVolumeLabel reads the filesystem label from /dev/disk/by-label on Linux.
+func osVolumeLabel(mount string) string {
+	device := mountDevice(mount)
+	if device == "" {
+		return ""
+	}
+	entries, err := os.ReadDir("/dev/disk/by-label")
+	if err != nil {
+		return ""
+	}
+	for _, e := range entries {
+		target, err := filepath.EvalSymlinks(filepath.Join("/dev/disk/by-label", e.Name()))
+		if err == nil && target == device {
+			return decodeProcMountField(strings.ReplaceAll(e.Name(), `\x20`, " "))
+		}
+	}
+	return ""
+}
+
+// windowsVolumeSerial is only meaningful on Windows.
+func windowsVolumeSerial(string) (string, error) {
+	return "", errors.New("volume serial numbers are read on Windows only")
+}
@@ -0,0 +1,82 @@
+//go:build windows
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"golang.org/x/sys/windows"
+)
+
+// volumeSpace returns the size and free bytes of the filesystem holding path.
+func volumeSpace(path string) (total, free uint64, err error) {
+	p, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, nil); err != nil {
+		return 0, 0, err
+	}
+	return total, free, nil
+}
+
+// removableDrives lists the drive letters Windows reports as removable, which
+// is how card readers and cameras in mass-storage mode show up.
+func removableDrives() []MountCandidate {
+	mask, err := windows.GetLogicalDrives()
+	if err != nil {
+		return nil
+	}
+	var drives []MountCandidate
+	for i := 0; i < 26; i++ {
+		if mask&(1<<i) == 0 {
+			continue
+		}
+		root := string(rune('A'+i)) + `:\`
+		p, _ := windows.UTF16PtrFromString(root)
+		if windows.GetDriveType(p) != windows.DRIVE_REMOVABLE {
+			continue
+		}
+		_, _, fsType, err := volumeInformation(root)
+		if err != nil {
+			continue // empty card reader slot
+		}
+		drives = append(drives, MountCandidate{Source: root, Path: root, FSType: fsType})
+	}
+	return drives
+}
+
+func osVolumeLabel(mount string) string {
+	label, _, _, err := volumeInformation(volumeRoot(mount))
+	if err != nil {
+		return ""
+	}
+	return label
+}
+
+// windowsVolumeSerial identifies a card by the serial number written when it
+// was formatted.
+func windowsVolumeSerial(mount string) (string, error) {
+	_, serial, _, err := volumeInformation(volumeRoot(mount))
+	if err != nil {
+		return "", fmt.Errorf("reading volume serial: %w", err)
+	}
+	return fmt.Sprintf("serial:%08X", serial), nil
+}
+
+func volumeRoot(mount string) string {
+	return filepath.VolumeName(mount) + `\`
+}
+
+func volumeInformation(root string) (label string, serial uint32, fsType string, err error) {
+	p, err := windows.UTF16PtrFromString(root)
+	if err != nil {
+		return "", 0, "", err
+	}
+	var labelBuf, fsBuf [windows.MAX_PATH + 1]uint16
+	if err := windows.GetVolumeInformation(p, &labelBuf[0], uint32(len(labelBuf)), &serial, nil, nil, &fsBuf[0], uint32(len(fsBuf))); err != nil {
+		return "", 0, "", err
+	}
+	return windows.UTF16ToString(labelBuf[:]), serial, windows.UTF16ToString(fsBuf[:]), nil
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// watchPollInterval is how often -watch looks for new files.
+const watchPollInterval = time.Second
+
+// watchedFile is what -watch last saw of a file.
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+	since   time.Time // when size and modTime last changed
+	done    bool      // archived, or failed, at this size and modTime
+}
+
+// runWatchFolder archives every photo or video that appears under dir,
+// such as a tethering app's capture folder, until ctx is cancelled. A file is
+// only sent once its size and modification time have held still for settle,
+// so files the app is still writing are left alone. Files already there
+// when the watch starts are not sent.
+func runWatchFolder(ctx context.Context, dir string, settle time.Duration, cfg *Config, folderName string, connections []*SMBConnection) (*transferReport, error) {
+	live, err := newLiveArchiver(ctx, cfg, folderName, "watch: "+dir, connections)
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]*watchedFile{}
+	// scan updates seen from dir. Files that are gone are forgotten, so a
+	// new one with the same name is sent.
+	scan := func(now time.Time) error {
+		present := map[string]bool{}
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if p == dir {
+					return err
+				}
+				// Folders can vanish while a session is reorganised.
+				return nil
+			}
+			if isSystemMetadata(d.Name()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || !photoExtensions[strings.ToLower(filepath.Ext(p))] {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			present[p] = true
+			f := seen[p]
+			switch {
+			case f == nil:
+				seen[p] = &watchedFile{size: info.Size(), modTime: info.ModTime(), since: now}
+			case f.size != info.Size() || !f.modTime.Equal(info.ModTime()):
+				// Still being written, or rewritten after it was sent.
+				*f = watchedFile{size: info.Size(), modTime: info.ModTime(), since: now}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for p := range seen {
+			if !present[p] {
+				delete(seen, p)
+			}
+		}
+		return nil
+	}
+
+	// What is already there belongs to an earlier import.
+	if err := scan(time.Now()); err != nil {
+		return nil, fmt.Errorf("reading watch folder: %w", err)
+	}
+	for _, f := range seen {
+		f.done = true
+	}
+
+	slog.Info("Watching folder", "path", dir, "folder", folderName, "settle", settle)
+	fmt.Printf("\n  👀 Watching %s for new files into %q\n  Press Ctrl+C to stop.\n\n", dir, folderName)
+
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return live.finish(), nil
+		case now := <-ticker.C:
+			if err := scan(now); err != nil {
+				slog.Warn("Cannot read watch folder", "path", dir, "error", err)
+				continue
+			}
+			var ready []string
+			for p, f := range seen {
+				if !f.done && f.size > 0 && now.Sub(f.since) >= settle {
+					ready = append(ready, p)
+				}
+			}
+			// In the order they were shot, as near as the files tell.
+			sort.Slice(ready, func(i, j int) bool { return seen[ready[i]].modTime.Before(seen[ready[j]].modTime) })
+			for _, p := range ready {
+				if ctx.Err() != nil {
+					break
+				}
+				// Some apps keep a file locked until they are done with it.
+				file, err := os.Open(p)
+				if err != nil {
+					continue
+				}
+				file.Close()
+				seen[p].done = true
+				// Failures are logged and reported by fanOut; the file is
+				// sent again only if it changes.
+				live.fanOut(ctx, p)
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+"use strict";
+
+// Dashboard for the ingest desk: detected cards with a one-step start, running
+// imports, recent history and per-share health. Polls the REST API.
+
+const $ = (sel) => document.querySelector(sel);
+
+const dash = {
+  mounts: [],
+  imports: [],
+  health: null,
+  drafts: {}, // mount path -> shoot name being typed, survives re-render
+};
+
+async function api(path, opts) {
+  const res = await fetch(path, opts);
+  let body = null;
+  try { body = await res.json(); } catch (_) {}
+  if (!res.ok) throw new Error((body && body.error) || `request failed (${res.status})`);
+  return body;
+}
+
+function esc(s) { return String(s == null ? "" : s).replace(/[&<>"']/g, (c) => ({ "&": "&amp;", "<": "&lt;", ">": "&gt;", '"': "&quot;", "'": "&#39;" }[c])); }
+function jsonH() { return { "Content-Type": "application/json" }; }
+
+function toast(msg, kind = "err") {
+  const t = $("#toast");
+  t.textContent = msg;
+  t.className = `toast ${kind}`;
+  t.hidden = false;
+  clearTimeout(toast._t);
+  toast._t = setTimeout(() => { t.hidden = true; }, 4200);
+}
+
+function fmtDuration(ms) {
+  const s = Math.round(ms / 1000);
+  if (s < 60) return `${s}s`;
+  const m = Math.floor(s / 60);
+  return m < 60 ? `${m}m ${s % 60}s` : `${Math.floor(m / 60)}h ${m % 60}m`;
+}
+
+// ---------- Cards ----------
+function renderCards() {
+  const wrap = $("#card-list");
+  // Keep the user's half-typed names across polls.
+  wrap.querySelectorAll("input[data-mount]").forEach((el) => { dash.drafts[el.dataset.mount] = el.value; });
+
+  if (dash.mounts.length === 0) {
+    wrap.innerHTML = `<div class="empty-note">No cards detected. Insert a card and it will appear here.</div>`;
+    return;
+  }
+  const busy = new Set(dash.imports.filter((i) => i.state === "running").map((i) => i.mount));
+  wrap.innerHTML = "";
+  dash.mounts.forEach((m) => {
+    const row = document.createElement("form");
+    row.className = "dash-card";
+    const meta = m.fsType ? `${m.fsType}${m.source ? " · " + m.source : ""}` : "volume";
+    row.innerHTML = `
+      <div class="card-body">
+        <span class="card-title mono">${esc(m.path)}</span>
+        <span class="card-sub">${esc(meta)}</span>
+      </div>
+      <input data-mount="${esc(m.path)}" placeholder="Shoot name" autocomplete="off" ${busy.has(m.path) ? "disabled" : ""} />
+      <button type="submit" class="btn-primary" ${busy.has(m.path) ? "disabled" : ""}>${busy.has(m.path) ? "Importing…" : "Start"}</button>`;
+    row.elements[0].value = dash.drafts[m.path] || "";
+    row.addEventListener("submit", (e) => { e.preventDefault(); startImport(m.path, row.elements[0].value.trim()); });
+    wrap.appendChild(row);
+  });
+}
+
+async function startImport(mount, name) {
+  if (!name) return toast("Name the shoot first");
+  try {
+    await api("/api/imports", { method: "POST", headers: jsonH(), body: JSON.stringify({ mount, name }) });
+    delete dash.drafts[mount];
+    toast(`Started ${name}`, "ok");
+    await refreshImports();
+  } catch (e) { toast(e.message); }
+}
+
+// ---------- Imports ----------
+function renderImports() {
+  const running = dash.imports.filter((i) => i.state === "running");
+  const done = dash.imports.filter((i) => i.state !== "running");
+
+  const r = $("#running-list");
+  r.innerHTML = running.length ? "" : `<div class="empty-note">Nothing importing right now.</div>`;
+  running.forEach((i) => {
+    const pct = i.total > 0 ? Math.round((i.completed / i.total) * 100) : 0;
+    const el = document.createElement("div");
+    el.className = "dash-job";
+    el.innerHTML = `
+      <div class="dash-job-head">
+        <span class="card-title">${esc(i.folderName)}</span>
+        <button class="btn-text" data-cancel>Cancel</button>
+      </div>
+      <div class="progress-track"><div class="progress-fill" style="width:${pct}%"></div></div>
+      <div class="progress-meta"><span>${i.completed} / ${i.total}</span><span class="mono">${pct}%</span></div>
+      <p class="current-file mono">${esc(i.currentFile || i.mount)}</p>`;
+    el.querySelector("[data-cancel]").addEventListener("click", () => cancelImport(i));
+    r.appendChild(el);
+  });
+
+  const h = $("#history-list");
+  h.innerHTML = done.length ? "" : `<div class="empty-note">No imports yet this session.</div>`;
+  done.forEach((i) => {
+    const el = document.createElement("div");
+    el.className = `dash-job ${i.state}`;
+    const errs = (i.errors || []).length;
+    let detail = `${i.completed} of ${i.total} files · ${fmtDuration(i.durationMs)}`;
+    if (errs) detail += ` · ${errs} error${errs === 1 ? "" : "s"}`;
+    el.innerHTML = `
+      <div class="dash-job-head">
+        <span class="card-title">${esc(i.folderName)}</span>
+        <span class="state-tag ${i.state}">${i.state}</span>
+      </div>
+      <span class="card-sub">${esc(detail)}</span>
+      ${i.fatalError ? `<span class="card-sub err-text">${esc(i.fatalError)}</span>` : ""}`;
+    h.appendChild(el);
+  });
+}
+
+async function cancelImport(i) {
+  if (!confirm(`Cancel import of ${i.folderName}?`)) return;
+  try { await api(`/api/imports/${encodeURIComponent(i.id)}`, { method: "DELETE" }); } catch (e) { toast(e.message); }
+  refreshImports();
+}
+
+// ---------- Health ----------
+function renderHealth() {
+  const wrap = $("#health-list");
+  if (dash.health === null) { wrap.innerHTML = `<div class="empty-note">Checking shares…</div>`; return; }
+  if (dash.health.length === 0) { wrap.innerHTML = `<div class="empty-note">No shares configured. Add one in the guided import.</div>`; return; }
+  wrap.innerHTML = dash.health.map((s) => `
+    <div class="dash-health ${s.ok ? "ok" : "err"}">
+      <span class="health-dot"></span>
+      <span class="card-body">
+        <span class="card-title mono">${esc(s.display)}</span>
+        <span class="card-sub">${s.ok ? `reachable · ${s.latencyMs} ms` : esc(s.error)}</span>
+      </span>
+    </div>`).join("");
+}
+
+// ---------- Polling ----------
+async function refreshMounts() {
+  try { dash.mounts = await api("/api/mounts"); } catch (_) { dash.mounts = []; }
+  renderCards();
+}
+
+async function refreshImports() {
+  try { dash.imports = await api("/api/imports"); } catch (_) { return; }
+  renderImports();
+  renderCards();
+}
+
+async function refreshHealth() {
+  dash.health = null;
+  renderHealth();
+  try { dash.health = await api("/api/shares/health"); } catch (e) { dash.health = []; toast(e.message); }
+  renderHealth();
+}
+
+document.addEventListener("DOMContentLoaded", () => {
+  $("#health-refresh").addEventListener("click", refreshHealth);
+  refreshMounts();
+  refreshImports();
+  refreshHealth();
+  setInterval(refreshImports, 2000);
+  setInterval(refreshMounts, 5000);
+  setInterval(refreshHealth, 60000);
+});
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+// prompter asks questions on stdout and reads answers from one buffered
+// stdin reader, so typed-ahead answers are not lost between questions.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (p *prompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, _ := p.in.ReadString('\n')
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer
+	}
+	return def
+}
+
+func (p *prompter) yes(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer := strings.ToLower(p.ask(question+" ("+hint+")", ""))
+	if answer == "" {
+		return def
+	}
+	return answer == "y" || answer == "yes"
+}
+
+// secret reads a password without echo when stdin is a terminal.
+func (p *prompter) secret(question string) string {
+	fmt.Fprintf(p.out, "%s: ", question)
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(p.out)
+		if err == nil {
+			return string(b)
+		}
+	}
+	line, _ := p.in.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+// runInitCommand is `snapvault init`: a guided setup that asks for the shares,
+// tests each connection and writes a config that passes `config validate`.
+func runInitCommand(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	configPath := fs.String("config", "config.yaml", "Where to write the config (YAML, TOML or JSON by extension)")
+	timeout := fs.Duration("timeout", 15*time.Second, "SMB connection timeout for the connection tests")
+	fs.Parse(args)
+
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	fmt.Println("SnapVault setup. Press Enter to accept the [default].")
+	fmt.Println()
+
+	if _, err := os.Stat(*configPath); err == nil {
+		if !p.yes(fmt.Sprintf("%s already exists. Replace it?", *configPath), false) {
+			fmt.Println("Nothing changed.")
+			return 1
+		}
+	}
+
+	cfg := &Config{}
+	for {
+		share, ok := askShare(p, len(cfg.SMBShares)+1, *timeout)
+		if ok {
+			cfg.SMBShares = append(cfg.SMBShares, share)
+		}
+		if !p.yes("Add another share (e.g. a backup NAS)?", false) {
+			break
+		}
+		fmt.Println()
+	}
+	if len(cfg.SMBShares) == 0 {
+		fmt.Println("No shares configured; nothing written.")
+		return 1
+	}
+
+	if topic := p.ask("ntfy topic for phone notifications (optional)", ""); topic != "" {
+		cfg.Ntfy = &NtfyConfig{Server: p.ask("ntfy server", "https://ntfy.sh"), Topic: topic}
+	}
+	if p.yes("Write a SHA256SUMS manifest into each date folder?", true) {
+		cfg.ChecksumManifest = manifestFolder
+	}
+
+	if err := saveConfig(*configPath, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "Writing %s: %v\n", *configPath, err)
+		return 1
+	}
+	fmt.Printf("\nWrote %s with %d share(s).\n", *configPath, len(cfg.SMBShares))
+	fmt.Printf("Next: ./snapvault -config %s   (or -serve for the web UI)\n", *configPath)
+	return 0
+}
+
+// askShare collects one share, tests it and decides where its password
+// lives. It reports false when the user drops the share.
+func askShare(p *prompter, n int, timeout time.Duration) (SMBConfig, bool) {
+	fmt.Printf("Share %d\n", n)
+	var share SMBConfig
+	for {
+		share.Name = p.ask("  Name for logs and reports", defaultString(share.Name, fmt.Sprintf("nas-%d", n)))
+		share.Host = p.ask("  NAS host or IP", share.Host)
+		port, err := strconv.Atoi(p.ask("  Port", strconv.Itoa(defaultInt(share.Port, 445))))
+		if err != nil || port < 1 || port > 65535 {
+			fmt.Println("  Port must be a number between 1 and 65535.")
+			continue
+		}
+		share.Port = port
+		share.Share = p.ask("  Share name", share.Share)
+		share.BasePath = p.ask("  Folder inside the share (optional)", share.BasePath)
+		share.Username = p.ask("  Username", share.Username)
+		share.Password = p.secret("  Password")
+		if share.Host == "" || share.Share == "" {
+			fmt.Println("  Host and share name are required.")
+			continue
+		}
+
+		fmt.Printf("  Testing %s ... ", formatShareForDisplay(share))
+		err = validateSMBConnection(share, timeout)
+		if err == nil {
+			fmt.Println("ok")
+			break
+		}
+		fmt.Printf("failed: %v\n", err)
+		if p.yes("  Edit and try again?", true) {
+			continue
+		}
+		if !p.yes("  Keep this share anyway?", false) {
+			return SMBConfig{}, false
+		}
+		break
+	}
+	if share.Port == 445 {
+		share.Port = 0
+	}
+
+	switch strings.ToLower(p.ask("  Store the password in the system keyring, the config file, or ask every time? (keyring/file/ask)", "keyring")) {
+	case "ask", "a":
+		share.AskPass, share.Password = true, ""
+	case "file", "f":
+	default:
+		if err := keyring.Set(keyringService, keyringAccount(share), share.Password); err != nil {
+			fmt.Printf("  Keyring unavailable (%v); storing the password in the config file instead.\n", err)
+			break
+		}
+		share.Keyring, share.Password = true, ""
+	}
+	return share, true
+}
+
+func defaultString(v, def string) string {
+	if v != "" {
+		return v
+	}
+	return def
+}
+
+func defaultInt(v, def int) int {
+	if v != 0 {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultWorkerRamp is how long a run takes to bring all its workers up.
+// Some consumer NAS boxes drop the session when a run opens with a burst of
+// parallel creates; starting workers one by one lets them keep up.
+const defaultWorkerRamp = 30 * time.Second
+
+// workerRamp is the config's worker_ramp, defaultWorkerRamp when unset. A
+// nil config gets the default too.
+func (c *Config) workerRamp() time.Duration {
+	if c == nil || c.WorkerRamp == nil {
+		return defaultWorkerRamp
+	}
+	return *c.WorkerRamp
+}
+
+// rampDelay is when worker i of n starts: the first at once, the rest
+// spread evenly over ramp.
+func rampDelay(i, n int, ramp time.Duration) time.Duration {
+	if ramp <= 0 || n <= 1 {
+		return 0
+	}
+	return ramp * time.Duration(i) / time.Duration(n)
+}
+
+// waitForRamp holds worker i back until its turn. It reports false when
+// ctx is done or queued is closed first: every job has then been taken.
+func waitForRamp(ctx context.Context, queued <-chan struct{}, i, n int, ramp time.Duration) bool {
+	d := rampDelay(i, n, ramp)
+	if d == 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-queued:
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// warmUpShares makes one cheap request on every SMB share before the first
+// copy, so a session that idled through the file list prompt is revived
+// (or found dead) before the workers pile onto it. Failures are only
+// logged; the copies report them properly.
+func warmUpShares(ctx context.Context, connections []*SMBConnection) {
+	var wg sync.WaitGroup
+	for _, conn := range connections {
+		if conn.Share == nil {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := conn.Share.WithContext(ctx).Stat(shootRoot(conn, "")); err != nil {
+				slog.Debug("Share warm-up failed", "share", shareLabel(conn.Config), "error", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"log/slog"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// XMP sidecar modes for Config.XMPSidecar, named after the application whose
+// naming convention they follow.
+const (
+	xmpLightroom = "lightroom" // IMG_0001.xmp, for RAW and video files only
+	xmpDigiKam   = "digikam"   // IMG_0001.CR3.xmp, for every file
+)
+
+// embeddedXMPExtensions are formats Lightroom reads XMP from inside the file;
+// it ignores sidecars for them.
+var embeddedXMPExtensions = map[string]bool{
+	".jpg": true, ".jpeg": true, ".heic": true, ".heif": true, ".png": true, ".tif": true, ".tiff": true, ".dng": true,
+}
+
+// xmpSidecarWriter writes an XMP sidecar with the import's provenance next to
+// every copy, so the cataloguing application picks it up on import.
+type xmpSidecarWriter struct {
+	mode string
+
+	mu    sync.Mutex
+	cards map[string]string // source root -> card fingerprint, "" when unknown
+}
+
+// newXMPSidecarWriter returns nil when sidecars are disabled.
+func newXMPSidecarWriter(mode string) (*xmpSidecarWriter, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case xmpLightroom, xmpDigiKam:
+		return &xmpSidecarWriter{mode: mode, cards: map[string]string{}}, nil
+	default:
+		return nil, fmt.Errorf("xmp_sidecar must be %q or %q, got %q", xmpLightroom, xmpDigiKam, mode)
+	}
+}
+
+// sidecarPath returns where the sidecar for destPath goes, or false when
+// this mode writes none for it.
+func (x *xmpSidecarWriter) sidecarPath(destPath string) (string, bool) {
+	ext := path.Ext(destPath)
+	if isCompanion(destPath) {
+		// Memos and track logs aren't catalogued; in lightroom mode a memo's
+		// sidecar would also replace its photo's.
+		return "", false
+	}
+	if x.mode == xmpDigiKam {
+		return destPath + ".xmp", true
+	}
+	if embeddedXMPExtensions[strings.ToLower(ext)] {
+		return "", false
+	}
+	return strings.TrimSuffix(destPath, ext) + ".xmp", true
+}
+
+// add writes the sidecar for a finished copy. Like checksum sidecars, a
+// failure is logged and doesn't fail the file.
+func (x *xmpSidecarWriter) add(ctx context.Context, conn *SMBConnection, job TransferJob, res copyResult, journal *runJournal) {
+	sidecar, ok := x.sidecarPath(res.DestPath)
+	if !ok {
+		return
+	}
+	data := provenanceXMP(job, x.cardID(ctx, job.SourceRoot), res, time.Now())
+	if err := conn.Share.WithContext(ctx).WriteFile(sidecar, data, 0o644); err != nil {
+		slog.Warn("Failed to write XMP sidecar", "file", res.DestPath, "share", shareLabel(conn.Config), "error", err)
+		return
+	}
+	if journal != nil {
+		h := newHasher(conn.hashAlg)
+		h.Write(data)
+		journal.record(conn, job.SourcePath, int64(len(data)), copyResult{DestPath: sidecar, Sum: h.Sum(nil), Algorithm: conn.hashAlg})
+	}
+}
+
+// cardID fingerprints each card once per run.
+func (x *xmpSidecarWriter) cardID(ctx context.Context, root string) string {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	id, ok := x.cards[root]
+	if !ok {
+		id, _ = cardFingerprint(ctx, root)
+		x.cards[root] = id
+	}
+	return id
+}
+
+// provenanceXMP is an XMP packet recording where a copy came from. The fields
+// live in SnapVault's own namespace, which Lightroom and digiKam keep with the
+// photo; the original file name also goes into the standard
+// xmpMM:PreservedFileName.
+func provenanceXMP(job TransferJob, cardID string, res copyResult, importedAt time.Time) []byte {
+	source := filepath.Base(job.SourcePath)
+	if rel, err := filepath.Rel(job.SourceRoot, job.SourcePath); err == nil && job.SourceRoot != "" {
+		source = filepath.ToSlash(rel)
+	}
+	attrs := [][2]string{
+		{"xmpMM:PreservedFileName", filepath.Base(job.SourcePath)},
+		{"snapvault:Shoot", job.FolderName},
+		{"snapvault:CardID", cardID},
+		{"snapvault:SourcePath", source},
+		{"snapvault:ImportedAt", importedAt.UTC().Format(time.RFC3339)},
+		{"snapvault:Checksum", hex.EncodeToString(res.Sum)},
+		{"snapvault:ChecksumAlgorithm", res.Algorithm},
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>` + "\n" +
+		`<x:xmpmeta xmlns:x="adobe:ns:meta/" x:xmptk="SnapVault">` + "\n" +
+		` <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">` + "\n" +
+		`  <rdf:Description rdf:about=""` + "\n" +
+		`    xmlns:xmpMM="http://ns.adobe.com/xap/1.0/mm/"` + "\n" +
+		`    xmlns:snapvault="https://github.com/KiranTheRam/SnapVault/ns/1.0/"`)
+	for _, a := range attrs {
+		if a[1] == "" {
+			continue
+		}
+		b.WriteString("\n    " + a[0] + `="`)
+		xml.EscapeText(&b, []byte(a[1]))
+		b.WriteString(`"`)
+	}
+	b.WriteString("/>\n </rdf:RDF>\n</x:xmpmeta>\n" + `<?xpacket end="w"?>` + "\n")
+	return b.Bytes()
+}